@@ -12,9 +12,14 @@ import (
 
 	"ctf/backend/internal/app"
 	"ctf/backend/internal/config"
+	"ctf/backend/internal/runtime"
 )
 
 func main() {
+	// Challenge processes of the process driver start as a re-execution of
+	// this binary.
+	runtime.RunProcessExecHelperIfRequested()
+
 	cfg := config.Load()
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("invalid config: %v", err)
@@ -48,6 +48,24 @@ func main() {
 		log.Fatalf("check existing admin by username: %v", err)
 	}
 
+	policy, err := auth.NewPasswordPolicy(auth.PasswordPolicyConfig{
+		MinLength:            cfg.PasswordMinLength,
+		MinCharClasses:       cfg.PasswordMinCharClasses,
+		RejectUserSimilarity: cfg.PasswordRejectUserSimilarity,
+		UseBundledBlocklist:  cfg.PasswordBundledBlocklist,
+		BlocklistPath:        cfg.PasswordBlocklistPath,
+	})
+	if err != nil {
+		log.Fatalf("load password policy: %v", err)
+	}
+	if err := policy.Validate(password, username, email); err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			log.Fatalf("admin bootstrap refused: %s (%s)", policyErr.Message, policyErr.Code)
+		}
+		log.Fatalf("validate password: %v", err)
+	}
+
 	hash, err := auth.HashPassword(password)
 	if err != nil {
 		log.Fatalf("hash password: %v", err)
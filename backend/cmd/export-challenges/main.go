@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/challengeimport"
+	"ctf/backend/internal/config"
+	"ctf/backend/internal/store"
+)
+
+func main() {
+	cfg := config.Load()
+
+	var (
+		slugs         = flag.String("slug", strings.TrimSpace(os.Getenv("EXPORT_CHALLENGE_SLUGS")), "comma separated slugs of the challenges to export")
+		all           = flag.Bool("all", false, "export every challenge that is not archived")
+		format        = flag.String("format", envOrDefault("EXPORT_FORMAT", challengeimport.BundleFormatZip), "bundle format: zip or tar.gz")
+		out           = flag.String("out", strings.TrimSpace(os.Getenv("EXPORT_OUT")), "bundle path; defaults to <slug>.<format>, or challenges.<format> for several challenges")
+		attachmentDir = flag.String("attachment-dir", envOrDefault("ATTACHMENT_STORAGE_DIR", cfg.AttachmentStorageDir), "attachment storage directory")
+	)
+	flag.Parse()
+
+	bundleFormat, err := challengeimport.NormalizeBundleFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wanted := make([]string, 0)
+	for _, slug := range strings.Split(*slugs, ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			wanted = append(wanted, slug)
+		}
+	}
+	if len(wanted) == 0 && !*all {
+		log.Fatal("pass -slug or -all")
+	}
+
+	db, err := store.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+
+	service := admin.NewService(store.NewAdminRepository(db), strings.TrimSpace(*attachmentDir))
+	actor := admin.Actor{Role: "admin"}
+	ctx := context.Background()
+
+	summaries, err := service.Challenges(ctx, actor)
+	if err != nil {
+		log.Fatalf("list challenges: %v", err)
+	}
+	ids := make([]int64, 0)
+	if *all {
+		for _, summary := range summaries {
+			if summary.ArchivedAt == nil {
+				ids = append(ids, summary.ID)
+			}
+		}
+	} else {
+		bySlug := make(map[string]int64, len(summaries))
+		for _, summary := range summaries {
+			bySlug[summary.Slug] = summary.ID
+		}
+		for _, slug := range wanted {
+			id, ok := bySlug[slug]
+			if !ok {
+				log.Fatalf("challenge %s not found", slug)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		log.Fatal("no challenges to export")
+	}
+
+	challenges := make([]challengeimport.ExportedChallenge, 0, len(ids))
+	for _, id := range ids {
+		exported, err := challengeimport.ExportChallenge(ctx, service, actor, id)
+		if err != nil {
+			log.Fatalf("export challenge %d: %v", id, err)
+		}
+		challenges = append(challenges, exported)
+	}
+
+	outPath := strings.TrimSpace(*out)
+	if outPath == "" {
+		name := "challenges"
+		if len(challenges) == 1 {
+			name = challenges[0].Spec.Meta.Slug
+		}
+		outPath = name + "." + bundleFormat
+	}
+	file, err := os.Create(outPath)
+	if err != nil {
+		log.Fatalf("create bundle: %v", err)
+	}
+	if err := challengeimport.WriteBundle(file, bundleFormat, challenges); err != nil {
+		file.Close()
+		_ = os.Remove(outPath)
+		log.Fatalf("write bundle: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("write bundle: %v", err)
+	}
+
+	for _, challenge := range challenges {
+		fmt.Printf("exported %s (attachments=%d runtime=%t)\n", challenge.Spec.Meta.Slug, len(challenge.Spec.Attachments), challenge.Spec.Runtime != nil)
+	}
+	fmt.Printf("wrote %s\n", outPath)
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
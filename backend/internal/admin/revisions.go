@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChallengeRevisions lists the saved revisions of a challenge, newest first.
+func (s *Service) ChallengeRevisions(ctx context.Context, actor Actor, challengeID int64) ([]ChallengeRevision, error) {
+	if _, err := s.repo.GetChallenge(ctx, actor, challengeID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListChallengeRevisions(ctx, challengeID)
+}
+
+// DiffChallengeRevisions compares two revisions of a challenge. Warnings tell
+// whether moving from one to the other would change the flag of a challenge
+// that has been solved.
+func (s *Service) DiffChallengeRevisions(ctx context.Context, actor Actor, challengeID int64, fromVersion, toVersion int) (ChallengeRevisionDiff, error) {
+	if _, err := s.repo.GetChallenge(ctx, actor, challengeID); err != nil {
+		return ChallengeRevisionDiff{}, err
+	}
+	from, err := s.repo.GetChallengeRevision(ctx, challengeID, fromVersion)
+	if err != nil {
+		return ChallengeRevisionDiff{}, err
+	}
+	to, err := s.repo.GetChallengeRevision(ctx, challengeID, toVersion)
+	if err != nil {
+		return ChallengeRevisionDiff{}, err
+	}
+	warnings, _, err := s.flagChangeWarnings(ctx, challengeID, *from.Snapshot, *to.Snapshot)
+	if err != nil {
+		return ChallengeRevisionDiff{}, err
+	}
+	return ChallengeRevisionDiff{
+		From:     from.Version,
+		To:       to.Version,
+		Changes:  diffChallengeSnapshots(*from.Snapshot, *to.Snapshot),
+		Warnings: warnings,
+	}, nil
+}
+
+// RollbackChallenge restores the fields saved in a revision. The rollback is
+// itself stored as a new revision, so it can be undone the same way.
+func (s *Service) RollbackChallenge(ctx context.Context, actor Actor, challengeID int64, version int) (ChallengeChange, error) {
+	if _, err := s.repo.GetChallenge(ctx, actor, challengeID); err != nil {
+		return ChallengeChange{}, err
+	}
+	revision, err := s.repo.GetChallengeRevision(ctx, challengeID, version)
+	if err != nil {
+		return ChallengeChange{}, err
+	}
+	input := *revision.Snapshot
+	if input.RuntimeConfig != nil {
+		// Saving normalizes the runtime config in place; keep the revision intact.
+		cfg := *input.RuntimeConfig
+		input.RuntimeConfig = &cfg
+	}
+	return s.updateChallenge(ctx, actor, challengeID, input, RevisionActionRollback, revision.Version)
+}
+
+// recordChallengeRevision stores after as the next revision of a challenge.
+// When the latest stored revision does not match before, the challenge was
+// changed outside the editor and before is stored first, so that every diff
+// between neighbouring revisions shows a real change.
+func (s *Service) recordChallengeRevision(ctx context.Context, actorUserID *int64, challengeID int64, action string, sourceVersion int, before *UpsertChallengeInput, after UpsertChallengeInput) (int, error) {
+	latestVersion := 0
+	if before != nil {
+		revisions, err := s.repo.ListChallengeRevisions(ctx, challengeID)
+		if err != nil {
+			return 0, err
+		}
+		changes := []FieldChange{}
+		inSync := false
+		if len(revisions) > 0 {
+			latest, err := s.repo.GetChallengeRevision(ctx, challengeID, revisions[0].Version)
+			if err != nil {
+				return 0, err
+			}
+			latestVersion = latest.Version
+			changes = diffChallengeSnapshots(*latest.Snapshot, *before)
+			inSync = len(changes) == 0
+		}
+		if !inSync {
+			baseline, err := s.repo.CreateChallengeRevision(ctx, CreateChallengeRevisionInput{
+				ChallengeID: challengeID,
+				Action:      RevisionActionExternal,
+				Snapshot:    *before,
+				Changes:     changes,
+			})
+			if err != nil {
+				return 0, err
+			}
+			latestVersion = baseline.Version
+		}
+	}
+
+	changes := []FieldChange{}
+	if before != nil {
+		changes = diffChallengeSnapshots(*before, after)
+		if len(changes) == 0 {
+			return latestVersion, nil
+		}
+	}
+	revision, err := s.repo.CreateChallengeRevision(ctx, CreateChallengeRevisionInput{
+		ChallengeID:   challengeID,
+		Action:        action,
+		SourceVersion: sourceVersion,
+		ActorUserID:   actorUserID,
+		Snapshot:      after,
+		Changes:       changes,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision.Version, nil
+}
+
+func (s *Service) flagChangeWarnings(ctx context.Context, challengeID int64, before, after UpsertChallengeInput) ([]ChallengeWarning, int, error) {
+	if before.FlagType == after.FlagType && before.FlagValue == after.FlagValue {
+		return nil, 0, nil
+	}
+	solves, err := s.repo.CountChallengeSolves(ctx, challengeID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if solves == 0 {
+		return nil, 0, nil
+	}
+	return []ChallengeWarning{{
+		Code:    "flag_changed_after_solves",
+		Message: fmt.Sprintf("the flag changes after %d solves; existing solves are kept and only new submissions are checked against the new flag", solves),
+	}}, solves, nil
+}
+
+// challengeSnapshot returns the editable fields of a stored challenge. The
+// pinned image digest is left out: it is managed by its own endpoints and a
+// rollback must not restore a stale pin.
+func challengeSnapshot(detail ChallengeDetail) UpsertChallengeInput {
+	cfg := detail.RuntimeConfig
+	cfg.ImageDigest = ""
+	return UpsertChallengeInput{
+		Slug:           detail.Slug,
+		Title:          detail.Title,
+		CategorySlug:   detail.Category,
+		Description:    detail.Description,
+		Points:         detail.Points,
+		Difficulty:     detail.Difficulty,
+		FlagType:       detail.FlagType,
+		FlagValue:      detail.FlagValue,
+		DynamicEnabled: detail.DynamicEnabled,
+		Status:         detail.Status,
+		Visible:        detail.Visible,
+		SortOrder:      detail.SortOrder,
+		RuntimeConfig:  &cfg,
+	}
+}
+
+// appliedSnapshot returns the state a challenge is in after input was saved
+// over previous. An input without runtime config leaves the stored one.
+func appliedSnapshot(previous, input UpsertChallengeInput) UpsertChallengeInput {
+	if input.RuntimeConfig == nil {
+		input.RuntimeConfig = previous.RuntimeConfig
+		return input
+	}
+	cfg := *input.RuntimeConfig
+	cfg.ImageDigest = ""
+	input.RuntimeConfig = &cfg
+	return input
+}
+
+// diffChallengeSnapshots lists the fields that differ between two snapshots,
+// sorted by field name. Empty and missing values compare equal.
+func diffChallengeSnapshots(before, after UpsertChallengeInput) []FieldChange {
+	left := flattenChallengeSnapshot(before)
+	right := flattenChallengeSnapshot(after)
+	fields := make([]string, 0, len(left)+len(right))
+	for field := range left {
+		fields = append(fields, field)
+	}
+	for field := range right {
+		if _, ok := left[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if !reflect.DeepEqual(left[field], right[field]) {
+			changes = append(changes, FieldChange{Field: field, Before: left[field], After: right[field]})
+		}
+	}
+	return changes
+}
+
+func flattenChallengeSnapshot(input UpsertChallengeInput) map[string]any {
+	var fields map[string]any
+	encoded, _ := json.Marshal(input)
+	_ = json.Unmarshal(encoded, &fields)
+
+	flat := make(map[string]any, len(fields))
+	for key, value := range fields {
+		if key == "runtime_config" {
+			nested, _ := value.(map[string]any)
+			for nestedKey, nestedValue := range nested {
+				if nestedValue = compactSnapshotValue(nestedValue); nestedValue != nil {
+					flat["runtime_config."+nestedKey] = nestedValue
+				}
+			}
+			continue
+		}
+		if value = compactSnapshotValue(value); value != nil {
+			flat[key] = value
+		}
+	}
+	return flat
+}
+
+// compactSnapshotValue maps empty lists and objects to nil, so that a field
+// stored as [] and one left out compare equal.
+func compactSnapshotValue(value any) any {
+	switch typed := value.(type) {
+	case []any:
+		if len(typed) == 0 {
+			return nil
+		}
+	case map[string]any:
+		compacted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			if item = compactSnapshotValue(item); item != nil {
+				compacted[key] = item
+			}
+		}
+		if len(compacted) == 0 {
+			return nil
+		}
+		return compacted
+	}
+	return value
+}
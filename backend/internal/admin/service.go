@@ -12,11 +12,13 @@ import (
 
 	"ctf/backend/internal/challengecfg"
 	"ctf/backend/internal/game"
+	"ctf/backend/internal/runtime"
 )
 
 type Service struct {
 	repo                 Repository
 	manager              InstanceManager
+	instances            ChallengeInstanceStopper
 	now                  func() time.Time
 	attachmentStorageDir string
 }
@@ -41,7 +43,12 @@ func NewService(repo Repository, attachmentStorageDir string) *Service {
 }
 
 func NewServiceWithManager(repo Repository, attachmentStorageDir string, manager InstanceManager) *Service {
-	return &Service{repo: repo, manager: manager, now: time.Now, attachmentStorageDir: attachmentStorageDir}
+	return NewServiceWithRuntime(repo, attachmentStorageDir, manager, nil)
+}
+
+// NewServiceWithRuntime also lets archiving a challenge stop its instances.
+func NewServiceWithRuntime(repo Repository, attachmentStorageDir string, manager InstanceManager, instances ChallengeInstanceStopper) *Service {
+	return &Service{repo: repo, manager: manager, instances: instances, now: time.Now, attachmentStorageDir: attachmentStorageDir}
 }
 
 func (s *Service) Challenges(ctx context.Context, actor Actor) ([]ChallengeSummary, error) {
@@ -64,10 +71,17 @@ func (s *Service) CreateChallenge(ctx context.Context, actor Actor, input Upsert
 	}
 	input.Status = status
 	input.Visible = challengecfg.IsPublished(status)
+	if err := normalizeRuntimeConfig(input.RuntimeConfig); err != nil {
+		return ChallengeSummary{}, err
+	}
 	challenge, err := s.repo.CreateChallenge(ctx, actor, input)
 	if err != nil {
 		return ChallengeSummary{}, err
 	}
+	snapshot := appliedSnapshot(UpsertChallengeInput{RuntimeConfig: &RuntimeConfig{}}, input)
+	if _, err := s.recordChallengeRevision(ctx, &actor.UserID, challenge.ID, RevisionActionCreate, 0, nil, snapshot); err != nil {
+		return ChallengeSummary{}, fmt.Errorf("record challenge revision: %w", err)
+	}
 	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.create", "challenge", fmt.Sprintf("%d", challenge.ID), map[string]any{
 		"slug":            challenge.Slug,
 		"title":           challenge.Title,
@@ -80,25 +94,49 @@ func (s *Service) CreateChallenge(ctx context.Context, actor Actor, input Upsert
 	return challenge, nil
 }
 
-func (s *Service) UpdateChallenge(ctx context.Context, actor Actor, challengeID int64, input UpsertChallengeInput) (ChallengeSummary, error) {
+// UpdateChallenge saves input over a challenge and stores the result as a new
+// revision. Warnings report a flag change on a solved challenge.
+func (s *Service) UpdateChallenge(ctx context.Context, actor Actor, challengeID int64, input UpsertChallengeInput) (ChallengeChange, error) {
+	return s.updateChallenge(ctx, actor, challengeID, input, RevisionActionUpdate, 0)
+}
+
+func (s *Service) updateChallenge(ctx context.Context, actor Actor, challengeID int64, input UpsertChallengeInput, action string, sourceVersion int) (ChallengeChange, error) {
 	normalized, err := game.ValidateFlagTypeConfig(input.FlagType, input.FlagValue)
 	if err != nil {
-		return ChallengeSummary{}, fmt.Errorf("%w: %v", ErrInvalidChallengeInput, err)
+		return ChallengeChange{}, fmt.Errorf("%w: %v", ErrInvalidChallengeInput, err)
 	}
 	input.FlagType = normalized
 	status, err := challengecfg.NormalizeInputStatus(input.Status, input.Visible)
 	if err != nil {
-		return ChallengeSummary{}, fmt.Errorf("%w: %v", ErrInvalidChallengeInput, err)
+		return ChallengeChange{}, fmt.Errorf("%w: %v", ErrInvalidChallengeInput, err)
 	}
 	input.Status = status
 	input.Visible = challengecfg.IsPublished(status)
+	if err := normalizeRuntimeConfig(input.RuntimeConfig); err != nil {
+		return ChallengeChange{}, err
+	}
 	previous, err := s.repo.GetChallenge(ctx, actor, challengeID)
 	if err != nil {
-		return ChallengeSummary{}, err
+		return ChallengeChange{}, err
+	}
+	before := challengeSnapshot(previous)
+	after := appliedSnapshot(before, input)
+	warnings, solves, err := s.flagChangeWarnings(ctx, challengeID, before, after)
+	if err != nil {
+		return ChallengeChange{}, err
 	}
 	challenge, err := s.repo.UpdateChallenge(ctx, actor, challengeID, input)
 	if err != nil {
-		return ChallengeSummary{}, err
+		return ChallengeChange{}, err
+	}
+	version, err := s.recordChallengeRevision(ctx, &actor.UserID, challengeID, action, sourceVersion, &before, after)
+	if err != nil {
+		return ChallengeChange{}, fmt.Errorf("record challenge revision: %w", err)
+	}
+
+	changedFields := make([]string, 0)
+	for _, change := range diffChallengeSnapshots(before, after) {
+		changedFields = append(changedFields, change.Field)
 	}
 	details := map[string]any{
 		"slug":               challenge.Slug,
@@ -114,14 +152,236 @@ func (s *Service) UpdateChallenge(ctx context.Context, actor Actor, challengeID
 	if previous.Status != challenge.Status {
 		details["status_transition"] = fmt.Sprintf("%s->%s", previous.Status, challenge.Status)
 	}
-	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.update", "challenge", fmt.Sprintf("%d", challenge.ID), details)
+	details["revision"] = version
+	details["changed_fields"] = changedFields
+	if before.FlagType != after.FlagType || before.FlagValue != after.FlagValue {
+		details["flag_changed"] = true
+		details["solves"] = solves
+	}
+	auditAction := "challenge.update"
+	if action == RevisionActionRollback {
+		auditAction = "challenge.rollback"
+		details["source_version"] = sourceVersion
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, auditAction, "challenge", fmt.Sprintf("%d", challenge.ID), details)
+	return ChallengeChange{Challenge: challenge, Revision: version, Warnings: warnings}, nil
+}
+
+// ArchiveChallenge hides a challenge from players and stops its instances.
+// Solves and submissions are kept, so the scoreboard and player histories do
+// not change. Archiving an archived challenge stops any instance left over
+// from an earlier attempt.
+func (s *Service) ArchiveChallenge(ctx context.Context, actor Actor, challengeID int64) (ChallengeDetail, error) {
+	challenge, err := s.repo.GetChallenge(ctx, actor, challengeID)
+	if err != nil {
+		return ChallengeDetail{}, err
+	}
+	archived := challenge.ArchivedAt == nil
+	if archived {
+		now := s.now().UTC()
+		if err := s.repo.SetChallengeArchivedAt(ctx, challengeID, &now); err != nil {
+			return ChallengeDetail{}, err
+		}
+		challenge.ArchivedAt = &now
+	}
+
+	stopped, stopErr := s.stopChallengeInstances(ctx, actor.UserID, challengeID)
+	if archived || stopped > 0 {
+		_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.archive", "challenge", fmt.Sprintf("%d", challengeID), map[string]any{
+			"slug":              challenge.Slug,
+			"title":             challenge.Title,
+			"status":            challenge.Status,
+			"stopped_instances": stopped,
+		})
+	}
+	if stopErr != nil {
+		return ChallengeDetail{}, stopErr
+	}
+	return challenge, nil
+}
+
+// RestoreChallenge brings an archived challenge back with the status it had.
+func (s *Service) RestoreChallenge(ctx context.Context, actor Actor, challengeID int64) (ChallengeDetail, error) {
+	challenge, err := s.repo.GetChallenge(ctx, actor, challengeID)
+	if err != nil {
+		return ChallengeDetail{}, err
+	}
+	if challenge.ArchivedAt == nil {
+		return challenge, nil
+	}
+	if err := s.repo.SetChallengeArchivedAt(ctx, challengeID, nil); err != nil {
+		return ChallengeDetail{}, err
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.restore", "challenge", fmt.Sprintf("%d", challengeID), map[string]any{
+		"slug":        challenge.Slug,
+		"title":       challenge.Title,
+		"status":      challenge.Status,
+		"archived_at": challenge.ArchivedAt.UTC().Format(time.RFC3339),
+	})
+	challenge.ArchivedAt = nil
 	return challenge, nil
 }
 
+// DeleteChallenge removes an archived challenge for good, with its solves,
+// submissions, instances and attachment files. The caller has to repeat the
+// slug to confirm.
+func (s *Service) DeleteChallenge(ctx context.Context, actor Actor, challengeID int64, input DeleteChallengeInput) (ChallengeDetail, error) {
+	challenge, err := s.repo.GetChallenge(ctx, actor, challengeID)
+	if err != nil {
+		return ChallengeDetail{}, err
+	}
+	if challenge.ArchivedAt == nil {
+		return ChallengeDetail{}, ErrChallengeNotArchived
+	}
+	if strings.TrimSpace(input.ConfirmSlug) != challenge.Slug {
+		return ChallengeDetail{}, ErrConfirmSlugMismatch
+	}
+	if err := s.repo.DeleteChallenge(ctx, challengeID); err != nil {
+		return ChallengeDetail{}, err
+	}
+
+	details := map[string]any{
+		"slug":        challenge.Slug,
+		"title":       challenge.Title,
+		"category":    challenge.Category,
+		"points":      challenge.Points,
+		"attachments": len(challenge.Attachments),
+	}
+	// The challenge is gone either way; a file that could not be removed is
+	// recorded for the operator to clean up.
+	if err := s.removeAttachmentFiles(challengeID); err != nil {
+		details["attachment_cleanup_error"] = err.Error()
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.delete", "challenge", fmt.Sprintf("%d", challengeID), details)
+	return challenge, nil
+}
+
+func (s *Service) stopChallengeInstances(ctx context.Context, actorUserID int64, challengeID int64) (int, error) {
+	if s.instances == nil {
+		return 0, nil
+	}
+	return s.instances.StopChallengeInstances(ctx, fmt.Sprintf("%d", challengeID), fmt.Sprintf("challenge archived by user %d", actorUserID))
+}
+
+// PinChallengeImage makes new instances of a challenge start from one image
+// ID, so that rebuilding or retagging its image does not change what players
+// get mid-contest. Without a digest in the input the image name is resolved on
+// the Docker nodes. Changing the image name later drops the pin.
+func (s *Service) PinChallengeImage(ctx context.Context, actor Actor, challengeID int64, input PinChallengeImageInput) (RuntimeConfig, error) {
+	challenge, err := s.repo.GetChallenge(ctx, actor, challengeID)
+	if err != nil {
+		return RuntimeConfig{}, err
+	}
+	cfg := challenge.RuntimeConfig
+	if !cfg.Enabled || cfg.ImageName == "" || cfg.Driver == runtime.DriverProcess {
+		return RuntimeConfig{}, fmt.Errorf("%w: challenge has no docker runtime config to pin", ErrInvalidChallengeInput)
+	}
+
+	digest := strings.ToLower(strings.TrimSpace(input.Digest))
+	if digest == "" {
+		resolver, ok := s.manager.(ImageResolver)
+		if !ok {
+			return RuntimeConfig{}, runtime.ErrImagesNotSupported
+		}
+		if digest, err = resolver.ResolveImage(ctx, runtime.ChallengeConfig{ImageName: cfg.ImageName, Internal: cfg.Internal, NodeLabels: cfg.NodeLabels}); err != nil {
+			return RuntimeConfig{}, err
+		}
+	}
+	if !runtime.ValidImageDigest(digest) {
+		return RuntimeConfig{}, fmt.Errorf("%w: digest must look like sha256:<64 hex characters>", ErrInvalidChallengeInput)
+	}
+	if err := s.repo.SetChallengeImageDigest(ctx, challengeID, cfg.ImageName, digest); err != nil {
+		return RuntimeConfig{}, err
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.image_pin", "challenge", fmt.Sprintf("%d", challengeID), map[string]any{
+		"image_name":      cfg.ImageName,
+		"digest":          digest,
+		"previous_digest": cfg.ImageDigest,
+	})
+	cfg.ImageDigest = digest
+	return cfg, nil
+}
+
+// UnpinChallengeImage makes new instances start from the image name again.
+func (s *Service) UnpinChallengeImage(ctx context.Context, actor Actor, challengeID int64) (RuntimeConfig, error) {
+	challenge, err := s.repo.GetChallenge(ctx, actor, challengeID)
+	if err != nil {
+		return RuntimeConfig{}, err
+	}
+	cfg := challenge.RuntimeConfig
+	if cfg.ImageDigest == "" {
+		return cfg, nil
+	}
+	if err := s.repo.SetChallengeImageDigest(ctx, challengeID, cfg.ImageName, ""); err != nil {
+		return RuntimeConfig{}, err
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.image_unpin", "challenge", fmt.Sprintf("%d", challengeID), map[string]any{
+		"image_name":      cfg.ImageName,
+		"previous_digest": cfg.ImageDigest,
+	})
+	cfg.ImageDigest = ""
+	return cfg, nil
+}
+
 func (s *Service) ChallengeAuthors(ctx context.Context, actor Actor, challengeID int64) ([]ChallengeAuthor, error) {
 	return s.repo.ListChallengeAuthors(ctx, actor, challengeID)
 }
 
+func normalizeRuntimeConfig(cfg *RuntimeConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	mode, ok := runtime.NormalizeMode(cfg.Mode)
+	if !ok {
+		return fmt.Errorf("%w: invalid runtime mode %q", ErrInvalidChallengeInput, cfg.Mode)
+	}
+	cfg.Mode = mode
+	driver, ok := runtime.NormalizeDriver(cfg.Driver)
+	if !ok {
+		return fmt.Errorf("%w: invalid runtime driver %q", ErrInvalidChallengeInput, cfg.Driver)
+	}
+	cfg.Driver = driver
+	if cfg.MaxRestartCount < 0 {
+		return fmt.Errorf("%w: max_restart_count cannot be negative", ErrInvalidChallengeInput)
+	}
+	if cfg.Internal {
+		switch strings.ToLower(strings.TrimSpace(cfg.ExposedProtocol)) {
+		case "", "http", "https":
+		default:
+			return fmt.Errorf("%w: internal runtime requires http or https exposure", ErrInvalidChallengeInput)
+		}
+	}
+	hardening, err := runtime.NormalizeHardening(cfg.Hardening)
+	if err != nil {
+		return fmt.Errorf("%w: hardening: %v", ErrInvalidChallengeInput, err)
+	}
+	cfg.Hardening = hardening
+	services, err := runtime.NormalizeServices(cfg.Services)
+	if err != nil {
+		return fmt.Errorf("%w: services: %v", ErrInvalidChallengeInput, err)
+	}
+	cfg.Services = services
+	readiness, err := runtime.NormalizeReadinessProbe(cfg.Readiness)
+	if err != nil {
+		return fmt.Errorf("%w: readiness: %v", ErrInvalidChallengeInput, err)
+	}
+	cfg.Readiness = readiness
+	if err := runtime.ValidateWarmPoolSize(cfg.WarmPoolSize, cfg.Mode); err != nil {
+		return fmt.Errorf("%w: warm_pool_size: %v", ErrInvalidChallengeInput, err)
+	}
+	nodeLabels, err := runtime.NormalizeNodeLabels(cfg.NodeLabels)
+	if err != nil {
+		return fmt.Errorf("%w: node_labels: %v", ErrInvalidChallengeInput, err)
+	}
+	cfg.NodeLabels = nodeLabels
+	if cfg.Driver == runtime.DriverProcess {
+		if err := runtime.ValidateProcessRuntime(cfg.ImageName, cfg.ExposedProtocol, cfg.Command, cfg.Internal, len(cfg.Services), len(cfg.NodeLabels)); err != nil {
+			return fmt.Errorf("%w: driver: %v", ErrInvalidChallengeInput, err)
+		}
+	}
+	return nil
+}
+
 func (s *Service) UpdateChallengeAuthors(ctx context.Context, actor Actor, challengeID int64, input UpdateChallengeAuthorsInput) ([]ChallengeAuthor, error) {
 	userIDs := make([]int64, 0, len(input.UserIDs))
 	seen := make(map[int64]struct{}, len(input.UserIDs))
@@ -163,6 +423,14 @@ func (s *Service) CreateAttachment(ctx context.Context, actor Actor, challengeID
 	return attachment, nil
 }
 
+// RecordChallengeExport notes in the audit log that a challenge, flag
+// included, was downloaded as a challenge.yaml bundle.
+func (s *Service) RecordChallengeExport(ctx context.Context, actor Actor, challengeID int64, format string) {
+	_ = s.repo.CreateAuditLog(ctx, &actor.UserID, "challenge.export", "challenge", fmt.Sprintf("%d", challengeID), map[string]any{
+		"format": format,
+	})
+}
+
 func (s *Service) Attachment(ctx context.Context, actor Actor, challengeID int64, attachmentID int64) (Attachment, string, error) {
 	if actor.RestrictToOwnedChallenges() {
 		allowed, err := challengeOwnedByUser(ctx, s.repo, challengeID, actor.UserID)
@@ -193,6 +461,45 @@ func (s *Service) UpdateUser(ctx context.Context, actorUserID int64, userID int6
 	return user, nil
 }
 
+func (s *Service) RecordUserPasswordReset(ctx context.Context, actorUserID int64, userID int64, username string) error {
+	return s.repo.CreateAuditLog(ctx, &actorUserID, "user.password_reset", "user", fmt.Sprintf("%d", userID), map[string]any{
+		"username": username,
+	})
+}
+
+func (s *Service) RecordSharedInstanceAction(ctx context.Context, actorUserID int64, action string, instance runtime.Instance) error {
+	return s.repo.CreateAuditLog(ctx, &actorUserID, action, "challenge", instance.ChallengeID, map[string]any{
+		"status":         instance.Status,
+		"host_port":      instance.HostPort,
+		"container_name": instance.ContainerName,
+	})
+}
+
+func (s *Service) RecordInstanceRestart(ctx context.Context, actorUserID int64, instance runtime.Instance) error {
+	return s.repo.CreateAuditLog(ctx, &actorUserID, "instance.restart", "challenge", instance.ChallengeID, map[string]any{
+		"restart_count":  instance.RestartCount,
+		"host_port":      instance.HostPort,
+		"container_name": instance.ContainerName,
+	})
+}
+
+func (s *Service) RecordNodeDrain(ctx context.Context, actorUserID int64, node string, draining bool) error {
+	action := "runtime_node.undrain"
+	if draining {
+		action = "runtime_node.drain"
+	}
+	return s.repo.CreateAuditLog(ctx, &actorUserID, action, "runtime_node", node, map[string]any{})
+}
+
+func (s *Service) RecordImagePull(ctx context.Context, actorUserID int64, summary runtime.ImagePullSummary) error {
+	return s.repo.CreateAuditLog(ctx, &actorUserID, "runtime_images.pull", "runtime_images", "", map[string]any{
+		"images":  summary.Images,
+		"present": summary.Present,
+		"pulled":  summary.Pulled,
+		"failed":  summary.Failed,
+	})
+}
+
 func (s *Service) AuditLogs(ctx context.Context) ([]AuditLogRecord, error) {
 	return s.repo.ListAuditLogs(ctx)
 }
@@ -240,7 +547,7 @@ func (s *Service) TerminateInstance(ctx context.Context, actorUserID int64, inst
 			return InstanceRecord{}, err
 		}
 		if current.ContainerID != "" && current.Status != "terminated" {
-			if err := s.manager.Stop(ctx, current.ContainerID); err != nil {
+			if err := s.manager.Stop(ctx, current.Node, current.ContainerID); err != nil {
 				return InstanceRecord{}, err
 			}
 		}
@@ -250,6 +557,7 @@ func (s *Service) TerminateInstance(ctx context.Context, actorUserID int64, inst
 	if err != nil {
 		return InstanceRecord{}, err
 	}
+	_ = s.repo.CreateInstanceEvent(ctx, instanceID, runtime.EventTerminatedByAdmin, fmt.Sprintf("terminated by user %d", actorUserID))
 	_ = s.repo.CreateAuditLog(ctx, &actorUserID, "instance.terminate", "instance", fmt.Sprintf("%d", instanceID), map[string]any{
 		"challenge_id": instance.ChallengeID,
 		"username":     instance.Username,
@@ -257,6 +565,56 @@ func (s *Service) TerminateInstance(ctx context.Context, actorUserID int64, inst
 	return instance, nil
 }
 
+// InstanceLogs opens the log stream of a running instance's container.
+func (s *Service) InstanceLogs(ctx context.Context, instanceID int64, opts runtime.LogOptions) (io.ReadCloser, error) {
+	current, err := s.runningInstance(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.manager.Logs(ctx, current.Node, current.ContainerID, opts)
+}
+
+// ExecInstance runs a diagnostic command inside a running instance. Every
+// attempt is audited, including the ones Docker rejects.
+func (s *Service) ExecInstance(ctx context.Context, actorUserID int64, instanceID int64, input ExecInstanceInput) (runtime.ExecResult, error) {
+	command, err := runtime.NormalizeExecCommand(input.Command)
+	if err != nil {
+		return runtime.ExecResult{}, err
+	}
+	current, err := s.runningInstance(ctx, instanceID)
+	if err != nil {
+		return runtime.ExecResult{}, err
+	}
+
+	result, err := s.manager.Exec(ctx, current.Node, current.ContainerID, command)
+	details := map[string]any{
+		"challenge_id": current.ChallengeID,
+		"username":     current.Username,
+		"command":      command,
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	} else {
+		details["exit_code"] = result.ExitCode
+	}
+	_ = s.repo.CreateAuditLog(ctx, &actorUserID, "instance.exec", "instance", fmt.Sprintf("%d", instanceID), details)
+	return result, err
+}
+
+func (s *Service) runningInstance(ctx context.Context, instanceID int64) (InstanceRecord, error) {
+	if s.manager == nil {
+		return InstanceRecord{}, ErrInstanceNotRunning
+	}
+	current, err := s.repo.GetInstance(ctx, instanceID)
+	if err != nil {
+		return InstanceRecord{}, err
+	}
+	if current.ContainerID == "" || (current.Status != "running" && current.Status != "creating") {
+		return InstanceRecord{}, ErrInstanceNotRunning
+	}
+	return current, nil
+}
+
 func (s *Service) writeAttachmentFile(challengeID int64, filename string, body io.Reader) (string, error) {
 	dir := filepath.Join(s.attachmentStorageDir, fmt.Sprintf("challenge-%d", challengeID))
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -275,6 +633,19 @@ func (s *Service) writeAttachmentFile(challengeID int64, filename string, body i
 	return path, nil
 }
 
+// removeAttachmentFiles deletes the directory that holds a challenge's
+// uploaded and imported attachments.
+func (s *Service) removeAttachmentFiles(challengeID int64) error {
+	if strings.TrimSpace(s.attachmentStorageDir) == "" {
+		return nil
+	}
+	dir := filepath.Join(s.attachmentStorageDir, fmt.Sprintf("challenge-%d", challengeID))
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("remove attachment dir: %w", err)
+	}
+	return nil
+}
+
 func sanitizeFilename(name string) string {
 	name = filepath.Base(strings.TrimSpace(name))
 	name = strings.ReplaceAll(name, "..", "")
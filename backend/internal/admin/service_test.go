@@ -5,18 +5,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"ctf/backend/internal/game"
+	"ctf/backend/internal/runtime"
 )
 
 type fakeRepo struct {
 	users                 []UserRecord
 	auditLogs             []AuditLogRecord
+	instanceEvents        []string
 	instances             []InstanceRecord
 	createdChallengeInput UpsertChallengeInput
 	createdChallengeActor Actor
@@ -24,14 +28,41 @@ type fakeRepo struct {
 	updatedChallengeActor Actor
 	updatedAuthorUserIDs  []int64
 	attachmentActor       Actor
+	imageDigest           string
+	archivedAt            *time.Time
+	deletedChallengeID    int64
+	detail                *ChallengeDetail
+	revisions             []ChallengeRevision
+	solveCount            int
 }
 
 type fakeManager struct {
-	stopped []string
-	err     error
+	stopped  []string
+	execs    []string
+	resolved string
+	err      error
 }
 
-func (m *fakeManager) Stop(_ context.Context, containerID string) error {
+type fakeInstanceStopper struct {
+	active map[string]int
+	calls  []string
+}
+
+func (s *fakeInstanceStopper) StopChallengeInstances(_ context.Context, challengeID string, detail string) (int, error) {
+	s.calls = append(s.calls, challengeID+":"+detail)
+	stopped := s.active[challengeID]
+	delete(s.active, challengeID)
+	return stopped, nil
+}
+
+func (m *fakeManager) ResolveImage(context.Context, runtime.ChallengeConfig) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return m.resolved, nil
+}
+
+func (m *fakeManager) Stop(_ context.Context, _, containerID string) error {
 	if m.err != nil {
 		return m.err
 	}
@@ -39,12 +70,30 @@ func (m *fakeManager) Stop(_ context.Context, containerID string) error {
 	return nil
 }
 
+func (m *fakeManager) Logs(_ context.Context, _, containerID string, _ runtime.LogOptions) (io.ReadCloser, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return io.NopCloser(strings.NewReader("log of " + containerID + "\n")), nil
+}
+
+func (m *fakeManager) Exec(_ context.Context, _, containerID string, cmd []string) (runtime.ExecResult, error) {
+	if m.err != nil {
+		return runtime.ExecResult{}, m.err
+	}
+	m.execs = append(m.execs, containerID+": "+strings.Join(cmd, " "))
+	return runtime.ExecResult{Output: "ok\n"}, nil
+}
+
 func (r *fakeRepo) ListChallenges(context.Context, Actor) ([]ChallengeSummary, error) {
 	return []ChallengeSummary{{ID: 1, Slug: "web-welcome"}}, nil
 }
 
 func (r *fakeRepo) GetChallenge(context.Context, Actor, int64) (ChallengeDetail, error) {
-	return ChallengeDetail{ID: 1, Slug: "web-welcome", Title: "Welcome Panel", Category: "web", Points: 100, Status: "draft", Visible: false, RuntimeConfig: RuntimeConfig{Enabled: true, ImageName: "ctf/web-welcome:dev"}}, nil
+	if r.detail != nil {
+		return *r.detail, nil
+	}
+	return ChallengeDetail{ID: 1, Slug: "web-welcome", Title: "Welcome Panel", Category: "web", Points: 100, Status: "draft", Visible: false, ArchivedAt: r.archivedAt, RuntimeConfig: RuntimeConfig{Enabled: true, ImageName: "ctf/web-welcome:dev"}}, nil
 }
 
 func (r *fakeRepo) CreateChallenge(_ context.Context, actor Actor, input UpsertChallengeInput) (ChallengeSummary, error) {
@@ -56,6 +105,15 @@ func (r *fakeRepo) CreateChallenge(_ context.Context, actor Actor, input UpsertC
 func (r *fakeRepo) UpdateChallenge(_ context.Context, actor Actor, _ int64, input UpsertChallengeInput) (ChallengeSummary, error) {
 	r.updatedChallengeActor = actor
 	r.updatedChallengeInput = input
+	if r.detail != nil {
+		r.detail.Slug, r.detail.Title, r.detail.Category = input.Slug, input.Title, input.CategorySlug
+		r.detail.Description, r.detail.Points, r.detail.Difficulty = input.Description, input.Points, input.Difficulty
+		r.detail.FlagType, r.detail.FlagValue = input.FlagType, input.FlagValue
+		r.detail.DynamicEnabled, r.detail.Status, r.detail.Visible, r.detail.SortOrder = input.DynamicEnabled, input.Status, input.Visible, input.SortOrder
+		if input.RuntimeConfig != nil {
+			r.detail.RuntimeConfig = *input.RuntimeConfig
+		}
+	}
 	return ChallengeSummary{ID: 1, Slug: input.Slug, Title: input.Title, Category: input.CategorySlug, Points: input.Points, Status: input.Status, Visible: input.Visible, DynamicEnabled: input.DynamicEnabled}, nil
 }
 
@@ -72,6 +130,61 @@ func (r *fakeRepo) UpdateChallengeAuthors(_ context.Context, _ Actor, _ int64, u
 	return items, nil
 }
 
+func (r *fakeRepo) SetChallengeImageDigest(_ context.Context, _ int64, imageName, digest string) error {
+	if imageName != "ctf/web-welcome:dev" {
+		return ErrResourceNotFound
+	}
+	r.imageDigest = digest
+	return nil
+}
+
+func (r *fakeRepo) CreateChallengeRevision(_ context.Context, input CreateChallengeRevisionInput) (ChallengeRevision, error) {
+	snapshot := input.Snapshot
+	revision := ChallengeRevision{
+		ID:            int64(len(r.revisions) + 1),
+		ChallengeID:   input.ChallengeID,
+		Version:       len(r.revisions) + 1,
+		Action:        input.Action,
+		SourceVersion: input.SourceVersion,
+		ActorUserID:   input.ActorUserID,
+		Changes:       input.Changes,
+		Snapshot:      &snapshot,
+	}
+	r.revisions = append(r.revisions, revision)
+	return revision, nil
+}
+
+func (r *fakeRepo) ListChallengeRevisions(context.Context, int64) ([]ChallengeRevision, error) {
+	items := make([]ChallengeRevision, 0, len(r.revisions))
+	for i := len(r.revisions) - 1; i >= 0; i-- {
+		item := r.revisions[i]
+		item.Snapshot = nil
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (r *fakeRepo) GetChallengeRevision(_ context.Context, _ int64, version int) (ChallengeRevision, error) {
+	if version < 1 || version > len(r.revisions) {
+		return ChallengeRevision{}, ErrRevisionNotFound
+	}
+	return r.revisions[version-1], nil
+}
+
+func (r *fakeRepo) CountChallengeSolves(context.Context, int64) (int, error) {
+	return r.solveCount, nil
+}
+
+func (r *fakeRepo) SetChallengeArchivedAt(_ context.Context, _ int64, archivedAt *time.Time) error {
+	r.archivedAt = archivedAt
+	return nil
+}
+
+func (r *fakeRepo) DeleteChallenge(_ context.Context, challengeID int64) error {
+	r.deletedChallengeID = challengeID
+	return nil
+}
+
 func (r *fakeRepo) CreateAttachment(_ context.Context, actor Actor, _ int64, filename, _, contentType string, sizeBytes int64) (Attachment, error) {
 	r.attachmentActor = actor
 	return Attachment{ID: 1, Filename: filename, ContentType: contentType, SizeBytes: sizeBytes}, nil
@@ -99,6 +212,11 @@ func (r *fakeRepo) CreateAuditLog(_ context.Context, actorUserID *int64, action,
 	return nil
 }
 
+func (r *fakeRepo) CreateInstanceEvent(_ context.Context, instanceID int64, eventType, _ string) error {
+	r.instanceEvents = append(r.instanceEvents, fmt.Sprintf("%d:%s", instanceID, eventType))
+	return nil
+}
+
 func (r *fakeRepo) ListAnnouncements(context.Context) ([]Announcement, error) {
 	return []Announcement{{ID: 1, Title: "hello"}}, nil
 }
@@ -374,6 +492,9 @@ func TestTerminateInstanceStopsContainerAndAudits(t *testing.T) {
 	if len(repo.auditLogs) != 1 || repo.auditLogs[0].Action != "instance.terminate" {
 		t.Fatalf("expected terminate audit log, got %+v", repo.auditLogs)
 	}
+	if len(repo.instanceEvents) != 1 || repo.instanceEvents[0] != "1:terminated_by_admin" {
+		t.Fatalf("expected terminated_by_admin event, got %+v", repo.instanceEvents)
+	}
 }
 
 func TestTerminateInstanceReturnsStopFailure(t *testing.T) {
@@ -389,6 +510,81 @@ func TestTerminateInstanceReturnsStopFailure(t *testing.T) {
 	}
 }
 
+func TestExecInstanceRunsCommandAndAudits(t *testing.T) {
+	repo := &fakeRepo{instances: []InstanceRecord{
+		{ID: 1, ChallengeID: 7, Username: "alice", Status: "running", ContainerID: "cid-1"},
+		{ID: 2, ChallengeID: 7, Username: "bob", Status: "terminated", ContainerID: "cid-2"},
+	}}
+	manager := &fakeManager{}
+	service := NewServiceWithManager(repo, t.TempDir(), manager)
+
+	result, err := service.ExecInstance(context.Background(), 9, 1, ExecInstanceInput{Command: []string{"ps", "aux"}})
+	if err != nil || result.Output != "ok\n" {
+		t.Fatalf("exec instance: %+v %v", result, err)
+	}
+	if len(manager.execs) != 1 || manager.execs[0] != "cid-1: ps aux" {
+		t.Fatalf("unexpected execs: %+v", manager.execs)
+	}
+	if len(repo.auditLogs) != 1 || repo.auditLogs[0].Action != "instance.exec" || repo.auditLogs[0].Details["exit_code"] != 0 {
+		t.Fatalf("expected exec audit log, got %+v", repo.auditLogs)
+	}
+
+	if _, err := service.ExecInstance(context.Background(), 9, 1, ExecInstanceInput{}); !errors.Is(err, runtime.ErrInvalidExecCommand) {
+		t.Fatalf("expected invalid command error, got %v", err)
+	}
+	if _, err := service.ExecInstance(context.Background(), 9, 2, ExecInstanceInput{Command: []string{"id"}}); !errors.Is(err, ErrInstanceNotRunning) {
+		t.Fatalf("expected not running error, got %v", err)
+	}
+	if len(manager.execs) != 1 || len(repo.auditLogs) != 1 {
+		t.Fatalf("rejected commands must not run: %+v %+v", manager.execs, repo.auditLogs)
+	}
+}
+
+func TestPinChallengeImageResolvesAndAudits(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	repo := &fakeRepo{}
+	manager := &fakeManager{resolved: digest}
+	service := NewServiceWithManager(repo, t.TempDir(), manager)
+	actor := Actor{UserID: 9, Role: "admin"}
+
+	cfg, err := service.PinChallengeImage(context.Background(), actor, 1, PinChallengeImageInput{})
+	if err != nil {
+		t.Fatalf("pin image: %v", err)
+	}
+	if cfg.ImageDigest != digest || repo.imageDigest != digest {
+		t.Fatalf("expected resolved digest to be pinned, got %q / %q", cfg.ImageDigest, repo.imageDigest)
+	}
+	if len(repo.auditLogs) != 1 || repo.auditLogs[0].Action != "challenge.image_pin" {
+		t.Fatalf("expected pin audit log, got %+v", repo.auditLogs)
+	}
+
+	if _, err := service.PinChallengeImage(context.Background(), actor, 1, PinChallengeImageInput{Digest: "latest"}); !errors.Is(err, ErrInvalidChallengeInput) {
+		t.Fatalf("expected malformed digest to be rejected, got %v", err)
+	}
+	manager.err = runtime.ErrImageNotFound
+	if _, err := service.PinChallengeImage(context.Background(), actor, 1, PinChallengeImageInput{}); !errors.Is(err, runtime.ErrImageNotFound) {
+		t.Fatalf("expected missing image error, got %v", err)
+	}
+}
+
+func TestInstanceLogsReadsRunningContainer(t *testing.T) {
+	repo := &fakeRepo{instances: []InstanceRecord{{ID: 1, ChallengeID: 7, Username: "alice", Status: "running", ContainerID: "cid-1"}}}
+	service := NewServiceWithManager(repo, t.TempDir(), &fakeManager{})
+
+	logs, err := service.InstanceLogs(context.Background(), 1, runtime.LogOptions{Tail: 10})
+	if err != nil {
+		t.Fatalf("instance logs: %v", err)
+	}
+	defer logs.Close()
+	body, _ := io.ReadAll(logs)
+	if string(body) != "log of cid-1\n" {
+		t.Fatalf("unexpected logs %q", body)
+	}
+	if _, err := service.InstanceLogs(context.Background(), 3, runtime.LogOptions{}); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("expected missing instance error, got %v", err)
+	}
+}
+
 func TestDeleteAnnouncement(t *testing.T) {
 	repo := &fakeRepo{}
 	service := NewService(repo, t.TempDir())
@@ -403,3 +599,148 @@ func TestDeleteAnnouncement(t *testing.T) {
 		t.Fatalf("expected delete audit log, got %+v", repo.auditLogs)
 	}
 }
+
+func TestArchiveChallengeStopsInstancesAndRestores(t *testing.T) {
+	repo := &fakeRepo{}
+	instances := &fakeInstanceStopper{active: map[string]int{"1": 1, "2": 1}}
+	service := NewServiceWithRuntime(repo, t.TempDir(), &fakeManager{}, instances)
+	actor := Actor{UserID: 9, Role: "admin"}
+
+	challenge, err := service.ArchiveChallenge(context.Background(), actor, 1)
+	if err != nil {
+		t.Fatalf("archive challenge: %v", err)
+	}
+	if challenge.ArchivedAt == nil || repo.archivedAt == nil {
+		t.Fatalf("expected the challenge to be archived, got %+v", challenge)
+	}
+	if !reflect.DeepEqual(instances.calls, []string{"1:challenge archived by user 9"}) || instances.active["2"] != 1 {
+		t.Fatalf("expected only the instances of the challenge to stop, got %v", instances.calls)
+	}
+	if len(repo.auditLogs) != 1 || repo.auditLogs[0].Action != "challenge.archive" || repo.auditLogs[0].Details["stopped_instances"] != 1 {
+		t.Fatalf("expected archive audit log, got %+v", repo.auditLogs)
+	}
+
+	// Archiving again finds nothing to do and records nothing.
+	if _, err := service.ArchiveChallenge(context.Background(), actor, 1); err != nil || len(repo.auditLogs) != 1 {
+		t.Fatalf("expected a second archive to be a no-op, got %v %+v", err, repo.auditLogs)
+	}
+
+	restored, err := service.RestoreChallenge(context.Background(), actor, 1)
+	if err != nil {
+		t.Fatalf("restore challenge: %v", err)
+	}
+	if restored.ArchivedAt != nil || repo.archivedAt != nil {
+		t.Fatalf("expected the challenge to be restored, got %+v", restored)
+	}
+	if len(repo.auditLogs) != 2 || repo.auditLogs[1].Action != "challenge.restore" {
+		t.Fatalf("expected restore audit log, got %+v", repo.auditLogs)
+	}
+}
+
+func TestDeleteChallengeRequiresArchiveAndSlug(t *testing.T) {
+	repo := &fakeRepo{}
+	storageDir := t.TempDir()
+	service := NewService(repo, storageDir)
+	actor := Actor{UserID: 9, Role: "admin"}
+	attachmentDir := filepath.Join(storageDir, "challenge-1")
+	if err := os.MkdirAll(attachmentDir, 0o755); err != nil {
+		t.Fatalf("create attachment dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(attachmentDir, "1-statement.pdf"), []byte("pdf"), 0o644); err != nil {
+		t.Fatalf("write attachment: %v", err)
+	}
+
+	input := DeleteChallengeInput{ConfirmSlug: "web-welcome"}
+	if _, err := service.DeleteChallenge(context.Background(), actor, 1, input); !errors.Is(err, ErrChallengeNotArchived) {
+		t.Fatalf("expected a published challenge to need archiving first, got %v", err)
+	}
+	archivedAt := time.Date(2025, time.March, 8, 12, 0, 0, 0, time.UTC)
+	repo.archivedAt = &archivedAt
+	if _, err := service.DeleteChallenge(context.Background(), actor, 1, DeleteChallengeInput{ConfirmSlug: "web"}); !errors.Is(err, ErrConfirmSlugMismatch) {
+		t.Fatalf("expected a wrong slug to be rejected, got %v", err)
+	}
+	if repo.deletedChallengeID != 0 {
+		t.Fatal("expected nothing to be deleted before confirmation")
+	}
+
+	if _, err := service.DeleteChallenge(context.Background(), actor, 1, input); err != nil {
+		t.Fatalf("delete challenge: %v", err)
+	}
+	if repo.deletedChallengeID != 1 {
+		t.Fatalf("expected challenge 1 to be deleted, got %d", repo.deletedChallengeID)
+	}
+	if _, err := os.Stat(attachmentDir); !os.IsNotExist(err) {
+		t.Fatalf("expected attachment files to be removed, got %v", err)
+	}
+	if len(repo.auditLogs) != 1 || repo.auditLogs[0].Action != "challenge.delete" || repo.auditLogs[0].Details["slug"] != "web-welcome" {
+		t.Fatalf("expected delete audit log, got %+v", repo.auditLogs)
+	}
+}
+
+func TestUpdateChallengeRecordsRevisionsAndRollsBack(t *testing.T) {
+	repo := &fakeRepo{solveCount: 3, detail: &ChallengeDetail{
+		ID: 1, Slug: "web-welcome", Title: "Welcome Panel", Category: "web", Description: "v1", Points: 100,
+		Difficulty: "easy", FlagType: game.FlagTypeStatic, FlagValue: "flag{old}", Status: "published", Visible: true,
+		RuntimeConfig: RuntimeConfig{Enabled: true, Mode: "per-user", Driver: "docker", ImageName: "ctf/web-welcome:dev", ImageDigest: "sha256:pinned"},
+	}}
+	service := NewService(repo, t.TempDir())
+	actor := Actor{UserID: 1, Role: "admin"}
+	input := UpsertChallengeInput{
+		Slug: "web-welcome", Title: "Welcome Panel", CategorySlug: "web", Description: "v2", Points: 100,
+		Difficulty: "easy", FlagType: game.FlagTypeStatic, FlagValue: "flag{new}", Status: "published",
+	}
+
+	change, err := service.UpdateChallenge(context.Background(), actor, 1, input)
+	if err != nil {
+		t.Fatalf("update challenge: %v", err)
+	}
+	if change.Revision != 2 || len(repo.revisions) != 2 {
+		t.Fatalf("expected a baseline and an update revision, got %d %+v", change.Revision, repo.revisions)
+	}
+	if repo.revisions[0].Action != RevisionActionExternal || repo.revisions[0].Snapshot.FlagValue != "flag{old}" || repo.revisions[0].Snapshot.RuntimeConfig.ImageDigest != "" {
+		t.Fatalf("unexpected baseline revision: %+v", repo.revisions[0])
+	}
+	var fields []string
+	for _, item := range repo.revisions[1].Changes {
+		fields = append(fields, item.Field)
+	}
+	if !reflect.DeepEqual(fields, []string{"description", "flag_value"}) || *repo.revisions[1].ActorUserID != 1 {
+		t.Fatalf("unexpected update revision: %+v", repo.revisions[1])
+	}
+	if len(change.Warnings) != 1 || change.Warnings[0].Code != "flag_changed_after_solves" {
+		t.Fatalf("expected a flag warning, got %+v", change.Warnings)
+	}
+	if details := repo.auditLogs[0].Details; details["flag_changed"] != true || details["solves"] != 3 || details["revision"] != 2 {
+		t.Fatalf("unexpected update audit details: %+v", details)
+	}
+
+	// Saving the same input again changes nothing and stores nothing.
+	if change, err := service.UpdateChallenge(context.Background(), actor, 1, input); err != nil || change.Revision != 2 || len(repo.revisions) != 2 || change.Warnings != nil {
+		t.Fatalf("expected an unchanged save to keep revision 2, got %+v %v", change, err)
+	}
+
+	diff, err := service.DiffChallengeRevisions(context.Background(), actor, 1, 2, 1)
+	if err != nil {
+		t.Fatalf("diff revisions: %v", err)
+	}
+	if len(diff.Changes) != 2 || diff.Changes[1].Before != "flag{new}" || diff.Changes[1].After != "flag{old}" || len(diff.Warnings) != 1 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	change, err = service.RollbackChallenge(context.Background(), actor, 1, 1)
+	if err != nil {
+		t.Fatalf("rollback challenge: %v", err)
+	}
+	if repo.detail.FlagValue != "flag{old}" || repo.detail.Description != "v1" || change.Revision != 3 {
+		t.Fatalf("expected revision 1 to be restored, got %+v %+v", repo.detail, change)
+	}
+	if last := repo.revisions[2]; last.Action != RevisionActionRollback || last.SourceVersion != 1 {
+		t.Fatalf("unexpected rollback revision: %+v", last)
+	}
+	if last := repo.auditLogs[len(repo.auditLogs)-1]; last.Action != "challenge.rollback" || last.Details["source_version"] != 1 {
+		t.Fatalf("expected rollback audit log, got %+v", last)
+	}
+	if _, err := service.RollbackChallenge(context.Background(), actor, 1, 9); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected a missing revision error, got %v", err)
+	}
+}
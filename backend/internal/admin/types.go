@@ -5,11 +5,27 @@ import (
 	"errors"
 	"io"
 	"time"
+
+	"ctf/backend/internal/runtime"
 )
 
 var (
 	ErrResourceNotFound      = errors.New("resource not found")
 	ErrInvalidChallengeInput = errors.New("invalid challenge input")
+	ErrInstanceNotRunning    = errors.New("instance is not running")
+	ErrChallengeNotArchived  = errors.New("challenge must be archived before it can be deleted")
+	ErrConfirmSlugMismatch   = errors.New("confirm_slug does not match the challenge slug")
+	ErrRevisionNotFound      = errors.New("challenge revision not found")
+)
+
+// Challenge revision actions. A revision with RevisionActionExternal records
+// a state written outside the admin editor, such as an import or an edit
+// made before revisions were kept.
+const (
+	RevisionActionCreate   = "create"
+	RevisionActionUpdate   = "update"
+	RevisionActionRollback = "rollback"
+	RevisionActionExternal = "external"
 )
 
 type Actor struct {
@@ -22,18 +38,28 @@ func (a Actor) RestrictToOwnedChallenges() bool {
 }
 
 type RuntimeConfig struct {
-	Enabled            bool              `json:"enabled"`
-	ImageName          string            `json:"image_name"`
-	ExposedProtocol    string            `json:"exposed_protocol"`
-	ContainerPort      int               `json:"container_port"`
-	DefaultTTL         int               `json:"default_ttl_seconds"`
-	MaxRenewCount      int               `json:"max_renew_count"`
-	MemoryLimitMB      int               `json:"memory_limit_mb"`
-	CPUMilli           int               `json:"cpu_limit_millicores"`
-	MaxActiveInstances int               `json:"max_active_instances"`
-	UserCooldown       int               `json:"user_cooldown_seconds"`
-	Env                map[string]string `json:"env,omitempty"`
-	Command            []string          `json:"command,omitempty"`
+	Enabled            bool                   `json:"enabled"`
+	Mode               string                 `json:"mode"`
+	Driver             string                 `json:"driver"`
+	Internal           bool                   `json:"internal"`
+	ImageName          string                 `json:"image_name"`
+	ImageDigest        string                 `json:"image_digest,omitempty"`
+	ExposedProtocol    string                 `json:"exposed_protocol"`
+	ContainerPort      int                    `json:"container_port"`
+	DefaultTTL         int                    `json:"default_ttl_seconds"`
+	MaxRenewCount      int                    `json:"max_renew_count"`
+	MaxRestartCount    int                    `json:"max_restart_count"`
+	MemoryLimitMB      int                    `json:"memory_limit_mb"`
+	CPUMilli           int                    `json:"cpu_limit_millicores"`
+	MaxActiveInstances int                    `json:"max_active_instances"`
+	UserCooldown       int                    `json:"user_cooldown_seconds"`
+	Env                map[string]string      `json:"env,omitempty"`
+	Command            []string               `json:"command,omitempty"`
+	Hardening          runtime.Hardening      `json:"hardening"`
+	Services           []runtime.ServiceSpec  `json:"services,omitempty"`
+	Readiness          runtime.ReadinessProbe `json:"readiness"`
+	WarmPoolSize       int                    `json:"warm_pool_size"`
+	NodeLabels         map[string]string      `json:"node_labels,omitempty"`
 }
 
 type Attachment struct {
@@ -60,6 +86,9 @@ type ChallengeSummary struct {
 	Status         string `json:"status"`
 	Visible        bool   `json:"visible"`
 	DynamicEnabled bool   `json:"dynamic_enabled"`
+	// ArchivedAt is set while the challenge is archived and hidden from
+	// players whatever its status.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
 type ChallengeDetail struct {
@@ -76,6 +105,7 @@ type ChallengeDetail struct {
 	Visible        bool              `json:"visible"`
 	DynamicEnabled bool              `json:"dynamic_enabled"`
 	SortOrder      int               `json:"sort_order"`
+	ArchivedAt     *time.Time        `json:"archived_at,omitempty"`
 	Authors        []ChallengeAuthor `json:"authors"`
 	Attachments    []Attachment      `json:"attachments"`
 	RuntimeConfig  RuntimeConfig     `json:"runtime_config"`
@@ -97,6 +127,63 @@ type UpsertChallengeInput struct {
 	RuntimeConfig  *RuntimeConfig `json:"runtime_config,omitempty"`
 }
 
+// ChallengeRevision is one saved state of a challenge's editable fields.
+// Snapshot is only loaded for single revisions; lists leave it nil.
+type ChallengeRevision struct {
+	ID            int64                 `json:"id"`
+	ChallengeID   int64                 `json:"challenge_id"`
+	Version       int                   `json:"version"`
+	Action        string                `json:"action"`
+	SourceVersion int                   `json:"source_version,omitempty"`
+	ActorUserID   *int64                `json:"actor_user_id,omitempty"`
+	ActorUsername string                `json:"actor_username,omitempty"`
+	Changes       []FieldChange         `json:"changes"`
+	Snapshot      *UpsertChallengeInput `json:"snapshot,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+}
+
+// FieldChange is one field that differs between two challenge snapshots.
+// Runtime config fields are prefixed with "runtime_config.".
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type ChallengeRevisionDiff struct {
+	From     int                `json:"from"`
+	To       int                `json:"to"`
+	Changes  []FieldChange      `json:"changes"`
+	Warnings []ChallengeWarning `json:"warnings,omitempty"`
+}
+
+// ChallengeWarning flags a saved change that may need follow-up, for example
+// a new flag on a challenge that players have already solved.
+type ChallengeWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ChallengeChange struct {
+	Challenge ChallengeSummary   `json:"challenge"`
+	Revision  int                `json:"revision,omitempty"`
+	Warnings  []ChallengeWarning `json:"warnings,omitempty"`
+}
+
+type CreateChallengeRevisionInput struct {
+	ChallengeID   int64
+	Action        string
+	SourceVersion int
+	ActorUserID   *int64
+	Snapshot      UpsertChallengeInput
+	Changes       []FieldChange
+}
+
+type DeleteChallengeInput struct {
+	// ConfirmSlug must repeat the challenge slug.
+	ConfirmSlug string `json:"confirm_slug"`
+}
+
 type UpdateChallengeAuthorsInput struct {
 	UserIDs []int64 `json:"user_ids"`
 }
@@ -119,6 +206,10 @@ type UserRecord struct {
 	CreatedAt   time.Time  `json:"created_at"`
 }
 
+type ResetUserPasswordInput struct {
+	Password string `json:"password"`
+}
+
 type UpdateUserInput struct {
 	Role        string `json:"role"`
 	DisplayName string `json:"display_name"`
@@ -166,15 +257,45 @@ type InstanceRecord struct {
 	ChallengeID   int64      `json:"challenge_id"`
 	ChallengeSlug string     `json:"challenge_slug"`
 	Username      string     `json:"username"`
+	Shared        bool       `json:"shared"`
 	Status        string     `json:"status"`
 	HostPort      int        `json:"host_port"`
 	ExpiresAt     time.Time  `json:"expires_at"`
 	TerminatedAt  *time.Time `json:"terminated_at,omitempty"`
 	ContainerID   string     `json:"container_id"`
+	Node          string     `json:"node"`
+	// ExitCode is set when the container exited on its own.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Stats is the latest resource usage sample of a running instance.
+	Stats *runtime.ContainerStats `json:"stats,omitempty"`
 }
 
 type InstanceManager interface {
-	Stop(context.Context, string) error
+	Stop(ctx context.Context, node, containerID string) error
+	Logs(ctx context.Context, node, containerID string, opts runtime.LogOptions) (io.ReadCloser, error)
+	Exec(ctx context.Context, node, containerID string, cmd []string) (runtime.ExecResult, error)
+}
+
+// ChallengeInstanceStopper ends the instances of a challenge through the
+// runtime service, so that it also drops what it tracks about them.
+type ChallengeInstanceStopper interface {
+	StopChallengeInstances(ctx context.Context, challengeID string, detail string) (int, error)
+}
+
+// ImageResolver finds the image ID an image name refers to on the nodes a
+// challenge can run on.
+type ImageResolver interface {
+	ResolveImage(ctx context.Context, cfg runtime.ChallengeConfig) (string, error)
+}
+
+type PinChallengeImageInput struct {
+	// Digest pins a known image ID; when empty the image name is resolved
+	// on the Docker nodes.
+	Digest string `json:"digest"`
+}
+
+type ExecInstanceInput struct {
+	Command []string `json:"command"`
 }
 
 type Repository interface {
@@ -184,12 +305,20 @@ type Repository interface {
 	UpdateChallenge(context.Context, Actor, int64, UpsertChallengeInput) (ChallengeSummary, error)
 	ListChallengeAuthors(context.Context, Actor, int64) ([]ChallengeAuthor, error)
 	UpdateChallengeAuthors(context.Context, Actor, int64, []int64) ([]ChallengeAuthor, error)
+	SetChallengeImageDigest(ctx context.Context, challengeID int64, imageName, digest string) error
+	SetChallengeArchivedAt(ctx context.Context, challengeID int64, archivedAt *time.Time) error
+	DeleteChallenge(ctx context.Context, challengeID int64) error
+	CreateChallengeRevision(context.Context, CreateChallengeRevisionInput) (ChallengeRevision, error)
+	ListChallengeRevisions(ctx context.Context, challengeID int64) ([]ChallengeRevision, error)
+	GetChallengeRevision(ctx context.Context, challengeID int64, version int) (ChallengeRevision, error)
+	CountChallengeSolves(ctx context.Context, challengeID int64) (int, error)
 	CreateAttachment(context.Context, Actor, int64, string, string, string, int64) (Attachment, error)
 	GetAttachment(context.Context, int64, int64) (Attachment, string, error)
 	ListUsers(context.Context) ([]UserRecord, error)
 	UpdateUser(context.Context, int64, UpdateUserInput) (UserRecord, error)
 	ListAuditLogs(context.Context) ([]AuditLogRecord, error)
 	CreateAuditLog(context.Context, *int64, string, string, string, map[string]any) error
+	CreateInstanceEvent(ctx context.Context, instanceID int64, eventType, detail string) error
 	ListAnnouncements(context.Context) ([]Announcement, error)
 	CreateAnnouncement(context.Context, int64, CreateAnnouncementInput) (Announcement, error)
 	DeleteAnnouncement(context.Context, int64) (Announcement, error)
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/httpx"
+)
+
+func (s *Server) handleAdminArchiveChallenge(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_archive"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	challenge, err := s.admin.ArchiveChallenge(r.Context(), actor, challengeID)
+	if err != nil {
+		writeChallengeArchiveError(w, "admin.challenge.archive.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"challenge": challenge})
+}
+
+func (s *Server) handleAdminRestoreChallenge(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_restore"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	challenge, err := s.admin.RestoreChallenge(r.Context(), actor, challengeID)
+	if err != nil {
+		writeChallengeArchiveError(w, "admin.challenge.restore.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"challenge": challenge})
+}
+
+// handleAdminDeleteChallenge removes an archived challenge for good. The body
+// has to repeat the challenge slug as confirm_slug.
+func (s *Server) handleAdminDeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_delete"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	var input admin.DeleteChallengeInput
+	if err := decodeJSON(r, &input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	challenge, err := s.admin.DeleteChallenge(r.Context(), actor, challengeID, input)
+	if err != nil {
+		writeChallengeArchiveError(w, "admin.challenge.delete.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"challenge": challenge})
+}
+
+func writeChallengeArchiveError(w http.ResponseWriter, event string, err error) {
+	switch {
+	case errors.Is(err, admin.ErrResourceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
+	case errors.Is(err, admin.ErrChallengeNotArchived):
+		httpx.WriteError(w, http.StatusConflict, "challenge_not_archived", err.Error())
+	case errors.Is(err, admin.ErrConfirmSlugMismatch):
+		httpx.WriteError(w, http.StatusBadRequest, "confirm_slug_mismatch", err.Error())
+	default:
+		logError(event, map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "challenge_update_failed", "failed to update challenge")
+	}
+}
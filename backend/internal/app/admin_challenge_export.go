@@ -0,0 +1,52 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/challengeimport"
+	"ctf/backend/internal/httpx"
+)
+
+// handleAdminExportChallenge downloads a challenge as a zip or tar.gz bundle
+// holding challenge.yaml and its attachments, which import-challenges reads
+// back unchanged. The format query parameter defaults to zip.
+func (s *Server) handleAdminExportChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	format, err := challengeimport.NormalizeBundleFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_export_format", err.Error())
+		return
+	}
+	exported, err := challengeimport.ExportChallenge(r.Context(), s.admin, actor, challengeID)
+	if err != nil {
+		writeChallengeExportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", challengeimport.BundleContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exported.Spec.Meta.Slug+"."+format))
+	w.WriteHeader(http.StatusOK)
+	if err := challengeimport.WriteBundle(w, format, []challengeimport.ExportedChallenge{exported}); err != nil {
+		logError("admin.challenge.export.write_failed", map[string]any{"challenge_id": challengeID, "error": err.Error()})
+		return
+	}
+	s.admin.RecordChallengeExport(r.Context(), actor, challengeID, format)
+}
+
+func writeChallengeExportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, admin.ErrResourceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
+	case errors.Is(err, challengeimport.ErrNotExportable):
+		httpx.WriteError(w, http.StatusConflict, "challenge_not_exportable", err.Error())
+	default:
+		logError("admin.challenge.export.failed", map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "challenge_export_failed", "failed to export challenge")
+	}
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/httpx"
+)
+
+func (s *Server) handleAdminChallengeRevisions(w http.ResponseWriter, r *http.Request) {
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.admin.ChallengeRevisions(r.Context(), actor, challengeID)
+	if err != nil {
+		writeChallengeRevisionError(w, "admin.challenge.revisions.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleAdminDiffChallengeRevisions compares the revisions given by the from
+// and to query parameters.
+func (s *Server) handleAdminDiffChallengeRevisions(w http.ResponseWriter, r *http.Request) {
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	from, fromErr := strconv.Atoi(r.URL.Query().Get("from"))
+	to, toErr := strconv.Atoi(r.URL.Query().Get("to"))
+	if fromErr != nil || toErr != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_revision", "from and to must be revision numbers")
+		return
+	}
+	diff, err := s.admin.DiffChallengeRevisions(r.Context(), actor, challengeID, from, to)
+	if err != nil {
+		writeChallengeRevisionError(w, "admin.challenge.revisions.diff.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, diff)
+}
+
+func (s *Server) handleAdminRollbackChallenge(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_rollback"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_revision", "revision must be numeric")
+		return
+	}
+	change, err := s.admin.RollbackChallenge(r.Context(), actor, challengeID, version)
+	if err != nil {
+		writeChallengeRevisionError(w, "admin.challenge.rollback.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, change)
+}
+
+func writeChallengeRevisionError(w http.ResponseWriter, event string, err error) {
+	switch {
+	case errors.Is(err, admin.ErrResourceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
+	case errors.Is(err, admin.ErrRevisionNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "revision_not_found", err.Error())
+	case admin.IsInvalidChallengeInput(err):
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_challenge_input", err.Error())
+	default:
+		logError(event, map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "challenge_revision_failed", "failed to load or apply challenge revision")
+	}
+}
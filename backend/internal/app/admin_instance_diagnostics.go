@@ -0,0 +1,117 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/httpx"
+	"ctf/backend/internal/runtime"
+)
+
+// maxLogLine bounds a single line of a followed log stream.
+const maxLogLine = 256 << 10
+
+func (s *Server) handleAdminInstanceLogs(w http.ResponseWriter, r *http.Request) {
+	instanceID, err := strconv.ParseInt(r.PathValue("instanceID"), 10, 64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_instance_id", "instance id must be numeric")
+		return
+	}
+	opts := runtime.LogOptions{Tail: runtime.DefaultLogTail}
+	if raw := strings.TrimSpace(r.URL.Query().Get("tail")); raw != "" {
+		tail, err := strconv.Atoi(raw)
+		if err != nil || tail <= 0 || tail > runtime.MaxLogTail {
+			httpx.WriteError(w, http.StatusBadRequest, "invalid_log_tail", fmt.Sprintf("tail must be between 1 and %d", runtime.MaxLogTail))
+			return
+		}
+		opts.Tail = tail
+	}
+	opts.Follow = r.URL.Query().Get("follow") == "true"
+	opts.Timestamps = r.URL.Query().Get("timestamps") == "true"
+
+	logs, err := s.admin.InstanceLogs(r.Context(), instanceID, opts)
+	if err != nil {
+		s.writeInstanceDiagnosticsError(w, "admin.instance.logs.failed", err)
+		return
+	}
+	defer logs.Close()
+
+	if !opts.Follow {
+		body, err := io.ReadAll(logs)
+		if err != nil {
+			logError("admin.instance.logs.failed", map[string]any{"instance_id": instanceID, "error": err.Error()})
+			httpx.WriteError(w, http.StatusBadGateway, "instance_logs_failed", "failed to read instance logs")
+			return
+		}
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"logs": string(body)})
+		return
+	}
+
+	// Follow mode streams one server-sent event per log line until the
+	// container exits or the client goes away.
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_ = controller.Flush()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLogLine)
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "event: log\ndata: %s\n\n", scanner.Text()); err != nil {
+			return
+		}
+		_ = controller.Flush()
+	}
+	if err := scanner.Err(); err != nil && r.Context().Err() == nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	fmt.Fprint(w, "event: end\ndata: \n\n")
+	_ = controller.Flush()
+}
+
+func (s *Server) handleAdminExecInstance(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "instance_exec")
+	if !ok {
+		return
+	}
+	instanceID, err := strconv.ParseInt(r.PathValue("instanceID"), 10, 64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_instance_id", "instance id must be numeric")
+		return
+	}
+	var input admin.ExecInstanceInput
+	if err := decodeJSON(r, &input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	result, err := s.admin.ExecInstance(r.Context(), actorUserID, instanceID, input)
+	if err != nil {
+		s.writeInstanceDiagnosticsError(w, "admin.instance.exec.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) writeInstanceDiagnosticsError(w http.ResponseWriter, event string, err error) {
+	switch {
+	case errors.Is(err, admin.ErrResourceNotFound), errors.Is(err, runtime.ErrInstanceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "instance_not_found", err.Error())
+	case errors.Is(err, admin.ErrInstanceNotRunning):
+		httpx.WriteError(w, http.StatusConflict, "instance_not_running", err.Error())
+	case errors.Is(err, runtime.ErrInvalidExecCommand):
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_exec_command", err.Error())
+	case errors.Is(err, runtime.ErrNodeNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "runtime_node_not_found", err.Error())
+	default:
+		logError(event, map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "runtime_error", "failed to reach the instance container")
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/httpx"
+	"ctf/backend/internal/runtime"
+)
+
+func (s *Server) handleAdminRuntimeImages(w http.ResponseWriter, r *http.Request) {
+	items, err := s.runtime.ImageReadiness(r.Context())
+	if err != nil {
+		s.writeRuntimeImageError(w, "admin.runtime_images.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleAdminPullRuntimeImages pulls the images of every published dynamic
+// challenge onto the Docker nodes, streaming one server-sent event per image
+// and node as pulls finish, then a summary.
+func (s *Server) handleAdminPullRuntimeImages(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "runtime_images_pull")
+	if !ok {
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	started := false
+	writeEvent := func(event string, payload any) {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		_ = controller.Flush()
+	}
+
+	summary, err := s.runtime.PullImages(r.Context(), func(pull runtime.ImagePull) {
+		s.metrics.Inc("ctf_runtime_image_pulls_total", map[string]string{"node": pull.Node, "status": pull.Status})
+		if pull.Error != "" {
+			logWarn("admin.runtime_images.pull_failed", map[string]any{"image": pull.Image, "node": pull.Node, "status": pull.Status, "error": pull.Error})
+		}
+		writeEvent("progress", pull)
+	})
+	if err != nil && !started {
+		s.writeRuntimeImageError(w, "admin.runtime_images.pull.failed", err)
+		return
+	}
+	if err := s.admin.RecordImagePull(r.Context(), actorUserID, summary); err != nil {
+		logWarn("admin.runtime_images.audit_failed", map[string]any{"error": err.Error()})
+	}
+	if err != nil {
+		writeEvent("error", map[string]string{"error": err.Error()})
+	}
+	writeEvent("end", summary)
+}
+
+func (s *Server) handleAdminPinChallengeImage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_image_pin"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	var input admin.PinChallengeImageInput
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &input); err != nil {
+			httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
+			return
+		}
+	}
+	cfg, err := s.admin.PinChallengeImage(r.Context(), actor, challengeID, input)
+	if err != nil {
+		s.writeRuntimeImageError(w, "admin.challenge.image_pin.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"runtime_config": cfg})
+}
+
+func (s *Server) handleAdminUnpinChallengeImage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.allowAdminWrite(w, r, "challenge_image_pin"); !ok {
+		return
+	}
+	challengeID, actor, ok := s.adminChallengeTarget(w, r)
+	if !ok {
+		return
+	}
+	cfg, err := s.admin.UnpinChallengeImage(r.Context(), actor, challengeID)
+	if err != nil {
+		s.writeRuntimeImageError(w, "admin.challenge.image_unpin.failed", err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"runtime_config": cfg})
+}
+
+func (s *Server) writeRuntimeImageError(w http.ResponseWriter, event string, err error) {
+	switch {
+	case errors.Is(err, admin.ErrResourceNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
+	case admin.IsInvalidChallengeInput(err):
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_challenge_input", err.Error())
+	case errors.Is(err, runtime.ErrImageNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "image_not_found", err.Error())
+	case errors.Is(err, runtime.ErrImageDigestConflict):
+		httpx.WriteError(w, http.StatusConflict, "image_digest_conflict", err.Error())
+	case errors.Is(err, runtime.ErrImagesNotSupported), errors.Is(err, runtime.ErrDockerDriverDisabled):
+		httpx.WriteError(w, http.StatusServiceUnavailable, "runtime_driver_disabled", err.Error())
+	default:
+		logError(event, map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "runtime_error", "failed to reach the docker nodes")
+	}
+}
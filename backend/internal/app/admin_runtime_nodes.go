@@ -0,0 +1,49 @@
+package app
+
+import (
+	"net/http"
+
+	"ctf/backend/internal/httpx"
+	"ctf/backend/internal/runtime"
+)
+
+type updateRuntimeNodeInput struct {
+	Draining *bool `json:"draining"`
+}
+
+func (s *Server) handleAdminRuntimeNodes(w http.ResponseWriter, r *http.Request) {
+	items := []runtime.NodeStatus{}
+	if s.nodes != nil {
+		items = s.nodes.Nodes(r.Context())
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleAdminUpdateRuntimeNode(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "runtime_node_update")
+	if !ok {
+		return
+	}
+	var input updateRuntimeNodeInput
+	if err := decodeJSON(r, &input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	if input.Draining == nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_runtime_node", "draining is required")
+		return
+	}
+	if s.nodes == nil {
+		s.writeRuntimeError(w, runtime.ErrNodeNotFound)
+		return
+	}
+	node, err := s.nodes.SetDraining(r.PathValue("node"), *input.Draining)
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	if err := s.admin.RecordNodeDrain(r.Context(), actorUserID, node.Name, node.Draining); err != nil {
+		logWarn("admin.runtime_node.audit_failed", map[string]any{"node": node.Name, "error": err.Error()})
+	}
+	httpx.WriteJSON(w, http.StatusOK, node)
+}
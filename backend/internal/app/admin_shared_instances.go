@@ -0,0 +1,68 @@
+package app
+
+import (
+	"net/http"
+
+	"ctf/backend/internal/runtime"
+)
+
+func (s *Server) handleAdminGetSharedInstance(w http.ResponseWriter, r *http.Request) {
+	instance, err := s.runtime.SharedInstance(r.Context(), r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	writeInstanceResponse(w, http.StatusOK, instance)
+}
+
+func (s *Server) handleAdminStartSharedInstance(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "shared_instance_start")
+	if !ok {
+		return
+	}
+	instance, created, err := s.runtime.StartSharedInstance(r.Context(), r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		s.recordSharedInstanceAction(r, actorUserID, "instance.shared_start", instance)
+	}
+	writeInstanceResponse(w, status, instance)
+}
+
+func (s *Server) handleAdminStopSharedInstance(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "shared_instance_stop")
+	if !ok {
+		return
+	}
+	instance, err := s.runtime.StopSharedInstance(r.Context(), r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	s.recordSharedInstanceAction(r, actorUserID, "instance.shared_stop", instance)
+	writeInstanceResponse(w, http.StatusOK, instance)
+}
+
+func (s *Server) handleAdminRestartSharedInstance(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := s.allowAdminWrite(w, r, "shared_instance_restart")
+	if !ok {
+		return
+	}
+	instance, err := s.runtime.RestartSharedInstance(r.Context(), r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	s.recordSharedInstanceAction(r, actorUserID, "instance.shared_restart", instance)
+	writeInstanceResponse(w, http.StatusOK, instance)
+}
+
+func (s *Server) recordSharedInstanceAction(r *http.Request, actorUserID int64, action string, instance runtime.Instance) {
+	if err := s.admin.RecordSharedInstanceAction(r.Context(), actorUserID, action, instance); err != nil {
+		logWarn("admin.shared_instance.audit_failed", map[string]any{"action": action, "challenge_id": instance.ChallengeID, "error": err.Error()})
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ctf/backend/internal/httpx"
+	"ctf/backend/internal/runtime"
+)
+
+func (s *Server) handleInstanceEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.requireContestPhase(w, r, contestRequirement{runtimeAllowed: true}); !ok {
+		return
+	}
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return
+	}
+	items, err := s.runtime.PlayerInstanceEvents(r.Context(), userID, r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleAdminInstanceEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseInstanceEventFilter(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_event_filter", err.Error())
+		return
+	}
+	items, err := s.runtime.InstanceEvents(r.Context(), filter)
+	if err != nil {
+		logError("admin.instance_events.list.failed", map[string]any{"error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "repository_error", "failed to load instance events")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func parseInstanceEventFilter(r *http.Request) (runtime.InstanceEventFilter, error) {
+	query := r.URL.Query()
+	filter := runtime.InstanceEventFilter{Limit: runtime.DefaultEventLimit}
+
+	ids := map[string]*int64{"instance_id": &filter.InstanceID, "user_id": &filter.UserID}
+	for name, target := range ids {
+		raw := strings.TrimSpace(query.Get(name))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value <= 0 {
+			return filter, fmt.Errorf("%s must be a positive integer", name)
+		}
+		*target = value
+	}
+	if raw := strings.TrimSpace(query.Get("challenge_id")); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err != nil || value <= 0 {
+			return filter, fmt.Errorf("challenge_id must be a positive integer")
+		}
+		filter.ChallengeID = raw
+	}
+	if raw := strings.TrimSpace(query.Get("type")); raw != "" {
+		if !runtime.KnownEventType(raw) {
+			return filter, fmt.Errorf("unknown event type %q", raw)
+		}
+		filter.Type = raw
+	}
+
+	times := map[string]*time.Time{"since": &filter.Since, "until": &filter.Until}
+	for name, target := range times {
+		raw := strings.TrimSpace(query.Get(name))
+		if raw == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+		}
+		*target = value.UTC()
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Until.After(filter.Since) {
+		return filter, fmt.Errorf("until must be after since")
+	}
+
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > runtime.MaxEventLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", runtime.MaxEventLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"ctf/backend/internal/runtime"
+)
+
+// runStatsSampler samples instance resource usage every interval and exports
+// the per-node totals as gauges.
+func (s *Server) runStatsSampler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logInfo("instance_stats.started", map[string]any{"interval": interval.String()})
+	reported := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.runtime.SampleStats(ctx)
+			if err != nil {
+				logError("instance_stats.error", map[string]any{"error": err.Error()})
+				continue
+			}
+			if report.Failed > 0 {
+				logWarn("instance_stats.sample_failed", map[string]any{"count": report.Failed})
+			}
+			if report.Killed > 0 {
+				logWarn("instance_stats.killed", map[string]any{"count": report.Killed})
+				s.metrics.Add("ctf_instance_resource_kills_total", float64(report.Killed), nil)
+			}
+			// Nodes without running instances report zero rather than
+			// their last totals.
+			for node := range reported {
+				if _, ok := report.Nodes[node]; !ok {
+					s.recordNodeStats(node, 0, runtime.ContainerStats{})
+					delete(reported, node)
+				}
+			}
+			for node, totals := range report.Nodes {
+				s.recordNodeStats(node, report.Instances[node], totals)
+				reported[node] = true
+			}
+		}
+	}
+}
+
+func (s *Server) recordNodeStats(node string, instances int, totals runtime.ContainerStats) {
+	labels := map[string]string{"node": node}
+	s.metrics.Set("ctf_runtime_instances_sampled", float64(instances), labels)
+	s.metrics.Set("ctf_runtime_cpu_percent", totals.CPUPercent, labels)
+	s.metrics.Set("ctf_runtime_memory_bytes", float64(totals.MemoryBytes), labels)
+	s.metrics.Set("ctf_runtime_network_rx_bytes", float64(totals.NetworkRxBytes), labels)
+	s.metrics.Set("ctf_runtime_network_tx_bytes", float64(totals.NetworkTxBytes), labels)
+	s.metrics.Set("ctf_runtime_pids", float64(totals.PIDs), labels)
+}
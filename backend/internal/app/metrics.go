@@ -35,6 +35,16 @@ func (m *metricsRegistry) Add(name string, value float64, labels map[string]stri
 	m.counters[metricKey(name, labels)] += value
 }
 
+// Set records the current value of a gauge.
+func (m *metricsRegistry) Set(name string, value float64, labels map[string]string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[metricKey(name, labels)] = value
+}
+
 func (m *metricsRegistry) snapshot() []string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
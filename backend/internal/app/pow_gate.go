@@ -0,0 +1,90 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"ctf/backend/internal/auth"
+	"ctf/backend/internal/config"
+)
+
+type powGate struct {
+	pow          *auth.ProofOfWork
+	mu           sync.Mutex
+	now          func() time.Time
+	base         int
+	max          int
+	window       time.Duration
+	hitsPerLevel int
+	hits         map[string][]time.Time
+}
+
+type powSolution struct {
+	PowChallenge string `json:"pow_challenge"`
+	PowNonce     string `json:"pow_nonce"`
+}
+
+func newPowGate(cfg config.Config) *powGate {
+	if !cfg.PowEnabled {
+		return nil
+	}
+	return &powGate{
+		pow:          auth.NewProofOfWork(cfg.PowSigningSecret(), cfg.PowChallengeTTL),
+		now:          time.Now,
+		base:         cfg.PowBaseDifficulty,
+		max:          cfg.PowMaxDifficulty,
+		window:       time.Duration(cfg.PowEscalationWindowSeconds) * time.Second,
+		hitsPerLevel: cfg.PowEscalationHitsPerLevel,
+		hits:         make(map[string][]time.Time),
+	}
+}
+
+func (g *powGate) Enabled() bool {
+	return g != nil
+}
+
+func (g *powGate) Issue(scope string) (auth.PowChallenge, error) {
+	return g.pow.Issue(scope, g.Difficulty(scope))
+}
+
+func (g *powGate) Verify(scope string, solution powSolution) error {
+	if g == nil {
+		return nil
+	}
+	return g.pow.Verify(scope, solution.PowChallenge, solution.PowNonce)
+}
+
+func (g *powGate) Difficulty(scope string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	difficulty := g.base
+	if g.hitsPerLevel > 0 {
+		difficulty += len(g.recentHits(scope)) / g.hitsPerLevel
+	}
+	if difficulty > g.max {
+		return g.max
+	}
+	return difficulty
+}
+
+func (g *powGate) RecordHit(scope string) {
+	if g == nil || g.window <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.hits[scope] = append(g.recentHits(scope), g.now().UTC())
+}
+
+func (g *powGate) recentHits(scope string) []time.Time {
+	cutoff := g.now().UTC().Add(-g.window)
+	hits := g.hits[scope]
+	index := 0
+	for index < len(hits) && !hits[index].After(cutoff) {
+		index++
+	}
+	hits = hits[index:]
+	g.hits[scope] = hits
+	return hits
+}
@@ -34,7 +34,9 @@ type Server struct {
 	contest  *contest.Service
 	game     *game.Service
 	runtime  *runtime.Service
+	nodes    *runtime.NodePool
 	limiters AppLimiters
+	pow      *powGate
 	metrics  *metricsRegistry
 	db       *sql.DB
 }
@@ -55,24 +57,99 @@ func NewServer(cfg config.Config) (*Server, error) {
 	gameRepo := store.NewGameRepository(db)
 	runtimeRepo := store.NewRuntimeRepository(db)
 	tokens := auth.NewTokenManager(cfg.JWTSecret, cfg.JWTTTL)
-	manager := runtime.NewDockerManager(cfg.DockerSocketPath)
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	nodes := []runtime.DockerNode{{Name: runtime.DefaultNodeName, Host: "unix://" + cfg.DockerSocketPath}}
+	if cfg.RuntimeDockerNodesFile != "" {
+		if nodes, err = runtime.LoadDockerNodes(cfg.RuntimeDockerNodesFile); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	manager, err := runtime.NewNodePool(nodes, runtime.DockerManagerConfig{
+		AttachContainer:   cfg.RuntimeNetworkAttachContainer,
+		SeccompProfileDir: cfg.RuntimeSeccompProfileDir,
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	processManager, err := runtime.NewProcessManager(runtime.ProcessManagerConfig{
+		Root:      cfg.RuntimeProcessRoot,
+		UID:       cfg.RuntimeProcessUID,
+		GID:       cfg.RuntimeProcessGID,
+		Chroot:    cfg.RuntimeProcessChroot,
+		CgroupDir: cfg.RuntimeProcessCgroup,
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	drivers := runtime.NewDrivers(manager, processManager)
 	limiters := newAppLimiters(cfg)
 	metrics := newMetricsRegistry()
 
+	runtimeService := runtime.NewService(runtime.ServiceConfig{
+		PublicBaseURL:  cfg.PublicBaseURL,
+		RuntimeBaseURL: cfg.RuntimePublicBaseURL,
+		BindAddr:       cfg.RuntimeBindAddr,
+		PortMin:        cfg.RuntimePortMin,
+		PortMax:        cfg.RuntimePortMax,
+		Isolation:      cfg.RuntimeNetworkIsolation,
+		Proxy: runtime.ProxyConfig{
+			Domain:              cfg.RuntimeProxyDomain,
+			Scheme:              cfg.RuntimeProxyScheme,
+			Secret:              cfg.RuntimeProxySigningSecret(),
+			Network:             cfg.RuntimeProxyNetwork,
+			RequireAccessCookie: cfg.RuntimeProxyRequireAccessCookie,
+		},
+		Gateway: runtime.GatewayConfig{
+			Addr:                cfg.RuntimeGatewayAddr,
+			PublicAddr:          cfg.RuntimeGatewayPublicAddr,
+			Network:             cfg.RuntimeGatewayNetwork,
+			UpstreamHost:        cfg.RuntimeGatewayUpstreamHost,
+			TLSAddr:             cfg.RuntimeGatewayTLSAddr,
+			TLSPublicAddr:       cfg.RuntimeGatewayTLSPublicAddr,
+			TLSDomain:           cfg.RuntimeGatewayTLSDomain,
+			TLSCertFile:         cfg.RuntimeGatewayTLSCertFile,
+			TLSKeyFile:          cfg.RuntimeGatewayTLSKeyFile,
+			MaxConnsPerInstance: cfg.RuntimeGatewayMaxConns,
+			IdleTimeout:         cfg.RuntimeGatewayIdleTimeout,
+		},
+		StartWorkers:   cfg.RuntimeStartWorkers,
+		StartQueueSize: cfg.RuntimeStartQueueSize,
+		NodeAddresses:  runtime.NodeAddresses(nodes),
+		StatsLimits: runtime.StatsLimits{
+			CPUPercent:    float64(cfg.RuntimeKillCPUPercent),
+			MemoryPercent: float64(cfg.RuntimeKillMemoryPercent),
+			PIDs:          cfg.RuntimeKillPIDs,
+			Sustain:       cfg.RuntimeKillSustain,
+		},
+		Idle: runtime.IdlePolicy{
+			Timeout: cfg.RuntimeIdleTimeout,
+			Warning: cfg.RuntimeIdleWarning,
+		},
+		Quotas: runtime.Quotas{
+			UserInstances:   cfg.RuntimeUserMaxInstances,
+			UserMemoryMB:    cfg.RuntimeUserMaxMemoryMB,
+			GlobalInstances: cfg.RuntimeMaxInstances,
+			GlobalMemoryMB:  cfg.RuntimeMaxMemoryMB,
+		},
+	}, drivers, runtimeRepo)
+
 	return &Server{
-		cfg:     cfg,
-		admin:   admin.NewServiceWithManager(adminRepo, cfg.AttachmentStorageDir, manager),
-		auth:    auth.NewService(userRepo, tokens),
-		contest: contest.NewService(contestRepo),
-		game:    game.NewService(gameRepo),
-		runtime: runtime.NewService(runtime.ServiceConfig{
-			PublicBaseURL:  cfg.PublicBaseURL,
-			RuntimeBaseURL: cfg.RuntimePublicBaseURL,
-			BindAddr:       cfg.RuntimeBindAddr,
-			PortMin:        cfg.RuntimePortMin,
-			PortMax:        cfg.RuntimePortMax,
-		}, manager, runtimeRepo),
+		cfg:      cfg,
+		admin:    admin.NewServiceWithRuntime(adminRepo, cfg.AttachmentStorageDir, drivers, runtimeService),
+		auth:     auth.NewServiceWithPolicy(userRepo, tokens, passwordPolicy),
+		contest:  contest.NewService(contestRepo),
+		game:     game.NewService(gameRepo),
+		runtime:  runtimeService,
+		nodes:    manager,
 		limiters: limiters,
+		pow:      newPowGate(cfg),
 		metrics:  metrics,
 		db:       db,
 	}, nil
@@ -87,6 +164,7 @@ func NewServerForTests(cfg config.Config, adminService *admin.Service, authServi
 		game:     gameService,
 		runtime:  runtimeService,
 		limiters: newAppLimiters(cfg),
+		pow:      newPowGate(cfg),
 		metrics:  newMetricsRegistry(),
 	}
 }
@@ -104,6 +182,7 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("GET /api/v1/ready", s.handleReady)
 	mux.Handle("GET /api/v1/metrics", s.metrics)
 	mux.HandleFunc("GET /api/v1/contest", s.handleContest)
+	mux.HandleFunc("GET /api/v1/auth/pow-challenge", s.handlePowChallenge)
 	mux.HandleFunc("POST /api/v1/auth/register", s.handleRegister)
 	mux.HandleFunc("POST /api/v1/auth/login", s.handleLogin)
 	mux.Handle("GET /api/v1/me", s.authenticated(http.HandlerFunc(s.handleMe)))
@@ -118,6 +197,8 @@ func (s *Server) Handler() http.Handler {
 	mux.Handle("GET /api/v1/challenges/{challengeID}/instances/me", s.authenticated(http.HandlerFunc(s.handleGetInstance)))
 	mux.Handle("DELETE /api/v1/challenges/{challengeID}/instances/me", s.authenticated(http.HandlerFunc(s.handleDeleteInstance)))
 	mux.Handle("POST /api/v1/challenges/{challengeID}/instances/me/renew", s.authenticated(http.HandlerFunc(s.handleRenewInstance)))
+	mux.Handle("POST /api/v1/challenges/{challengeID}/instances/me/restart", s.authenticated(http.HandlerFunc(s.handleRestartInstance)))
+	mux.Handle("GET /api/v1/challenges/{challengeID}/instances/me/events", s.authenticated(http.HandlerFunc(s.handleInstanceEvents)))
 	mux.Handle("POST /api/v1/challenges/{challengeID}/submissions", s.authenticated(http.HandlerFunc(s.handleSubmitFlag)))
 	mux.Handle("GET /api/v1/admin/contest", s.requirePermission("contest:read", http.HandlerFunc(s.handleAdminContest)))
 	mux.Handle("PATCH /api/v1/admin/contest", s.requirePermission("contest:write", http.HandlerFunc(s.handleAdminUpdateContest)))
@@ -125,6 +206,13 @@ func (s *Server) Handler() http.Handler {
 	mux.Handle("POST /api/v1/admin/challenges", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminCreateChallenge)))
 	mux.Handle("GET /api/v1/admin/challenges/{challengeID}", s.requirePermission("challenge:read", http.HandlerFunc(s.handleAdminChallengeDetail)))
 	mux.Handle("PATCH /api/v1/admin/challenges/{challengeID}", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminUpdateChallenge)))
+	mux.Handle("DELETE /api/v1/admin/challenges/{challengeID}", s.requirePermission("challenge:delete", http.HandlerFunc(s.handleAdminDeleteChallenge)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/archive", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminArchiveChallenge)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/restore", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminRestoreChallenge)))
+	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/revisions", s.requirePermission("challenge:read", http.HandlerFunc(s.handleAdminChallengeRevisions)))
+	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/revisions/diff", s.requirePermission("challenge:read", http.HandlerFunc(s.handleAdminDiffChallengeRevisions)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/revisions/{version}/rollback", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminRollbackChallenge)))
+	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/export", s.requirePermission("challenge:read", http.HandlerFunc(s.handleAdminExportChallenge)))
 	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/authors", s.requirePermission("challenge:read", http.HandlerFunc(s.handleAdminChallengeAuthors)))
 	mux.Handle("PUT /api/v1/admin/challenges/{challengeID}/authors", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminUpdateChallengeAuthors)))
 	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/attachments", s.requirePermission("attachment:write", http.HandlerFunc(s.handleAdminCreateAttachment)))
@@ -135,16 +223,48 @@ func (s *Server) Handler() http.Handler {
 	mux.Handle("GET /api/v1/admin/submissions", s.requirePermission("submission:read", http.HandlerFunc(s.handleAdminSubmissions)))
 	mux.Handle("GET /api/v1/admin/instances", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminInstances)))
 	mux.Handle("POST /api/v1/admin/instances/{instanceID}/terminate", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminTerminateInstance)))
+	mux.Handle("GET /api/v1/admin/instances/{instanceID}/logs", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminInstanceLogs)))
+	mux.Handle("POST /api/v1/admin/instances/{instanceID}/exec", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminExecInstance)))
+	mux.Handle("GET /api/v1/admin/instance-events", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminInstanceEvents)))
+	mux.Handle("GET /api/v1/admin/runtime/nodes", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminRuntimeNodes)))
+	mux.Handle("PATCH /api/v1/admin/runtime/nodes/{node}", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminUpdateRuntimeNode)))
+	mux.Handle("GET /api/v1/admin/runtime/images", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminRuntimeImages)))
+	mux.Handle("POST /api/v1/admin/runtime/images/pull", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminPullRuntimeImages)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/image-pin", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminPinChallengeImage)))
+	mux.Handle("DELETE /api/v1/admin/challenges/{challengeID}/image-pin", s.requirePermission("challenge:write", http.HandlerFunc(s.handleAdminUnpinChallengeImage)))
+	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/shared-instance", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminGetSharedInstance)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/shared-instance", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminStartSharedInstance)))
+	mux.Handle("DELETE /api/v1/admin/challenges/{challengeID}/shared-instance", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminStopSharedInstance)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/shared-instance/restart", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminRestartSharedInstance)))
 	mux.Handle("GET /api/v1/admin/users", s.requirePermission("user:read", http.HandlerFunc(s.handleAdminUsers)))
 	mux.Handle("PATCH /api/v1/admin/users/{userID}", s.requirePermission("user:write", http.HandlerFunc(s.handleAdminUpdateUser)))
+	mux.Handle("POST /api/v1/admin/users/{userID}/password", s.requirePermission("user:write", http.HandlerFunc(s.handleAdminResetUserPassword)))
 	mux.Handle("GET /api/v1/admin/audit-logs", s.requirePermission("audit:read", http.HandlerFunc(s.handleAdminAuditLogs)))
 	mux.Handle("POST /api/v1/admin/challenges/import", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminImportChallenges)))
 	mux.Handle("POST /api/v1/admin/challenges/build-image", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminBuildChallengeImage)))
 	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/instances/me", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminCreateMyInstance)))
 	mux.Handle("GET /api/v1/admin/challenges/{challengeID}/instances/me", s.requirePermission("instance:read", http.HandlerFunc(s.handleAdminGetMyInstance)))
 	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/instances/me/renew", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminRenewMyInstance)))
+	mux.Handle("POST /api/v1/admin/challenges/{challengeID}/instances/me/restart", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminRestartMyInstance)))
 	mux.Handle("DELETE /api/v1/admin/challenges/{challengeID}/instances/me", s.requirePermission("instance:write", http.HandlerFunc(s.handleAdminDeleteMyInstance)))
-	return loggingMiddleware(s.metrics, mux)
+	return loggingMiddleware(s.metrics, s.routeInstanceProxy(mux))
+}
+
+// routeInstanceProxy sends requests for instance subdomains to the runtime
+// proxy and everything else to the API mux.
+func (s *Server) routeInstanceProxy(next http.Handler) http.Handler {
+	proxy := s.runtime.Proxy()
+	if !proxy.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := proxy.ProxyIDFromHost(r.Host); ok {
+			s.metrics.Inc("ctf_instance_proxy_requests_total", nil)
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) StartBackground(ctx context.Context) {
@@ -158,10 +278,26 @@ func (s *Server) StartBackground(ctx context.Context) {
 	defer ticker.Stop()
 
 	logInfo("instance_sweeper.started", map[string]any{"interval": interval.String()})
+	if gateway := s.runtime.Gateway(); gateway.Enabled() {
+		go func() {
+			logInfo("tcp_gateway.started", map[string]any{"addr": s.cfg.RuntimeGatewayAddr, "tls_addr": s.cfg.RuntimeGatewayTLSAddr})
+			if err := gateway.Serve(ctx); err != nil {
+				logError("tcp_gateway.error", map[string]any{"error": err.Error()})
+			}
+		}()
+	}
+	go s.runtime.RunStartWorkers(ctx)
+	go s.runtime.WatchContainerEvents(ctx, func(node string, err error) {
+		logWarn("runtime_events.error", map[string]any{"node": node, "error": err.Error()})
+		s.metrics.Inc("ctf_runtime_event_errors_total", map[string]string{"node": node})
+	})
+	if s.cfg.RuntimeStatsInterval > 0 {
+		go s.runStatsSampler(ctx, s.cfg.RuntimeStatsInterval)
+	}
 	if report, err := s.runtime.Reconcile(ctx); err != nil {
 		logError("instance_reconcile.error", map[string]any{"error": err.Error()})
-	} else if report.TerminatedRecords > 0 || report.RemovedContainers > 0 {
-		logInfo("instance_reconcile.corrected", map[string]any{"terminated_records": report.TerminatedRecords, "removed_containers": report.RemovedContainers})
+	} else if report.TerminatedRecords > 0 || report.RemovedContainers > 0 || report.RestartedShared > 0 || report.RemovedNetworks > 0 {
+		logInfo("instance_reconcile.corrected", map[string]any{"terminated_records": report.TerminatedRecords, "removed_containers": report.RemovedContainers, "restarted_shared": report.RestartedShared, "removed_networks": report.RemovedNetworks})
 	}
 
 	for {
@@ -179,13 +315,21 @@ func (s *Server) StartBackground(ctx context.Context) {
 				logInfo("instance_sweeper.terminated", map[string]any{"count": terminated})
 			}
 
+			reclaimed, err := s.runtime.ReclaimIdle(ctx)
+			if err != nil {
+				logError("instance_idle.error", map[string]any{"error": err.Error()})
+			} else if reclaimed > 0 {
+				logInfo("instance_idle.reclaimed", map[string]any{"count": reclaimed})
+				s.metrics.Add("ctf_instance_idle_reclaims_total", float64(reclaimed), nil)
+			}
+
 			report, err := s.runtime.Reconcile(ctx)
 			if err != nil {
 				logError("instance_reconcile.error", map[string]any{"error": err.Error()})
 				continue
 			}
-			if report.TerminatedRecords > 0 || report.RemovedContainers > 0 {
-				logInfo("instance_reconcile.corrected", map[string]any{"terminated_records": report.TerminatedRecords, "removed_containers": report.RemovedContainers})
+			if report.TerminatedRecords > 0 || report.RemovedContainers > 0 || report.RestartedShared > 0 {
+				logInfo("instance_reconcile.corrected", map[string]any{"terminated_records": report.TerminatedRecords, "removed_containers": report.RemovedContainers, "restarted_shared": report.RestartedShared})
 			}
 		}
 	}
@@ -233,6 +377,7 @@ func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
 		"submission_rate_limit_max":             s.cfg.SubmissionRateLimitMax,
 		"admin_write_rate_limit_window_seconds": s.cfg.AdminWriteRateLimitWindowSeconds,
 		"admin_write_rate_limit_max":            s.cfg.AdminWriteRateLimitMax,
+		"pow_enabled":                           s.pow.Enabled(),
 	})
 }
 
@@ -242,7 +387,10 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_ = phase
-	var input auth.RegisterInput
+	var input struct {
+		auth.RegisterInput
+		powSolution
+	}
 	if err := decodeJSON(r, &input); err != nil {
 		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
 		return
@@ -256,12 +404,19 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	if !allowed {
 		s.metrics.Inc("ctf_rate_limit_hits_total", map[string]string{"scope": "register"})
+		s.pow.RecordHit("register")
 		httpx.WriteError(w, http.StatusTooManyRequests, "register_rate_limited", "too many registration attempts, please try again later")
 		return
 	}
+	if !s.verifyPow(w, "register", input.powSolution) {
+		return
+	}
 
-	result, err := s.auth.Register(r.Context(), input)
+	result, err := s.auth.Register(r.Context(), input.RegisterInput)
 	if err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
 		logWarn("auth.register.failed", map[string]any{"error": err.Error()})
 		httpx.WriteError(w, http.StatusBadRequest, "register_failed", "failed to register user")
 		return
@@ -270,7 +425,10 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
-	var input auth.LoginInput
+	var input struct {
+		auth.LoginInput
+		powSolution
+	}
 	if err := decodeJSON(r, &input); err != nil {
 		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
 		return
@@ -284,11 +442,15 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	if !allowed {
 		s.metrics.Inc("ctf_rate_limit_hits_total", map[string]string{"scope": "login"})
+		s.pow.RecordHit("login")
 		httpx.WriteError(w, http.StatusTooManyRequests, "login_rate_limited", "too many login attempts, please try again later")
 		return
 	}
+	if !s.verifyPow(w, "login", input.powSolution) {
+		return
+	}
 
-	result, err := s.auth.Login(r.Context(), input)
+	result, err := s.auth.Login(r.Context(), input.LoginInput)
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			httpx.WriteError(w, http.StatusUnauthorized, "invalid_credentials", err.Error())
@@ -301,6 +463,51 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	writeAuthResponse(w, http.StatusOK, result)
 }
 
+func (s *Server) handlePowChallenge(w http.ResponseWriter, r *http.Request) {
+	if !s.pow.Enabled() {
+		httpx.WriteJSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+	scope := strings.TrimSpace(r.URL.Query().Get("scope"))
+	if scope != "register" && scope != "login" {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_pow_scope", "scope must be register or login")
+		return
+	}
+	challenge, err := s.pow.Issue(scope)
+	if err != nil {
+		logError("auth.pow.issue.failed", map[string]any{"scope": scope, "error": err.Error()})
+		httpx.WriteError(w, http.StatusInternalServerError, "pow_issue_failed", "failed to issue proof of work challenge")
+		return
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"enabled":    true,
+		"challenge":  challenge.Challenge,
+		"algorithm":  challenge.Algorithm,
+		"scope":      challenge.Scope,
+		"difficulty": challenge.Difficulty,
+		"expires_at": challenge.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) verifyPow(w http.ResponseWriter, scope string, solution powSolution) bool {
+	err := s.pow.Verify(scope, solution)
+	if err == nil {
+		return true
+	}
+	s.metrics.Inc("ctf_pow_rejections_total", map[string]string{"scope": scope})
+	switch {
+	case errors.Is(err, auth.ErrPowRequired):
+		httpx.WriteError(w, http.StatusForbidden, "pow_required", err.Error())
+	case errors.Is(err, auth.ErrPowExpired):
+		httpx.WriteError(w, http.StatusForbidden, "pow_expired", err.Error())
+	case errors.Is(err, auth.ErrPowReused):
+		httpx.WriteError(w, http.StatusForbidden, "pow_reused", err.Error())
+	default:
+		httpx.WriteError(w, http.StatusForbidden, "pow_invalid", err.Error())
+	}
+	return false
+}
+
 func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
 	userID, ok := userIDFromContext(r.Context())
 	if !ok {
@@ -474,11 +681,7 @@ func (s *Server) handleCreateInstance(w http.ResponseWriter, r *http.Request) {
 		s.writeRuntimeError(w, err)
 		return
 	}
-	status := http.StatusCreated
-	if !created {
-		status = http.StatusOK
-	}
-	writeInstanceResponse(w, status, instance)
+	writeInstanceResponse(w, startInstanceStatus(instance, created), instance)
 }
 
 func (s *Server) handleGetInstance(w http.ResponseWriter, r *http.Request) {
@@ -495,7 +698,14 @@ func (s *Server) handleGetInstance(w http.ResponseWriter, r *http.Request) {
 		s.writeRuntimeError(w, err)
 		return
 	}
-	writeInstanceResponse(w, http.StatusOK, instance)
+	events, err := s.runtime.PlayerInstanceEvents(r.Context(), userID, r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	body := instanceResponse(instance)
+	body["events"] = events[:min(len(events), instanceResponseEvents)]
+	httpx.WriteJSON(w, http.StatusOK, body)
 }
 
 func (s *Server) handleDeleteInstance(w http.ResponseWriter, r *http.Request) {
@@ -532,6 +742,32 @@ func (s *Server) handleRenewInstance(w http.ResponseWriter, r *http.Request) {
 	writeInstanceResponse(w, http.StatusOK, instance)
 }
 
+func (s *Server) handleRestartInstance(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.requireContestPhase(w, r, contestRequirement{runtimeAllowed: true}); !ok {
+		return
+	}
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return
+	}
+	s.restartInstance(w, r, userID)
+}
+
+// restartInstance recreates the caller's container and records the restart
+// in the audit log.
+func (s *Server) restartInstance(w http.ResponseWriter, r *http.Request, userID int64) {
+	instance, err := s.runtime.RestartInstance(r.Context(), userID, r.PathValue("challengeID"))
+	if err != nil {
+		s.writeRuntimeError(w, err)
+		return
+	}
+	if err := s.admin.RecordInstanceRestart(r.Context(), userID, instance); err != nil {
+		logWarn("runtime.instance_restart.audit_failed", map[string]any{"challenge_id": instance.ChallengeID, "user_id": userID, "error": err.Error()})
+	}
+	writeInstanceResponse(w, http.StatusOK, instance)
+}
+
 func (s *Server) handleSubmitFlag(w http.ResponseWriter, r *http.Request) {
 	if _, ok := s.requireContestPhase(w, r, contestRequirement{submissionAllowed: true}); !ok {
 		return
@@ -693,7 +929,7 @@ func (s *Server) handleAdminUpdateChallenge(w http.ResponseWriter, r *http.Reque
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
 		return
 	}
-	challenge, err := s.admin.UpdateChallenge(r.Context(), actor, challengeID, input)
+	change, err := s.admin.UpdateChallenge(r.Context(), actor, challengeID, input)
 	if err != nil {
 		if errors.Is(err, admin.ErrResourceNotFound) {
 			httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
@@ -707,7 +943,7 @@ func (s *Server) handleAdminUpdateChallenge(w http.ResponseWriter, r *http.Reque
 		httpx.WriteError(w, http.StatusBadGateway, "update_failed", "failed to update challenge")
 		return
 	}
-	httpx.WriteJSON(w, http.StatusOK, map[string]any{"challenge": challenge})
+	httpx.WriteJSON(w, http.StatusOK, change)
 }
 
 func (s *Server) handleAdminChallengeAuthors(w http.ResponseWriter, r *http.Request) {
@@ -1023,6 +1259,12 @@ func (s *Server) handleAdminInstances(w http.ResponseWriter, r *http.Request) {
 		httpx.WriteError(w, http.StatusBadGateway, "repository_error", "failed to load instances")
 		return
 	}
+	stats := s.runtime.InstanceStats()
+	for i := range items {
+		if sample, ok := stats[items[i].ID]; ok {
+			items[i].Stats = &sample
+		}
+	}
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
 }
 
@@ -1113,6 +1355,53 @@ func (s *Server) handleAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"user": user})
 }
 
+func (s *Server) handleAdminResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	actorUserID, ok := userIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return
+	}
+	allowed, err := enforceRateLimit(r.Context(), s.limiters.AdminWrite, adminRateLimitKey("user_password_reset", r, actorUserID))
+	if err != nil {
+		s.metrics.Inc("ctf_rate_limit_errors_total", map[string]string{"scope": "admin_write"})
+		logError("rate_limit.admin_write.error", map[string]any{"action": "user_password_reset", "error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "rate_limit_error", "failed to enforce rate limit")
+		return
+	}
+	if !allowed {
+		s.metrics.Inc("ctf_rate_limit_hits_total", map[string]string{"scope": "admin_write"})
+		httpx.WriteError(w, http.StatusTooManyRequests, "admin_rate_limited", "too many admin write requests, please try again later")
+		return
+	}
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_user_id", "user id must be numeric")
+		return
+	}
+	var input admin.ResetUserPasswordInput
+	if err := decodeJSON(r, &input); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	user, err := s.auth.ResetPassword(r.Context(), userID, input.Password)
+	if err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		if errors.Is(err, runtime.ErrRepositoryNotFound) {
+			httpx.WriteError(w, http.StatusNotFound, "user_not_found", "user not found")
+			return
+		}
+		logError("admin.user.password_reset.failed", map[string]any{"user_id": userID, "error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "password_reset_failed", "failed to reset password")
+		return
+	}
+	if err := s.admin.RecordUserPasswordReset(r.Context(), actorUserID, userID, user.Username); err != nil {
+		logWarn("admin.user.password_reset.audit_failed", map[string]any{"user_id": userID, "error": err.Error()})
+	}
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"user": user})
+}
+
 func (s *Server) handleAdminAuditLogs(w http.ResponseWriter, r *http.Request) {
 	items, err := s.admin.AuditLogs(r.Context())
 	if err != nil {
@@ -1134,11 +1423,7 @@ func (s *Server) handleAdminCreateMyInstance(w http.ResponseWriter, r *http.Requ
 		s.writeRuntimeError(w, err)
 		return
 	}
-	status := http.StatusCreated
-	if !created {
-		status = http.StatusOK
-	}
-	writeInstanceResponse(w, status, instance)
+	writeInstanceResponse(w, startInstanceStatus(instance, created), instance)
 }
 
 func (s *Server) handleAdminGetMyInstance(w http.ResponseWriter, r *http.Request) {
@@ -1169,6 +1454,15 @@ func (s *Server) handleAdminRenewMyInstance(w http.ResponseWriter, r *http.Reque
 	writeInstanceResponse(w, http.StatusOK, instance)
 }
 
+func (s *Server) handleAdminRestartMyInstance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return
+	}
+	s.restartInstance(w, r, userID)
+}
+
 func (s *Server) handleAdminDeleteMyInstance(w http.ResponseWriter, r *http.Request) {
 	userID, ok := userIDFromContext(r.Context())
 	if !ok {
@@ -1184,6 +1478,9 @@ func (s *Server) handleAdminDeleteMyInstance(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *Server) writeRuntimeError(w http.ResponseWriter, err error) {
+	if s.writeQuotaError(w, err) {
+		return
+	}
 	switch {
 	case errors.Is(err, runtime.ErrChallengeNotFound):
 		httpx.WriteError(w, http.StatusNotFound, "challenge_not_found", err.Error())
@@ -1195,18 +1492,95 @@ func (s *Server) writeRuntimeError(w http.ResponseWriter, err error) {
 		httpx.WriteError(w, http.StatusNotFound, "instance_not_found", err.Error())
 	case errors.Is(err, runtime.ErrInstanceRenewLimitReached):
 		httpx.WriteError(w, http.StatusConflict, "instance_renew_limit_reached", err.Error())
+	case errors.Is(err, runtime.ErrInstanceRestartLimitReached):
+		httpx.WriteError(w, http.StatusConflict, "instance_restart_limit_reached", err.Error())
+	case errors.Is(err, runtime.ErrInstanceNotReady):
+		httpx.WriteError(w, http.StatusConflict, "instance_not_ready", err.Error())
 	case errors.Is(err, runtime.ErrInstanceCapacityReached):
 		httpx.WriteError(w, http.StatusConflict, "instance_capacity_reached", err.Error())
 	case errors.Is(err, runtime.ErrInstanceCooldownActive):
 		httpx.WriteError(w, http.StatusConflict, "instance_cooldown_active", err.Error())
 	case errors.Is(err, runtime.ErrInstancePortExhausted):
 		httpx.WriteError(w, http.StatusConflict, "instance_port_exhausted", "no available instance ports")
+	case errors.Is(err, runtime.ErrChallengeNotShared):
+		httpx.WriteError(w, http.StatusConflict, "challenge_not_shared", err.Error())
+	case errors.Is(err, runtime.ErrSharedInstanceNotRunning):
+		httpx.WriteError(w, http.StatusNotFound, "shared_instance_not_running", err.Error())
+	case errors.Is(err, runtime.ErrSharedInstanceReadOnly):
+		httpx.WriteError(w, http.StatusConflict, "shared_instance_read_only", err.Error())
+	case errors.Is(err, runtime.ErrInternalNetworkNeedsProxy):
+		httpx.WriteError(w, http.StatusConflict, "internal_network_needs_proxy", err.Error())
+	case errors.Is(err, runtime.ErrInstanceReadinessFailed):
+		httpx.WriteError(w, http.StatusBadGateway, "instance_readiness_failed", err.Error())
+	case errors.Is(err, runtime.ErrInstanceStartFailed):
+		httpx.WriteError(w, http.StatusBadGateway, "instance_start_failed", err.Error())
+	case errors.Is(err, runtime.ErrInstanceResourceLimit):
+		httpx.WriteError(w, http.StatusConflict, "instance_resource_limit_exceeded", err.Error())
+	case errors.Is(err, runtime.ErrStartQueueFull):
+		httpx.WriteError(w, http.StatusServiceUnavailable, "instance_start_queue_full", err.Error())
+	case errors.Is(err, runtime.ErrNoNodeAvailable):
+		httpx.WriteError(w, http.StatusServiceUnavailable, "instance_no_node_available", err.Error())
+	case errors.Is(err, runtime.ErrNodeNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "runtime_node_not_found", err.Error())
+	case errors.Is(err, runtime.ErrProcessDriverDisabled), errors.Is(err, runtime.ErrDockerDriverDisabled):
+		httpx.WriteError(w, http.StatusServiceUnavailable, "runtime_driver_disabled", err.Error())
 	default:
 		logError("runtime.error", map[string]any{"error": err.Error()})
 		httpx.WriteError(w, http.StatusBadGateway, "runtime_error", fmt.Sprintf("%v", err))
 	}
 }
 
+// writeQuotaError answers a start refused by a quota with the quota that was
+// hit and the player's active instances, so that they can stop one.
+func (s *Server) writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *runtime.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	s.metrics.Inc("ctf_instance_quota_rejections_total", map[string]string{"quota": quotaErr.Quota})
+	status := http.StatusConflict
+	if quotaErr.Global() {
+		status = http.StatusServiceUnavailable
+	}
+	active := quotaErr.Active
+	if active == nil {
+		active = []runtime.ActiveInstance{}
+	}
+	httpx.WriteJSON(w, status, map[string]any{
+		"error":            "instance_quota_exceeded",
+		"message":          quotaErr.Error(),
+		"quota":            quotaErr.Quota,
+		"limit":            quotaErr.Limit,
+		"used":             quotaErr.Used,
+		"requested":        quotaErr.Requested,
+		"active_instances": active,
+	})
+	return true
+}
+
+// allowAdminWrite applies the admin write rate limit and writes the error
+// response itself when the request must not proceed.
+func (s *Server) allowAdminWrite(w http.ResponseWriter, r *http.Request, action string) (int64, bool) {
+	actorUserID, ok := userIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return 0, false
+	}
+	allowed, err := enforceRateLimit(r.Context(), s.limiters.AdminWrite, adminRateLimitKey(action, r, actorUserID))
+	if err != nil {
+		s.metrics.Inc("ctf_rate_limit_errors_total", map[string]string{"scope": "admin_write"})
+		logError("rate_limit.admin_write.error", map[string]any{"action": action, "error": err.Error()})
+		httpx.WriteError(w, http.StatusBadGateway, "rate_limit_error", "failed to enforce rate limit")
+		return 0, false
+	}
+	if !allowed {
+		s.metrics.Inc("ctf_rate_limit_hits_total", map[string]string{"scope": "admin_write"})
+		httpx.WriteError(w, http.StatusTooManyRequests, "admin_rate_limited", "too many admin write requests, please try again later")
+		return 0, false
+	}
+	return actorUserID, true
+}
+
 func (s *Server) authenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := bearerToken(r.Header.Get("Authorization"))
@@ -1302,6 +1676,7 @@ func hasPermission(role, permission string) bool {
 		"admin": {
 			"challenge:read":     true,
 			"challenge:write":    true,
+			"challenge:delete":   true,
 			"attachment:write":   true,
 			"contest:read":       true,
 			"contest:write":      true,
@@ -1336,6 +1711,25 @@ func hasPermission(role, permission string) bool {
 	return false
 }
 
+func newPasswordPolicy(cfg config.Config) (*auth.PasswordPolicy, error) {
+	return auth.NewPasswordPolicy(auth.PasswordPolicyConfig{
+		MinLength:            cfg.PasswordMinLength,
+		MinCharClasses:       cfg.PasswordMinCharClasses,
+		RejectUserSimilarity: cfg.PasswordRejectUserSimilarity,
+		UseBundledBlocklist:  cfg.PasswordBundledBlocklist,
+		BlocklistPath:        cfg.PasswordBlocklistPath,
+	})
+}
+
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	httpx.WriteError(w, http.StatusBadRequest, policyErr.Code, policyErr.Message)
+	return true
+}
+
 func writeAuthResponse(w http.ResponseWriter, status int, result auth.AuthResult) {
 	httpx.WriteJSON(w, status, map[string]any{
 		"token":      result.Token,
@@ -1348,17 +1742,49 @@ func writeChallengeResponse(w http.ResponseWriter, status int, challenge game.Ch
 	httpx.WriteJSON(w, status, map[string]any{"challenge": challenge})
 }
 
+// startInstanceStatus is 202 for a new instance that is still queued or
+// waiting for its readiness probe.
+func startInstanceStatus(instance runtime.Instance, created bool) int {
+	switch {
+	case !created:
+		return http.StatusOK
+	case instance.Status == "creating":
+		return http.StatusAccepted
+	default:
+		return http.StatusCreated
+	}
+}
+
+// instanceResponseEvents is how many of the player's latest instance events
+// GET /instances/me carries; the events endpoint has the longer history.
+const instanceResponseEvents = 10
+
 func writeInstanceResponse(w http.ResponseWriter, status int, instance runtime.Instance) {
-	httpx.WriteJSON(w, status, map[string]any{
-		"challenge_id":  instance.ChallengeID,
-		"status":        instance.Status,
-		"access_url":    instance.AccessURL,
-		"host_port":     instance.HostPort,
-		"renew_count":   instance.RenewCount,
-		"started_at":    instance.StartedAt.UTC().Format(time.RFC3339),
-		"expires_at":    instance.ExpiresAt.UTC().Format(time.RFC3339),
-		"terminated_at": formatTime(instance.TerminatedAt),
-	})
+	httpx.WriteJSON(w, status, instanceResponse(instance))
+}
+
+func instanceResponse(instance runtime.Instance) map[string]any {
+	var expiresAt any = instance.ExpiresAt.UTC().Format(time.RFC3339)
+	if instance.Shared {
+		expiresAt = nil
+	}
+	return map[string]any{
+		"challenge_id":     instance.ChallengeID,
+		"status":           instance.Status,
+		"shared":           instance.Shared,
+		"access_url":       instance.AccessURL,
+		"gateway_token":    instance.GatewayToken,
+		"gateway_tls_addr": instance.GatewayTLSAddr,
+		"host_port":        instance.HostPort,
+		"renew_count":      instance.RenewCount,
+		"restart_count":    instance.RestartCount,
+		"started_at":       instance.StartedAt.UTC().Format(time.RFC3339),
+		"expires_at":       expiresAt,
+		"terminated_at":    formatTime(instance.TerminatedAt),
+		"ready_deadline":   formatTime(instance.ReadyDeadline),
+		"idle_expires_at":  formatTime(instance.IdleExpiresAt),
+		"queue_position":   instance.QueuePosition,
+	}
 }
 
 func formatTime(value *time.Time) any {
@@ -1412,6 +1838,22 @@ func adminActorFromContext(ctx context.Context) (admin.Actor, bool) {
 	return admin.Actor{UserID: userID, Role: role}, true
 }
 
+// adminChallengeTarget reads the challenge ID from the path and the acting
+// admin from the request, writing the error response when either is missing.
+func (s *Server) adminChallengeTarget(w http.ResponseWriter, r *http.Request) (int64, admin.Actor, bool) {
+	challengeID, err := strconv.ParseInt(r.PathValue("challengeID"), 10, 64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, "invalid_challenge_id", "challenge id must be numeric")
+		return 0, admin.Actor{}, false
+	}
+	actor, ok := adminActorFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized", "missing authenticated user")
+		return 0, admin.Actor{}, false
+	}
+	return challengeID, actor, true
+}
+
 func requestSourceIP(r *http.Request) string {
 	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
 		if parsed := net.ParseIP(realIP); parsed != nil {
@@ -1450,6 +1892,12 @@ func (r *statusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func loggingMiddleware(metrics *metricsRegistry, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -1,14 +1,17 @@
 package app
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -46,7 +49,7 @@ func defaultedTestPort(value int, fallback int) int {
 	return fallback
 }
 
-func (m *testManager) Stop(_ context.Context, containerID string) error {
+func (m *testManager) Stop(_ context.Context, _, containerID string) error {
 	m.stopped = append(m.stopped, containerID)
 	if m.containers != nil {
 		delete(m.containers, containerID)
@@ -54,11 +57,30 @@ func (m *testManager) Stop(_ context.Context, containerID string) error {
 	return nil
 }
 
-func (m *testManager) Exists(_ context.Context, containerID string) (bool, error) {
+func (m *testManager) Exists(_ context.Context, _, containerID string) (bool, error) {
 	_, ok := m.containers[containerID]
 	return ok, nil
 }
 
+func (m *testManager) Logs(_ context.Context, _, containerID string, _ runtime.LogOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("booting " + containerID + "\nready\n")), nil
+}
+
+func (m *testManager) Exec(_ context.Context, _, _ string, cmd []string) (runtime.ExecResult, error) {
+	return runtime.ExecResult{Output: strings.Join(cmd, " ") + "\n"}, nil
+}
+
+func (m *testManager) Stats(_ context.Context, _, containerID string) (runtime.ContainerStats, error) {
+	if _, ok := m.containers[containerID]; !ok {
+		return runtime.ContainerStats{}, runtime.ErrInstanceNotFound
+	}
+	return runtime.ContainerStats{CPUPercent: 12.5, MemoryBytes: 64 << 20, MemoryLimitBytes: 256 << 20, PIDs: 3, SampledAt: time.Now().UTC()}, nil
+}
+
+func (m *testManager) PruneNetworks(context.Context) (int, error) {
+	return 0, nil
+}
+
 func (m *testManager) ListManagedContainers(_ context.Context) ([]runtime.ManagedContainer, error) {
 	items := make([]runtime.ManagedContainer, 0, len(m.containers))
 	for _, item := range m.containers {
@@ -71,6 +93,7 @@ type testRuntimeRepo struct {
 	challenge runtime.RuntimeConfigRecord
 	instance  *runtime.InstanceRecord
 	history   *runtime.InstanceRecord
+	events    []runtime.InstanceEvent
 }
 
 type testUserRepo struct {
@@ -108,6 +131,8 @@ type testAdminRepo struct {
 	announcements       []admin.Announcement
 	submissions         []admin.SubmissionRecord
 	instances           []admin.InstanceRecord
+	revisions           map[int64][]admin.ChallengeRevision
+	solveCounts         map[int64]int
 }
 
 type testAttachmentFile struct {
@@ -276,10 +301,10 @@ func newTestServer(t *testing.T) (*Server, *testRuntimeRepo) {
 	cfg.AdminWriteRateLimitMax = 1
 	tokens := auth.NewTokenManager(cfg.JWTSecret, cfg.JWTTTL)
 	authService := auth.NewService(userRepo, tokens)
-	adminService := admin.NewServiceWithManager(adminRepo, cfg.AttachmentStorageDir, manager)
+	runtimeService := runtime.NewService(runtime.ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080", PortMin: 20000, PortMax: 20010}, manager, runtimeRepo)
+	adminService := admin.NewServiceWithRuntime(adminRepo, cfg.AttachmentStorageDir, manager, runtimeService)
 	contestService := contest.NewService(contestRepo)
 	gameService := game.NewService(gameRepo)
-	runtimeService := runtime.NewService(runtime.ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080", PortMin: 20000, PortMax: 20010}, manager, runtimeRepo)
 	server := NewServerForTests(cfg, adminService, authService, contestService, gameService, runtimeService)
 	if limiter, ok := server.limiters.Submission.(*memoryRateLimiter); ok {
 		limiter.now = func() time.Time { return now }
@@ -324,6 +349,23 @@ func (r *testRuntimeRepo) GetActiveInstance(_ context.Context, userID int64, cha
 	return *r.instance, nil
 }
 
+func (r *testRuntimeRepo) RecordInstanceEvent(_ context.Context, event runtime.InstanceEvent) error {
+	event.ID = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *testRuntimeRepo) ListInstanceEvents(_ context.Context, filter runtime.InstanceEventFilter) ([]runtime.InstanceEvent, error) {
+	items := make([]runtime.InstanceEvent, 0)
+	for i := len(r.events) - 1; i >= 0 && len(items) < filter.Limit; i-- {
+		event := r.events[i]
+		if (filter.UserID == 0 || event.UserID == filter.UserID) && (filter.Type == "" || event.Type == filter.Type) {
+			items = append(items, event)
+		}
+	}
+	return items, nil
+}
+
 func (r *testRuntimeRepo) CreateInstance(_ context.Context, runtimeConfigID int64, instance runtime.Instance) (runtime.InstanceRecord, error) {
 	record := runtime.InstanceRecord{ID: 1, RuntimeConfigID: runtimeConfigID, Instance: instance}
 	r.instance = &record
@@ -342,6 +384,22 @@ func (r *testRuntimeRepo) RenewInstance(_ context.Context, instanceID int64, exp
 	return *r.instance, nil
 }
 
+func (r *testRuntimeRepo) RestartInstance(_ context.Context, instanceID int64, instance runtime.Instance) (runtime.InstanceRecord, error) {
+	if r.instance == nil || r.instance.ID != instanceID || r.instance.Instance.Status != "running" {
+		return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+	}
+	restartCount := r.instance.Instance.RestartCount + 1
+	instance.ChallengeID = r.instance.Instance.ChallengeID
+	instance.UserID = r.instance.Instance.UserID
+	instance.RenewCount = r.instance.Instance.RenewCount
+	instance.RestartCount = restartCount
+	instance.ExpiresAt = r.instance.Instance.ExpiresAt
+	r.instance.Instance = instance
+	record := *r.instance
+	r.history = &record
+	return *r.instance, nil
+}
+
 func (r *testRuntimeRepo) TerminateInstance(_ context.Context, instanceID int64, terminatedAt time.Time) error {
 	if r.instance == nil || r.instance.ID != instanceID {
 		return runtime.ErrRepositoryNotFound
@@ -355,6 +413,64 @@ func (r *testRuntimeRepo) TerminateInstance(_ context.Context, instanceID int64,
 	return nil
 }
 
+func (r *testRuntimeRepo) ListWarmPoolChallengeIDs(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (r *testRuntimeRepo) ListUserActiveInstances(_ context.Context, userID int64) ([]runtime.ActiveInstance, error) {
+	if r.instance != nil && r.instance.Instance.UserID == userID {
+		return []runtime.ActiveInstance{{ChallengeID: r.instance.Instance.ChallengeID, Status: r.instance.Instance.Status, ExpiresAt: r.instance.Instance.ExpiresAt}}, nil
+	}
+	return nil, nil
+}
+
+func (r *testRuntimeRepo) GetInstanceUsage(context.Context) (runtime.InstanceUsage, error) {
+	if r.instance != nil {
+		return runtime.InstanceUsage{Instances: 1}, nil
+	}
+	return runtime.InstanceUsage{}, nil
+}
+
+func (r *testRuntimeRepo) ListDynamicChallengeIDs(context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (r *testRuntimeRepo) AttachInstanceContainer(_ context.Context, instanceID int64, instance runtime.Instance) error {
+	if r.instance == nil || r.instance.ID != instanceID || r.instance.Instance.ContainerID != "" {
+		return runtime.ErrRepositoryNotFound
+	}
+	r.instance.Instance = instance
+	record := *r.instance
+	r.history = &record
+	return nil
+}
+
+func (r *testRuntimeRepo) MarkInstanceRunning(_ context.Context, instanceID int64) error {
+	if r.instance == nil || r.instance.ID != instanceID || r.instance.Instance.Status != "creating" {
+		return runtime.ErrRepositoryNotFound
+	}
+	r.instance.Instance.Status = "running"
+	return nil
+}
+
+func (r *testRuntimeRepo) FailInstance(_ context.Context, instanceID int64, failedAt time.Time, reason string) error {
+	if r.instance == nil || r.instance.ID != instanceID || (r.instance.Instance.Status != "creating" && r.instance.Instance.Status != "running") {
+		return runtime.ErrRepositoryNotFound
+	}
+	record := *r.instance
+	record.Instance.Status = "failed"
+	record.Instance.FailureReason = reason
+	t := failedAt.UTC()
+	record.Instance.TerminatedAt = &t
+	r.history = &record
+	r.instance = nil
+	return nil
+}
+
+func (r *testRuntimeRepo) ExitInstance(ctx context.Context, instanceID int64, exitedAt time.Time, _ int) error {
+	return r.TerminateInstance(ctx, instanceID, exitedAt)
+}
+
 func (r *testRuntimeRepo) ListExpiredInstances(_ context.Context, now time.Time) ([]runtime.InstanceRecord, error) {
 	if r.instance == nil || r.instance.Instance.ExpiresAt.After(now) {
 		return nil, nil
@@ -376,6 +492,20 @@ func (r *testRuntimeRepo) GetLatestInstance(_ context.Context, userID int64, cha
 	return *r.history, nil
 }
 
+func (r *testRuntimeRepo) GetInstanceByProxyID(_ context.Context, proxyID string) (runtime.InstanceRecord, error) {
+	if r.instance == nil || r.instance.Instance.ProxyID != proxyID {
+		return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+	}
+	return *r.instance, nil
+}
+
+func (r *testRuntimeRepo) GetInstanceByGatewayToken(_ context.Context, token string) (runtime.InstanceRecord, error) {
+	if r.instance == nil || r.instance.Instance.GatewayToken != token {
+		return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+	}
+	return *r.instance, nil
+}
+
 func (r *testRuntimeRepo) ListActiveInstances(context.Context) ([]runtime.InstanceRecord, error) {
 	if r.instance == nil {
 		return nil, nil
@@ -426,6 +556,16 @@ func (r *testUserRepo) UpdateLastLogin(_ context.Context, userID int64, loggedIn
 	return nil
 }
 
+func (r *testUserRepo) UpdatePassword(_ context.Context, userID int64, passwordHash string) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return runtime.ErrRepositoryNotFound
+	}
+	user.PasswordHash = passwordHash
+	r.users[userID] = user
+	return nil
+}
+
 func (r *testGameRepo) ListAnnouncements(context.Context) ([]game.Announcement, error) {
 	return r.announcements, nil
 }
@@ -535,6 +675,75 @@ func (r *testAdminRepo) ListChallengeAuthors(_ context.Context, actor admin.Acto
 	return append([]admin.ChallengeAuthor(nil), detail.Authors...), nil
 }
 
+func (r *testAdminRepo) SetChallengeImageDigest(_ context.Context, challengeID int64, imageName, digest string) error {
+	detail, ok := r.challengeDetails[challengeID]
+	if !ok || detail.RuntimeConfig.ImageName != imageName {
+		return admin.ErrResourceNotFound
+	}
+	detail.RuntimeConfig.ImageDigest = digest
+	r.challengeDetails[challengeID] = detail
+	return nil
+}
+
+func (r *testAdminRepo) CreateChallengeRevision(_ context.Context, input admin.CreateChallengeRevisionInput) (admin.ChallengeRevision, error) {
+	if r.revisions == nil {
+		r.revisions = map[int64][]admin.ChallengeRevision{}
+	}
+	snapshot := input.Snapshot
+	revision := admin.ChallengeRevision{
+		ChallengeID:   input.ChallengeID,
+		Version:       len(r.revisions[input.ChallengeID]) + 1,
+		Action:        input.Action,
+		SourceVersion: input.SourceVersion,
+		ActorUserID:   input.ActorUserID,
+		Changes:       input.Changes,
+		Snapshot:      &snapshot,
+	}
+	r.revisions[input.ChallengeID] = append(r.revisions[input.ChallengeID], revision)
+	return revision, nil
+}
+
+func (r *testAdminRepo) ListChallengeRevisions(_ context.Context, challengeID int64) ([]admin.ChallengeRevision, error) {
+	stored := r.revisions[challengeID]
+	items := make([]admin.ChallengeRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		item := stored[i]
+		item.Snapshot = nil
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (r *testAdminRepo) GetChallengeRevision(_ context.Context, challengeID int64, version int) (admin.ChallengeRevision, error) {
+	stored := r.revisions[challengeID]
+	if version < 1 || version > len(stored) {
+		return admin.ChallengeRevision{}, admin.ErrRevisionNotFound
+	}
+	return stored[version-1], nil
+}
+
+func (r *testAdminRepo) CountChallengeSolves(_ context.Context, challengeID int64) (int, error) {
+	return r.solveCounts[challengeID], nil
+}
+
+func (r *testAdminRepo) SetChallengeArchivedAt(_ context.Context, challengeID int64, archivedAt *time.Time) error {
+	detail, ok := r.challengeDetails[challengeID]
+	if !ok {
+		return admin.ErrResourceNotFound
+	}
+	detail.ArchivedAt = archivedAt
+	r.challengeDetails[challengeID] = detail
+	return nil
+}
+
+func (r *testAdminRepo) DeleteChallenge(_ context.Context, challengeID int64) error {
+	if _, ok := r.challengeDetails[challengeID]; !ok {
+		return admin.ErrResourceNotFound
+	}
+	delete(r.challengeDetails, challengeID)
+	return nil
+}
+
 func (r *testAdminRepo) UpdateChallengeAuthors(_ context.Context, actor admin.Actor, challengeID int64, userIDs []int64) ([]admin.ChallengeAuthor, error) {
 	if actor.Role != "admin" {
 		return nil, admin.ErrResourceNotFound
@@ -637,6 +846,9 @@ func (r *testAdminRepo) CreateAuditLog(_ context.Context, actorUserID *int64, ac
 	r.auditLogs = append(r.auditLogs, admin.AuditLogRecord{ID: id, ActorUserID: actorUserID, Action: action, ResourceType: resourceType, ResourceID: resourceID, Details: details, CreatedAt: time.Now().UTC()})
 	return nil
 }
+func (r *testAdminRepo) CreateInstanceEvent(context.Context, int64, string, string) error {
+	return nil
+}
 func (r *testAdminRepo) ListAnnouncements(context.Context) ([]admin.Announcement, error) {
 	return r.announcements, nil
 }
@@ -949,6 +1161,49 @@ func TestRenewInstanceEndpointRejectsLimitReached(t *testing.T) {
 	}
 }
 
+func TestRestartInstanceEndpoint(t *testing.T) {
+	server, runtimeRepo := newTestServer(t)
+	runtimeRepo.challenge.Challenge.MaxRestartCount = 1
+	token := registerTestUser(t, server)
+	createReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me", nil)
+	createReq.Header.Set("Authorization", "Bearer "+token)
+	createRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(createRes, createReq)
+	if createRes.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createRes.Code)
+	}
+
+	restartReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me/restart", nil)
+	restartReq.Header.Set("Authorization", "Bearer "+token)
+	restartRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(restartRes, restartReq)
+	if restartRes.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", restartRes.Code, restartRes.Body.String())
+	}
+	var payload struct {
+		RestartCount int `json:"restart_count"`
+	}
+	if err := json.Unmarshal(restartRes.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode restart response: %v", err)
+	}
+	if payload.RestartCount != 1 {
+		t.Fatalf("expected restart count 1, got %s", restartRes.Body.String())
+	}
+	logs, err := server.admin.AuditLogs(context.Background())
+	if err != nil || logs[len(logs)-1].Action != "instance.restart" {
+		t.Fatalf("expected restart audit log, got %#v err=%v", logs, err)
+	}
+
+	limitReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me/restart", nil)
+	limitReq.Header.Set("Authorization", "Bearer "+token)
+	limitRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(limitRes, limitReq)
+	if limitRes.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", limitRes.Code)
+	}
+	assertAPIErrorCode(t, limitRes.Body.Bytes(), "instance_restart_limit_reached")
+}
+
 func TestCreateInstanceEndpointRejectsChallengeCapacity(t *testing.T) {
 	server, runtimeRepo := newTestServer(t)
 	runtimeRepo.challenge.Challenge.MaxActiveInstances = 1
@@ -1004,6 +1259,38 @@ func TestCreateInstanceEndpointRejectsCooldownActive(t *testing.T) {
 	assertAPIErrorCode(t, retryRes.Body.Bytes(), "instance_cooldown_active")
 }
 
+func TestRuntimeQuotaErrorListsActiveInstances(t *testing.T) {
+	server, _ := newTestServer(t)
+	res := httptest.NewRecorder()
+	server.writeRuntimeError(res, &runtime.QuotaError{
+		Quota:     runtime.QuotaUserInstances,
+		Limit:     1,
+		Used:      1,
+		Requested: 1,
+		Active:    []runtime.ActiveInstance{{ChallengeID: "2", Slug: "pwn-echo", Title: "Echo", Status: "running"}},
+	})
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", res.Code)
+	}
+	var body struct {
+		Error           string                   `json:"error"`
+		Quota           string                   `json:"quota"`
+		ActiveInstances []runtime.ActiveInstance `json:"active_instances"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error != "instance_quota_exceeded" || body.Quota != runtime.QuotaUserInstances || len(body.ActiveInstances) != 1 || body.ActiveInstances[0].Slug != "pwn-echo" {
+		t.Fatalf("unexpected quota error %+v", body)
+	}
+
+	res = httptest.NewRecorder()
+	server.writeRuntimeError(res, &runtime.QuotaError{Quota: runtime.QuotaGlobalMemory, Limit: 4096, Used: 4000, Requested: 256})
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for the global budget, got %d", res.Code)
+	}
+}
+
 func assertAPIErrorCode(t *testing.T, body []byte, want string) {
 	t.Helper()
 	var payload map[string]any
@@ -1276,6 +1563,171 @@ func TestAdminWriteRateLimitEndpoint(t *testing.T) {
 	assertAPIErrorCode(t, secondRes.Body.Bytes(), "admin_rate_limited")
 }
 
+func TestAdminArchiveAndDeleteChallengeEndpoints(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.limiters.AdminWrite = nil
+	adminToken := issueAdminToken(t, server)
+	opsToken := issueRoleToken(t, server, "ops")
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		server.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	if res := send(http.MethodDelete, "/api/v1/admin/challenges/1", opsToken, `{"confirm_slug":"web-welcome"}`); res.Code != http.StatusForbidden {
+		t.Fatalf("expected ops to be refused hard delete, got %d", res.Code)
+	}
+	res := send(http.MethodDelete, "/api/v1/admin/challenges/1", adminToken, `{"confirm_slug":"web-welcome"}`)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409 before archiving, got %d: %s", res.Code, res.Body.String())
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "challenge_not_archived")
+
+	res = send(http.MethodPost, "/api/v1/admin/challenges/1/archive", adminToken, "")
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"archived_at"`) {
+		t.Fatalf("expected archived challenge, got %d: %s", res.Code, res.Body.String())
+	}
+	res = send(http.MethodPost, "/api/v1/admin/challenges/1/restore", adminToken, "")
+	if res.Code != http.StatusOK || strings.Contains(res.Body.String(), `"archived_at"`) {
+		t.Fatalf("expected restored challenge, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := send(http.MethodPost, "/api/v1/admin/challenges/1/archive", adminToken, ""); res.Code != http.StatusOK {
+		t.Fatalf("expected archive 200, got %d", res.Code)
+	}
+
+	res = send(http.MethodDelete, "/api/v1/admin/challenges/1", adminToken, `{"confirm_slug":"web"}`)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a wrong slug, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "confirm_slug_mismatch")
+	if res := send(http.MethodDelete, "/api/v1/admin/challenges/1", adminToken, `{"confirm_slug":"web-welcome"}`); res.Code != http.StatusOK {
+		t.Fatalf("expected delete 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := send(http.MethodGet, "/api/v1/admin/challenges/1", adminToken, ""); res.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted challenge to be gone, got %d", res.Code)
+	}
+}
+
+func TestAdminChallengeRevisionEndpoints(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.limiters.AdminWrite = nil
+	adminToken := issueAdminToken(t, server)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		res := httptest.NewRecorder()
+		server.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	res := send(http.MethodPatch, "/api/v1/admin/challenges/1", `{"slug":"web-welcome","title":"Welcome Panel","category_slug":"web","description":"updated","points":100,"difficulty":"easy","flag_type":"static","flag_value":"flag{welcome}","status":"published","visible":true,"sort_order":10}`)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"revision":2`) {
+		t.Fatalf("expected update to store revision 2, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = send(http.MethodGet, "/api/v1/admin/challenges/1/revisions", "")
+	var list struct {
+		Items []admin.ChallengeRevision `json:"items"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &list); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("list revisions: %d %v", res.Code, err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Version != 2 || list.Items[0].Action != admin.RevisionActionUpdate || list.Items[0].Snapshot != nil {
+		t.Fatalf("unexpected revisions: %+v", list.Items)
+	}
+
+	res = send(http.MethodGet, "/api/v1/admin/challenges/1/revisions/diff?from=1&to=2", "")
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"field":"description"`) {
+		t.Fatalf("expected description in diff, got %d: %s", res.Code, res.Body.String())
+	}
+	res = send(http.MethodGet, "/api/v1/admin/challenges/1/revisions/diff?from=1", "")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without to, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "invalid_revision")
+
+	res = send(http.MethodPost, "/api/v1/admin/challenges/1/revisions/1/rollback", "")
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"revision":3`) {
+		t.Fatalf("expected rollback to store revision 3, got %d: %s", res.Code, res.Body.String())
+	}
+	res = send(http.MethodGet, "/api/v1/admin/challenges/1", "")
+	if !strings.Contains(res.Body.String(), `"description":"demo"`) {
+		t.Fatalf("expected the original description back, got %s", res.Body.String())
+	}
+	res = send(http.MethodPost, "/api/v1/admin/challenges/1/revisions/7/rollback", "")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing revision, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "revision_not_found")
+}
+
+func TestAdminExportChallengeEndpoint(t *testing.T) {
+	server, _ := newTestServer(t)
+	adminToken := issueAdminToken(t, server)
+	authorToken := issueRoleToken(t, server, "author")
+	send := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		server.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	res := send(adminToken, "/api/v1/admin/challenges/1/export")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if res.Header().Get("Content-Type") != "application/zip" || !strings.Contains(res.Header().Get("Content-Disposition"), `filename="web-welcome.zip"`) {
+		t.Fatalf("unexpected headers: %v", res.Header())
+	}
+	bundle, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	entries := map[string]string{}
+	for _, file := range bundle.File {
+		entry, err := file.Open()
+		if err != nil {
+			t.Fatalf("open bundle entry: %v", err)
+		}
+		content, _ := io.ReadAll(entry)
+		entry.Close()
+		entries[file.Name] = string(content)
+	}
+	if entries["web-welcome/attachments/statement.pdf"] != "statement-data" {
+		t.Fatalf("expected the attachment in the bundle, got %v", entries)
+	}
+	for _, want := range []string{"  slug: web-welcome\n", "  value: flag{welcome}\n", "  author: author\n", "  image: ctf/web-welcome:dev\n", "    source: attachments/statement.pdf\n"} {
+		if !strings.Contains(entries["web-welcome/challenge.yaml"], want) {
+			t.Fatalf("expected %q in challenge.yaml:\n%s", want, entries["web-welcome/challenge.yaml"])
+		}
+	}
+
+	res = send(adminToken, "/api/v1/admin/audit-logs")
+	if !strings.Contains(res.Body.String(), `"action":"challenge.export"`) {
+		t.Fatalf("expected an export audit log, got %s", res.Body.String())
+	}
+
+	res = send(adminToken, "/api/v1/admin/challenges/2/export?format=tar.gz")
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a tar.gz bundle, got %d %v", res.Code, res.Header())
+	}
+
+	res = send(adminToken, "/api/v1/admin/challenges/1/export?format=rar")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown format, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "invalid_export_format")
+
+	res = send(authorToken, "/api/v1/admin/challenges/2/export")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a challenge the author does not own, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "challenge_not_found")
+}
+
 func TestAdminChallengeAuthorsEndpoint(t *testing.T) {
 	server, _ := newTestServer(t)
 	adminToken := issueAdminToken(t, server)
@@ -1370,6 +1822,50 @@ func TestAdminUpdateUserEndpoint(t *testing.T) {
 	}
 }
 
+func TestAdminResetUserPasswordEndpoint(t *testing.T) {
+	server, _ := newTestServer(t)
+	adminToken := issueAdminToken(t, server)
+	registerTestUser(t, server)
+
+	weakReq := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/2/password", bytes.NewReader([]byte(`{"password":"alice2025"}`)))
+	weakReq.Header.Set("Authorization", "Bearer "+adminToken)
+	weakRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(weakRes, weakReq)
+	if weakRes.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", weakRes.Code, weakRes.Body.String())
+	}
+	assertAPIErrorCode(t, weakRes.Body.Bytes(), "password_similar_to_user")
+
+	server.limiters.AdminWrite = nil
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/2/password", bytes.NewReader([]byte(`{"password":"Rotated-Secret-42"}`)))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+
+	auditReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit-logs", nil)
+	auditReq.Header.Set("Authorization", "Bearer "+adminToken)
+	auditRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(auditRes, auditReq)
+	if !strings.Contains(auditRes.Body.String(), `"user.password_reset"`) {
+		t.Fatalf("expected password reset audit log, got %s", auditRes.Body.String())
+	}
+}
+
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	server, _ := newTestServer(t)
+	body := []byte(`{"username":"alice","email":"alice@example.com","password":"qwerty123","display_name":"Alice"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "password_breached")
+}
+
 func TestAdminAuditLogsEndpoint(t *testing.T) {
 	server, _ := newTestServer(t)
 	adminToken := issueAdminToken(t, server)
@@ -1406,6 +1902,70 @@ func TestAdminTerminateInstanceEndpoint(t *testing.T) {
 	}
 }
 
+func TestAdminSharedInstanceEndpoints(t *testing.T) {
+	server, runtimeRepo := newTestServer(t)
+	runtimeRepo.challenge.Challenge.Mode = runtime.ModeShared
+	adminToken := issueAdminToken(t, server)
+	playerToken := registerTestUser(t, server)
+
+	playerReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me", nil)
+	playerReq.Header.Set("Authorization", "Bearer "+playerToken)
+	playerRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(playerRes, playerReq)
+	if playerRes.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before shared start, got %d: %s", playerRes.Code, playerRes.Body.String())
+	}
+	assertAPIErrorCode(t, playerRes.Body.Bytes(), "shared_instance_not_running")
+
+	startReq := httptest.NewRequest(http.MethodPost, "/api/v1/admin/challenges/1/shared-instance", nil)
+	startReq.Header.Set("Authorization", "Bearer "+adminToken)
+	startRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(startRes, startReq)
+	if startRes.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", startRes.Code, startRes.Body.String())
+	}
+
+	playerReq = httptest.NewRequest(http.MethodGet, "/api/v1/challenges/1/instances/me", nil)
+	playerReq.Header.Set("Authorization", "Bearer "+playerToken)
+	playerRes = httptest.NewRecorder()
+	server.Handler().ServeHTTP(playerRes, playerReq)
+	if playerRes.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", playerRes.Code, playerRes.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(playerRes.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode instance: %v", err)
+	}
+	if payload["shared"] != true || payload["expires_at"] != nil {
+		t.Fatalf("expected shared instance without expiry, got %#v", payload)
+	}
+
+	renewReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me/renew", nil)
+	renewReq.Header.Set("Authorization", "Bearer "+playerToken)
+	renewRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(renewRes, renewReq)
+	if renewRes.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", renewRes.Code, renewRes.Body.String())
+	}
+	assertAPIErrorCode(t, renewRes.Body.Bytes(), "shared_instance_read_only")
+
+	stopReq := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/challenges/1/shared-instance", nil)
+	stopReq.Header.Set("Authorization", "Bearer "+adminToken)
+	stopRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(stopRes, stopReq)
+	if stopRes.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", stopRes.Code, stopRes.Body.String())
+	}
+
+	auditReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit-logs", nil)
+	auditReq.Header.Set("Authorization", "Bearer "+adminToken)
+	auditRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(auditRes, auditReq)
+	if !strings.Contains(auditRes.Body.String(), `"instance.shared_start"`) || !strings.Contains(auditRes.Body.String(), `"instance.shared_stop"`) {
+		t.Fatalf("expected shared instance audit logs, got %s", auditRes.Body.String())
+	}
+}
+
 func registerAnotherTestUser(t *testing.T, server *Server) string {
 	t.Helper()
 	registerBody := []byte(`{"username":"bob","email":"bob@example.com","password":"Password123!","display_name":"Bob"}`)
@@ -1523,3 +2083,297 @@ func TestRuntimeBlockedWhenContestFrozen(t *testing.T) {
 		t.Fatalf("expected runtime_closed, got %s", res.Body.String())
 	}
 }
+
+func newPowTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, _ := newTestServer(t)
+	server.cfg.PowEnabled = true
+	server.cfg.PowChallengeTTL = time.Minute
+	server.cfg.PowBaseDifficulty = 4
+	server.cfg.PowMaxDifficulty = 6
+	server.cfg.PowEscalationWindowSeconds = 600
+	server.cfg.PowEscalationHitsPerLevel = 1
+	server.pow = newPowGate(server.cfg)
+	return server
+}
+
+func fetchPowSolution(t *testing.T, server *Server, scope string) (string, string, int) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/pow-challenge?scope="+scope, nil)
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected pow challenge 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var payload struct {
+		Enabled    bool   `json:"enabled"`
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode pow challenge: %v", err)
+	}
+	if !payload.Enabled || payload.Challenge == "" {
+		t.Fatalf("expected enabled pow challenge, got %s", res.Body.String())
+	}
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if auth.PowLeadingZeroBits(payload.Challenge, nonce) >= payload.Difficulty {
+			return payload.Challenge, nonce, payload.Difficulty
+		}
+	}
+}
+
+func TestPowChallengeDisabledByDefault(t *testing.T) {
+	server, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/pow-challenge?scope=register", nil)
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"enabled":false`) {
+		t.Fatalf("expected disabled pow response, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestRegisterRequiresPowWhenEnabled(t *testing.T) {
+	server := newPowTestServer(t)
+	body := []byte(`{"username":"alice","email":"alice@example.com","password":"Password123!","display_name":"Alice"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "pow_required")
+
+	challenge, nonce, _ := fetchPowSolution(t, server, "register")
+	solved, _ := json.Marshal(map[string]string{
+		"username":      "alice",
+		"email":         "alice@example.com",
+		"password":      "Password123!",
+		"display_name":  "Alice",
+		"pow_challenge": challenge,
+		"pow_nonce":     nonce,
+	})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", bytes.NewReader(solved))
+	res = httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	loginBody, _ := json.Marshal(map[string]string{
+		"identifier":    "alice@example.com",
+		"password":      "Password123!",
+		"pow_challenge": challenge,
+		"pow_nonce":     nonce,
+	})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(loginBody))
+	res = httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected register challenge to be rejected for login, got %d", res.Code)
+	}
+	assertAPIErrorCode(t, res.Body.Bytes(), "pow_invalid")
+}
+
+func TestPowDifficultyRisesWithRateLimitHits(t *testing.T) {
+	server := newPowTestServer(t)
+	if limiter, ok := server.limiters.Login.(*memoryRateLimiter); ok {
+		limiter.max = 1
+	}
+	_, _, initial := fetchPowSolution(t, server, "login")
+	if initial != 4 {
+		t.Fatalf("expected base difficulty 4, got %d", initial)
+	}
+
+	body := []byte(`{"identifier":"alice@example.com","password":"wrong-password"}`)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:54321"
+		res := httptest.NewRecorder()
+		server.Handler().ServeHTTP(res, req)
+	}
+
+	_, _, raised := fetchPowSolution(t, server, "login")
+	if raised != 6 {
+		t.Fatalf("expected difficulty capped at 6 after rate limit hits, got %d", raised)
+	}
+	_, _, register := fetchPowSolution(t, server, "register")
+	if register != 4 {
+		t.Fatalf("expected register difficulty to stay at base, got %d", register)
+	}
+}
+
+func TestAdminRuntimeNodeDrain(t *testing.T) {
+	server, _ := newTestServer(t)
+	nodes, err := runtime.NewNodePool([]runtime.DockerNode{{Name: "local", Host: "unix://" + filepath.Join(t.TempDir(), "docker.sock")}}, runtime.DockerManagerConfig{})
+	if err != nil {
+		t.Fatalf("new node pool: %v", err)
+	}
+	server.nodes = nodes
+	adminToken := issueAdminToken(t, server)
+
+	drainReq := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/runtime/nodes/local", strings.NewReader(`{"draining":true}`))
+	drainReq.Header.Set("Authorization", "Bearer "+adminToken)
+	drainRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(drainRes, drainReq)
+	if drainRes.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", drainRes.Code, drainRes.Body.String())
+	}
+
+	listReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/runtime/nodes", nil)
+	listReq.Header.Set("Authorization", "Bearer "+adminToken)
+	listRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(listRes, listReq)
+	var payload struct {
+		Items []runtime.NodeStatus `json:"items"`
+	}
+	if err := json.Unmarshal(listRes.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode nodes: %v", err)
+	}
+	if len(payload.Items) != 1 || !payload.Items[0].Draining || payload.Items[0].Healthy || payload.Items[0].Error == "" {
+		t.Fatalf("expected drained unreachable node, got %+v", payload.Items)
+	}
+}
+
+func TestAdminInstanceLogsAndExec(t *testing.T) {
+	server, _ := newTestServer(t)
+	adminToken := issueAdminToken(t, server)
+
+	logsReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/1/logs?tail=50", nil)
+	logsReq.Header.Set("Authorization", "Bearer "+adminToken)
+	logsRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(logsRes, logsReq)
+	if logsRes.Code != http.StatusOK || !strings.Contains(logsRes.Body.String(), `"logs":"booting test-container\nready\n"`) {
+		t.Fatalf("unexpected logs response %d: %s", logsRes.Code, logsRes.Body.String())
+	}
+
+	followReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/1/logs?follow=true", nil)
+	followReq.Header.Set("Authorization", "Bearer "+adminToken)
+	followRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(followRes, followReq)
+	if followRes.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", followRes.Header().Get("Content-Type"))
+	}
+	wantEvents := "event: log\ndata: booting test-container\n\nevent: log\ndata: ready\n\nevent: end\ndata: \n\n"
+	if followRes.Body.String() != wantEvents {
+		t.Fatalf("unexpected event stream %q", followRes.Body.String())
+	}
+
+	badTailReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/1/logs?tail=0", nil)
+	badTailReq.Header.Set("Authorization", "Bearer "+adminToken)
+	badTailRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(badTailRes, badTailReq)
+	if badTailRes.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad tail, got %d", badTailRes.Code)
+	}
+
+	execReq := httptest.NewRequest(http.MethodPost, "/api/v1/admin/instances/1/exec", strings.NewReader(`{"command":["ps","aux"]}`))
+	execReq.Header.Set("Authorization", "Bearer "+adminToken)
+	execRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(execRes, execReq)
+	if execRes.Code != http.StatusOK || !strings.Contains(execRes.Body.String(), `"output":"ps aux\n"`) {
+		t.Fatalf("unexpected exec response %d: %s", execRes.Code, execRes.Body.String())
+	}
+	logs, err := server.admin.AuditLogs(context.Background())
+	if err != nil || logs[len(logs)-1].Action != "instance.exec" {
+		t.Fatalf("expected exec audit log, got %#v err=%v", logs, err)
+	}
+}
+
+func TestAdminInstancesIncludeResourceStats(t *testing.T) {
+	server, _ := newTestServer(t)
+	token := registerTestUser(t, server)
+	createReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me", nil)
+	createReq.Header.Set("Authorization", "Bearer "+token)
+	createRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(createRes, createReq)
+	if createRes.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createRes.Code)
+	}
+
+	report, err := server.runtime.SampleStats(context.Background())
+	if err != nil || report.Sampled != 1 {
+		t.Fatalf("expected one sampled instance, got %#v err=%v", report, err)
+	}
+	for node, totals := range report.Nodes {
+		server.recordNodeStats(node, report.Instances[node], totals)
+	}
+
+	adminToken := issueAdminToken(t, server)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res := httptest.NewRecorder()
+	server.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"cpu_percent":12.5`) || !strings.Contains(res.Body.String(), `"pids":3`) {
+		t.Fatalf("expected instance stats in listing, got %d: %s", res.Code, res.Body.String())
+	}
+
+	metricsRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(metricsRes, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+	if !strings.Contains(metricsRes.Body.String(), `ctf_runtime_memory_bytes{node=""} 6.7108864e+07`) {
+		t.Fatalf("expected node memory gauge in metrics, got %q", metricsRes.Body.String())
+	}
+}
+
+func TestInstanceEventEndpoints(t *testing.T) {
+	server, _ := newTestServer(t)
+	token := registerTestUser(t, server)
+	createReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me", nil)
+	createReq.Header.Set("Authorization", "Bearer "+token)
+	createRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(createRes, createReq)
+	if createRes.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createRes.Code)
+	}
+	renewReq := httptest.NewRequest(http.MethodPost, "/api/v1/challenges/1/instances/me/renew", nil)
+	renewReq.Header.Set("Authorization", "Bearer "+token)
+	server.Handler().ServeHTTP(httptest.NewRecorder(), renewReq)
+
+	playerReq := httptest.NewRequest(http.MethodGet, "/api/v1/challenges/1/instances/me/events", nil)
+	playerReq.Header.Set("Authorization", "Bearer "+token)
+	playerRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(playerRes, playerReq)
+	var player struct {
+		Items []runtime.InstanceEvent `json:"items"`
+	}
+	if err := json.NewDecoder(playerRes.Body).Decode(&player); err != nil || playerRes.Code != http.StatusOK {
+		t.Fatalf("decode player events: %v (status %d)", err, playerRes.Code)
+	}
+	if len(player.Items) != 3 || player.Items[0].Type != runtime.EventRenewed || player.Items[0].Detail != "" {
+		t.Fatalf("expected newest-first player events without details, got %+v", player.Items)
+	}
+
+	instanceReq := httptest.NewRequest(http.MethodGet, "/api/v1/challenges/1/instances/me", nil)
+	instanceReq.Header.Set("Authorization", "Bearer "+token)
+	instanceRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(instanceRes, instanceReq)
+	var instance struct {
+		Events []runtime.InstanceEvent `json:"events"`
+	}
+	if err := json.NewDecoder(instanceRes.Body).Decode(&instance); err != nil || instanceRes.Code != http.StatusOK {
+		t.Fatalf("decode instance: %v (status %d)", err, instanceRes.Code)
+	}
+	if len(instance.Events) != len(player.Items) || instance.Events[0] != player.Items[0] {
+		t.Fatalf("expected the instance to carry the player events %+v, got %+v", player.Items, instance.Events)
+	}
+
+	adminToken := issueAdminToken(t, server)
+	adminReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instance-events?type=renewed", nil)
+	adminReq.Header.Set("Authorization", "Bearer "+adminToken)
+	adminRes := httptest.NewRecorder()
+	server.Handler().ServeHTTP(adminRes, adminReq)
+	if adminRes.Code != http.StatusOK || !strings.Contains(adminRes.Body.String(), `"detail":"expires_at `) || strings.Contains(adminRes.Body.String(), `"type":"created"`) {
+		t.Fatalf("unexpected admin events %d: %s", adminRes.Code, adminRes.Body.String())
+	}
+
+	for _, query := range []string{"type=exploded", "limit=0", "since=yesterday", "instance_id=abc", "since=2025-03-08T10:00:00Z&until=2025-03-08T09:00:00Z"} {
+		badReq := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instance-events?"+query, nil)
+		badReq.Header.Set("Authorization", "Bearer "+adminToken)
+		badRes := httptest.NewRecorder()
+		server.Handler().ServeHTTP(badRes, badReq)
+		if badRes.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, badRes.Code)
+		}
+	}
+}
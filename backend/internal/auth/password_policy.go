@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+//go:embed passwords/common.txt
+var bundledCommonPasswords string
+
+const (
+	PasswordCodeTooShort       = "password_too_short"
+	PasswordCodeTooLong        = "password_too_long"
+	PasswordCodeTooFewClasses  = "password_too_few_classes"
+	PasswordCodeSimilarToUser  = "password_similar_to_user"
+	PasswordCodeBreached       = "password_breached"
+	maxPasswordBytes           = 72
+	passwordSimilarityMaxRatio = 0.7
+)
+
+type PasswordPolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrPasswordPolicy
+}
+
+type PasswordPolicyConfig struct {
+	MinLength            int
+	MinCharClasses       int
+	RejectUserSimilarity bool
+	UseBundledBlocklist  bool
+	BlocklistPath        string
+}
+
+// PasswordPolicy checks candidate passwords before they are hashed. Blocklist
+// entries are kept as SHA-1 digests grouped by their five hex character
+// prefix, the same range layout used by k-anonymity breach lookups, so a
+// locally mirrored breach corpus can be loaded without plaintext.
+type PasswordPolicy struct {
+	minLength            int
+	minCharClasses       int
+	rejectUserSimilarity bool
+	blocklist            map[string]map[string]struct{}
+}
+
+func DefaultPasswordPolicy() *PasswordPolicy {
+	policy, _ := NewPasswordPolicy(PasswordPolicyConfig{
+		MinLength:            8,
+		MinCharClasses:       2,
+		RejectUserSimilarity: true,
+		UseBundledBlocklist:  true,
+	})
+	return policy
+}
+
+func NewPasswordPolicy(cfg PasswordPolicyConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength:            cfg.MinLength,
+		minCharClasses:       cfg.MinCharClasses,
+		rejectUserSimilarity: cfg.RejectUserSimilarity,
+		blocklist:            make(map[string]map[string]struct{}),
+	}
+	if cfg.UseBundledBlocklist {
+		if err := policy.loadBlocklist(strings.NewReader(bundledCommonPasswords)); err != nil {
+			return nil, fmt.Errorf("load bundled password blocklist: %w", err)
+		}
+	}
+	if path := strings.TrimSpace(cfg.BlocklistPath); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open password blocklist: %w", err)
+		}
+		defer file.Close()
+		if err := policy.loadBlocklist(file); err != nil {
+			return nil, fmt.Errorf("load password blocklist %s: %w", path, err)
+		}
+	}
+	return policy, nil
+}
+
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	if p == nil {
+		return nil
+	}
+	if len([]rune(password)) < p.minLength {
+		return &PasswordPolicyError{Code: PasswordCodeTooShort, Message: fmt.Sprintf("password must be at least %d characters", p.minLength)}
+	}
+	if len(password) > maxPasswordBytes {
+		return &PasswordPolicyError{Code: PasswordCodeTooLong, Message: fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes)}
+	}
+	if classes := passwordCharClasses(password); classes < p.minCharClasses {
+		return &PasswordPolicyError{Code: PasswordCodeTooFewClasses, Message: fmt.Sprintf("password must mix at least %d of lowercase, uppercase, digits and symbols", p.minCharClasses)}
+	}
+	if p.rejectUserSimilarity {
+		localPart, _, _ := strings.Cut(email, "@")
+		for _, attribute := range []string{username, localPart} {
+			if passwordResembles(password, attribute) {
+				return &PasswordPolicyError{Code: PasswordCodeSimilarToUser, Message: "password is too similar to the username or email"}
+			}
+		}
+	}
+	if p.blocked(password) || p.blocked(strings.ToLower(password)) {
+		return &PasswordPolicyError{Code: PasswordCodeBreached, Message: "password appears in a list of common or breached passwords"}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) blocked(password string) bool {
+	prefix, suffix := passwordDigestRange(password)
+	_, found := p.blocklist[prefix][suffix]
+	return found
+}
+
+func (p *PasswordPolicy) loadBlocklist(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var prefix, suffix string
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			digest = strings.ToUpper(digest)
+			prefix, suffix = digest[:5], digest[5:]
+		} else {
+			prefix, suffix = passwordDigestRange(line)
+		}
+		bucket, ok := p.blocklist[prefix]
+		if !ok {
+			bucket = make(map[string]struct{})
+			p.blocklist[prefix] = bucket
+		}
+		bucket[suffix] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+func passwordDigestRange(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return digest[:5], digest[5:]
+}
+
+func isSHA1Hex(value string) bool {
+	if len(value) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func passwordCharClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func passwordResembles(password, attribute string) bool {
+	attribute = strings.ToLower(strings.TrimSpace(attribute))
+	if len([]rune(attribute)) < 3 {
+		return false
+	}
+	core := strings.TrimFunc(strings.ToLower(password), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if core == "" {
+		return false
+	}
+	if len([]rune(core)) >= 3 && strings.Contains(attribute, core) {
+		return true
+	}
+
+	a, b := []rune(core), []rune(attribute)
+	longest := max(len(a), len(b))
+	distance := levenshtein(a, b)
+	return 1-float64(distance)/float64(longest) >= passwordSimilarityMaxRatio
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicyReturnsStructuredCodes(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "too short", password: "Ab1!", want: PasswordCodeTooShort},
+		{name: "single class", password: "lowercaseonly", want: PasswordCodeTooFewClasses},
+		{name: "username with suffix", password: "alice2024!", want: PasswordCodeSimilarToUser},
+		{name: "email local part variant", password: "Al1ce.Smith", want: PasswordCodeSimilarToUser},
+		{name: "bundled common password", password: "Password1", want: PasswordCodeBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "alice", "alice.smith@example.com")
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected policy error, got %v", err)
+			}
+			if policyErr.Code != tt.want {
+				t.Fatalf("expected code %q, got %q", tt.want, policyErr.Code)
+			}
+			if !errors.Is(err, ErrPasswordPolicy) {
+				t.Fatalf("expected error to match ErrPasswordPolicy")
+			}
+		})
+	}
+
+	if err := policy.Validate("Password123!", "alice", "alice@example.com"); err != nil {
+		t.Fatalf("expected strong password to pass: %v", err)
+	}
+	if err := policy.Validate("AdminPass123!", "admin", "admin@example.com"); err != nil {
+		t.Fatalf("expected password containing a short username to pass: %v", err)
+	}
+}
+
+func TestPasswordPolicyLoadsLocalBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# local mirror\nCorrectHorse9\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write blocklist: %v", err)
+	}
+	policy, err := NewPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MinCharClasses: 2, BlocklistPath: path})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	var policyErr *PasswordPolicyError
+	if err := policy.Validate("CorrectHorse9", "bob", "bob@example.com"); !errors.As(err, &policyErr) || policyErr.Code != PasswordCodeBreached {
+		t.Fatalf("expected plaintext entry to be blocked, got %v", err)
+	}
+	prefix, suffix := passwordDigestRange("Zebra-Stripes-7")
+	if err := os.WriteFile(path, []byte(prefix+suffix+":3\n"), 0o644); err != nil {
+		t.Fatalf("rewrite blocklist: %v", err)
+	}
+	policy, err = NewPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MinCharClasses: 2, BlocklistPath: path})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	if err := policy.Validate("Zebra-Stripes-7", "bob", "bob@example.com"); !errors.As(err, &policyErr) || policyErr.Code != PasswordCodeBreached {
+		t.Fatalf("expected hashed entry to be blocked, got %v", err)
+	}
+	if err := policy.Validate("Password1", "bob", "bob@example.com"); err != nil {
+		t.Fatalf("expected bundled list to be skipped when disabled: %v", err)
+	}
+}
+
+func TestRegisterAndResetEnforcePasswordPolicy(t *testing.T) {
+	repo := newFakeRepo()
+	service := NewService(repo, NewTokenManager("secret", time.Hour))
+	_, err := service.Register(context.Background(), RegisterInput{Username: "alice", Email: "alice@example.com", Password: "short"})
+	if !errors.Is(err, ErrPasswordPolicy) {
+		t.Fatalf("expected register to enforce policy, got %v", err)
+	}
+
+	result, err := service.Register(context.Background(), RegisterInput{Username: "alice", Email: "alice@example.com", Password: "Password123!"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := service.ResetPassword(context.Background(), result.User.ID, "qwerty123"); !errors.Is(err, ErrPasswordPolicy) {
+		t.Fatalf("expected reset to enforce policy, got %v", err)
+	}
+	if _, err := service.ResetPassword(context.Background(), result.User.ID, "N3w-Secret-Phrase"); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	if _, err := service.Login(context.Background(), LoginInput{Identifier: "alice", Password: "N3w-Secret-Phrase"}); err != nil {
+		t.Fatalf("login with reset password: %v", err)
+	}
+}
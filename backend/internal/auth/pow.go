@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PowAlgorithm = "sha256-leading-zero-bits"
+
+type PowChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Scope      string    `json:"scope"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type powPayload struct {
+	Scope      string `json:"scope"`
+	Salt       string `json:"salt"`
+	Difficulty int    `json:"difficulty"`
+	Exp        int64  `json:"exp"`
+}
+
+// ProofOfWork issues signed hashcash-style challenges. A solution is a nonce
+// such that sha256(challenge + ":" + nonce) starts with Difficulty zero bits.
+type ProofOfWork struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	spent map[string]time.Time
+}
+
+func NewProofOfWork(secret string, ttl time.Duration) *ProofOfWork {
+	return &ProofOfWork{
+		secret: []byte(secret),
+		ttl:    ttl,
+		now:    time.Now,
+		spent:  make(map[string]time.Time),
+	}
+}
+
+func (p *ProofOfWork) Issue(scope string, difficulty int) (PowChallenge, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return PowChallenge{}, fmt.Errorf("generate pow salt: %w", err)
+	}
+	expiresAt := p.now().UTC().Add(p.ttl)
+	payloadPart, err := encodeTokenPart(powPayload{
+		Scope:      scope,
+		Salt:       base64.RawURLEncoding.EncodeToString(salt),
+		Difficulty: difficulty,
+		Exp:        expiresAt.Unix(),
+	})
+	if err != nil {
+		return PowChallenge{}, err
+	}
+
+	return PowChallenge{
+		Challenge:  payloadPart + "." + p.sign(payloadPart),
+		Algorithm:  PowAlgorithm,
+		Scope:      scope,
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (p *ProofOfWork) Verify(scope, challenge, nonce string) error {
+	challenge = strings.TrimSpace(challenge)
+	if challenge == "" || nonce == "" {
+		return ErrPowRequired
+	}
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 2 {
+		return ErrPowInvalid
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(p.sign(parts[0]))) {
+		return ErrPowInvalid
+	}
+
+	var payload powPayload
+	if err := decodeTokenPart(parts[0], &payload); err != nil {
+		return ErrPowInvalid
+	}
+	if payload.Scope != scope {
+		return ErrPowInvalid
+	}
+	now := p.now().UTC()
+	if now.Unix() >= payload.Exp {
+		return ErrPowExpired
+	}
+	if PowLeadingZeroBits(challenge, nonce) < payload.Difficulty {
+		return ErrPowInvalid
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, expiresAt := range p.spent {
+		if !now.Before(expiresAt) {
+			delete(p.spent, key)
+		}
+	}
+	if _, used := p.spent[parts[1]]; used {
+		return ErrPowReused
+	}
+	p.spent[parts[1]] = time.Unix(payload.Exp, 0).UTC()
+	return nil
+}
+
+func (p *ProofOfWork) sign(value string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte("pow:" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func PowLeadingZeroBits(challenge, nonce string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	count := 0
+	for _, b := range sum {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		count += bits.LeadingZeros8(b)
+		break
+	}
+	return count
+}
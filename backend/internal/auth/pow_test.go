@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func solvePow(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	for i := 0; i < 1<<24; i++ {
+		nonce := strconv.Itoa(i)
+		if PowLeadingZeroBits(challenge, nonce) >= difficulty {
+			return nonce
+		}
+	}
+	t.Fatalf("failed to solve pow challenge at difficulty %d", difficulty)
+	return ""
+}
+
+func TestProofOfWorkVerifiesSolvedChallengeOnce(t *testing.T) {
+	pow := NewProofOfWork("secret", time.Minute)
+	issued, err := pow.Issue("register", 8)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	nonce := solvePow(t, issued.Challenge, issued.Difficulty)
+
+	if err := pow.Verify("register", issued.Challenge, nonce); err != nil {
+		t.Fatalf("expected solution to verify: %v", err)
+	}
+	if err := pow.Verify("register", issued.Challenge, nonce); !errors.Is(err, ErrPowReused) {
+		t.Fatalf("expected reused challenge to fail, got %v", err)
+	}
+}
+
+func TestProofOfWorkRejectsWrongScopeAndTampering(t *testing.T) {
+	pow := NewProofOfWork("secret", time.Minute)
+	issued, err := pow.Issue("login", 4)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	nonce := solvePow(t, issued.Challenge, issued.Difficulty)
+
+	if err := pow.Verify("register", issued.Challenge, nonce); !errors.Is(err, ErrPowInvalid) {
+		t.Fatalf("expected scope mismatch to fail, got %v", err)
+	}
+	other := NewProofOfWork("other-secret", time.Minute)
+	if err := other.Verify("login", issued.Challenge, nonce); !errors.Is(err, ErrPowInvalid) {
+		t.Fatalf("expected foreign signature to fail, got %v", err)
+	}
+	if err := pow.Verify("login", issued.Challenge, ""); !errors.Is(err, ErrPowRequired) {
+		t.Fatalf("expected missing nonce to fail, got %v", err)
+	}
+}
+
+func TestProofOfWorkRejectsInsufficientWork(t *testing.T) {
+	pow := NewProofOfWork("secret", time.Minute)
+	issued, err := pow.Issue("register", 20)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if PowLeadingZeroBits(issued.Challenge, nonce) < issued.Difficulty {
+			if err := pow.Verify("register", issued.Challenge, nonce); !errors.Is(err, ErrPowInvalid) {
+				t.Fatalf("expected insufficient work to fail, got %v", err)
+			}
+			return
+		}
+	}
+}
+
+func TestProofOfWorkRejectsExpiredChallenge(t *testing.T) {
+	now := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	pow := NewProofOfWork("secret", time.Minute)
+	pow.now = func() time.Time { return now }
+	issued, err := pow.Issue("register", 4)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	nonce := solvePow(t, issued.Challenge, issued.Difficulty)
+
+	now = now.Add(2 * time.Minute)
+	if err := pow.Verify("register", issued.Challenge, nonce); !errors.Is(err, ErrPowExpired) {
+		t.Fatalf("expected expired challenge to fail, got %v", err)
+	}
+}
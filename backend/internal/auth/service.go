@@ -12,6 +12,7 @@ type Repository interface {
 	GetUserByIdentifier(context.Context, string) (User, error)
 	GetUserByID(context.Context, int64) (User, error)
 	UpdateLastLogin(context.Context, int64, time.Time) error
+	UpdatePassword(context.Context, int64, string) error
 }
 
 type CreateUserParams struct {
@@ -25,6 +26,7 @@ type CreateUserParams struct {
 type Service struct {
 	repo   Repository
 	tokens *TokenManager
+	policy *PasswordPolicy
 	now    func() time.Time
 }
 
@@ -35,10 +37,17 @@ type AuthResult struct {
 }
 
 func NewService(repo Repository, tokens *TokenManager) *Service {
-	return &Service{repo: repo, tokens: tokens, now: time.Now}
+	return NewServiceWithPolicy(repo, tokens, DefaultPasswordPolicy())
+}
+
+func NewServiceWithPolicy(repo Repository, tokens *TokenManager, policy *PasswordPolicy) *Service {
+	return &Service{repo: repo, tokens: tokens, policy: policy, now: time.Now}
 }
 
 func (s *Service) Register(ctx context.Context, input RegisterInput) (AuthResult, error) {
+	if err := s.policy.Validate(input.Password, strings.TrimSpace(input.Username), strings.TrimSpace(input.Email)); err != nil {
+		return AuthResult{}, err
+	}
 	hash, err := HashPassword(input.Password)
 	if err != nil {
 		return AuthResult{}, err
@@ -77,6 +86,25 @@ func (s *Service) Login(ctx context.Context, input LoginInput) (AuthResult, erro
 	return s.issueToken(user)
 }
 
+func (s *Service) ResetPassword(ctx context.Context, userID int64, password string) (User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.policy.Validate(password, user.Username, user.Email); err != nil {
+		return User{}, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, hash); err != nil {
+		return User{}, err
+	}
+	user.PasswordHash = ""
+	return user, nil
+}
+
 func (s *Service) Authenticate(token string) (TokenClaims, error) {
 	return s.tokens.Verify(token)
 }
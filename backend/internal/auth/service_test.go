@@ -66,6 +66,16 @@ func (r *fakeRepo) UpdateLastLogin(_ context.Context, userID int64, loggedInAt t
 	return nil
 }
 
+func (r *fakeRepo) UpdatePassword(_ context.Context, userID int64, passwordHash string) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return runtime.ErrRepositoryNotFound
+	}
+	user.PasswordHash = passwordHash
+	r.users[userID] = user
+	return nil
+}
+
 func TestRegisterAndAuthenticate(t *testing.T) {
 	repo := newFakeRepo()
 	tokens := NewTokenManager("secret", time.Hour)
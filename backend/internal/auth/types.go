@@ -9,6 +9,11 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrTokenInvalid       = errors.New("invalid token")
 	ErrTokenExpired       = errors.New("token expired")
+	ErrPasswordPolicy     = errors.New("password does not meet policy")
+	ErrPowRequired        = errors.New("proof of work required")
+	ErrPowInvalid         = errors.New("invalid proof of work")
+	ErrPowExpired         = errors.New("proof of work challenge expired")
+	ErrPowReused          = errors.New("proof of work challenge already used")
 )
 
 type User struct {
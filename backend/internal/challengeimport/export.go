@@ -0,0 +1,691 @@
+package challengeimport
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/runtime"
+)
+
+const (
+	BundleFormatZip   = "zip"
+	BundleFormatTarGz = "tar.gz"
+
+	bundleAttachmentDir = "attachments"
+)
+
+var (
+	// ErrNotExportable means the stored challenge cannot be written as a
+	// challenge.yaml that imports back to the same challenge.
+	ErrNotExportable           = errors.New("challenge cannot be exported")
+	ErrUnsupportedBundleFormat = errors.New("bundle format must be zip or tar.gz")
+)
+
+// ExportSource loads challenges and their attachment files; admin.Service
+// implements it.
+type ExportSource interface {
+	Challenge(ctx context.Context, actor admin.Actor, challengeID int64) (admin.ChallengeDetail, error)
+	Attachment(ctx context.Context, actor admin.Actor, challengeID int64, attachmentID int64) (admin.Attachment, string, error)
+}
+
+// ExportedChallenge is one challenge ready to be written into a bundle. Files
+// maps every attachment source in Spec to the local file holding its content.
+type ExportedChallenge struct {
+	Spec  ChallengeSpec
+	Files map[string]string
+}
+
+// NormalizeBundleFormat maps a requested bundle format to BundleFormatZip or
+// BundleFormatTarGz. An empty format selects zip.
+func NormalizeBundleFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "zip":
+		return BundleFormatZip, nil
+	case "tar.gz", "tgz":
+		return BundleFormatTarGz, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedBundleFormat, format)
+	}
+}
+
+// BundleContentType returns the media type of a normalized bundle format.
+func BundleContentType(format string) string {
+	if format == BundleFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// ExportChallenge loads a challenge and checks that its spec can be written
+// and every attachment file is present, so that writing the bundle afterwards
+// only fails on I/O errors.
+func ExportChallenge(ctx context.Context, source ExportSource, actor admin.Actor, challengeID int64) (ExportedChallenge, error) {
+	detail, err := source.Challenge(ctx, actor, challengeID)
+	if err != nil {
+		return ExportedChallenge{}, err
+	}
+	spec, err := SpecFromChallenge(detail)
+	if err != nil {
+		return ExportedChallenge{}, err
+	}
+	if _, err := MarshalSpec(spec); err != nil {
+		return ExportedChallenge{}, err
+	}
+	files := make(map[string]string, len(detail.Attachments))
+	for i, attachment := range detail.Attachments {
+		_, storagePath, err := source.Attachment(ctx, actor, challengeID, attachment.ID)
+		if err != nil {
+			return ExportedChallenge{}, fmt.Errorf("load attachment %s: %w", attachment.Filename, err)
+		}
+		if _, err := os.Stat(storagePath); err != nil {
+			return ExportedChallenge{}, fmt.Errorf("open attachment %s: %w", attachment.Filename, err)
+		}
+		files[spec.Attachments[i].Source] = storagePath
+	}
+	return ExportedChallenge{Spec: spec, Files: files}, nil
+}
+
+// SpecFromChallenge turns a stored challenge into the spec that imports it.
+// The runtime section is only written for dynamic challenges with an enabled
+// runtime; authors are referenced by username and attachments are sourced
+// from the attachments directory next to challenge.yaml.
+func SpecFromChallenge(detail admin.ChallengeDetail) (ChallengeSpec, error) {
+	spec := ChallengeSpec{
+		Meta: ChallengeMeta{
+			Slug:       detail.Slug,
+			Title:      detail.Title,
+			Category:   detail.Category,
+			Points:     detail.Points,
+			Difficulty: detail.Difficulty,
+			Dynamic:    detail.DynamicEnabled,
+			Status:     detail.Status,
+			Visible:    detail.Visible,
+			SortOrder:  detail.SortOrder,
+		},
+		Flag:    ChallengeFlag{Type: detail.FlagType, Value: detail.FlagValue},
+		Content: ChallengeContent{Description: detail.Description},
+	}
+
+	authors := make([]string, 0, len(detail.Authors))
+	for _, author := range detail.Authors {
+		ref := author.Username
+		if strings.TrimSpace(ref) == "" {
+			ref = author.Email
+		}
+		authors = append(authors, ref)
+	}
+	switch len(authors) {
+	case 0:
+	case 1:
+		spec.Ownership.Author = authors[0]
+	default:
+		spec.Ownership.Authors = authors
+	}
+
+	cfg := detail.RuntimeConfig
+	if detail.DynamicEnabled && cfg.Enabled && strings.TrimSpace(cfg.ImageName) != "" {
+		spec.Runtime = &ChallengeRuntime{
+			ImageName:          cfg.ImageName,
+			Mode:               cfg.Mode,
+			Driver:             cfg.Driver,
+			Internal:           cfg.Internal,
+			ExposedProtocol:    cfg.ExposedProtocol,
+			ContainerPort:      cfg.ContainerPort,
+			TTL:                time.Duration(cfg.DefaultTTL) * time.Second,
+			MemoryLimitMB:      cfg.MemoryLimitMB,
+			CPUMilli:           cfg.CPUMilli,
+			MaxRenewCount:      cfg.MaxRenewCount,
+			MaxRestartCount:    cfg.MaxRestartCount,
+			MaxActiveInstances: cfg.MaxActiveInstances,
+			UserCooldown:       time.Duration(cfg.UserCooldown) * time.Second,
+			Env:                cfg.Env,
+			Command:            cfg.Command,
+			Hardening:          cfg.Hardening,
+			Services:           cfg.Services,
+			Readiness:          cfg.Readiness,
+			WarmPoolSize:       cfg.WarmPoolSize,
+			NodeLabels:         cfg.NodeLabels,
+			Enabled:            true,
+		}
+	}
+
+	used := make(map[string]struct{}, len(detail.Attachments))
+	for _, attachment := range detail.Attachments {
+		name := sanitizeFilename(attachment.Filename)
+		if _, ok := used[name]; ok {
+			name = fmt.Sprintf("%d-%s", attachment.ID, name)
+		}
+		used[name] = struct{}{}
+		spec.Attachments = append(spec.Attachments, AttachmentSpec{
+			Filename:    attachment.Filename,
+			Source:      path.Join(bundleAttachmentDir, name),
+			ContentType: attachment.ContentType,
+		})
+	}
+
+	normalized, err := NormalizeSpec(spec)
+	if err != nil {
+		return ChallengeSpec{}, fmt.Errorf("%w: %v", ErrNotExportable, err)
+	}
+	return normalized, nil
+}
+
+// MarshalSpec writes spec in the challenge.yaml layout read by LoadSpecFile.
+// Values are quoted only where the parser needs it and multi-line text is
+// written as a "|-" block. The output is parsed back before it is returned;
+// a spec that would not read back unchanged is rejected with
+// ErrNotExportable instead of being written lossily.
+func MarshalSpec(spec ChallengeSpec) ([]byte, error) {
+	normalized, err := NormalizeSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotExportable, err)
+	}
+
+	w := &specWriter{}
+	w.writeSpec(normalized)
+	if w.err != nil {
+		return nil, w.err
+	}
+	output := w.buf.Bytes()
+
+	parsed, err := parseSpec(bufio.NewScanner(bytes.NewReader(output)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: generated challenge.yaml does not parse: %v", ErrNotExportable, err)
+	}
+	if !reflect.DeepEqual(canonicalSpec(parsed), canonicalSpec(normalized)) {
+		return nil, fmt.Errorf("%w: generated challenge.yaml does not read back unchanged", ErrNotExportable)
+	}
+	return output, nil
+}
+
+// WriteBundle writes challenges as a zip or tar.gz archive. Every challenge
+// gets a directory named after its slug holding challenge.yaml and its
+// attachment files, so the unpacked archive can be imported as it is.
+func WriteBundle(w io.Writer, format string, challenges []ExportedChallenge) error {
+	format, err := NormalizeBundleFormat(format)
+	if err != nil {
+		return err
+	}
+	var archive bundleArchive
+	if format == BundleFormatTarGz {
+		archive = newTarBundle(w)
+	} else {
+		archive = &zipBundle{writer: zip.NewWriter(w)}
+	}
+
+	now := time.Now()
+	dirs := make(map[string]struct{}, len(challenges))
+	for _, challenge := range challenges {
+		dir := sanitizeFilename(challenge.Spec.Meta.Slug)
+		if _, ok := dirs[dir]; ok {
+			return fmt.Errorf("bundle already contains challenge %q", challenge.Spec.Meta.Slug)
+		}
+		dirs[dir] = struct{}{}
+
+		content, err := MarshalSpec(challenge.Spec)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", challenge.Spec.Meta.Slug, err)
+		}
+		if err := archive.add(path.Join(dir, "challenge.yaml"), int64(len(content)), now, bytes.NewReader(content)); err != nil {
+			return err
+		}
+		for _, attachment := range challenge.Spec.Attachments {
+			localPath, ok := challenge.Files[attachment.Source]
+			if !ok {
+				return fmt.Errorf("export %s: no file for attachment %s", challenge.Spec.Meta.Slug, attachment.Source)
+			}
+			if err := addBundleFile(archive, path.Join(dir, attachment.Source), localPath); err != nil {
+				return fmt.Errorf("export %s: %w", challenge.Spec.Meta.Slug, err)
+			}
+		}
+	}
+	return archive.Close()
+}
+
+func addBundleFile(archive bundleArchive, name, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("open attachment: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat attachment: %w", err)
+	}
+	return archive.add(name, info.Size(), info.ModTime(), file)
+}
+
+type bundleArchive interface {
+	add(name string, size int64, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+type zipBundle struct {
+	writer *zip.Writer
+}
+
+func (b *zipBundle) add(name string, _ int64, modTime time.Time, content io.Reader) error {
+	entry, err := b.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return fmt.Errorf("write bundle entry %s: %w", name, err)
+	}
+	if _, err := io.Copy(entry, content); err != nil {
+		return fmt.Errorf("write bundle entry %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *zipBundle) Close() error {
+	if err := b.writer.Close(); err != nil {
+		return fmt.Errorf("finish zip bundle: %w", err)
+	}
+	return nil
+}
+
+type tarBundle struct {
+	gzip   *gzip.Writer
+	writer *tar.Writer
+}
+
+func newTarBundle(w io.Writer) *tarBundle {
+	compressed := gzip.NewWriter(w)
+	return &tarBundle{gzip: compressed, writer: tar.NewWriter(compressed)}
+}
+
+func (b *tarBundle) add(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: size, ModTime: modTime}
+	if err := b.writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("write bundle entry %s: %w", name, err)
+	}
+	if _, err := io.CopyN(b.writer, content, size); err != nil {
+		return fmt.Errorf("write bundle entry %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *tarBundle) Close() error {
+	if err := b.writer.Close(); err != nil {
+		return fmt.Errorf("finish tar bundle: %w", err)
+	}
+	if err := b.gzip.Close(); err != nil {
+		return fmt.Errorf("finish tar bundle: %w", err)
+	}
+	return nil
+}
+
+type specWriter struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (w *specWriter) writeSpec(spec ChallengeSpec) {
+	w.line(0, "meta:")
+	w.text("slug", spec.Meta.Slug)
+	w.text("title", spec.Meta.Title)
+	w.text("category", spec.Meta.Category)
+	w.line(2, "points: "+strconv.Itoa(spec.Meta.Points))
+	w.text("difficulty", spec.Meta.Difficulty)
+	w.line(2, "dynamic: "+strconv.FormatBool(spec.Meta.Dynamic))
+	w.text("status", spec.Meta.Status)
+	w.line(2, "visible: "+strconv.FormatBool(spec.Meta.Visible))
+	w.line(2, "sort_order: "+strconv.Itoa(spec.Meta.SortOrder))
+
+	w.line(0, "flag:")
+	w.text("type", spec.Flag.Type)
+	w.text("value", spec.Flag.Value)
+
+	if spec.Content.Description != "" || spec.Content.Author != "" {
+		w.line(0, "content:")
+		if spec.Content.Description != "" {
+			w.text("description", spec.Content.Description)
+		}
+		if spec.Content.Author != "" {
+			w.text("author", spec.Content.Author)
+		}
+	}
+
+	if spec.Ownership.Author != "" || len(spec.Ownership.Authors) > 0 {
+		w.line(0, "ownership:")
+		if spec.Ownership.Author != "" {
+			w.keyValue(2, "author", spec.Ownership.Author)
+		}
+		if len(spec.Ownership.Authors) > 0 {
+			w.keyValue(2, "authors", strings.Join(spec.Ownership.Authors, ", "))
+		}
+	}
+
+	if spec.Runtime != nil {
+		w.writeRuntime(*spec.Runtime)
+	}
+
+	if len(spec.Attachments) > 0 {
+		w.line(0, "attachments:")
+		for _, attachment := range spec.Attachments {
+			w.item(2, "filename", attachment.Filename)
+			w.keyValue(4, "source", attachment.Source)
+			if attachment.ContentType != "" {
+				w.keyValue(4, "content_type", attachment.ContentType)
+			}
+		}
+	}
+}
+
+func (w *specWriter) writeRuntime(cfg ChallengeRuntime) {
+	w.line(0, "runtime:")
+	w.text("image", cfg.ImageName)
+	w.text("mode", cfg.Mode)
+	w.text("driver", cfg.Driver)
+	if cfg.Internal {
+		w.line(2, "internal: true")
+	}
+	w.text("expose", cfg.ExposedProtocol)
+	w.line(2, "container_port: "+strconv.Itoa(cfg.ContainerPort))
+	w.line(2, "ttl: "+cfg.TTL.String())
+	w.line(2, "memory_limit_mb: "+strconv.Itoa(cfg.MemoryLimitMB))
+	w.line(2, "cpu_limit_millicores: "+strconv.Itoa(cfg.CPUMilli))
+	w.line(2, "max_renew_count: "+strconv.Itoa(cfg.MaxRenewCount))
+	if cfg.MaxRestartCount > 0 {
+		w.line(2, "max_restart_count: "+strconv.Itoa(cfg.MaxRestartCount))
+	}
+	w.line(2, "max_active_instances: "+strconv.Itoa(cfg.MaxActiveInstances))
+	if cfg.WarmPoolSize > 0 {
+		w.line(2, "warm_pool_size: "+strconv.Itoa(cfg.WarmPoolSize))
+	}
+	if cfg.UserCooldown > 0 {
+		w.line(2, "user_cooldown: "+cfg.UserCooldown.String())
+	}
+	if len(cfg.Env) > 0 {
+		w.line(2, "env:")
+		w.keyValues(4, cfg.Env)
+	}
+	if len(cfg.Command) > 0 {
+		w.line(2, "command:")
+		for _, arg := range cfg.Command {
+			w.rawItem(4, arg)
+		}
+	}
+	w.writeHardening(cfg.Hardening)
+	if len(cfg.Services) > 0 {
+		w.line(2, "services:")
+		for _, service := range cfg.Services {
+			w.writeService(service)
+		}
+	}
+	if cfg.Readiness.Enabled() {
+		w.line(2, "readiness:")
+		w.keyValue(4, "type", cfg.Readiness.Type)
+		if cfg.Readiness.Path != "" {
+			w.keyValue(4, "path", cfg.Readiness.Path)
+		}
+		if cfg.Readiness.ExpectedStatus != 0 {
+			w.line(4, "expected_status: "+strconv.Itoa(cfg.Readiness.ExpectedStatus))
+		}
+		if cfg.Readiness.TimeoutSeconds != 0 {
+			w.line(4, "timeout: "+(time.Duration(cfg.Readiness.TimeoutSeconds)*time.Second).String())
+		}
+	}
+	if len(cfg.NodeLabels) > 0 {
+		w.line(2, "node_labels:")
+		w.keyValues(4, cfg.NodeLabels)
+	}
+}
+
+func (w *specWriter) writeHardening(h runtime.Hardening) {
+	if reflect.DeepEqual(h, runtime.Hardening{}) {
+		return
+	}
+	w.line(2, "hardening:")
+	if h.ReadOnlyRootfs {
+		w.line(4, "read_only_rootfs: true")
+	}
+	if h.NoNewPrivileges != nil {
+		w.line(4, "no_new_privileges: "+strconv.FormatBool(*h.NoNewPrivileges))
+	}
+	if h.PidsLimit != 0 {
+		w.line(4, "pids_limit: "+strconv.FormatInt(h.PidsLimit, 10))
+	}
+	if h.DiskQuotaMB != 0 {
+		w.line(4, "disk_quota_mb: "+strconv.Itoa(h.DiskQuotaMB))
+	}
+	if h.SeccompProfile != "" {
+		w.keyValue(4, "seccomp_profile", h.SeccompProfile)
+	}
+	if h.User != "" {
+		w.keyValue(4, "user", h.User)
+	}
+	if h.CapAdd != nil {
+		if len(h.CapAdd) == 0 {
+			w.line(4, "cap_add: []")
+		} else {
+			w.line(4, "cap_add:")
+			for _, capability := range h.CapAdd {
+				w.listItem(6, capability)
+			}
+		}
+	}
+	if len(h.Tmpfs) > 0 {
+		w.line(4, "tmpfs:")
+		w.keyValues(6, h.Tmpfs)
+	}
+	if len(h.Ulimits) > 0 {
+		w.line(4, "ulimits:")
+		for _, limit := range h.Ulimits {
+			w.keyValue(6, limit.Name, fmt.Sprintf("%d:%d", limit.Soft, limit.Hard))
+		}
+	}
+}
+
+func (w *specWriter) writeService(service runtime.ServiceSpec) {
+	w.item(4, "name", service.Name)
+	w.keyValue(6, "image", service.Image)
+	if service.MemoryLimitMB != 0 {
+		w.line(6, "memory_limit_mb: "+strconv.Itoa(service.MemoryLimitMB))
+	}
+	if service.CPUMilli != 0 {
+		w.line(6, "cpu_limit_millicores: "+strconv.Itoa(service.CPUMilli))
+	}
+	if len(service.Env) > 0 {
+		w.line(6, "env:")
+		w.keyValues(8, service.Env)
+	}
+	if len(service.Command) > 0 {
+		w.line(6, "command:")
+		for _, arg := range service.Command {
+			w.rawItem(8, arg)
+		}
+	}
+}
+
+func (w *specWriter) line(indent int, text string) {
+	w.buf.WriteString(strings.Repeat(" ", indent))
+	w.buf.WriteString(text)
+	w.buf.WriteByte('\n')
+}
+
+func (w *specWriter) fail(field string) {
+	if w.err == nil {
+		w.err = fmt.Errorf("%w: %s cannot be written to challenge.yaml", ErrNotExportable, field)
+	}
+}
+
+// text writes a top-level string field. Values the inline form cannot hold,
+// multi-line text in particular, go into a "|-" block.
+func (w *specWriter) text(key, value string) {
+	if !strings.Contains(value, "\n") {
+		if encoded, ok := encodeKeyValue(key, value); ok {
+			w.line(2, encoded)
+			return
+		}
+	}
+	w.line(2, key+": |-")
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimSpace(line) == "" {
+			w.buf.WriteByte('\n')
+			continue
+		}
+		w.line(4, line)
+	}
+}
+
+func (w *specWriter) keyValue(indent int, key, value string) {
+	encoded, ok := encodeKeyValue(key, value)
+	if !ok {
+		w.fail(key)
+		return
+	}
+	w.line(indent, encoded)
+}
+
+// keyValues writes a map sorted by key so exports are stable.
+func (w *specWriter) keyValues(indent int, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.keyValue(indent, key, values[key])
+	}
+}
+
+// item starts a list entry whose first field is key, e.g. "- name: db".
+func (w *specWriter) item(indent int, key, value string) {
+	encoded, ok := encodeKeyValue(key, value)
+	if !ok {
+		w.fail(key)
+		return
+	}
+	w.line(indent, "- "+encoded)
+}
+
+func (w *specWriter) listItem(indent int, value string) {
+	encoded, ok := encodeListItem(value, true)
+	if !ok {
+		w.fail(value)
+		return
+	}
+	w.line(indent, "- "+encoded)
+}
+
+// rawItem writes a command argument; the parser keeps quotes in command
+// items, so they cannot be quoted.
+func (w *specWriter) rawItem(indent int, value string) {
+	encoded, ok := encodeListItem(value, false)
+	if !ok {
+		w.fail("command " + strconv.Quote(value))
+		return
+	}
+	w.line(indent, "- "+encoded)
+}
+
+// encodeKeyValue returns "key: value" with value bare or quoted, whichever
+// parseSpec reads back as value first.
+func encodeKeyValue(key, value string) (string, bool) {
+	for _, candidate := range scalarCandidates(value, true) {
+		line := key + ": " + candidate
+		trimmed := strings.TrimSpace(stripComment(line))
+		if strings.HasSuffix(trimmed, ":") {
+			// Would be read as the start of a nested section.
+			continue
+		}
+		parsedKey, parsedValue, err := splitKeyValue(trimmed)
+		if err != nil || parsedKey != key {
+			continue
+		}
+		if parsedValue == "|" || parsedValue == "|-" {
+			continue
+		}
+		if normalizeScalar(parsedValue) == value {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func encodeListItem(value string, quoted bool) (string, bool) {
+	for _, candidate := range scalarCandidates(value, quoted) {
+		trimmed := strings.TrimSpace(stripComment("- " + candidate))
+		content, ok := strings.CutPrefix(trimmed, "- ")
+		if !ok {
+			continue
+		}
+		parsed := strings.TrimSpace(content)
+		if quoted {
+			parsed = normalizeScalar(parsed)
+		}
+		if parsed == value {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func scalarCandidates(value string, quoted bool) []string {
+	if !quoted {
+		return []string{value}
+	}
+	return []string{value, `"` + value + `"`, `'` + value + `'`}
+}
+
+// canonicalSpec maps empty lists and maps to nil so that specs compare equal
+// whether a section was written empty or left out. cap_add keeps the
+// difference: an empty list drops every capability.
+func canonicalSpec(spec ChallengeSpec) ChallengeSpec {
+	if len(spec.Ownership.Authors) == 0 {
+		spec.Ownership.Authors = nil
+	}
+	if len(spec.Attachments) == 0 {
+		spec.Attachments = nil
+	}
+	if spec.Runtime == nil {
+		return spec
+	}
+	cfg := *spec.Runtime
+	if len(cfg.Env) == 0 {
+		cfg.Env = nil
+	}
+	if len(cfg.Command) == 0 {
+		cfg.Command = nil
+	}
+	if len(cfg.NodeLabels) == 0 {
+		cfg.NodeLabels = nil
+	}
+	if len(cfg.Hardening.Tmpfs) == 0 {
+		cfg.Hardening.Tmpfs = nil
+	}
+	if len(cfg.Hardening.Ulimits) == 0 {
+		cfg.Hardening.Ulimits = nil
+	}
+	if len(cfg.Services) == 0 {
+		cfg.Services = nil
+	} else {
+		services := make([]runtime.ServiceSpec, len(cfg.Services))
+		for i, service := range cfg.Services {
+			if len(service.Env) == 0 {
+				service.Env = nil
+			}
+			if len(service.Command) == 0 {
+				service.Command = nil
+			}
+			services[i] = service
+		}
+		cfg.Services = services
+	}
+	spec.Runtime = &cfg
+	return spec
+}
@@ -0,0 +1,260 @@
+package challengeimport
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ctf/backend/internal/admin"
+	"ctf/backend/internal/runtime"
+)
+
+func exportFixture() admin.ChallengeDetail {
+	noNewPrivileges := false
+	return admin.ChallengeDetail{
+		ID:             7,
+		Slug:           "web-notes",
+		Title:          "Notes: part #2",
+		Category:       "web",
+		Description:    "# Notes\n\nRead \"notes.txt\" first.\n\n    curl http://target/  # example\nIt's easy: really",
+		Points:         300,
+		Difficulty:     "hard",
+		FlagType:       "static",
+		FlagValue:      `flag{a#b "c"}`,
+		Status:         "published",
+		Visible:        true,
+		DynamicEnabled: true,
+		SortOrder:      20,
+		Authors: []admin.ChallengeAuthor{
+			{UserID: 1, Username: "alice"},
+			{UserID: 2, Email: "bob@example.com"},
+		},
+		Attachments: []admin.Attachment{
+			{ID: 11, Filename: "notes.txt", ContentType: "text/plain"},
+			{ID: 12, Filename: "dist/notes.txt"},
+		},
+		RuntimeConfig: admin.RuntimeConfig{
+			Enabled:            true,
+			Mode:               "per-user",
+			Driver:             "docker",
+			ImageName:          "ctf/web-notes:dev",
+			ImageDigest:        "sha256:abc",
+			ExposedProtocol:    "http",
+			ContainerPort:      8080,
+			DefaultTTL:         1800,
+			MaxRenewCount:      2,
+			MemoryLimitMB:      256,
+			CPUMilli:           500,
+			MaxActiveInstances: 50,
+			UserCooldown:       90,
+			Env:                map[string]string{"GREETING": `"hi" there`, "PATH_HINT": "/srv:/opt # not a comment"},
+			Command:            []string{"/bin/sh", "-c", `exec app --banner "a # b"`},
+			Hardening: runtime.Hardening{
+				ReadOnlyRootfs:  true,
+				NoNewPrivileges: &noNewPrivileges,
+				CapAdd:          []string{},
+				Tmpfs:           map[string]string{"/tmp": "size=16m"},
+				Ulimits:         []runtime.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+			},
+			Services: []runtime.ServiceSpec{{
+				Name:    "db",
+				Image:   "redis:7",
+				Env:     map[string]string{"MODE": "cache"},
+				Command: []string{"redis-server", "--save", ""},
+			}},
+			Readiness:  runtime.ReadinessProbe{Type: "http", Path: "/healthz", ExpectedStatus: 200, TimeoutSeconds: 20},
+			NodeLabels: map[string]string{"pool": "web"},
+		},
+	}
+}
+
+func TestMarshalSpecRoundTripsThroughParser(t *testing.T) {
+	detail := exportFixture()
+	// Empty command items cannot be written; drop it for the round trip.
+	detail.RuntimeConfig.Services[0].Command = []string{"redis-server"}
+
+	spec, err := SpecFromChallenge(detail)
+	if err != nil {
+		t.Fatalf("spec from challenge: %v", err)
+	}
+	output, err := MarshalSpec(spec)
+	if err != nil {
+		t.Fatalf("marshal spec: %v", err)
+	}
+	parsed, err := parseSpec(bufio.NewScanner(bytes.NewReader(output)))
+	if err != nil {
+		t.Fatalf("parse exported spec: %v\n%s", err, output)
+	}
+	if !reflect.DeepEqual(canonicalSpec(parsed), canonicalSpec(spec)) {
+		t.Fatalf("exported spec changed on the way back\nwant %+v\ngot  %+v\n%s", spec, parsed, output)
+	}
+
+	text := string(output)
+	for _, want := range []string{"  description: |-\n", "  authors: alice, bob@example.com\n", "    cap_add: []\n", "  - filename: notes.txt\n    source: attachments/notes.txt\n", "    source: attachments/12-notes.txt\n"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in exported spec:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "sha256:abc") {
+		t.Fatalf("expected image digest to be left out:\n%s", text)
+	}
+}
+
+func TestSpecFromChallengeLeavesOutDisabledRuntime(t *testing.T) {
+	detail := exportFixture()
+	detail.RuntimeConfig.Enabled = false
+
+	spec, err := SpecFromChallenge(detail)
+	if err != nil {
+		t.Fatalf("spec from challenge: %v", err)
+	}
+	if spec.Runtime != nil {
+		t.Fatalf("expected no runtime section, got %+v", spec.Runtime)
+	}
+}
+
+func TestMarshalSpecRejectsValuesTheParserCannotRead(t *testing.T) {
+	_, err := MarshalSpec(ChallengeSpec{
+		Meta: ChallengeMeta{Slug: "demo", Title: "Demo", Category: "web", Points: 100, Dynamic: true},
+		Flag: ChallengeFlag{Value: "flag{demo}"},
+		Runtime: &ChallengeRuntime{
+			ImageName:     "ctf/demo:dev",
+			ContainerPort: 80,
+			TTL:           1800e9,
+			Env:           map[string]string{"QUOTED": `'a"`},
+		},
+	})
+	if !errors.Is(err, ErrNotExportable) {
+		t.Fatalf("expected ErrNotExportable, got %v", err)
+	}
+
+	_, err = MarshalSpec(mustSpecFromChallenge(t, exportFixture()))
+	if !errors.Is(err, ErrNotExportable) || !strings.Contains(err.Error(), "command") {
+		t.Fatalf("expected empty command item to be rejected, got %v", err)
+	}
+}
+
+func TestWriteBundleUnpacksToImportableDirectory(t *testing.T) {
+	detail := exportFixture()
+	detail.RuntimeConfig.Services[0].Command = nil
+	spec := mustSpecFromChallenge(t, detail)
+
+	storage := t.TempDir()
+	files := map[string]string{}
+	for i, attachment := range spec.Attachments {
+		localPath := filepath.Join(storage, "stored-"+string(rune('a'+i)))
+		mustWriteFile(t, localPath, "content of "+attachment.Source)
+		files[attachment.Source] = localPath
+	}
+
+	for _, format := range []string{BundleFormatZip, BundleFormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteBundle(&buf, format, []ExportedChallenge{{Spec: spec, Files: files}}); err != nil {
+				t.Fatalf("write bundle: %v", err)
+			}
+			root := t.TempDir()
+			names := unpackBundle(t, format, buf.Bytes(), root)
+			want := []string{"web-notes/challenge.yaml", "web-notes/attachments/notes.txt", "web-notes/attachments/12-notes.txt"}
+			if !reflect.DeepEqual(names, want) {
+				t.Fatalf("unexpected bundle entries: %v", names)
+			}
+
+			specPath := filepath.Join(root, "web-notes", "challenge.yaml")
+			loaded, err := LoadSpecFile(specPath)
+			if err != nil {
+				t.Fatalf("load exported spec: %v", err)
+			}
+			if !reflect.DeepEqual(canonicalSpec(loaded), canonicalSpec(spec)) {
+				t.Fatalf("bundled spec changed\nwant %+v\ngot  %+v", spec, loaded)
+			}
+			staged, err := stageAttachments(filepath.Dir(specPath), loaded.Attachments)
+			if err != nil {
+				t.Fatalf("stage bundled attachments: %v", err)
+			}
+			for _, item := range staged {
+				defer os.Remove(item.tempPath)
+			}
+			content, err := os.ReadFile(staged[1].tempPath)
+			if err != nil {
+				t.Fatalf("read staged attachment: %v", err)
+			}
+			if string(content) != "content of attachments/12-notes.txt" {
+				t.Fatalf("unexpected attachment content: %q", content)
+			}
+		})
+	}
+}
+
+func TestWriteBundleRejectsUnknownFormat(t *testing.T) {
+	err := WriteBundle(io.Discard, "rar", nil)
+	if !errors.Is(err, ErrUnsupportedBundleFormat) {
+		t.Fatalf("expected ErrUnsupportedBundleFormat, got %v", err)
+	}
+}
+
+func mustSpecFromChallenge(t *testing.T, detail admin.ChallengeDetail) ChallengeSpec {
+	t.Helper()
+	spec, err := SpecFromChallenge(detail)
+	if err != nil {
+		t.Fatalf("spec from challenge: %v", err)
+	}
+	return spec
+}
+
+// unpackBundle extracts a bundle below root and returns its entry names in
+// archive order.
+func unpackBundle(t *testing.T, format string, data []byte, root string) []string {
+	t.Helper()
+	names := []string{}
+	extract := func(name string, content io.Reader) {
+		names = append(names, name)
+		target := filepath.Join(root, filepath.FromSlash(name))
+		body, err := io.ReadAll(content)
+		if err != nil {
+			t.Fatalf("read bundle entry %s: %v", name, err)
+		}
+		mustWriteFile(t, target, string(body))
+	}
+
+	if format == BundleFormatZip {
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("open zip bundle: %v", err)
+		}
+		for _, file := range reader.File {
+			entry, err := file.Open()
+			if err != nil {
+				t.Fatalf("open zip entry: %v", err)
+			}
+			extract(file.Name, entry)
+			entry.Close()
+		}
+		return names
+	}
+
+	compressed, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("open tar.gz bundle: %v", err)
+	}
+	reader := tar.NewReader(compressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("read tar entry: %v", err)
+		}
+		extract(header.Name, reader)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"ctf/backend/internal/admin"
 	"ctf/backend/internal/challengecfg"
 	"ctf/backend/internal/game"
+	"ctf/backend/internal/runtime"
 	"ctf/backend/internal/store"
 )
 
@@ -75,22 +76,31 @@ type ChallengeContent struct {
 }
 
 type ChallengeOwnership struct {
-	Author string
+	Author  string
+	Authors []string
 }
 
 type ChallengeRuntime struct {
 	ImageName          string
 	Mode               string
+	Driver             string
+	Internal           bool
 	ExposedProtocol    string
 	ContainerPort      int
 	TTL                time.Duration
 	MemoryLimitMB      int
 	CPUMilli           int
 	MaxRenewCount      int
+	MaxRestartCount    int
 	MaxActiveInstances int
 	UserCooldown       time.Duration
 	Env                map[string]string
 	Command            []string
+	Hardening          runtime.Hardening
+	Services           []runtime.ServiceSpec
+	Readiness          runtime.ReadinessProbe
+	WarmPoolSize       int
+	NodeLabels         map[string]string
 	Enabled            bool
 }
 
@@ -283,6 +293,15 @@ func NormalizeSpec(spec ChallengeSpec) (ChallengeSpec, error) {
 	normalized.Content.Description = strings.TrimSpace(normalized.Content.Description)
 	normalized.Content.Author = strings.TrimSpace(normalized.Content.Author)
 	normalized.Ownership.Author = strings.TrimSpace(normalized.Ownership.Author)
+	if normalized.Ownership.Authors != nil {
+		authors := make([]string, 0, len(normalized.Ownership.Authors))
+		for _, author := range normalized.Ownership.Authors {
+			if author = strings.TrimSpace(author); author != "" {
+				authors = append(authors, author)
+			}
+		}
+		normalized.Ownership.Authors = authors
+	}
 	for i := range normalized.Attachments {
 		normalized.Attachments[i].Filename = strings.TrimSpace(normalized.Attachments[i].Filename)
 		normalized.Attachments[i].Source = strings.TrimSpace(normalized.Attachments[i].Source)
@@ -304,13 +323,16 @@ func NormalizeSpec(spec ChallengeSpec) (ChallengeSpec, error) {
 
 	runtimeCfg := *normalized.Runtime
 	runtimeCfg.ImageName = strings.TrimSpace(runtimeCfg.ImageName)
-	runtimeCfg.Mode = strings.ToLower(strings.TrimSpace(runtimeCfg.Mode))
-	if runtimeCfg.Mode == "" {
-		runtimeCfg.Mode = "per-user"
+	mode, ok := runtime.NormalizeMode(runtimeCfg.Mode)
+	if !ok {
+		return ChallengeSpec{}, fmt.Errorf("runtime.mode %q is not supported; only per-user and shared are allowed", normalized.Runtime.Mode)
 	}
-	if runtimeCfg.Mode != "per-user" {
-		return ChallengeSpec{}, fmt.Errorf("runtime.mode %q is not supported; only per-user is allowed", normalized.Runtime.Mode)
+	runtimeCfg.Mode = mode
+	driver, ok := runtime.NormalizeDriver(runtimeCfg.Driver)
+	if !ok {
+		return ChallengeSpec{}, fmt.Errorf("runtime.driver %q is not supported; only docker and process are allowed", normalized.Runtime.Driver)
 	}
+	runtimeCfg.Driver = driver
 
 	runtimeCfg.ExposedProtocol = strings.ToLower(strings.TrimSpace(runtimeCfg.ExposedProtocol))
 	if runtimeCfg.ExposedProtocol == "" {
@@ -321,6 +343,32 @@ func NormalizeSpec(spec ChallengeSpec) (ChallengeSpec, error) {
 	default:
 		return ChallengeSpec{}, fmt.Errorf("runtime.expose %q is not supported", normalized.Runtime.ExposedProtocol)
 	}
+	if runtimeCfg.Internal && runtimeCfg.ExposedProtocol != "http" && runtimeCfg.ExposedProtocol != "https" {
+		return ChallengeSpec{}, errors.New("runtime.internal requires expose http or https; internal instances are only reachable through the instance proxy")
+	}
+	hardening, err := runtime.NormalizeHardening(runtimeCfg.Hardening)
+	if err != nil {
+		return ChallengeSpec{}, fmt.Errorf("runtime.hardening: %w", err)
+	}
+	runtimeCfg.Hardening = hardening
+	services, err := runtime.NormalizeServices(runtimeCfg.Services)
+	if err != nil {
+		return ChallengeSpec{}, fmt.Errorf("runtime.services: %w", err)
+	}
+	runtimeCfg.Services = services
+	readiness, err := runtime.NormalizeReadinessProbe(runtimeCfg.Readiness)
+	if err != nil {
+		return ChallengeSpec{}, fmt.Errorf("runtime.readiness: %w", err)
+	}
+	runtimeCfg.Readiness = readiness
+	if err := runtime.ValidateWarmPoolSize(runtimeCfg.WarmPoolSize, runtimeCfg.Mode); err != nil {
+		return ChallengeSpec{}, fmt.Errorf("runtime.warm_pool_size: %w", err)
+	}
+	nodeLabels, err := runtime.NormalizeNodeLabels(runtimeCfg.NodeLabels)
+	if err != nil {
+		return ChallengeSpec{}, fmt.Errorf("runtime.node_labels: %w", err)
+	}
+	runtimeCfg.NodeLabels = nodeLabels
 
 	if runtimeCfg.ImageName == "" {
 		return ChallengeSpec{}, errors.New("runtime.image is required when runtime section is present")
@@ -340,6 +388,9 @@ func NormalizeSpec(spec ChallengeSpec) (ChallengeSpec, error) {
 	if runtimeCfg.MaxRenewCount < 0 {
 		return ChallengeSpec{}, errors.New("runtime.max_renew_count cannot be negative")
 	}
+	if runtimeCfg.MaxRestartCount < 0 {
+		return ChallengeSpec{}, errors.New("runtime.max_restart_count cannot be negative")
+	}
 	if runtimeCfg.MaxActiveInstances < 0 {
 		return ChallengeSpec{}, errors.New("runtime.max_active_instances cannot be negative")
 	}
@@ -352,6 +403,11 @@ func NormalizeSpec(spec ChallengeSpec) (ChallengeSpec, error) {
 	if runtimeCfg.Command == nil {
 		runtimeCfg.Command = []string{}
 	}
+	if runtimeCfg.Driver == runtime.DriverProcess {
+		if err := runtime.ValidateProcessRuntime(runtimeCfg.ImageName, runtimeCfg.ExposedProtocol, runtimeCfg.Command, runtimeCfg.Internal, len(runtimeCfg.Services), len(runtimeCfg.NodeLabels)); err != nil {
+			return ChallengeSpec{}, fmt.Errorf("runtime.driver: %w", err)
+		}
+	}
 	runtimeCfg.Enabled = true
 	normalized.Runtime = &runtimeCfg
 	return normalized, nil
@@ -366,12 +422,24 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 		runtimeEnv  = make(map[string]string)
 		runtimeCmd  []string
 		runtimeSeen bool
+		hardening   string
+		serviceList string
 		attachment  *AttachmentSpec
+		block       *blockScalar
 	)
 
 	for scanner.Scan() {
 		lineNumber++
 		raw := scanner.Text()
+		if block != nil {
+			if block.add(raw) {
+				continue
+			}
+			if err := assignScalar(&spec, section, block.key, block.value()); err != nil {
+				return ChallengeSpec{}, fmt.Errorf("line %d: %w", block.line, err)
+			}
+			block = nil
+		}
 		trimmed := strings.TrimSpace(stripComment(raw))
 		if trimmed == "" {
 			continue
@@ -388,6 +456,8 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 			}
 			section = strings.TrimSuffix(trimmed, ":")
 			nested = ""
+			hardening = ""
+			serviceList = ""
 			attachment = nil
 			if section == "runtime" && spec.Runtime == nil {
 				spec.Runtime = &ChallengeRuntime{Enabled: true}
@@ -417,8 +487,23 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 
 			if strings.HasSuffix(trimmed, ":") {
 				nested = strings.TrimSuffix(trimmed, ":")
+				hardening = ""
+				serviceList = ""
 				if section == "runtime" {
 					switch nested {
+					case "hardening", "services", "readiness":
+						if spec.Runtime == nil {
+							spec.Runtime = &ChallengeRuntime{Enabled: true}
+							runtimeSeen = true
+						}
+						continue
+					case "node_labels":
+						if spec.Runtime == nil {
+							spec.Runtime = &ChallengeRuntime{Enabled: true}
+							runtimeSeen = true
+						}
+						spec.Runtime.NodeLabels = make(map[string]string)
+						continue
 					case "env":
 						if spec.Runtime == nil {
 							spec.Runtime = &ChallengeRuntime{Enabled: true}
@@ -444,7 +529,11 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 			}
 			nested = ""
 			attachment = nil
-			if err := assignScalar(&spec, section, key, value); err != nil {
+			if value == "|" || value == "|-" {
+				block = &blockScalar{key: key, line: lineNumber, keepNewline: value == "|"}
+				continue
+			}
+			if err := assignScalar(&spec, section, key, normalizeScalar(value)); err != nil {
 				return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
 			}
 			continue
@@ -473,6 +562,56 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 						spec.Runtime.Env = runtimeEnv
 					}
 					continue
+				case "node_labels":
+					key, value, err := splitKeyValue(trimmed)
+					if err != nil {
+						return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					spec.Runtime.NodeLabels[key] = normalizeScalar(value)
+					continue
+				case "readiness":
+					key, value, err := splitKeyValue(trimmed)
+					if err != nil {
+						return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					if err := assignReadinessScalar(&spec.Runtime.Readiness, key, value); err != nil {
+						return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					continue
+				case "services":
+					content, ok := strings.CutPrefix(trimmed, "- ")
+					if !ok {
+						return ChallengeSpec{}, fmt.Errorf("line %d: runtime.services items must start with '- '", lineNumber)
+					}
+					spec.Runtime.Services = append(spec.Runtime.Services, runtime.ServiceSpec{})
+					serviceList = ""
+					if content = strings.TrimSpace(content); content != "" {
+						key, value, err := splitKeyValue(content)
+						if err != nil {
+							return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+						}
+						if err := assignServiceScalar(lastService(spec.Runtime), key, value); err != nil {
+							return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+						}
+					}
+					continue
+				case "hardening":
+					if strings.HasSuffix(trimmed, ":") {
+						hardening = strings.TrimSuffix(trimmed, ":")
+						if err := startHardeningList(&spec.Runtime.Hardening, hardening); err != nil {
+							return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+						}
+						continue
+					}
+					hardening = ""
+					key, value, err := splitKeyValue(trimmed)
+					if err != nil {
+						return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					if err := assignHardeningScalar(&spec.Runtime.Hardening, key, value); err != nil {
+						return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+					}
+					continue
 				}
 				return ChallengeSpec{}, fmt.Errorf("line %d: unsupported nested runtime section %q", lineNumber, nested)
 			}
@@ -489,11 +628,67 @@ func parseSpec(scanner *bufio.Scanner) (ChallengeSpec, error) {
 			return ChallengeSpec{}, fmt.Errorf("line %d: nested values are only supported under runtime and attachments", lineNumber)
 		}
 
-		return ChallengeSpec{}, fmt.Errorf("line %d: nesting deeper than 4 spaces is not supported", lineNumber)
+		if indent == 6 && section == "runtime" && nested == "services" && len(spec.Runtime.Services) > 0 {
+			service := lastService(spec.Runtime)
+			if strings.HasSuffix(trimmed, ":") {
+				serviceList = strings.TrimSuffix(trimmed, ":")
+				switch serviceList {
+				case "env":
+					service.Env = make(map[string]string)
+				case "command":
+					service.Command = []string{}
+				default:
+					return ChallengeSpec{}, fmt.Errorf("line %d: unsupported runtime.services list %q", lineNumber, serviceList)
+				}
+				continue
+			}
+			serviceList = ""
+			key, value, err := splitKeyValue(trimmed)
+			if err != nil {
+				return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if err := assignServiceScalar(service, key, value); err != nil {
+				return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			continue
+		}
+
+		if indent == 8 && section == "runtime" && nested == "services" && serviceList != "" {
+			service := lastService(spec.Runtime)
+			switch serviceList {
+			case "env":
+				key, value, err := splitKeyValue(trimmed)
+				if err != nil {
+					return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				service.Env[key] = normalizeScalar(value)
+			case "command":
+				value, ok := strings.CutPrefix(trimmed, "- ")
+				if !ok {
+					return ChallengeSpec{}, fmt.Errorf("line %d: command items must use '- value'", lineNumber)
+				}
+				service.Command = append(service.Command, strings.TrimSpace(value))
+			}
+			continue
+		}
+
+		if indent == 6 && section == "runtime" && nested == "hardening" && hardening != "" {
+			if err := assignHardeningItem(&spec.Runtime.Hardening, hardening, trimmed); err != nil {
+				return ChallengeSpec{}, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			continue
+		}
+
+		return ChallengeSpec{}, fmt.Errorf("line %d: unsupported nesting; only runtime.hardening and runtime.services go deeper than 4 spaces", lineNumber)
 	}
 	if err := scanner.Err(); err != nil {
 		return ChallengeSpec{}, fmt.Errorf("scan challenge spec: %w", err)
 	}
+	if block != nil {
+		if err := assignScalar(&spec, section, block.key, block.value()); err != nil {
+			return ChallengeSpec{}, fmt.Errorf("line %d: %w", block.line, err)
+		}
+	}
 	if runtimeSeen && spec.Runtime == nil {
 		spec.Runtime = &ChallengeRuntime{Enabled: true}
 	}
@@ -571,6 +766,26 @@ func upsertRuntimeConfig(ctx context.Context, tx *sql.Tx, challengeID int64, cfg
 	if err != nil {
 		return fmt.Errorf("encode runtime command: %w", err)
 	}
+	hardeningJSON, err := json.Marshal(cfg.Hardening)
+	if err != nil {
+		return fmt.Errorf("encode runtime hardening: %w", err)
+	}
+	servicesJSON, err := json.Marshal(cfg.Services)
+	if err != nil {
+		return fmt.Errorf("encode runtime services: %w", err)
+	}
+	readinessJSON, err := json.Marshal(cfg.Readiness)
+	if err != nil {
+		return fmt.Errorf("encode runtime readiness: %w", err)
+	}
+	nodeLabels := cfg.NodeLabels
+	if nodeLabels == nil {
+		nodeLabels = map[string]string{}
+	}
+	nodeLabelsJSON, err := json.Marshal(nodeLabels)
+	if err != nil {
+		return fmt.Errorf("encode runtime node labels: %w", err)
+	}
 
 	const query = `
 INSERT INTO challenge_runtime_configs (
@@ -587,8 +802,17 @@ INSERT INTO challenge_runtime_configs (
     env_json,
     command_json,
     enabled,
+    mode,
+    network_internal,
+    hardening_json,
+    services_json,
+    readiness_json,
+    warm_pool_size,
+    node_labels_json,
+    max_restart_count,
+    driver,
     updated_at
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW())
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NOW())
 ON CONFLICT (challenge_id) DO UPDATE SET
     image_name = EXCLUDED.image_name,
     exposed_protocol = EXCLUDED.exposed_protocol,
@@ -602,6 +826,16 @@ ON CONFLICT (challenge_id) DO UPDATE SET
     env_json = EXCLUDED.env_json,
     command_json = EXCLUDED.command_json,
     enabled = EXCLUDED.enabled,
+    mode = EXCLUDED.mode,
+    network_internal = EXCLUDED.network_internal,
+    hardening_json = EXCLUDED.hardening_json,
+    services_json = EXCLUDED.services_json,
+    readiness_json = EXCLUDED.readiness_json,
+    warm_pool_size = EXCLUDED.warm_pool_size,
+    node_labels_json = EXCLUDED.node_labels_json,
+    max_restart_count = EXCLUDED.max_restart_count,
+    driver = EXCLUDED.driver,
+    image_digest = CASE WHEN challenge_runtime_configs.image_name = EXCLUDED.image_name THEN challenge_runtime_configs.image_digest ELSE '' END,
     updated_at = NOW()
 `
 	if _, err := tx.ExecContext(ctx, query,
@@ -618,6 +852,15 @@ ON CONFLICT (challenge_id) DO UPDATE SET
 		envJSON,
 		commandJSON,
 		cfg.Enabled,
+		cfg.Mode,
+		cfg.Internal,
+		hardeningJSON,
+		servicesJSON,
+		readinessJSON,
+		cfg.WarmPoolSize,
+		nodeLabelsJSON,
+		cfg.MaxRestartCount,
+		cfg.Driver,
 	); err != nil {
 		return fmt.Errorf("upsert runtime config for challenge %d: %w", challengeID, err)
 	}
@@ -749,8 +992,44 @@ func sanitizeFilename(name string) string {
 	return name
 }
 
+// blockScalar collects the lines of a "key: |" value. Lines indented by at
+// least 4 spaces belong to the value and are kept verbatim, without comment
+// stripping or quote handling; blank lines are kept as well.
+type blockScalar struct {
+	key         string
+	line        int
+	keepNewline bool
+	lines       []string
+}
+
+func (b *blockScalar) add(raw string) bool {
+	if strings.TrimSpace(raw) == "" {
+		b.lines = append(b.lines, "")
+		return true
+	}
+	content, ok := strings.CutPrefix(raw, "    ")
+	if !ok {
+		return false
+	}
+	b.lines = append(b.lines, content)
+	return true
+}
+
+// value joins the collected lines. Trailing blank lines are dropped; "|"
+// keeps a single final newline and "|-" none, as in YAML.
+func (b *blockScalar) value() string {
+	lines := b.lines
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	value := strings.Join(lines, "\n")
+	if b.keepNewline && value != "" {
+		value += "\n"
+	}
+	return value
+}
+
 func assignScalar(spec *ChallengeSpec, section, key, value string) error {
-	value = normalizeScalar(value)
 	switch section {
 	case "meta":
 		switch key {
@@ -813,6 +1092,14 @@ func assignScalar(spec *ChallengeSpec, section, key, value string) error {
 		switch key {
 		case "author":
 			spec.Ownership.Author = value
+		case "authors":
+			// Comma separated usernames or emails, e.g. "authors: alice, bob".
+			spec.Ownership.Authors = []string{}
+			for _, item := range strings.Split(value, ",") {
+				if item = normalizeScalar(item); item != "" {
+					spec.Ownership.Authors = append(spec.Ownership.Authors, item)
+				}
+			}
 		default:
 			return fmt.Errorf("unsupported ownership key %q", key)
 		}
@@ -825,6 +1112,14 @@ func assignScalar(spec *ChallengeSpec, section, key, value string) error {
 			spec.Runtime.ImageName = value
 		case "mode":
 			spec.Runtime.Mode = value
+		case "driver":
+			spec.Runtime.Driver = value
+		case "internal":
+			parsed, err := parseBool(value)
+			if err != nil {
+				return fmt.Errorf("runtime.internal must be boolean")
+			}
+			spec.Runtime.Internal = parsed
 		case "expose":
 			spec.Runtime.ExposedProtocol = value
 		case "container_port":
@@ -857,12 +1152,24 @@ func assignScalar(spec *ChallengeSpec, section, key, value string) error {
 				return fmt.Errorf("runtime.max_renew_count must be numeric")
 			}
 			spec.Runtime.MaxRenewCount = parsed
+		case "max_restart_count":
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("runtime.max_restart_count must be numeric")
+			}
+			spec.Runtime.MaxRestartCount = parsed
 		case "max_active_instances":
 			parsed, err := strconv.Atoi(value)
 			if err != nil {
 				return fmt.Errorf("runtime.max_active_instances must be numeric")
 			}
 			spec.Runtime.MaxActiveInstances = parsed
+		case "warm_pool_size":
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("runtime.warm_pool_size must be numeric")
+			}
+			spec.Runtime.WarmPoolSize = parsed
 		case "user_cooldown":
 			parsed, err := time.ParseDuration(value)
 			if err != nil {
@@ -890,6 +1197,158 @@ func assignScalar(spec *ChallengeSpec, section, key, value string) error {
 	return nil
 }
 
+func assignReadinessScalar(probe *runtime.ReadinessProbe, key, value string) error {
+	value = normalizeScalar(value)
+	switch key {
+	case "type":
+		probe.Type = value
+	case "path":
+		probe.Path = value
+	case "expected_status":
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("runtime.readiness.expected_status must be numeric")
+		}
+		probe.ExpectedStatus = parsed
+	case "timeout":
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("runtime.readiness.timeout must be a valid duration")
+		}
+		probe.TimeoutSeconds = int(parsed / time.Second)
+	default:
+		return fmt.Errorf("unsupported runtime.readiness key %q", key)
+	}
+	return nil
+}
+
+func lastService(cfg *ChallengeRuntime) *runtime.ServiceSpec {
+	return &cfg.Services[len(cfg.Services)-1]
+}
+
+func assignServiceScalar(service *runtime.ServiceSpec, key, value string) error {
+	value = normalizeScalar(value)
+	switch key {
+	case "name":
+		service.Name = value
+	case "image":
+		service.Image = value
+	case "memory_limit_mb":
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("runtime.services.memory_limit_mb must be numeric")
+		}
+		service.MemoryLimitMB = parsed
+	case "cpu_limit_millicores":
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("runtime.services.cpu_limit_millicores must be numeric")
+		}
+		service.CPUMilli = parsed
+	default:
+		return fmt.Errorf("unsupported runtime.services key %q", key)
+	}
+	return nil
+}
+
+func startHardeningList(h *runtime.Hardening, key string) error {
+	switch key {
+	case "cap_add":
+		h.CapAdd = []string{}
+	case "tmpfs":
+		h.Tmpfs = make(map[string]string)
+	case "ulimits":
+	default:
+		return fmt.Errorf("unsupported runtime.hardening list %q", key)
+	}
+	return nil
+}
+
+func assignHardeningScalar(h *runtime.Hardening, key, value string) error {
+	value = normalizeScalar(value)
+	switch key {
+	case "read_only_rootfs":
+		parsed, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("runtime.hardening.read_only_rootfs must be boolean")
+		}
+		h.ReadOnlyRootfs = parsed
+	case "no_new_privileges":
+		parsed, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("runtime.hardening.no_new_privileges must be boolean")
+		}
+		h.NoNewPrivileges = &parsed
+	case "pids_limit":
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("runtime.hardening.pids_limit must be numeric")
+		}
+		h.PidsLimit = parsed
+	case "disk_quota_mb":
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("runtime.hardening.disk_quota_mb must be numeric")
+		}
+		h.DiskQuotaMB = parsed
+	case "seccomp_profile":
+		h.SeccompProfile = value
+	case "user":
+		h.User = value
+	case "cap_add":
+		// Inline form, e.g. "cap_add: []" to drop every capability.
+		inner, ok := strings.CutPrefix(value, "[")
+		inner, ok2 := strings.CutSuffix(inner, "]")
+		if !ok || !ok2 {
+			return fmt.Errorf("runtime.hardening.cap_add must be a list")
+		}
+		h.CapAdd = []string{}
+		for _, item := range strings.Split(inner, ",") {
+			if item = normalizeScalar(item); item != "" {
+				h.CapAdd = append(h.CapAdd, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported runtime.hardening key %q", key)
+	}
+	return nil
+}
+
+func assignHardeningItem(h *runtime.Hardening, list, line string) error {
+	switch list {
+	case "cap_add":
+		value, ok := strings.CutPrefix(line, "- ")
+		if !ok {
+			return fmt.Errorf("runtime.hardening.cap_add items must use '- value'")
+		}
+		h.CapAdd = append(h.CapAdd, normalizeScalar(value))
+	case "tmpfs":
+		path, options, err := splitKeyValue(line)
+		if err != nil {
+			return err
+		}
+		h.Tmpfs[path] = normalizeScalar(options)
+	case "ulimits":
+		name, value, err := splitKeyValue(line)
+		if err != nil {
+			return err
+		}
+		softValue, hardValue, _ := strings.Cut(normalizeScalar(value), ":")
+		soft, err := strconv.ParseInt(strings.TrimSpace(softValue), 10, 64)
+		if err != nil {
+			return fmt.Errorf("runtime.hardening.ulimits.%s must be soft or soft:hard", name)
+		}
+		hard := soft
+		if hardValue != "" {
+			if hard, err = strconv.ParseInt(strings.TrimSpace(hardValue), 10, 64); err != nil {
+				return fmt.Errorf("runtime.hardening.ulimits.%s must be soft or soft:hard", name)
+			}
+		}
+		h.Ulimits = append(h.Ulimits, runtime.Ulimit{Name: name, Soft: soft, Hard: hard})
+	}
+	return nil
+}
+
 func assignAttachmentScalar(attachment *AttachmentSpec, key, value string) error {
 	value = normalizeScalar(value)
 	switch key {
@@ -958,11 +1417,22 @@ func stripComment(line string) string {
 }
 
 func normalizedOwnerRefs(spec ChallengeSpec) []string {
-	refs := make([]string, 0, 2)
-	if value := strings.TrimSpace(spec.Ownership.Author); value != "" {
-		refs = append(refs, value)
-	}
-	if value := strings.TrimSpace(spec.Content.Author); value != "" && value != strings.TrimSpace(spec.Ownership.Author) {
+	candidates := make([]string, 0, len(spec.Ownership.Authors)+2)
+	candidates = append(candidates, spec.Ownership.Author)
+	candidates = append(candidates, spec.Ownership.Authors...)
+	candidates = append(candidates, spec.Content.Author)
+
+	refs := make([]string, 0, len(candidates))
+	seen := make(map[string]struct{}, len(candidates))
+	for _, value := range candidates {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
 		refs = append(refs, value)
 	}
 	return refs
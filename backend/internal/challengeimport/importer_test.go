@@ -2,6 +2,7 @@ package challengeimport
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"ctf/backend/internal/game"
+	"ctf/backend/internal/runtime"
 )
 
 func TestParseSpecParsesCurrentTemplateShape(t *testing.T) {
@@ -34,6 +36,7 @@ ownership:
 runtime:
   image: ctf/web-welcome:dev
   mode: per-user
+  internal: true
   expose: http
   container_port: 80
   ttl: 30m
@@ -69,6 +72,9 @@ attachments:
 	if spec.Runtime == nil {
 		t.Fatal("expected runtime config")
 	}
+	if !spec.Runtime.Internal {
+		t.Fatal("expected internal runtime flag")
+	}
 	if spec.Runtime.TTL != 30*time.Minute {
 		t.Fatalf("unexpected ttl: %s", spec.Runtime.TTL)
 	}
@@ -83,6 +89,245 @@ attachments:
 	}
 }
 
+func TestParseSpecParsesRuntimeHardening(t *testing.T) {
+	spec, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: pwn-heap
+  title: Heap
+  category: pwn
+  points: 300
+  dynamic: true
+flag:
+  type: static
+  value: flag{heap}
+runtime:
+  image: ctf/pwn-heap:dev
+  expose: tcp
+  container_port: 9999
+  ttl: 30m
+  hardening:
+    read_only_rootfs: true
+    no_new_privileges: false
+    pids_limit: 64
+    seccomp_profile: strict
+    cap_add:
+      - setuid
+      - SETGID
+    tmpfs:
+      /tmp: rw,size=16m
+    ulimits:
+      nofile: 512:1024
+      nproc: 32
+`)))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	hardening := spec.Runtime.Hardening
+	if !hardening.ReadOnlyRootfs || hardening.PidsLimit != 64 || hardening.SeccompProfile != "strict" {
+		t.Fatalf("unexpected hardening scalars: %+v", hardening)
+	}
+	if hardening.NoNewPrivileges == nil || *hardening.NoNewPrivileges {
+		t.Fatalf("expected no_new_privileges to be explicitly disabled, got %v", hardening.NoNewPrivileges)
+	}
+	if strings.Join(hardening.CapAdd, ",") != "SETUID,SETGID" {
+		t.Fatalf("unexpected capabilities: %v", hardening.CapAdd)
+	}
+	if hardening.Tmpfs["/tmp"] != "rw,size=16m" {
+		t.Fatalf("unexpected tmpfs: %v", hardening.Tmpfs)
+	}
+	if len(hardening.Ulimits) != 2 || hardening.Ulimits[0].Hard != 1024 || hardening.Ulimits[1].Hard != 32 {
+		t.Fatalf("unexpected ulimits: %+v", hardening.Ulimits)
+	}
+}
+
+func TestParseSpecParsesRuntimeServices(t *testing.T) {
+	spec, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: web-notes
+  title: Notes
+  category: web
+  points: 200
+  dynamic: true
+flag:
+  type: static
+  value: flag{notes}
+runtime:
+  image: ctf/web-notes:dev
+  expose: http
+  container_port: 80
+  ttl: 30m
+  env:
+    DB_HOST: db
+  services:
+    - name: db
+      image: mysql:8
+      memory_limit_mb: 256
+      env:
+        MYSQL_ROOT_PASSWORD: root
+    - name: bot
+      image: ctf/notes-bot:dev
+      cpu_limit_millicores: 250
+      command:
+        - node
+        - bot.js
+`)))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	services := spec.Runtime.Services
+	if len(services) != 2 {
+		t.Fatalf("expected two services, got %+v", services)
+	}
+	if services[0].Name != "db" || services[0].Image != "mysql:8" || services[0].MemoryLimitMB != 256 || services[0].Env["MYSQL_ROOT_PASSWORD"] != "root" {
+		t.Fatalf("unexpected db service: %+v", services[0])
+	}
+	if services[1].CPUMilli != 250 || strings.Join(services[1].Command, " ") != "node bot.js" {
+		t.Fatalf("unexpected bot service: %+v", services[1])
+	}
+	if spec.Runtime.Env["DB_HOST"] != "db" {
+		t.Fatalf("expected entrypoint env to be kept, got %+v", spec.Runtime.Env)
+	}
+}
+
+func TestParseSpecParsesReadinessProbe(t *testing.T) {
+	spec, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: web-slow
+  title: Slow
+  category: web
+  points: 100
+  dynamic: true
+flag:
+  type: static
+  value: flag{slow}
+runtime:
+  image: ctf/web-slow:dev
+  expose: http
+  container_port: 80
+  ttl: 30m
+  readiness:
+    type: HTTP
+    path: /healthz
+    timeout: 90s
+`)))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	probe := spec.Runtime.Readiness
+	if probe.Type != "http" || probe.Path != "/healthz" || probe.ExpectedStatus != 200 || probe.TimeoutSeconds != 90 {
+		t.Fatalf("unexpected readiness probe: %+v", probe)
+	}
+}
+
+func TestParseSpecParsesNodeLabels(t *testing.T) {
+	spec, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: pwn-gpu
+  title: GPU
+  category: pwn
+  points: 100
+  dynamic: true
+flag:
+  type: static
+  value: flag{gpu}
+runtime:
+  image: ctf/pwn-gpu:dev
+  expose: tcp
+  container_port: 9999
+  ttl: 30m
+  node_labels:
+    gpu: "true"
+    zone: b
+`)))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	labels := spec.Runtime.NodeLabels
+	if len(labels) != 2 || labels["gpu"] != "true" || labels["zone"] != "b" {
+		t.Fatalf("unexpected node labels: %#v", labels)
+	}
+}
+
+func TestParseSpecValidatesProcessDriver(t *testing.T) {
+	const spec = `
+meta:
+  slug: pwn-echo
+  title: Echo
+  category: pwn
+  points: 100
+  dynamic: true
+flag:
+  type: static
+  value: flag{echo}
+runtime:
+  image: pwn-echo
+  driver: process
+  expose: %s
+  container_port: 9999
+  ttl: 30m
+  command:
+    - /pwn
+`
+	parsed, err := parseSpec(bufio.NewScanner(strings.NewReader(fmt.Sprintf(spec, "tcp"))))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	if parsed.Runtime.Driver != runtime.DriverProcess {
+		t.Fatalf("unexpected driver %q", parsed.Runtime.Driver)
+	}
+	if _, err := parseSpec(bufio.NewScanner(strings.NewReader(fmt.Sprintf(spec, "http")))); err == nil || !strings.Contains(err.Error(), "runtime.driver") {
+		t.Fatalf("expected process driver to reject http, got %v", err)
+	}
+}
+
+func TestParseSpecRejectsWarmPoolForSharedChallenge(t *testing.T) {
+	_, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: web-shared
+  title: Shared
+  category: web
+  points: 100
+  dynamic: true
+flag:
+  type: static
+  value: flag{shared}
+runtime:
+  image: ctf/web-shared:dev
+  mode: shared
+  expose: http
+  container_port: 80
+  ttl: 30m
+  warm_pool_size: 2
+`)))
+	if err == nil || !strings.Contains(err.Error(), "runtime.warm_pool_size") {
+		t.Fatalf("expected warm pool error, got %v", err)
+	}
+}
+
+func TestParseSpecRejectsAllCapability(t *testing.T) {
+	_, err := parseSpec(bufio.NewScanner(strings.NewReader(`
+meta:
+  slug: demo
+  title: Demo
+  category: pwn
+  points: 100
+  dynamic: true
+flag:
+  type: static
+  value: flag{demo}
+runtime:
+  image: ctf/demo:dev
+  expose: tcp
+  container_port: 9999
+  ttl: 30m
+  hardening:
+    cap_add: [ALL]
+`)))
+	if err == nil || !strings.Contains(err.Error(), "runtime.hardening: cap_add") {
+		t.Fatalf("expected capability error, got %v", err)
+	}
+}
+
 func TestNormalizeSpecAppliesDefaultsAndFlagNormalization(t *testing.T) {
 	normalized, err := NormalizeSpec(ChallengeSpec{
 		Meta: ChallengeMeta{
@@ -152,23 +397,94 @@ func TestNormalizedOwnerRefsPrefersExplicitOwnershipAndKeepsCompatibility(t *tes
 	}
 }
 
+func TestParseSpecParsesBlockScalarsAndAuthorLists(t *testing.T) {
+	spec, err := parseSpec(bufio.NewScanner(strings.NewReader(`meta:
+  slug: notes
+  title: Notes
+  category: misc
+  points: 100
+flag:
+  value: flag{notes}
+content:
+  description: |
+    # Notes
+
+    Read "notes.txt" # not a comment
+      indented line
+ownership:
+  author: alice
+  authors: bob, 'carol@example.com', alice
+`)))
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	want := "# Notes\n\nRead \"notes.txt\" # not a comment\n  indented line"
+	if spec.Content.Description != want {
+		t.Fatalf("unexpected description: %q", spec.Content.Description)
+	}
+	if len(spec.Ownership.Authors) != 3 || spec.Ownership.Authors[1] != "carol@example.com" {
+		t.Fatalf("unexpected authors: %+v", spec.Ownership.Authors)
+	}
+	refs := normalizedOwnerRefs(spec)
+	if strings.Join(refs, ",") != "alice,bob,carol@example.com" {
+		t.Fatalf("unexpected owner refs: %+v", refs)
+	}
+}
+
 func TestNormalizeSpecRejectsUnsupportedRuntimeMode(t *testing.T) {
 	_, err := NormalizeSpec(ChallengeSpec{
 		Meta: ChallengeMeta{Slug: "demo", Title: "Demo", Category: "web", Points: 100, Dynamic: true},
 		Flag: ChallengeFlag{Type: game.FlagTypeStatic, Value: "flag{demo}"},
 		Runtime: &ChallengeRuntime{
 			ImageName:       "ctf/demo:dev",
-			Mode:            "shared",
+			Mode:            "cluster",
 			ExposedProtocol: "http",
 			ContainerPort:   80,
 			TTL:             30 * time.Minute,
 		},
 	})
-	if err == nil || !strings.Contains(err.Error(), "only per-user is allowed") {
+	if err == nil || !strings.Contains(err.Error(), "only per-user and shared are allowed") {
 		t.Fatalf("expected unsupported mode error, got %v", err)
 	}
 }
 
+func TestNormalizeSpecAcceptsSharedRuntimeMode(t *testing.T) {
+	spec, err := NormalizeSpec(ChallengeSpec{
+		Meta: ChallengeMeta{Slug: "demo", Title: "Demo", Category: "web", Points: 100, Dynamic: true},
+		Flag: ChallengeFlag{Type: game.FlagTypeStatic, Value: "flag{demo}"},
+		Runtime: &ChallengeRuntime{
+			ImageName:       "ctf/demo:dev",
+			Mode:            " Shared ",
+			ExposedProtocol: "tcp",
+			ContainerPort:   8545,
+			TTL:             30 * time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("normalize shared spec: %v", err)
+	}
+	if spec.Runtime.Mode != "shared" {
+		t.Fatalf("expected shared mode, got %q", spec.Runtime.Mode)
+	}
+}
+
+func TestNormalizeSpecRejectsInternalRuntimeWithoutHTTP(t *testing.T) {
+	_, err := NormalizeSpec(ChallengeSpec{
+		Meta: ChallengeMeta{Slug: "demo", Title: "Demo", Category: "pwn", Points: 100, Dynamic: true},
+		Flag: ChallengeFlag{Type: game.FlagTypeStatic, Value: "flag{demo}"},
+		Runtime: &ChallengeRuntime{
+			ImageName:       "ctf/demo:dev",
+			Internal:        true,
+			ExposedProtocol: "tcp",
+			ContainerPort:   9999,
+			TTL:             30 * time.Minute,
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "runtime.internal requires expose http or https") {
+		t.Fatalf("expected internal runtime error, got %v", err)
+	}
+}
+
 func TestNormalizeSpecRejectsAttachmentWithoutSource(t *testing.T) {
 	_, err := NormalizeSpec(ChallengeSpec{
 		Meta:        ChallengeMeta{Slug: "demo", Title: "Demo", Category: "web", Points: 100},
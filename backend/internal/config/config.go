@@ -22,11 +22,49 @@ type Config struct {
 	JWTTTL                           time.Duration
 	InstanceSweeperPollInterval      string
 	DockerSocketPath                 string
+	RuntimeDockerNodesFile           string
 	PublicBaseURL                    string
 	RuntimePublicBaseURL             string
 	RuntimePortMin                   int
 	RuntimePortMax                   int
 	RuntimeBindAddr                  string
+	RuntimeNetworkIsolation          string
+	RuntimeNetworkAttachContainer    string
+	RuntimeSeccompProfileDir         string
+	RuntimeStartWorkers              int
+	RuntimeStartQueueSize            int
+	RuntimeStatsInterval             time.Duration
+	RuntimeKillCPUPercent            int
+	RuntimeKillMemoryPercent         int
+	RuntimeKillPIDs                  int
+	RuntimeKillSustain               time.Duration
+	RuntimeIdleTimeout               time.Duration
+	RuntimeIdleWarning               time.Duration
+	RuntimeUserMaxInstances          int
+	RuntimeUserMaxMemoryMB           int
+	RuntimeMaxInstances              int
+	RuntimeMaxMemoryMB               int
+	RuntimeProcessRoot               string
+	RuntimeProcessUID                int
+	RuntimeProcessGID                int
+	RuntimeProcessChroot             bool
+	RuntimeProcessCgroup             string
+	RuntimeProxyDomain               string
+	RuntimeProxyScheme               string
+	RuntimeProxySecret               string
+	RuntimeProxyNetwork              string
+	RuntimeProxyRequireAccessCookie  bool
+	RuntimeGatewayAddr               string
+	RuntimeGatewayPublicAddr         string
+	RuntimeGatewayNetwork            string
+	RuntimeGatewayUpstreamHost       string
+	RuntimeGatewayTLSAddr            string
+	RuntimeGatewayTLSPublicAddr      string
+	RuntimeGatewayTLSDomain          string
+	RuntimeGatewayTLSCertFile        string
+	RuntimeGatewayTLSKeyFile         string
+	RuntimeGatewayMaxConns           int
+	RuntimeGatewayIdleTimeout        time.Duration
 	AttachmentStorageDir             string
 	RedisAddr                        string
 	RedisPassword                    string
@@ -40,6 +78,18 @@ type Config struct {
 	SubmissionRateLimitMax           int
 	AdminWriteRateLimitWindowSeconds int
 	AdminWriteRateLimitMax           int
+	PasswordMinLength                int
+	PasswordMinCharClasses           int
+	PasswordRejectUserSimilarity     bool
+	PasswordBundledBlocklist         bool
+	PasswordBlocklistPath            string
+	PowEnabled                       bool
+	PowSecret                        string
+	PowChallengeTTL                  time.Duration
+	PowBaseDifficulty                int
+	PowMaxDifficulty                 int
+	PowEscalationWindowSeconds       int
+	PowEscalationHitsPerLevel        int
 }
 
 func Load() Config {
@@ -51,11 +101,49 @@ func Load() Config {
 		JWTTTL:                           getDurationEnv("JWT_TTL", 24*time.Hour),
 		InstanceSweeperPollInterval:      getEnv("INSTANCE_SWEEPER_POLL_INTERVAL", "30s"),
 		DockerSocketPath:                 getEnv("DOCKER_SOCKET_PATH", "/var/run/docker.sock"),
+		RuntimeDockerNodesFile:           getEnv("RUNTIME_DOCKER_NODES_FILE", ""),
 		PublicBaseURL:                    getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
 		RuntimePublicBaseURL:             getEnv("RUNTIME_PUBLIC_BASE_URL", getEnv("PUBLIC_BASE_URL", "http://localhost:8080")),
 		RuntimePortMin:                   getIntEnv("RUNTIME_PORT_MIN", 0),
 		RuntimePortMax:                   getIntEnv("RUNTIME_PORT_MAX", 0),
 		RuntimeBindAddr:                  getEnv("RUNTIME_BIND_ADDR", "127.0.0.1"),
+		RuntimeNetworkIsolation:          getEnv("RUNTIME_NETWORK_ISOLATION", "none"),
+		RuntimeNetworkAttachContainer:    getEnv("RUNTIME_NETWORK_ATTACH_CONTAINER", ""),
+		RuntimeSeccompProfileDir:         getEnv("RUNTIME_SECCOMP_PROFILE_DIR", ""),
+		RuntimeStartWorkers:              getIntEnv("RUNTIME_START_WORKERS", 4),
+		RuntimeStartQueueSize:            getIntEnv("RUNTIME_START_QUEUE_SIZE", 256),
+		RuntimeStatsInterval:             getDurationEnv("RUNTIME_STATS_INTERVAL", 30*time.Second),
+		RuntimeKillCPUPercent:            getIntEnv("RUNTIME_KILL_CPU_PERCENT", 0),
+		RuntimeKillMemoryPercent:         getIntEnv("RUNTIME_KILL_MEMORY_PERCENT", 0),
+		RuntimeKillPIDs:                  getIntEnv("RUNTIME_KILL_PIDS", 0),
+		RuntimeKillSustain:               getDurationEnv("RUNTIME_KILL_SUSTAIN", 5*time.Minute),
+		RuntimeIdleTimeout:               getDurationEnv("RUNTIME_IDLE_TIMEOUT", 0),
+		RuntimeIdleWarning:               getDurationEnv("RUNTIME_IDLE_WARNING", 5*time.Minute),
+		RuntimeUserMaxInstances:          getIntEnv("RUNTIME_USER_MAX_INSTANCES", 0),
+		RuntimeUserMaxMemoryMB:           getIntEnv("RUNTIME_USER_MAX_MEMORY_MB", 0),
+		RuntimeMaxInstances:              getIntEnv("RUNTIME_MAX_INSTANCES", 0),
+		RuntimeMaxMemoryMB:               getIntEnv("RUNTIME_MAX_MEMORY_MB", 0),
+		RuntimeProcessRoot:               getEnv("RUNTIME_PROCESS_ROOT", ""),
+		RuntimeProcessUID:                getIntEnv("RUNTIME_PROCESS_UID", 0),
+		RuntimeProcessGID:                getIntEnv("RUNTIME_PROCESS_GID", 0),
+		RuntimeProcessChroot:             getBoolEnv("RUNTIME_PROCESS_CHROOT", true),
+		RuntimeProcessCgroup:             getEnv("RUNTIME_PROCESS_CGROUP", ""),
+		RuntimeProxyDomain:               getEnv("RUNTIME_PROXY_DOMAIN", ""),
+		RuntimeProxyScheme:               getEnv("RUNTIME_PROXY_SCHEME", "https"),
+		RuntimeProxySecret:               getEnv("RUNTIME_PROXY_SECRET", ""),
+		RuntimeProxyNetwork:              getEnv("RUNTIME_PROXY_NETWORK", ""),
+		RuntimeProxyRequireAccessCookie:  getBoolEnv("RUNTIME_PROXY_REQUIRE_ACCESS_COOKIE", true),
+		RuntimeGatewayAddr:               getEnv("RUNTIME_TCP_GATEWAY_ADDR", ""),
+		RuntimeGatewayPublicAddr:         getEnv("RUNTIME_TCP_GATEWAY_PUBLIC_ADDR", ""),
+		RuntimeGatewayNetwork:            getEnv("RUNTIME_TCP_GATEWAY_NETWORK", ""),
+		RuntimeGatewayUpstreamHost:       getEnv("RUNTIME_TCP_GATEWAY_UPSTREAM_HOST", ""),
+		RuntimeGatewayTLSAddr:            getEnv("RUNTIME_TCP_GATEWAY_TLS_ADDR", ""),
+		RuntimeGatewayTLSPublicAddr:      getEnv("RUNTIME_TCP_GATEWAY_TLS_PUBLIC_ADDR", ""),
+		RuntimeGatewayTLSDomain:          getEnv("RUNTIME_TCP_GATEWAY_TLS_DOMAIN", ""),
+		RuntimeGatewayTLSCertFile:        getEnv("RUNTIME_TCP_GATEWAY_TLS_CERT_FILE", ""),
+		RuntimeGatewayTLSKeyFile:         getEnv("RUNTIME_TCP_GATEWAY_TLS_KEY_FILE", ""),
+		RuntimeGatewayMaxConns:           getIntEnv("RUNTIME_TCP_GATEWAY_MAX_CONNS_PER_INSTANCE", 8),
+		RuntimeGatewayIdleTimeout:        getDurationEnv("RUNTIME_TCP_GATEWAY_IDLE_TIMEOUT", 5*time.Minute),
 		AttachmentStorageDir:             getEnv("ATTACHMENT_STORAGE_DIR", "/tmp/ctf-attachments"),
 		RedisAddr:                        getEnv("REDIS_ADDR", "redis:6379"),
 		RedisPassword:                    getEnv("REDIS_PASSWORD", ""),
@@ -69,10 +157,65 @@ func Load() Config {
 		SubmissionRateLimitMax:           getIntEnv("SUBMISSION_RATE_LIMIT_MAX", 10),
 		AdminWriteRateLimitWindowSeconds: getIntEnv("ADMIN_WRITE_RATE_LIMIT_WINDOW_SECONDS", 60),
 		AdminWriteRateLimitMax:           getIntEnv("ADMIN_WRITE_RATE_LIMIT_MAX", 30),
+		PasswordMinLength:                getIntEnv("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinCharClasses:           getIntEnv("PASSWORD_MIN_CHAR_CLASSES", 2),
+		PasswordRejectUserSimilarity:     getBoolEnv("PASSWORD_REJECT_USER_SIMILARITY", true),
+		PasswordBundledBlocklist:         getBoolEnv("PASSWORD_BUNDLED_BLOCKLIST", true),
+		PasswordBlocklistPath:            getEnv("PASSWORD_BLOCKLIST_PATH", ""),
+		PowEnabled:                       getBoolEnv("POW_ENABLED", false),
+		PowSecret:                        getEnv("POW_SECRET", ""),
+		PowChallengeTTL:                  getDurationEnv("POW_CHALLENGE_TTL", 2*time.Minute),
+		PowBaseDifficulty:                getIntEnv("POW_BASE_DIFFICULTY", 16),
+		PowMaxDifficulty:                 getIntEnv("POW_MAX_DIFFICULTY", 22),
+		PowEscalationWindowSeconds:       getIntEnv("POW_ESCALATION_WINDOW_SECONDS", 600),
+		PowEscalationHitsPerLevel:        getIntEnv("POW_ESCALATION_HITS_PER_LEVEL", 5),
 	}
 }
 
 func (c Config) Validate() error {
+	if err := validatePow(c); err != nil {
+		return err
+	}
+	if err := validateRuntimeProxy(c); err != nil {
+		return err
+	}
+	if err := validateRuntimeGateway(c); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(c.RuntimeNetworkIsolation)) {
+	case "", "none", "instance", "user":
+	default:
+		return fmt.Errorf("RUNTIME_NETWORK_ISOLATION must be none, instance or user")
+	}
+	if c.RuntimeStartWorkers < 0 {
+		return fmt.Errorf("RUNTIME_START_WORKERS must not be negative")
+	}
+	if c.RuntimeStartWorkers > 0 && c.RuntimeStartQueueSize <= 0 {
+		return fmt.Errorf("RUNTIME_START_QUEUE_SIZE must be positive when RUNTIME_START_WORKERS is set")
+	}
+	if c.RuntimeStatsInterval < 0 {
+		return fmt.Errorf("RUNTIME_STATS_INTERVAL must not be negative")
+	}
+	if c.RuntimeKillCPUPercent < 0 || c.RuntimeKillMemoryPercent < 0 || c.RuntimeKillPIDs < 0 {
+		return fmt.Errorf("RUNTIME_KILL_CPU_PERCENT, RUNTIME_KILL_MEMORY_PERCENT and RUNTIME_KILL_PIDS must not be negative")
+	}
+	if c.RuntimeKillMemoryPercent > 100 {
+		return fmt.Errorf("RUNTIME_KILL_MEMORY_PERCENT must not exceed 100")
+	}
+	if c.RuntimeIdleTimeout < 0 || c.RuntimeIdleWarning < 0 {
+		return fmt.Errorf("RUNTIME_IDLE_TIMEOUT and RUNTIME_IDLE_WARNING must not be negative")
+	}
+	// Without stats, instances reached on a published port show no activity
+	// and would be reclaimed while in use.
+	if c.RuntimeIdleTimeout > 0 && (c.RuntimeStatsInterval == 0 || c.RuntimeIdleTimeout <= 2*c.RuntimeStatsInterval) {
+		return fmt.Errorf("RUNTIME_IDLE_TIMEOUT needs RUNTIME_STATS_INTERVAL to be set and must exceed two sampling intervals")
+	}
+	if c.RuntimeUserMaxInstances < 0 || c.RuntimeUserMaxMemoryMB < 0 || c.RuntimeMaxInstances < 0 || c.RuntimeMaxMemoryMB < 0 {
+		return fmt.Errorf("RUNTIME_USER_MAX_INSTANCES, RUNTIME_USER_MAX_MEMORY_MB, RUNTIME_MAX_INSTANCES and RUNTIME_MAX_MEMORY_MB must not be negative")
+	}
+	if c.RuntimeProcessUID < 0 || c.RuntimeProcessGID < 0 {
+		return fmt.Errorf("RUNTIME_PROCESS_UID and RUNTIME_PROCESS_GID must not be negative")
+	}
 	if c.IsDevelopment() {
 		return nil
 	}
@@ -109,6 +252,79 @@ func validateRuntimePortRange(minPort, maxPort int) error {
 	return nil
 }
 
+func validatePow(c Config) error {
+	if !c.PowEnabled {
+		return nil
+	}
+	if c.PowBaseDifficulty < 0 || c.PowMaxDifficulty > 32 {
+		return fmt.Errorf("POW_BASE_DIFFICULTY and POW_MAX_DIFFICULTY must be within 0..32")
+	}
+	if c.PowBaseDifficulty > c.PowMaxDifficulty {
+		return fmt.Errorf("POW_BASE_DIFFICULTY must be <= POW_MAX_DIFFICULTY")
+	}
+	if c.PowChallengeTTL <= 0 {
+		return fmt.Errorf("POW_CHALLENGE_TTL must be positive")
+	}
+	return nil
+}
+
+func validateRuntimeProxy(c Config) error {
+	domain := strings.Trim(strings.TrimSpace(c.RuntimeProxyDomain), ".")
+	if domain == "" {
+		return nil
+	}
+	if strings.ContainsAny(domain, "/: ") {
+		return fmt.Errorf("RUNTIME_PROXY_DOMAIN must be a bare domain such as inst.example.com")
+	}
+	switch strings.ToLower(strings.TrimSpace(c.RuntimeProxyScheme)) {
+	case "http", "https":
+	default:
+		return fmt.Errorf("RUNTIME_PROXY_SCHEME must be http or https")
+	}
+	return nil
+}
+
+func validateRuntimeGateway(c Config) error {
+	tlsAddr := strings.TrimSpace(c.RuntimeGatewayTLSAddr)
+	if strings.TrimSpace(c.RuntimeGatewayAddr) == "" {
+		if tlsAddr != "" {
+			return fmt.Errorf("RUNTIME_TCP_GATEWAY_TLS_ADDR requires RUNTIME_TCP_GATEWAY_ADDR")
+		}
+		return nil
+	}
+	if c.RuntimeGatewayMaxConns <= 0 {
+		return fmt.Errorf("RUNTIME_TCP_GATEWAY_MAX_CONNS_PER_INSTANCE must be positive")
+	}
+	if c.RuntimeGatewayIdleTimeout <= 0 {
+		return fmt.Errorf("RUNTIME_TCP_GATEWAY_IDLE_TIMEOUT must be positive")
+	}
+	if tlsAddr == "" {
+		return nil
+	}
+	domain := strings.Trim(strings.TrimSpace(c.RuntimeGatewayTLSDomain), ".")
+	if domain == "" || strings.ContainsAny(domain, "/: ") {
+		return fmt.Errorf("RUNTIME_TCP_GATEWAY_TLS_DOMAIN must be a bare domain when RUNTIME_TCP_GATEWAY_TLS_ADDR is set")
+	}
+	if strings.TrimSpace(c.RuntimeGatewayTLSCertFile) == "" || strings.TrimSpace(c.RuntimeGatewayTLSKeyFile) == "" {
+		return fmt.Errorf("RUNTIME_TCP_GATEWAY_TLS_CERT_FILE and RUNTIME_TCP_GATEWAY_TLS_KEY_FILE must be set when RUNTIME_TCP_GATEWAY_TLS_ADDR is set")
+	}
+	return nil
+}
+
+func (c Config) RuntimeProxySigningSecret() string {
+	if secret := strings.TrimSpace(c.RuntimeProxySecret); secret != "" {
+		return secret
+	}
+	return c.JWTSecret
+}
+
+func (c Config) PowSigningSecret() string {
+	if secret := strings.TrimSpace(c.PowSecret); secret != "" {
+		return secret
+	}
+	return c.JWTSecret
+}
+
 func (c Config) IsDevelopment() bool {
 	return normalizeAppEnv(c.AppEnv) == developmentEnv
 }
@@ -147,6 +363,18 @@ func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	return parsed
 }
 
+func getBoolEnv(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func getIntEnv(key string, fallback int) int {
 	value := os.Getenv(key)
 	if value == "" {
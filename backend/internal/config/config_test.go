@@ -96,3 +96,68 @@ func TestConfigValidateAllowsEmptyRuntimePublicBaseURL(t *testing.T) {
 		t.Fatalf("expected validation to allow empty runtime public base URL: %v", err)
 	}
 }
+
+func TestConfigValidateRejectsInvalidPowDifficulty(t *testing.T) {
+	cfg := Config{AppEnv: "development", PowEnabled: true, PowBaseDifficulty: 20, PowMaxDifficulty: 16, PowChallengeTTL: time.Minute}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected base difficulty above max to fail validation")
+	}
+	cfg.PowMaxDifficulty = 24
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected pow config to validate: %v", err)
+	}
+}
+
+func TestConfigValidateRejectsInvalidRuntimeProxy(t *testing.T) {
+	cfg := Config{AppEnv: "development", RuntimeProxyDomain: "https://inst.example.com", RuntimeProxyScheme: "https"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected proxy domain with scheme to fail validation")
+	}
+	cfg.RuntimeProxyDomain = "inst.example.com"
+	cfg.RuntimeProxyScheme = "ftp"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected unsupported proxy scheme to fail validation")
+	}
+	cfg.RuntimeProxyScheme = "http"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected proxy config to validate: %v", err)
+	}
+}
+
+func TestConfigValidateRuntimeGateway(t *testing.T) {
+	cfg := Config{AppEnv: "development", RuntimeGatewayTLSAddr: ":9443"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected tls gateway without plain gateway to fail validation")
+	}
+	cfg.RuntimeGatewayAddr = ":9000"
+	cfg.RuntimeGatewayMaxConns = 8
+	cfg.RuntimeGatewayIdleTimeout = time.Minute
+	cfg.RuntimeGatewayTLSDomain = "tcp.example.com"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected tls gateway without certificate to fail validation")
+	}
+	cfg.RuntimeGatewayTLSCertFile = "/etc/ctf/tcp.crt"
+	cfg.RuntimeGatewayTLSKeyFile = "/etc/ctf/tcp.key"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected gateway config to validate: %v", err)
+	}
+	cfg.RuntimeGatewayMaxConns = 0
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected non-positive connection limit to fail validation")
+	}
+}
+
+func TestConfigValidateRuntimeIdleTimeout(t *testing.T) {
+	cfg := Config{AppEnv: "development", RuntimeIdleTimeout: 10 * time.Minute, RuntimeIdleWarning: 5 * time.Minute}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected idle timeout without stats sampling to fail validation")
+	}
+	cfg.RuntimeStatsInterval = 5 * time.Minute
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected idle timeout within two sampling intervals to fail validation")
+	}
+	cfg.RuntimeStatsInterval = 30 * time.Second
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected idle config to validate: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLogTail = 200
+	MaxLogTail     = 5000
+
+	maxExecArgs      = 32
+	maxExecArgLength = 1024
+	maxExecOutput    = 64 << 10
+	execTimeout      = 30 * time.Second
+)
+
+type LogOptions struct {
+	Tail       int
+	Follow     bool
+	Timestamps bool
+}
+
+type ExecResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Output    string `json:"output"`
+	Truncated bool   `json:"truncated"`
+}
+
+// NormalizeExecCommand checks a diagnostic command before it is run inside an
+// instance. Commands run without a shell, TTY or stdin, so the argv is passed
+// to the container as is.
+func NormalizeExecCommand(cmd []string) ([]string, error) {
+	if len(cmd) == 0 || strings.TrimSpace(cmd[0]) == "" {
+		return nil, fmt.Errorf("%w: command cannot be empty", ErrInvalidExecCommand)
+	}
+	if len(cmd) > maxExecArgs {
+		return nil, fmt.Errorf("%w: at most %d arguments are allowed", ErrInvalidExecCommand, maxExecArgs)
+	}
+	normalized := make([]string, len(cmd))
+	for i, arg := range cmd {
+		if len(arg) > maxExecArgLength {
+			return nil, fmt.Errorf("%w: arguments are limited to %d bytes", ErrInvalidExecCommand, maxExecArgLength)
+		}
+		if strings.ContainsRune(arg, 0) {
+			return nil, fmt.Errorf("%w: arguments cannot contain NUL bytes", ErrInvalidExecCommand)
+		}
+		normalized[i] = arg
+	}
+	normalized[0] = strings.TrimSpace(normalized[0])
+	return normalized, nil
+}
+
+// Logs streams the stdout and stderr of a container as plain text. The caller
+// closes the reader; with Follow it only ends when ctx is done or the
+// container exits.
+func (p *NodePool) Logs(ctx context.Context, nodeName, containerID string, opts LogOptions) (io.ReadCloser, error) {
+	node := p.node(nodeName)
+	if node == nil {
+		return nil, ErrNodeNotFound
+	}
+	return node.manager.Logs(ctx, containerID, opts)
+}
+
+// Exec runs a diagnostic command inside a container and collects its output.
+func (p *NodePool) Exec(ctx context.Context, nodeName, containerID string, cmd []string) (ExecResult, error) {
+	node := p.node(nodeName)
+	if node == nil {
+		return ExecResult{}, ErrNodeNotFound
+	}
+	return node.manager.Exec(ctx, containerID, cmd)
+}
+
+func (m *DockerManager) Logs(ctx context.Context, containerID string, opts LogOptions) (io.ReadCloser, error) {
+	tail := opts.Tail
+	if tail <= 0 {
+		tail = DefaultLogTail
+	}
+	if tail > MaxLogTail {
+		tail = MaxLogTail
+	}
+	query := url.Values{}
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	query.Set("tail", strconv.Itoa(tail))
+	query.Set("follow", strconv.FormatBool(opts.Follow))
+	query.Set("timestamps", strconv.FormatBool(opts.Timestamps))
+
+	client := m.client
+	if opts.Follow {
+		client = m.streamClient
+	}
+	resp, err := m.send(ctx, client, http.MethodGet, m.apiPath(fmt.Sprintf("/containers/%s/logs?%s", containerID, query.Encode())), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		if isDockerStatus(err, http.StatusNotFound) {
+			return nil, ErrInstanceNotFound
+		}
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := demuxDockerStream(writer, resp.Body)
+		resp.Body.Close()
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+func (m *DockerManager) Exec(ctx context.Context, containerID string, cmd []string) (ExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	resp, err := m.request(ctx, http.MethodPost, m.apiPath(fmt.Sprintf("/containers/%s/exec", containerID)), map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          false,
+		"Privileged":   false,
+		"Cmd":          cmd,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if err := expectStatus(resp, http.StatusCreated); err != nil {
+		resp.Body.Close()
+		if isDockerStatus(err, http.StatusNotFound) {
+			return ExecResult{}, ErrInstanceNotFound
+		}
+		return ExecResult{}, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("decode exec create response: %w", err)
+	}
+
+	resp, err = m.send(ctx, m.streamClient, http.MethodPost, m.apiPath(fmt.Sprintf("/exec/%s/start", created.ID)), map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return ExecResult{}, err
+	}
+	output := &limitedBuffer{limit: maxExecOutput}
+	err = demuxDockerStream(output, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("read exec output: %w", err)
+	}
+
+	resp, err = m.request(ctx, http.MethodGet, m.apiPath(fmt.Sprintf("/exec/%s/json", created.ID)), nil)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return ExecResult{}, err
+	}
+	var inspected struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return ExecResult{}, fmt.Errorf("decode exec inspect response: %w", err)
+	}
+	return ExecResult{
+		ExitCode:  inspected.ExitCode,
+		Output:    output.buf.String(),
+		Truncated: output.truncated,
+	}, nil
+}
+
+// demuxDockerStream copies the payload of a multiplexed stdout/stderr stream,
+// dropping the 8 byte frame headers Docker adds for containers without a TTY.
+func demuxDockerStream(dst io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(dst, src, size); err != nil {
+			return err
+		}
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest,
+// so a noisy command cannot grow the response without bound.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func dockerFrame(stream byte, payload string) []byte {
+	frame := make([]byte, 8, 8+len(payload))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func newDiagnosticsDocker(t *testing.T, handler http.HandlerFunc) *DockerManager {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen docker socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return NewDockerManagerWithConfig(socket, DockerManagerConfig{})
+}
+
+func TestDockerLogsDemultiplexesStreams(t *testing.T) {
+	manager := newDiagnosticsDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/c1/logs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("tail") != "20" || r.URL.Query().Get("stderr") != "true" {
+			t.Errorf("unexpected logs query %q", r.URL.RawQuery)
+		}
+		_, _ = w.Write(dockerFrame(1, "listening on :80\n"))
+		_, _ = w.Write(dockerFrame(2, "warning: debug mode\n"))
+	})
+
+	logs, err := manager.Logs(context.Background(), "c1", LogOptions{Tail: 20})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	defer logs.Close()
+	body, err := io.ReadAll(logs)
+	if err != nil || string(body) != "listening on :80\nwarning: debug mode\n" {
+		t.Fatalf("unexpected logs %q err=%v", body, err)
+	}
+
+	if _, err := manager.Logs(context.Background(), "gone", LogOptions{}); !errors.Is(err, ErrInstanceNotFound) {
+		t.Fatalf("expected missing container error, got %v", err)
+	}
+}
+
+func TestDockerExecCollectsOutputAndExitCode(t *testing.T) {
+	var created map[string]any
+	manager := newDiagnosticsDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/containers/c1/exec":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]string{"Id": "e1"})
+		case r.Method == http.MethodPost && r.URL.Path == "/exec/e1/start":
+			_, _ = w.Write(dockerFrame(1, "PID USER\n"))
+			_, _ = w.Write(dockerFrame(2, strings.Repeat("x", maxExecOutput)))
+		case r.Method == http.MethodGet && r.URL.Path == "/exec/e1/json":
+			_ = json.NewEncoder(w).Encode(map[string]any{"ExitCode": 3})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	result, err := manager.Exec(context.Background(), "c1", []string{"ps", "aux"})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if result.ExitCode != 3 || !result.Truncated || len(result.Output) != maxExecOutput || !strings.HasPrefix(result.Output, "PID USER\n") {
+		t.Fatalf("unexpected exec result: exit=%d truncated=%v len=%d", result.ExitCode, result.Truncated, len(result.Output))
+	}
+	if created["Privileged"] != false || created["Tty"] != false {
+		t.Fatalf("expected unprivileged exec without tty, got %#v", created)
+	}
+}
+
+func TestNormalizeExecCommandRejectsUnsafeInput(t *testing.T) {
+	cases := [][]string{
+		nil,
+		{" "},
+		{"sh", "-c", strings.Repeat("a", maxExecArgLength+1)},
+		{"cat", "a\x00b"},
+		make([]string, maxExecArgs+1),
+	}
+	for _, cmd := range cases {
+		if _, err := NormalizeExecCommand(cmd); !errors.Is(err, ErrInvalidExecCommand) {
+			t.Fatalf("expected %q to be rejected, got %v", cmd, err)
+		}
+	}
+	if cmd, err := NormalizeExecCommand([]string{" ps ", "aux"}); err != nil || cmd[0] != "ps" {
+		t.Fatalf("unexpected normalized command %q err=%v", cmd, err)
+	}
+}
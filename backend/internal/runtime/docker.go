@@ -11,35 +11,71 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type DockerManager struct {
-	apiVersion string
-	client     *http.Client
+	apiVersion      string
+	attachContainer string
+	seccompDir      string
+	client          *http.Client
+	// streamClient has no overall timeout, for log follows and exec output.
+	streamClient *http.Client
+
+	// networkMu guards networkRefs, the isolated networks that starts in
+	// progress are about to put a container on, and serializes network
+	// removal against them.
+	networkMu   sync.Mutex
+	networkRefs map[string]int
 }
 
 type DockerManagerConfig struct {
 	BindAddr string
+	// AttachContainer is the API's own container, joined to isolated networks
+	// of proxied instances so the proxy can reach them.
+	AttachContainer string
+	// SeccompProfileDir holds <name>.json profiles that challenges can pick
+	// through their hardening seccomp_profile.
+	SeccompProfileDir string
 }
 
 type createContainerRequest struct {
 	Image        string                    `json:"Image"`
 	Env          []string                  `json:"Env,omitempty"`
 	Cmd          []string                  `json:"Cmd,omitempty"`
+	User         string                    `json:"User,omitempty"`
 	Labels       map[string]string         `json:"Labels,omitempty"`
 	ExposedPorts map[string]struct{}       `json:"ExposedPorts,omitempty"`
 	HostConfig   createContainerHostConfig `json:"HostConfig"`
+	// NetworkingConfig gives group members their DNS aliases.
+	NetworkingConfig *networkingConfig `json:"NetworkingConfig,omitempty"`
 }
 
 type createContainerHostConfig struct {
-	AutoRemove   bool                     `json:"AutoRemove"`
-	Memory       int64                    `json:"Memory,omitempty"`
-	NanoCPUs     int64                    `json:"NanoCpus,omitempty"`
-	PortBindings map[string][]portBinding `json:"PortBindings,omitempty"`
+	AutoRemove     bool                     `json:"AutoRemove"`
+	Memory         int64                    `json:"Memory,omitempty"`
+	NanoCPUs       int64                    `json:"NanoCpus,omitempty"`
+	NetworkMode    string                   `json:"NetworkMode,omitempty"`
+	PortBindings   map[string][]portBinding `json:"PortBindings,omitempty"`
+	ReadonlyRootfs bool                     `json:"ReadonlyRootfs,omitempty"`
+	Tmpfs          map[string]string        `json:"Tmpfs,omitempty"`
+	CapDrop        []string                 `json:"CapDrop,omitempty"`
+	CapAdd         []string                 `json:"CapAdd,omitempty"`
+	SecurityOpt    []string                 `json:"SecurityOpt,omitempty"`
+	PidsLimit      int64                    `json:"PidsLimit,omitempty"`
+	Ulimits        []dockerUlimit           `json:"Ulimits,omitempty"`
+	StorageOpt     map[string]string        `json:"StorageOpt,omitempty"`
+}
+
+type dockerUlimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
 }
 
 type portBinding struct {
@@ -61,10 +97,14 @@ type inspectContainerResponse struct {
 		Labels map[string]string `json:"Labels"`
 	} `json:"Config"`
 	NetworkSettings struct {
-		Ports map[string][]struct {
+		IPAddress string `json:"IPAddress"`
+		Ports     map[string][]struct {
 			HostIP   string `json:"HostIp"`
 			HostPort string `json:"HostPort"`
 		} `json:"Ports"`
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
 	} `json:"NetworkSettings"`
 }
 
@@ -78,21 +118,28 @@ func NewDockerManager(socketPath string) *DockerManager {
 }
 
 func NewDockerManagerWithConfig(socketPath string, cfg DockerManagerConfig) *DockerManager {
+	return newDockerManager(func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}, cfg)
+}
+
+func newDockerManager(dial func(context.Context) (net.Conn, error), cfg DockerManagerConfig) *DockerManager {
 	transport := &http.Transport{
 		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-			var dialer net.Dialer
-			return dialer.DialContext(ctx, "unix", socketPath)
+			return dial(ctx)
 		},
 	}
 
-	_ = cfg
-
 	return &DockerManager{
-		apiVersion: strings.TrimSpace(os.Getenv("DOCKER_API_VERSION")),
+		apiVersion:      strings.TrimSpace(os.Getenv("DOCKER_API_VERSION")),
+		attachContainer: strings.TrimSpace(cfg.AttachContainer),
+		seccompDir:      strings.TrimSpace(cfg.SeccompProfileDir),
 		client: &http.Client{
 			Transport: transport,
 			Timeout:   15 * time.Second,
 		},
+		streamClient: &http.Client{Transport: transport},
 	}
 }
 
@@ -109,16 +156,31 @@ func (m *DockerManager) Start(ctx context.Context, req StartRequest) (StartedCon
 		hostPort = strconv.Itoa(req.HostPort)
 	}
 
+	network := isolatedNetworkName(req, containerName)
+	started := false
+	if network != "" {
+		if req.Config.Internal && m.attachContainer == "" {
+			return StartedContainer{}, fmt.Errorf("internal network for %s needs an attach container for the proxy", containerName)
+		}
+		// The network stays held until the container is on it, so a prune or
+		// a stop in between cannot remove it.
+		m.holdNetwork(network)
+		defer func() {
+			m.releaseNetwork(network)
+			if !started {
+				_, _ = m.removeNetworkIfUnused(context.Background(), network)
+			}
+		}()
+		if err := m.ensureNetwork(ctx, network, req); err != nil {
+			return StartedContainer{}, err
+		}
+	}
+
 	payload := createContainerRequest{
-		Image: req.Config.ImageName,
-		Env:   flattenEnv(req.Config.Env),
-		Cmd:   req.Config.Command,
-		Labels: map[string]string{
-			"ctf.platform":       "recruit",
-			"ctf.challenge_id":   req.Config.ID,
-			"ctf.challenge_slug": req.Config.Slug,
-			"ctf.user_id":        strconv.FormatInt(req.UserID, 10),
-		},
+		Image:  req.Config.image(),
+		Env:    flattenEnv(req.Config.Env),
+		Cmd:    req.Config.Command,
+		Labels: containerLabels(req, containerName, network),
 		ExposedPorts: map[string]struct{}{
 			portKey: {},
 		},
@@ -126,70 +188,162 @@ func (m *DockerManager) Start(ctx context.Context, req StartRequest) (StartedCon
 			AutoRemove: true,
 			Memory:     int64(req.Config.MemoryLimitMB) * 1024 * 1024,
 			NanoCPUs:   int64(req.Config.CPUMilli) * 1_000_000,
-			PortBindings: map[string][]portBinding{
-				portKey: {{HostIP: bindAddr, HostPort: hostPort}},
-			},
 		},
 	}
-
-	createPath := m.apiPath(fmt.Sprintf("/containers/create?name=%s", url.QueryEscape(containerName)))
-	resp, err := m.request(ctx, http.MethodPost, createPath, payload)
-	if err != nil {
-		return StartedContainer{}, err
+	if req.Proxied {
+		// Proxied containers are only reachable through the platform proxy or
+		// the tcp gateway, so nothing is published on the host.
+		payload.HostConfig.NetworkMode = strings.TrimSpace(req.Network)
+	} else {
+		payload.HostConfig.PortBindings = map[string][]portBinding{
+			portKey: {{HostIP: bindAddr, HostPort: hostPort}},
+		}
 	}
-	defer resp.Body.Close()
-
-	if err := expectStatus(resp, http.StatusCreated); err != nil {
-		return StartedContainer{}, err
+	if network != "" {
+		payload.HostConfig.NetworkMode = network
 	}
-
-	var created createContainerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
-		return StartedContainer{}, fmt.Errorf("decode create container response: %w", err)
+	if err := m.applyHardening(&payload, req.Config.Hardening); err != nil {
+		return StartedContainer{}, err
 	}
 
-	started := false
-	defer func() {
-		if started {
-			return
+	if req.Config.IsGroup() {
+		payload.NetworkingConfig = aliasNetworking(network, EntrypointAlias)
+		companions, err := m.startServices(ctx, req, containerName, network)
+		defer func() {
+			if started {
+				return
+			}
+			for _, id := range companions {
+				_ = m.removeContainer(context.Background(), id)
+			}
+		}()
+		if err != nil {
+			return StartedContainer{}, err
 		}
-		_ = m.removeContainer(context.Background(), created.ID)
-	}()
+	}
 
-	startPath := m.apiPath(fmt.Sprintf("/containers/%s/start", created.ID))
-	resp, err = m.request(ctx, http.MethodPost, startPath, nil)
+	containerID, err := m.createAndStart(ctx, containerName, payload)
 	if err != nil {
 		return StartedContainer{}, err
 	}
-	defer resp.Body.Close()
+	started = true
 
-	if err := expectStatus(resp, http.StatusNoContent); err != nil {
-		return StartedContainer{}, err
+	// Without an attach container, the entrypoint of a
+	// proxied group also joins the proxy network so the API can reach it.
+	groupOnProxyNetwork := req.Proxied && req.Config.IsGroup() && m.attachContainer == "" && strings.TrimSpace(req.Network) != ""
+	switch {
+	case groupOnProxyNetwork:
+		if err := m.connectNetwork(ctx, strings.TrimSpace(req.Network), containerID); err != nil {
+			return StartedContainer{}, err
+		}
+	case req.Proxied && network != "" && m.attachContainer != "":
+		if err := m.connectNetwork(ctx, network, m.attachContainer); err != nil {
+			return StartedContainer{}, err
+		}
 	}
-	started = true
 
-	inspected, err := m.inspectContainer(ctx, created.ID)
+	inspected, err := m.inspectContainer(ctx, containerID)
 	if err != nil {
 		return StartedContainer{}, err
 	}
 
+	if req.Proxied {
+		proxyNetwork := req.Network
+		if network != "" && !groupOnProxyNetwork {
+			proxyNetwork = network
+		}
+		internalIP := containerIP(inspected, proxyNetwork)
+		if internalIP == "" {
+			return StartedContainer{}, fmt.Errorf("container %s has no address on network %q", containerID, proxyNetwork)
+		}
+		return StartedContainer{
+			ContainerID:   containerID,
+			ContainerName: strings.TrimPrefix(inspected.Name, "/"),
+			InternalIP:    internalIP,
+		}, nil
+	}
+
 	bindings := inspected.NetworkSettings.Ports[portKey]
 	if len(bindings) == 0 {
-		return StartedContainer{}, fmt.Errorf("container %s has no published port for %s", created.ID, portKey)
+		return StartedContainer{}, fmt.Errorf("container %s has no published port for %s", containerID, portKey)
 	}
 	if req.HostPort > 0 && mustAtoi(bindings[0].HostPort) != req.HostPort {
-		return StartedContainer{}, fmt.Errorf("container %s published port %s does not match requested %d", created.ID, bindings[0].HostPort, req.HostPort)
+		return StartedContainer{}, fmt.Errorf("container %s published port %s does not match requested %d", containerID, bindings[0].HostPort, req.HostPort)
 	}
 
 	return StartedContainer{
-		ContainerID:   created.ID,
+		ContainerID:   containerID,
 		ContainerName: strings.TrimPrefix(inspected.Name, "/"),
 		HostIP:        bindings[0].HostIP,
 		HostPort:      mustAtoi(bindings[0].HostPort),
 	}, nil
 }
 
+func containerIP(inspected inspectContainerResponse, network string) string {
+	if network = strings.TrimSpace(network); network != "" {
+		return inspected.NetworkSettings.Networks[network].IPAddress
+	}
+	if inspected.NetworkSettings.IPAddress != "" {
+		return inspected.NetworkSettings.IPAddress
+	}
+	names := make([]string, 0, len(inspected.NetworkSettings.Networks))
+	for name := range inspected.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if address := inspected.NetworkSettings.Networks[name].IPAddress; address != "" {
+			return address
+		}
+	}
+	return ""
+}
+
+// Stop stops the container and, for a multi-container group, every other
+// member of its group, then removes the isolated network it ran on.
 func (m *DockerManager) Stop(ctx context.Context, containerID string) error {
+	if containerID == "" {
+		// Claimed instances that were never provisioned have no container.
+		return nil
+	}
+	network, group := "", ""
+	if inspected, err := m.inspectContainer(ctx, containerID); err == nil {
+		network = inspected.Config.Labels[networkLabel]
+		group = inspected.Config.Labels[groupLabel]
+	}
+
+	if err := m.stopContainer(ctx, containerID); err != nil {
+		return err
+	}
+	var members []string
+	if group != "" {
+		var err error
+		if members, err = m.listGroupMembers(ctx, group); err != nil {
+			return err
+		}
+		for _, id := range members {
+			if id == containerID {
+				continue
+			}
+			if err := m.stopContainer(ctx, id); err != nil {
+				return err
+			}
+		}
+	}
+	if network == "" {
+		return nil
+	}
+	m.waitRemoved(ctx, containerID)
+	for _, id := range members {
+		if id != containerID {
+			m.waitRemoved(ctx, id)
+		}
+	}
+	_, err := m.removeNetworkIfUnused(ctx, network)
+	return err
+}
+
+func (m *DockerManager) stopContainer(ctx context.Context, containerID string) error {
 	stopPath := m.apiPath(fmt.Sprintf("/containers/%s/stop?t=5", containerID))
 	resp, err := m.request(ctx, http.MethodPost, stopPath, nil)
 	if err != nil {
@@ -229,8 +383,24 @@ func (m *DockerManager) ListManagedContainers(ctx context.Context) ([]ManagedCon
 		return nil, fmt.Errorf("decode list containers response: %w", err)
 	}
 
+	// A group is reported once, through its entrypoint, or through one of its
+	// companions when the entrypoint is already gone.
+	entrypoints := make(map[string]bool)
+	for _, item := range items {
+		if group := item.Labels[groupLabel]; group != "" && item.Labels[serviceLabel] == "" {
+			entrypoints[group] = true
+		}
+	}
+	reportedGroups := make(map[string]bool)
+
 	result := make([]ManagedContainer, 0, len(items))
 	for _, item := range items {
+		if group := item.Labels[groupLabel]; group != "" && item.Labels[serviceLabel] != "" {
+			if entrypoints[group] || reportedGroups[group] {
+				continue
+			}
+			reportedGroups[group] = true
+		}
 		userID, err := strconv.ParseInt(strings.TrimSpace(item.Labels["ctf.user_id"]), 10, 64)
 		if err != nil {
 			continue
@@ -243,6 +413,7 @@ func (m *DockerManager) ListManagedContainers(ctx context.Context) ([]ManagedCon
 			ContainerID: item.ID,
 			ChallengeID: challengeID,
 			UserID:      userID,
+			Pooled:      item.Labels[poolLabel] == "true",
 		})
 	}
 	return result, nil
@@ -292,6 +463,10 @@ func (m *DockerManager) apiPath(path string) string {
 }
 
 func (m *DockerManager) request(ctx context.Context, method, path string, payload any) (*http.Response, error) {
+	return m.send(ctx, m.client, method, path, payload)
+}
+
+func (m *DockerManager) send(ctx context.Context, client *http.Client, method, path string, payload any) (*http.Response, error) {
 	var body io.Reader
 	if payload != nil {
 		buf := new(bytes.Buffer)
@@ -309,7 +484,7 @@ func (m *DockerManager) request(ctx context.Context, method, path string, payloa
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	resp, err := m.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("docker request %s %s: %w", method, path, err)
 	}
@@ -344,6 +519,41 @@ func expectStatus(resp *http.Response, expected ...int) error {
 	return dockerStatusError{statusCode: resp.StatusCode, message: strings.TrimSpace(string(body))}
 }
 
+func (m *DockerManager) applyHardening(payload *createContainerRequest, h Hardening) error {
+	h = h.withDefaults()
+	payload.User = h.User
+	payload.HostConfig.ReadonlyRootfs = h.ReadOnlyRootfs
+	payload.HostConfig.Tmpfs = h.Tmpfs
+	payload.HostConfig.CapDrop = []string{"ALL"}
+	payload.HostConfig.CapAdd = h.CapAdd
+	payload.HostConfig.PidsLimit = h.PidsLimit
+	for _, limit := range h.Ulimits {
+		payload.HostConfig.Ulimits = append(payload.HostConfig.Ulimits, dockerUlimit{Name: limit.Name, Soft: limit.Soft, Hard: limit.Hard})
+	}
+	if *h.NoNewPrivileges {
+		payload.HostConfig.SecurityOpt = append(payload.HostConfig.SecurityOpt, "no-new-privileges")
+	}
+	switch h.SeccompProfile {
+	case "":
+	case SeccompUnconfined:
+		payload.HostConfig.SecurityOpt = append(payload.HostConfig.SecurityOpt, "seccomp=unconfined")
+	default:
+		// The Engine API takes the profile body, not a path.
+		if m.seccompDir == "" {
+			return fmt.Errorf("seccomp profile %q requested but no profile directory is configured", h.SeccompProfile)
+		}
+		profile, err := os.ReadFile(filepath.Join(m.seccompDir, h.SeccompProfile+".json"))
+		if err != nil {
+			return fmt.Errorf("read seccomp profile %q: %w", h.SeccompProfile, err)
+		}
+		payload.HostConfig.SecurityOpt = append(payload.HostConfig.SecurityOpt, "seccomp="+string(profile))
+	}
+	if h.DiskQuotaMB > 0 {
+		payload.HostConfig.StorageOpt = map[string]string{"size": fmt.Sprintf("%dM", h.DiskQuotaMB)}
+	}
+	return nil
+}
+
 func flattenEnv(values map[string]string) []string {
 	if len(values) == 0 {
 		return nil
@@ -365,9 +575,45 @@ func flattenEnv(values map[string]string) []string {
 func buildContainerName(req StartRequest) string {
 	replacer := strings.NewReplacer("/", "-", "_", "-", ":", "-", " ", "-")
 	base := replacer.Replace(req.Config.Slug)
+	if req.Config.IsShared() {
+		return fmt.Sprintf("ctf-%s-shared-%d", base, time.Now().Unix())
+	}
+	if req.Pooled {
+		return fmt.Sprintf("ctf-%s-pool-%d", base, time.Now().UnixNano())
+	}
 	return fmt.Sprintf("ctf-%s-u%d-%d", base, req.UserID, time.Now().Unix())
 }
 
+func containerLabels(req StartRequest, containerName, network string) map[string]string {
+	labels := map[string]string{
+		"ctf.platform":       "recruit",
+		"ctf.challenge_id":   req.Config.ID,
+		"ctf.challenge_slug": req.Config.Slug,
+		"ctf.user_id":        strconv.FormatInt(req.UserID, 10),
+		"ctf.mode":           containerMode(req),
+		networkLabel:         network,
+	}
+	// The entrypoint carries the reservation of the whole group so that node
+	// usage is counted once per instance.
+	need := req.Config.reservation()
+	labels[memoryLabel] = strconv.Itoa(need.MemoryMB)
+	labels[cpuLabel] = strconv.Itoa(need.CPUMilli)
+	if req.Config.IsGroup() {
+		labels[groupLabel] = containerName
+	}
+	if req.Pooled {
+		labels[poolLabel] = "true"
+	}
+	return labels
+}
+
+func containerMode(req StartRequest) string {
+	if req.Config.IsShared() {
+		return ModeShared
+	}
+	return ModePerUser
+}
+
 func networkProtocol(exposedProtocol string) string {
 	switch strings.ToLower(exposedProtocol) {
 	case "udp":
@@ -0,0 +1,261 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Docker container actions the runtime reacts to.
+const (
+	ContainerDied   = "die"
+	ContainerOOM    = "oom"
+	ContainerKilled = "kill"
+
+	eventRetryMin = time.Second
+	eventRetryMax = 30 * time.Second
+	// signalledTTL bounds how long a kill is remembered when its die never
+	// arrives, e.g. because the signal was ignored.
+	signalledTTL = 10 * time.Minute
+)
+
+// ContainerEvent is a lifecycle change of a platform container reported by
+// the Docker event stream.
+type ContainerEvent struct {
+	Node        string
+	ContainerID string
+	Action      string
+	ExitCode    int
+	Time        time.Time
+}
+
+// containerEventSource is implemented by managers that can follow the Docker
+// event stream. Managers without it leave crashed containers to Reconcile.
+type containerEventSource interface {
+	WatchEvents(ctx context.Context, handle func(ContainerEvent), onError func(node string, err error))
+}
+
+// exitTracker remembers containers that were sent a signal, so that the die
+// that follows a stop issued by the platform or an administrator is not taken
+// for a crash.
+type exitTracker struct {
+	mu        sync.Mutex
+	signalled map[string]time.Time
+}
+
+func newExitTracker() *exitTracker {
+	return &exitTracker{signalled: make(map[string]time.Time)}
+}
+
+func (t *exitTracker) signal(containerID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, since := range t.signalled {
+		if at.Sub(since) > signalledTTL {
+			delete(t.signalled, id)
+		}
+	}
+	t.signalled[containerID] = at
+}
+
+// stopped reports whether containerID was signalled before it died and
+// forgets it.
+func (t *exitTracker) stopped(containerID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.signalled[containerID]
+	delete(t.signalled, containerID)
+	return ok
+}
+
+// WatchContainerEvents follows the Docker event stream of every node until ctx
+// is done, ending instances whose container died or ran out of memory without
+// waiting for the next Reconcile. onError is told about dropped streams and
+// events that could not be applied.
+func (s *Service) WatchContainerEvents(ctx context.Context, onError func(node string, err error)) {
+	source, ok := s.manager.(containerEventSource)
+	if !ok {
+		return
+	}
+	source.WatchEvents(ctx, func(event ContainerEvent) {
+		if err := s.HandleContainerEvent(ctx, event); err != nil {
+			onError(event.Node, err)
+		}
+	}, onError)
+}
+
+// HandleContainerEvent applies one container event. A die that was not
+// preceded by a kill ends the instance with the container's exit code; an oom
+// ends it right away and stops what is left of the container. Shared instances
+// are relaunched as Reconcile would.
+func (s *Service) HandleContainerEvent(ctx context.Context, event ContainerEvent) error {
+	switch event.Action {
+	case ContainerKilled:
+		s.exits.signal(event.ContainerID, event.Time)
+		return nil
+	case ContainerDied:
+		if s.exits.stopped(event.ContainerID) {
+			return nil
+		}
+	case ContainerOOM:
+	default:
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active, err := s.repo.ListActiveInstances(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		item  InstanceRecord
+		found bool
+	)
+	for _, candidate := range active {
+		if candidate.Instance.ContainerID == event.ContainerID {
+			item, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	now := s.now().UTC()
+	if event.Action == ContainerOOM {
+		if err := s.repo.TerminateInstance(ctx, item.ID, now); err != nil {
+			return err
+		}
+		s.recordEvent(ctx, item, EventOOMKilled, "container "+event.ContainerID+" ran out of memory")
+		// The kernel may have killed a child rather than the entrypoint.
+		if err := s.manager.Stop(ctx, item.Instance.Node, item.Instance.ContainerID); err != nil {
+			return err
+		}
+	} else {
+		if err := s.repo.ExitInstance(ctx, item.ID, now, event.ExitCode); err != nil {
+			return err
+		}
+		s.recordEvent(ctx, item, EventExited, fmt.Sprintf("exit code %d", event.ExitCode))
+	}
+	s.stats.forget(item.ID)
+
+	if item.Instance.UserID == SharedOwnerID {
+		if _, err := s.relaunchSharedInstance(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchEvents follows the event stream of every node until ctx is done. A
+// dropped stream is resubscribed with backoff, replaying what happened since
+// the last event seen so that nothing is lost in between.
+func (p *NodePool) WatchEvents(ctx context.Context, handle func(ContainerEvent), onError func(node string, err error)) {
+	var wg sync.WaitGroup
+	for _, node := range p.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.watchEvents(ctx, handle, onError)
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *dockerNode) watchEvents(ctx context.Context, handle func(ContainerEvent), onError func(node string, err error)) {
+	since := time.Now()
+	retry := eventRetryMin
+	for {
+		subscribed := time.Now()
+		received := false
+		err := n.manager.Events(ctx, since, func(event ContainerEvent) {
+			event.Node = n.spec.Name
+			since = event.Time
+			received = true
+			handle(event)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		onError(n.spec.Name, err)
+		if !received {
+			// Nothing was missed before the failed attempt.
+			since = subscribed
+		}
+		if received || time.Since(subscribed) > eventRetryMax {
+			retry = eventRetryMin
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		retry = min(retry*2, eventRetryMax)
+	}
+}
+
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Events streams die, kill and oom events of platform containers since the
+// given time to handle. It only returns once the stream ends, with the reason.
+func (m *DockerManager) Events(ctx context.Context, since time.Time, handle func(ContainerEvent)) error {
+	query := url.Values{}
+	query.Set("filters", `{"type":["container"],"label":["ctf.platform=recruit"],"event":["die","kill","oom"]}`)
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+	resp, err := m.send(ctx, m.streamClient, http.MethodGet, m.apiPath("/events?"+query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var raw dockerEvent
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("docker event stream closed")
+			}
+			return fmt.Errorf("decode docker event: %w", err)
+		}
+		if raw.Type != "container" || raw.Actor.ID == "" {
+			continue
+		}
+		event := ContainerEvent{
+			ContainerID: raw.Actor.ID,
+			Action:      raw.Action,
+			Time:        time.Unix(0, raw.TimeNano).UTC(),
+		}
+		if raw.TimeNano == 0 {
+			event.Time = time.Now().UTC()
+		}
+		if code, err := strconv.Atoi(raw.Actor.Attributes["exitCode"]); err == nil {
+			event.ExitCode = code
+		}
+		handle(event)
+	}
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDockerEventsDecodesStream(t *testing.T) {
+	since := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	manager := newDiagnosticsDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		if !strings.Contains(query.Get("filters"), "ctf.platform=recruit") || query.Get("since") != "1741424400.000000000" {
+			t.Errorf("unexpected events query %q", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"Type":"container","Action":"oom","Actor":{"ID":"c1"},"timeNano":1741424401000000000}
+{"Type":"container","Action":"die","Actor":{"ID":"c1","Attributes":{"exitCode":"137"}},"timeNano":1741424402000000000}
+`))
+	})
+
+	var got []ContainerEvent
+	err := manager.Events(context.Background(), since, func(event ContainerEvent) {
+		got = append(got, event)
+	})
+	if err == nil {
+		t.Fatalf("expected the closed stream to be reported")
+	}
+	if len(got) != 2 || got[0].Action != ContainerOOM || got[1].Action != ContainerDied || got[1].ExitCode != 137 || got[1].ContainerID != "c1" {
+		t.Fatalf("unexpected events %#v", got)
+	}
+	if !got[1].Time.Equal(since.Add(2 * time.Second)) {
+		t.Fatalf("unexpected event time %s", got[1].Time)
+	}
+}
+
+func TestContainerEventsEndInstances(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	ctx := context.Background()
+
+	for _, userID := range []int64{7, 8, 9} {
+		if _, _, err := service.StartInstance(ctx, userID, "1"); err != nil {
+			t.Fatalf("start instance: %v", err)
+		}
+	}
+	now := time.Now()
+
+	// A die that follows a kill is a stop, not a crash.
+	for _, action := range []string{ContainerKilled, ContainerDied} {
+		if err := service.HandleContainerEvent(ctx, ContainerEvent{ContainerID: "container-1", Action: action, ExitCode: 143, Time: now}); err != nil {
+			t.Fatalf("handle %s: %v", action, err)
+		}
+	}
+	if _, ok := repo.active["7:1"]; !ok {
+		t.Fatalf("expected a stopped container to leave its instance alone")
+	}
+
+	if err := service.HandleContainerEvent(ctx, ContainerEvent{ContainerID: "container-2", Action: ContainerDied, ExitCode: 1, Time: now}); err != nil {
+		t.Fatalf("handle die: %v", err)
+	}
+	if _, ok := repo.active["8:1"]; ok || repo.history["8:1"].Instance.Status != "terminated" {
+		t.Fatalf("expected crashed instance to be terminated")
+	}
+	if !reflect.DeepEqual(repo.exitCodes, []int{1}) {
+		t.Fatalf("unexpected exit codes %v", repo.exitCodes)
+	}
+
+	if err := service.HandleContainerEvent(ctx, ContainerEvent{ContainerID: "container-3", Action: ContainerOOM, Time: now}); err != nil {
+		t.Fatalf("handle oom: %v", err)
+	}
+	if _, ok := repo.active["9:1"]; ok {
+		t.Fatalf("expected oom killed instance to be terminated")
+	}
+	if !reflect.DeepEqual(manager.stoppedIDs, []string{"container-3"}) {
+		t.Fatalf("expected what is left of the oom killed container to be stopped, got %v", manager.stoppedIDs)
+	}
+	// The die that follows is for an instance that is already gone.
+	if err := service.HandleContainerEvent(ctx, ContainerEvent{ContainerID: "container-3", Action: ContainerDied, ExitCode: 137, Time: now}); err != nil {
+		t.Fatalf("handle die after oom: %v", err)
+	}
+
+	events, err := service.InstanceEvents(ctx, InstanceEventFilter{})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var ends []string
+	for _, event := range events {
+		if event.Type == EventExited || event.Type == EventOOMKilled {
+			ends = append(ends, event.Type+" "+event.Detail)
+		}
+	}
+	want := []string{EventOOMKilled + " container container-3 ran out of memory", EventExited + " exit code 1"}
+	if !reflect.DeepEqual(ends, want) {
+		t.Fatalf("unexpected end events %v", ends)
+	}
+}
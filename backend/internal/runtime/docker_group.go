@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	groupLabel        = "ctf.group"
+	serviceLabel      = "ctf.service"
+	serviceOrderLabel = "ctf.service_order"
+)
+
+type networkingConfig struct {
+	EndpointsConfig map[string]endpointSettings `json:"EndpointsConfig"`
+}
+
+type endpointSettings struct {
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+func aliasNetworking(network, alias string) *networkingConfig {
+	return &networkingConfig{
+		EndpointsConfig: map[string]endpointSettings{network: {Aliases: []string{alias}}},
+	}
+}
+
+// startServices starts the companions of a group in declaration order. The
+// returned IDs cover every companion that was created, also on error, so the
+// caller can clean them up.
+func (m *DockerManager) startServices(ctx context.Context, req StartRequest, containerName, network string) ([]string, error) {
+	started := make([]string, 0, len(req.Config.Services))
+	for i, service := range req.Config.Services {
+		labels := containerLabels(req, containerName, network)
+		labels[serviceLabel] = service.Name
+		labels[serviceOrderLabel] = strconv.Itoa(i)
+
+		payload := createContainerRequest{
+			Image:  service.Image,
+			Env:    flattenEnv(service.Env),
+			Cmd:    service.Command,
+			Labels: labels,
+			HostConfig: createContainerHostConfig{
+				AutoRemove:  true,
+				Memory:      int64(service.MemoryLimitMB) * 1024 * 1024,
+				NanoCPUs:    int64(service.CPUMilli) * 1_000_000,
+				NetworkMode: network,
+			},
+			NetworkingConfig: aliasNetworking(network, service.Name),
+		}
+		// Companions run stock images such as databases, so they get the
+		// platform defaults rather than the entrypoint's hardening.
+		if err := m.applyHardening(&payload, Hardening{}); err != nil {
+			return started, err
+		}
+
+		id, err := m.createAndStart(ctx, containerName+"-"+service.Name, payload)
+		if err != nil {
+			return started, fmt.Errorf("start service %s: %w", service.Name, err)
+		}
+		started = append(started, id)
+	}
+	return started, nil
+}
+
+// createAndStart creates a container and starts it, removing it again when it
+// does not start.
+func (m *DockerManager) createAndStart(ctx context.Context, name string, payload createContainerRequest) (string, error) {
+	createPath := m.apiPath(fmt.Sprintf("/containers/create?name=%s", url.QueryEscape(name)))
+	resp, err := m.request(ctx, http.MethodPost, createPath, payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusCreated); err != nil {
+		return "", err
+	}
+
+	var created createContainerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("decode create container response: %w", err)
+	}
+
+	startPath := m.apiPath(fmt.Sprintf("/containers/%s/start", created.ID))
+	resp, err = m.request(ctx, http.MethodPost, startPath, nil)
+	if err != nil {
+		_ = m.removeContainer(context.Background(), created.ID)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusNoContent); err != nil {
+		_ = m.removeContainer(context.Background(), created.ID)
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// listGroupMembers returns the containers of a group, companions last-started
+// first so they stop in reverse startup order.
+func (m *DockerManager) listGroupMembers(ctx context.Context, group string) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {groupLabel + "=" + group}})
+	if err != nil {
+		return nil, fmt.Errorf("encode group filter: %w", err)
+	}
+	path := m.apiPath("/containers/json?all=true&filters=" + url.QueryEscape(string(filters)))
+	resp, err := m.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var items []listContainerSummary
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decode list containers response: %w", err)
+	}
+
+	order := func(item listContainerSummary) int {
+		if item.Labels[serviceLabel] == "" {
+			return -1
+		}
+		value, err := strconv.Atoi(item.Labels[serviceOrderLabel])
+		if err != nil {
+			return 0
+		}
+		return value
+	}
+	sort.SliceStable(items, func(i, j int) bool { return order(items[i]) > order(items[j]) })
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids, nil
+}
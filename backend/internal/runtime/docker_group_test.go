@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func groupStartRequest() StartRequest {
+	return StartRequest{
+		ChallengeID: "1",
+		UserID:      7,
+		Proxied:     true,
+		Config: ChallengeConfig{
+			ID:              "1",
+			Slug:            "web",
+			ImageName:       "ctf/web:dev",
+			ExposedProtocol: "http",
+			ContainerPort:   80,
+			Services: []ServiceSpec{
+				{Name: "db", Image: "mysql:8", Env: map[string]string{"MYSQL_DATABASE": "ctf"}, MemoryLimitMB: 256},
+				{Name: "bot", Image: "ctf/bot:dev"},
+			},
+		},
+	}
+}
+
+func TestDockerStartGroupStartsServicesBeforeEntrypoint(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	manager := NewDockerManagerWithConfig(socket, DockerManagerConfig{AttachContainer: "api"})
+
+	started, err := manager.Start(t.Context(), groupStartRequest())
+	if err != nil {
+		t.Fatalf("start group: %v", err)
+	}
+
+	var creates []string
+	for _, call := range engine.calls {
+		if call == "POST /containers/create" {
+			creates = append(creates, call)
+		}
+	}
+	if len(creates) != 3 || len(engine.created) != 3 {
+		t.Fatalf("expected three containers, calls: %v", engine.calls)
+	}
+	db := engine.created[started.ContainerID+"-db"]
+	entry := engine.created[started.ContainerID]
+	network := entry.HostConfig.NetworkMode
+	if !strings.HasPrefix(network, "ctf-net-web-u7-") || db.HostConfig.NetworkMode != network {
+		t.Fatalf("expected group on one per-instance network, got %q and %q", network, db.HostConfig.NetworkMode)
+	}
+	if !slices.Equal(db.NetworkingConfig.EndpointsConfig[network].Aliases, []string{"db"}) {
+		t.Fatalf("unexpected db aliases: %+v", db.NetworkingConfig)
+	}
+	if !slices.Equal(entry.NetworkingConfig.EndpointsConfig[network].Aliases, []string{EntrypointAlias}) {
+		t.Fatalf("unexpected entrypoint aliases: %+v", entry.NetworkingConfig)
+	}
+	if db.Labels[groupLabel] != started.ContainerID || entry.Labels[groupLabel] != started.ContainerID || entry.Labels[serviceLabel] != "" {
+		t.Fatalf("unexpected group labels: db=%v entry=%v", db.Labels, entry.Labels)
+	}
+	if db.HostConfig.Memory != 256*1024*1024 || !slices.Equal(db.Env, []string{"MYSQL_DATABASE=ctf"}) {
+		t.Fatalf("unexpected db resources or env: %+v", db)
+	}
+	if started.InternalIP != "10.0.0.2" {
+		t.Fatalf("expected entrypoint address, got %+v", started)
+	}
+}
+
+func TestDockerStopStopsWholeGroup(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	manager := NewDockerManagerWithConfig(socket, DockerManagerConfig{AttachContainer: "api"})
+	started, err := manager.Start(t.Context(), groupStartRequest())
+	if err != nil {
+		t.Fatalf("start group: %v", err)
+	}
+
+	if err := manager.Stop(t.Context(), started.ContainerID); err != nil {
+		t.Fatalf("stop group: %v", err)
+	}
+	if len(engine.containers) != 0 {
+		t.Fatalf("expected every group member to be stopped, left: %v", engine.containers)
+	}
+	if len(engine.networks) != 0 {
+		t.Fatalf("expected group network to be removed, left: %v", engine.networks)
+	}
+	stops := make([]string, 0, 3)
+	for _, call := range engine.calls {
+		if strings.HasSuffix(call, "/stop") {
+			stops = append(stops, strings.TrimPrefix(call, "POST /containers/"))
+		}
+	}
+	want := []string{started.ContainerID + "/stop", started.ContainerID + "-bot/stop", started.ContainerID + "-db/stop"}
+	if !slices.Equal(stops, want) {
+		t.Fatalf("expected reverse startup order %v, got %v", want, stops)
+	}
+}
+
+func TestDockerListManagedContainersReportsGroupOnce(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	base := map[string]string{"ctf.platform": "recruit", "ctf.challenge_id": "1", "ctf.user_id": "7"}
+	member := func(extra map[string]string) map[string]string {
+		labels := make(map[string]string, len(base)+len(extra))
+		for key, value := range base {
+			labels[key] = value
+		}
+		for key, value := range extra {
+			labels[key] = value
+		}
+		return labels
+	}
+	engine.containers["g1"] = member(map[string]string{groupLabel: "g1"})
+	engine.containers["g1-db"] = member(map[string]string{groupLabel: "g1", serviceLabel: "db"})
+	engine.containers["g2-db"] = member(map[string]string{groupLabel: "g2", serviceLabel: "db"})
+	engine.containers["g2-bot"] = member(map[string]string{groupLabel: "g2", serviceLabel: "bot"})
+	manager := NewDockerManager(socket)
+
+	containers, err := manager.ListManagedContainers(t.Context())
+	if err != nil {
+		t.Fatalf("list managed containers: %v", err)
+	}
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ContainerID)
+	}
+	if len(ids) != 2 || !slices.Contains(ids, "g1") {
+		t.Fatalf("expected one container per group, got %v", ids)
+	}
+}
+
+func TestNormalizeServicesValidatesNames(t *testing.T) {
+	services, err := NormalizeServices([]ServiceSpec{{Name: " DB ", Image: " mysql:8 ", Env: map[string]string{}}})
+	if err != nil {
+		t.Fatalf("normalize services: %v", err)
+	}
+	if services[0].Name != "db" || services[0].Image != "mysql:8" || services[0].Env != nil {
+		t.Fatalf("unexpected normalized service: %+v", services[0])
+	}
+
+	cases := map[string][]ServiceSpec{
+		"reserved":     {{Name: EntrypointAlias, Image: "x"}},
+		"duplicated":   {{Name: "db", Image: "x"}, {Name: "db", Image: "y"}},
+		"DNS label":    {{Name: "db_1", Image: "x"}},
+		"requires an":  {{Name: "db"}},
+		"cannot be ne": {{Name: "db", Image: "x", CPUMilli: -1}},
+	}
+	for want, input := range cases {
+		if _, err := NormalizeServices(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q error for %+v, got %v", want, input, err)
+		}
+	}
+}
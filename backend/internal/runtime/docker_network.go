@@ -0,0 +1,248 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	networkLabel         = "ctf.network"
+	bridgeICCOption      = "com.docker.network.bridge.enable_icc"
+	networkRemoveTimeout = 15 * time.Second
+)
+
+type createNetworkRequest struct {
+	Name           string            `json:"Name"`
+	Driver         string            `json:"Driver"`
+	Internal       bool              `json:"Internal"`
+	CheckDuplicate bool              `json:"CheckDuplicate"`
+	Labels         map[string]string `json:"Labels,omitempty"`
+	Options        map[string]string `json:"Options,omitempty"`
+}
+
+type connectNetworkRequest struct {
+	Container string `json:"Container"`
+	Force     bool   `json:"Force,omitempty"`
+}
+
+type inspectNetworkResponse struct {
+	ID         string `json:"Id"`
+	Name       string `json:"Name"`
+	Containers map[string]struct {
+		Name string `json:"Name"`
+	} `json:"Containers"`
+}
+
+// isolatedNetworkName picks the network a new container joins, or "" for the
+// default bridge. Internal challenges and multi-container groups always get a
+// network of their own, and so do proxied and shared instances, which the API
+// or every player reaches.
+func isolatedNetworkName(req StartRequest, containerName string) string {
+	perInstance := "ctf-net-" + strings.TrimPrefix(containerName, "ctf-")
+	switch {
+	case req.Config.Internal, req.Config.IsGroup():
+		return perInstance
+	case req.Isolation == NetworkIsolationInstance:
+		return perInstance
+	case req.Isolation == NetworkIsolationUser:
+		// Pooled containers do not know their player yet.
+		if req.Proxied || req.Config.IsShared() || req.Pooled {
+			return perInstance
+		}
+		return fmt.Sprintf("ctf-net-u%d", req.UserID)
+	default:
+		return ""
+	}
+}
+
+func (m *DockerManager) ensureNetwork(ctx context.Context, name string, req StartRequest) error {
+	payload := createNetworkRequest{
+		Name:           name,
+		Driver:         "bridge",
+		Internal:       req.Config.Internal,
+		CheckDuplicate: true,
+		Labels: map[string]string{
+			"ctf.platform": "recruit",
+			"ctf.user_id":  strconv.FormatInt(req.UserID, 10),
+		},
+	}
+	// The API container has to talk to proxied instances over this network
+	// and group members to each other; everything else only needs its
+	// published port.
+	if (!req.Proxied || m.attachContainer == "") && !req.Config.IsGroup() {
+		payload.Options = map[string]string{bridgeICCOption: "false"}
+	}
+
+	resp, err := m.request(ctx, http.MethodPost, m.apiPath("/networks/create"), payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusCreated, http.StatusConflict); err != nil {
+		return fmt.Errorf("create network %s: %w", name, err)
+	}
+	return nil
+}
+
+func (m *DockerManager) connectNetwork(ctx context.Context, network, container string) error {
+	path := m.apiPath(fmt.Sprintf("/networks/%s/connect", url.PathEscape(network)))
+	resp, err := m.request(ctx, http.MethodPost, path, connectNetworkRequest{Container: container})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 403 and 409 mean the container is already attached.
+	if err := expectStatus(resp, http.StatusOK, http.StatusForbidden, http.StatusConflict); err != nil {
+		return fmt.Errorf("connect %s to network %s: %w", container, network, err)
+	}
+	return nil
+}
+
+func (m *DockerManager) disconnectNetwork(ctx context.Context, network, container string) error {
+	path := m.apiPath(fmt.Sprintf("/networks/%s/disconnect", url.PathEscape(network)))
+	resp, err := m.request(ctx, http.MethodPost, path, connectNetworkRequest{Container: container, Force: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return expectStatus(resp, http.StatusOK, http.StatusNotFound)
+}
+
+func (m *DockerManager) inspectNetwork(ctx context.Context, network string) (inspectNetworkResponse, error) {
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath("/networks/"+url.PathEscape(network)), nil)
+	if err != nil {
+		return inspectNetworkResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return inspectNetworkResponse{}, err
+	}
+	var inspected inspectNetworkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return inspectNetworkResponse{}, fmt.Errorf("decode inspect network response: %w", err)
+	}
+	return inspected, nil
+}
+
+func (m *DockerManager) holdNetwork(network string) {
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+	if m.networkRefs == nil {
+		m.networkRefs = make(map[string]int)
+	}
+	m.networkRefs[network]++
+}
+
+func (m *DockerManager) releaseNetwork(network string) {
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+	m.networkRefs[network]--
+	if m.networkRefs[network] <= 0 {
+		delete(m.networkRefs, network)
+	}
+}
+
+// removeNetworkIfUnused deletes an isolated network once no instance container
+// is left on it and no start is about to join it. The attach container is
+// detached first so it never keeps a network alive on its own.
+func (m *DockerManager) removeNetworkIfUnused(ctx context.Context, network string) (bool, error) {
+	m.networkMu.Lock()
+	defer m.networkMu.Unlock()
+	if m.networkRefs[network] > 0 {
+		return false, nil
+	}
+	inspected, err := m.inspectNetwork(ctx, network)
+	if err != nil {
+		if isDockerStatus(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	attached := false
+	for id, container := range inspected.Containers {
+		if m.isAttachContainer(id, container.Name) {
+			attached = true
+			continue
+		}
+		return false, nil
+	}
+	if attached {
+		if err := m.disconnectNetwork(ctx, network, m.attachContainer); err != nil {
+			return false, err
+		}
+	}
+
+	resp, err := m.request(ctx, http.MethodDelete, m.apiPath("/networks/"+url.PathEscape(network)), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound, http.StatusForbidden, http.StatusConflict:
+		// Already gone, or another instance joined in the meantime.
+		return false, nil
+	}
+	return false, expectStatus(resp, http.StatusNoContent)
+}
+
+func (m *DockerManager) isAttachContainer(id, name string) bool {
+	if m.attachContainer == "" {
+		return false
+	}
+	return strings.HasPrefix(id, m.attachContainer) || strings.TrimPrefix(name, "/") == m.attachContainer
+}
+
+// waitRemoved blocks until an auto-removed container is gone, so its network
+// endpoint is released before the network is deleted.
+func (m *DockerManager) waitRemoved(ctx context.Context, containerID string) {
+	ctx, cancel := context.WithTimeout(ctx, networkRemoveTimeout)
+	defer cancel()
+	path := m.apiPath(fmt.Sprintf("/containers/%s/wait?condition=removed", containerID))
+	resp, err := m.request(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+func (m *DockerManager) PruneNetworks(ctx context.Context) (int, error) {
+	filters := url.QueryEscape(`{"label":["ctf.platform=recruit"]}`)
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath("/networks?filters="+filters), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return 0, err
+	}
+	var items []inspectNetworkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return 0, fmt.Errorf("decode list networks response: %w", err)
+	}
+
+	removed := 0
+	for _, item := range items {
+		ok, err := m.removeNetworkIfUnused(ctx, item.Name)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,205 @@
+package runtime
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type fakeDockerEngine struct {
+	mu         sync.Mutex
+	networks   map[string]map[string]string
+	containers map[string]map[string]string
+	created    map[string]createContainerRequest
+	calls      []string
+}
+
+func newFakeDockerEngine(t *testing.T) (*fakeDockerEngine, string) {
+	t.Helper()
+	engine := &fakeDockerEngine{
+		networks:   make(map[string]map[string]string),
+		containers: make(map[string]map[string]string),
+		created:    make(map[string]createContainerRequest),
+	}
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen docker socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(engine)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return engine, socket
+}
+
+func (e *fakeDockerEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, r.Method+" "+r.URL.Path)
+
+	id := filepath.Base(filepath.Dir(r.URL.Path))
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/containers/create":
+		var payload createContainerRequest
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		name := r.URL.Query().Get("name")
+		e.created[name] = payload
+		e.containers[name] = payload.Labels
+		if members, ok := e.networks[payload.HostConfig.NetworkMode]; ok {
+			members[name] = name
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Id": name})
+	case r.Method == http.MethodPost && filepath.Base(r.URL.Path) == "start":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == "/info":
+		_ = json.NewEncoder(w).Encode(dockerInfo{NCPU: 2, MemTotal: 2048 * 1024 * 1024})
+	case r.Method == http.MethodGet && r.URL.Path == "/containers/json":
+		items := make([]listContainerSummary, 0, len(e.containers))
+		for id, labels := range e.containers {
+			items = append(items, listContainerSummary{ID: id, Labels: labels})
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	case r.Method == http.MethodGet && filepath.Base(r.URL.Path) == "json" && filepath.Dir(filepath.Dir(r.URL.Path)) == "/containers":
+		labels, ok := e.containers[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		network := e.created[id].HostConfig.NetworkMode
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"Id":     id,
+			"Name":   "/" + id,
+			"Config": map[string]any{"Labels": labels},
+			"NetworkSettings": map[string]any{
+				"Networks": map[string]any{network: map[string]string{"IPAddress": "10.0.0.2"}},
+				"Ports":    e.created[id].HostConfig.PortBindings,
+			},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/networks/create":
+		var payload createNetworkRequest
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		e.networks[payload.Name] = make(map[string]string)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPost && filepath.Base(r.URL.Path) == "connect":
+		var payload connectNetworkRequest
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		e.networks[id][payload.Container] = payload.Container
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && filepath.Base(r.URL.Path) == "stop":
+		delete(e.containers, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && filepath.Base(r.URL.Path) == "wait":
+		for _, members := range e.networks {
+			delete(members, id)
+		}
+		_, _ = w.Write([]byte(`{"StatusCode":0}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/networks":
+		items := make([]map[string]string, 0, len(e.networks))
+		for name := range e.networks {
+			items = append(items, map[string]string{"Name": name})
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	case r.Method == http.MethodPost && filepath.Base(r.URL.Path) == "disconnect":
+		name := filepath.Base(filepath.Dir(r.URL.Path))
+		delete(e.networks[name], "api")
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && filepath.Dir(r.URL.Path) == "/networks":
+		members, ok := e.networks[filepath.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		containers := make(map[string]map[string]string, len(members))
+		for id, name := range members {
+			containers[id] = map[string]string{"Name": name}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Name": filepath.Base(r.URL.Path), "Containers": containers})
+	case r.Method == http.MethodDelete && filepath.Dir(r.URL.Path) == "/networks":
+		name := filepath.Base(r.URL.Path)
+		if len(e.networks[name]) > 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		delete(e.networks, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestIsolatedNetworkName(t *testing.T) {
+	cases := []struct {
+		name string
+		req  StartRequest
+		want string
+	}{
+		{"none", StartRequest{UserID: 7}, ""},
+		{"instance", StartRequest{UserID: 7, Isolation: NetworkIsolationInstance}, "ctf-net-web-u7-1"},
+		{"user", StartRequest{UserID: 7, Isolation: NetworkIsolationUser}, "ctf-net-u7"},
+		{"user proxied", StartRequest{UserID: 7, Isolation: NetworkIsolationUser, Proxied: true}, "ctf-net-web-u7-1"},
+		{"internal without isolation", StartRequest{UserID: 7, Config: ChallengeConfig{Internal: true}}, "ctf-net-web-u7-1"},
+	}
+	for _, tc := range cases {
+		if got := isolatedNetworkName(tc.req, "ctf-web-u7-1"); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestDockerStopRemovesIsolatedNetwork(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	engine.containers["c1"] = map[string]string{networkLabel: "ctf-net-web-u7-1"}
+	engine.networks["ctf-net-web-u7-1"] = map[string]string{"c1": "ctf-web-u7-1", "api": "api"}
+	manager := NewDockerManagerWithConfig(socket, DockerManagerConfig{AttachContainer: "api"})
+
+	if err := manager.Stop(t.Context(), "c1"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, ok := engine.networks["ctf-net-web-u7-1"]; ok {
+		t.Fatalf("expected isolated network to be removed, calls: %v", engine.calls)
+	}
+}
+
+func TestDockerPruneNetworksKeepsNetworksInUse(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	engine.networks["ctf-net-u7"] = map[string]string{"c2": "ctf-web-u7-2"}
+	engine.networks["ctf-net-u8"] = map[string]string{}
+	manager := NewDockerManager(socket)
+
+	removed, err := manager.PruneNetworks(t.Context())
+	if err != nil {
+		t.Fatalf("prune networks: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected one pruned network, got %d", removed)
+	}
+	if _, ok := engine.networks["ctf-net-u7"]; !ok {
+		t.Fatal("expected network with a running instance to be kept")
+	}
+}
+
+func TestDockerPruneNetworksSkipsNetworksOfStartsInProgress(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	engine.networks["ctf-net-u7"] = map[string]string{}
+	manager := NewDockerManager(socket)
+
+	manager.holdNetwork("ctf-net-u7")
+	removed, err := manager.PruneNetworks(t.Context())
+	if err != nil {
+		t.Fatalf("prune networks: %v", err)
+	}
+	if removed != 0 {
+		t.Fatalf("expected the held network to be kept, removed %d", removed)
+	}
+
+	manager.releaseNetwork("ctf-net-u7")
+	if removed, err := manager.PruneNetworks(t.Context()); err != nil || removed != 1 {
+		t.Fatalf("expected the released network to be pruned, removed=%d err=%v", removed, err)
+	}
+}
@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Instance lifecycle events, appended to an instance's history as they happen.
+const (
+	EventCreated           = "created"
+	EventReady             = "ready"
+	EventRenewed           = "renewed"
+	EventRestarted         = "restarted"
+	EventExpired           = "expired"
+	EventTerminated        = "terminated"
+	EventTerminatedByAdmin = "terminated_by_admin"
+	EventReconciledMissing = "reconciled_missing"
+	EventStartFailed       = "start_failed"
+	EventReadinessFailed   = "readiness_failed"
+	EventResourceLimit     = "resource_limit_exceeded"
+	EventOOMKilled         = "oom_killed"
+	EventExited            = "exited"
+	EventIdleReclaimed     = "idle_reclaimed"
+
+	DefaultEventLimit = 100
+	MaxEventLimit     = 1000
+
+	playerEventLimit = 50
+	maxEventDetail   = 2048
+)
+
+var (
+	errClaimAbandoned     = errors.New("claim was abandoned before a container was started")
+	errReadinessAbandoned = errors.New("readiness probe was abandoned")
+)
+
+// KnownEventType reports whether eventType is one of the recorded event types.
+func KnownEventType(eventType string) bool {
+	switch eventType {
+	case EventCreated, EventReady, EventRenewed, EventRestarted, EventExpired, EventTerminated,
+		EventTerminatedByAdmin, EventReconciledMissing, EventStartFailed, EventReadinessFailed,
+		EventResourceLimit, EventOOMKilled, EventExited, EventIdleReclaimed:
+		return true
+	default:
+		return false
+	}
+}
+
+type InstanceEvent struct {
+	ID            int64     `json:"id"`
+	InstanceID    int64     `json:"instance_id"`
+	ChallengeID   string    `json:"challenge_id"`
+	ChallengeSlug string    `json:"challenge_slug,omitempty"`
+	UserID        int64     `json:"user_id,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Type          string    `json:"type"`
+	Detail        string    `json:"detail,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// InstanceEventFilter selects events; zero fields match everything. Events
+// are returned newest first, at most Limit of them.
+type InstanceEventFilter struct {
+	InstanceID  int64
+	ChallengeID string
+	UserID      int64
+	Type        string
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// recordEvent appends an event to an instance's history. History is
+// best-effort and never fails the lifecycle step that produced it.
+func (s *Service) recordEvent(ctx context.Context, record InstanceRecord, eventType, detail string) {
+	if len(detail) > maxEventDetail {
+		detail = detail[:maxEventDetail]
+	}
+	_ = s.repo.RecordInstanceEvent(context.WithoutCancel(ctx), InstanceEvent{
+		InstanceID:  record.ID,
+		ChallengeID: record.Instance.ChallengeID,
+		UserID:      record.Instance.UserID,
+		Type:        eventType,
+		Detail:      detail,
+		CreatedAt:   s.now().UTC(),
+	})
+}
+
+// failureEvent is the event recorded when an instance is failed for reason.
+func failureEvent(reason string, cause error) (string, string) {
+	detail := reason
+	if cause != nil {
+		detail = reason + ": " + cause.Error()
+	}
+	switch reason {
+	case FailureReadinessProbe:
+		return EventReadinessFailed, detail
+	case FailureResourceLimit:
+		return EventResourceLimit, detail
+	default:
+		return EventStartFailed, detail
+	}
+}
+
+// InstanceEvents lists recorded events for administrators.
+func (s *Service) InstanceEvents(ctx context.Context, filter InstanceEventFilter) ([]InstanceEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultEventLimit
+	}
+	if filter.Limit > MaxEventLimit {
+		filter.Limit = MaxEventLimit
+	}
+	filter.Type = strings.TrimSpace(filter.Type)
+	return s.repo.ListInstanceEvents(ctx, filter)
+}
+
+// PlayerInstanceEvents lists the recent history of a player's own instances
+// of a challenge. Details can hold Docker errors and are left out.
+func (s *Service) PlayerInstanceEvents(ctx context.Context, userID int64, challengeRef string) ([]InstanceEvent, error) {
+	record, err := s.repo.GetChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	cfg := record.Challenge
+	if !cfg.Dynamic {
+		return nil, ErrChallengeNotDynamic
+	}
+	if cfg.IsShared() {
+		return []InstanceEvent{}, nil
+	}
+
+	items, err := s.repo.ListInstanceEvents(ctx, InstanceEventFilter{ChallengeID: cfg.ID, UserID: userID, Limit: playerEventLimit})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]InstanceEvent, 0, len(items))
+	for _, item := range items {
+		events = append(events, InstanceEvent{
+			ID:          item.ID,
+			InstanceID:  item.InstanceID,
+			ChallengeID: item.ChallengeID,
+			Type:        item.Type,
+			CreatedAt:   item.CreatedAt,
+		})
+	}
+	return events, nil
+}
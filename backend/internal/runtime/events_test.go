@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstanceLifecycleIsRecordedAsEvents(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.MaxRestartCount = 1
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	baseTime := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return baseTime }
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if _, err := service.RenewInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("renew instance: %v", err)
+	}
+	if _, err := service.RestartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("restart instance: %v", err)
+	}
+	if _, err := service.DeleteInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("delete instance: %v", err)
+	}
+
+	want := []string{EventCreated, EventReady, EventRenewed, EventRestarted, EventReady, EventTerminated}
+	if got := repo.eventTypes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected events %v, want %v", got, want)
+	}
+}
+
+func TestFailedStartRecordsDockerError(t *testing.T) {
+	manager := &fakeManager{startError: errors.New("docker create container: image not found")}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err == nil {
+		t.Fatalf("expected start to fail")
+	}
+	events, err := service.InstanceEvents(context.Background(), InstanceEventFilter{Type: EventStartFailed})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one start_failed event, got %#v err=%v", events, err)
+	}
+	if !strings.Contains(events[0].Detail, "image not found") || events[0].UserID != 7 {
+		t.Fatalf("expected docker error in event detail, got %#v", events[0])
+	}
+
+	// Players see what happened but not the Docker error.
+	player, err := service.PlayerInstanceEvents(context.Background(), 7, "1")
+	if err != nil || len(player) != 2 || player[0].Type != EventStartFailed || player[0].Detail != "" {
+		t.Fatalf("unexpected player events %#v err=%v", player, err)
+	}
+	if other, err := service.PlayerInstanceEvents(context.Background(), 8, "1"); err != nil || len(other) != 0 {
+		t.Fatalf("expected no events for another player, got %#v err=%v", other, err)
+	}
+}
+
+func TestSweepAndReconcileRecordEvents(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	baseTime := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return baseTime }
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if _, _, err := service.StartInstance(context.Background(), 8, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	manager.missingIDs = map[string]bool{"container-2": true}
+	if _, err := service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	service.now = func() time.Time { return baseTime.Add(time.Hour) }
+	if _, err := service.SweepExpired(context.Background()); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+
+	missing, _ := service.InstanceEvents(context.Background(), InstanceEventFilter{Type: EventReconciledMissing})
+	expired, _ := service.InstanceEvents(context.Background(), InstanceEventFilter{Type: EventExpired})
+	if len(missing) != 1 || missing[0].UserID != 8 || !strings.Contains(missing[0].Detail, "container-2") {
+		t.Fatalf("expected reconciled_missing for user 8, got %#v", missing)
+	}
+	if len(expired) != 1 || expired[0].UserID != 7 {
+		t.Fatalf("expected expired event for user 7, got %#v", expired)
+	}
+}
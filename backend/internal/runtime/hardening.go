@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	SeccompDefault    = "default"
+	SeccompUnconfined = "unconfined"
+
+	defaultPidsLimit   int64 = 256
+	defaultNofileSoft  int64 = 4096
+	defaultNofileHard  int64 = 8192
+	defaultTmpfsMount        = "/tmp"
+	defaultTmpfsOption       = "rw,noexec,nosuid,size=64m"
+)
+
+// DefaultCapAdd is granted back after CapDrop ALL when a challenge does not
+// list its own capabilities. It covers what typical web and xinetd images
+// need to drop privileges and bind low ports.
+var DefaultCapAdd = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "NET_BIND_SERVICE", "SETGID", "SETUID"}
+
+var (
+	seccompProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	linuxCapabilities = []string{
+		"AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF", "CHECKPOINT_RESTORE",
+		"CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "IPC_LOCK", "IPC_OWNER",
+		"KILL", "LEASE", "LINUX_IMMUTABLE", "MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN",
+		"NET_BIND_SERVICE", "NET_BROADCAST", "NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP",
+		"SETUID", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT", "SYS_MODULE", "SYS_NICE", "SYS_PACCT",
+		"SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE", "SYS_TIME", "SYS_TTY_CONFIG", "SYSLOG", "WAKE_ALARM",
+	}
+	ulimitNames = []string{
+		"as", "core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+		"nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack",
+	}
+)
+
+// Hardening is the per-challenge container lockdown. Zero values mean "use the
+// platform default"; CapAdd distinguishes nil (defaults) from an explicit
+// empty list (no capabilities at all).
+type Hardening struct {
+	ReadOnlyRootfs  bool              `json:"read_only_rootfs,omitempty"`
+	Tmpfs           map[string]string `json:"tmpfs,omitempty"`
+	CapAdd          []string          `json:"cap_add"`
+	NoNewPrivileges *bool             `json:"no_new_privileges,omitempty"`
+	PidsLimit       int64             `json:"pids_limit,omitempty"`
+	Ulimits         []Ulimit          `json:"ulimits,omitempty"`
+	SeccompProfile  string            `json:"seccomp_profile,omitempty"`
+	User            string            `json:"user,omitempty"`
+	DiskQuotaMB     int               `json:"disk_quota_mb,omitempty"`
+}
+
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// NormalizeHardening validates author input and canonicalizes capability,
+// ulimit and seccomp names. It does not fill in defaults; those are applied
+// when the container starts so existing challenges pick them up too.
+func NormalizeHardening(h Hardening) (Hardening, error) {
+	if h.CapAdd != nil {
+		caps := make([]string, 0, len(h.CapAdd))
+		for _, value := range h.CapAdd {
+			capability := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "CAP_")
+			if capability == "ALL" {
+				return Hardening{}, fmt.Errorf("cap_add must list capabilities explicitly, ALL is not allowed")
+			}
+			if !slices.Contains(linuxCapabilities, capability) {
+				return Hardening{}, fmt.Errorf("cap_add %q is not a Linux capability", value)
+			}
+			if !slices.Contains(caps, capability) {
+				caps = append(caps, capability)
+			}
+		}
+		h.CapAdd = caps
+	}
+
+	if len(h.Tmpfs) > 0 {
+		mounts := make(map[string]string, len(h.Tmpfs))
+		for path, options := range h.Tmpfs {
+			path = strings.TrimSpace(path)
+			options = strings.TrimSpace(options)
+			if !strings.HasPrefix(path, "/") || strings.ContainsAny(path, " :") {
+				return Hardening{}, fmt.Errorf("tmpfs mount %q must be an absolute path", path)
+			}
+			if strings.ContainsAny(options, " \t") {
+				return Hardening{}, fmt.Errorf("tmpfs options for %s must not contain spaces", path)
+			}
+			mounts[path] = options
+		}
+		h.Tmpfs = mounts
+	}
+
+	if h.PidsLimit < 0 {
+		return Hardening{}, fmt.Errorf("pids_limit cannot be negative")
+	}
+	if h.DiskQuotaMB < 0 {
+		return Hardening{}, fmt.Errorf("disk_quota_mb cannot be negative")
+	}
+
+	for i := range h.Ulimits {
+		limit := &h.Ulimits[i]
+		limit.Name = strings.ToLower(strings.TrimSpace(limit.Name))
+		if !slices.Contains(ulimitNames, limit.Name) {
+			return Hardening{}, fmt.Errorf("ulimit %q is not supported", limit.Name)
+		}
+		if limit.Hard == 0 {
+			limit.Hard = limit.Soft
+		}
+		if limit.Soft < 0 || limit.Hard < 0 || limit.Soft > limit.Hard {
+			return Hardening{}, fmt.Errorf("ulimit %s must satisfy 0 <= soft <= hard", limit.Name)
+		}
+	}
+
+	h.SeccompProfile = strings.TrimSpace(h.SeccompProfile)
+	if strings.EqualFold(h.SeccompProfile, SeccompDefault) {
+		h.SeccompProfile = ""
+	}
+	if strings.EqualFold(h.SeccompProfile, SeccompUnconfined) {
+		h.SeccompProfile = SeccompUnconfined
+	}
+	if h.SeccompProfile != "" && !seccompProfileName.MatchString(h.SeccompProfile) {
+		return Hardening{}, fmt.Errorf("seccomp_profile %q must be a profile name, not a path", h.SeccompProfile)
+	}
+
+	h.User = strings.TrimSpace(h.User)
+	if strings.ContainsAny(h.User, " \t") {
+		return Hardening{}, fmt.Errorf("user %q must not contain spaces", h.User)
+	}
+	return h, nil
+}
+
+// withDefaults fills in the safe defaults for anything the challenge left
+// unset.
+func (h Hardening) withDefaults() Hardening {
+	if h.CapAdd == nil {
+		h.CapAdd = slices.Clone(DefaultCapAdd)
+	}
+	if h.NoNewPrivileges == nil {
+		enabled := true
+		h.NoNewPrivileges = &enabled
+	}
+	if h.PidsLimit == 0 {
+		h.PidsLimit = defaultPidsLimit
+	}
+	if !slices.ContainsFunc(h.Ulimits, func(limit Ulimit) bool { return limit.Name == "nofile" }) {
+		h.Ulimits = append(slices.Clone(h.Ulimits), Ulimit{Name: "nofile", Soft: defaultNofileSoft, Hard: defaultNofileHard})
+	}
+	if h.ReadOnlyRootfs && len(h.Tmpfs) == 0 {
+		h.Tmpfs = map[string]string{defaultTmpfsMount: defaultTmpfsOption}
+	}
+	return h
+}
@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeHardeningCanonicalizesInput(t *testing.T) {
+	h, err := NormalizeHardening(Hardening{
+		CapAdd:         []string{" cap_net_bind_service", "NET_BIND_SERVICE", "setuid"},
+		Ulimits:        []Ulimit{{Name: " NOFILE ", Soft: 128}},
+		SeccompProfile: "Default",
+	})
+	if err != nil {
+		t.Fatalf("normalize hardening: %v", err)
+	}
+	if !slices.Equal(h.CapAdd, []string{"NET_BIND_SERVICE", "SETUID"}) {
+		t.Fatalf("unexpected capabilities: %v", h.CapAdd)
+	}
+	if h.Ulimits[0].Name != "nofile" || h.Ulimits[0].Hard != 128 {
+		t.Fatalf("unexpected ulimit: %+v", h.Ulimits[0])
+	}
+	if h.SeccompProfile != "" {
+		t.Fatalf("expected default seccomp profile to be stored empty, got %q", h.SeccompProfile)
+	}
+}
+
+func TestNormalizeHardeningRejectsInvalidInput(t *testing.T) {
+	cases := map[string]Hardening{
+		"cap_add":         {CapAdd: []string{"ALL"}},
+		"is not a Linux":  {CapAdd: []string{"ROOT"}},
+		"tmpfs mount":     {Tmpfs: map[string]string{"tmp": "rw"}},
+		"ulimit":          {Ulimits: []Ulimit{{Name: "nofile", Soft: 10, Hard: 5}}},
+		"seccomp_profile": {SeccompProfile: "../etc/profile"},
+		"pids_limit":      {PidsLimit: -1},
+	}
+	for want, input := range cases {
+		if _, err := NormalizeHardening(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q error for %+v, got %v", want, input, err)
+		}
+	}
+}
+
+func TestApplyHardeningUsesSafeDefaults(t *testing.T) {
+	manager := NewDockerManager("/var/run/docker.sock")
+	var payload createContainerRequest
+	if err := manager.applyHardening(&payload, Hardening{ReadOnlyRootfs: true}); err != nil {
+		t.Fatalf("apply hardening: %v", err)
+	}
+	host := payload.HostConfig
+	if !slices.Equal(host.CapDrop, []string{"ALL"}) || !slices.Equal(host.CapAdd, DefaultCapAdd) {
+		t.Fatalf("unexpected capabilities: drop=%v add=%v", host.CapDrop, host.CapAdd)
+	}
+	if !slices.Contains(host.SecurityOpt, "no-new-privileges") {
+		t.Fatalf("expected no-new-privileges, got %v", host.SecurityOpt)
+	}
+	if host.PidsLimit != defaultPidsLimit {
+		t.Fatalf("expected default pids limit, got %d", host.PidsLimit)
+	}
+	if len(host.Ulimits) != 1 || host.Ulimits[0].Name != "nofile" {
+		t.Fatalf("expected default nofile ulimit, got %+v", host.Ulimits)
+	}
+	if !host.ReadonlyRootfs || host.Tmpfs[defaultTmpfsMount] != defaultTmpfsOption {
+		t.Fatalf("expected read-only rootfs with /tmp tmpfs, got %v %v", host.ReadonlyRootfs, host.Tmpfs)
+	}
+}
+
+func TestApplyHardeningHonoursExplicitSettings(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "strict.json"), []byte(`{"defaultAction":"SCMP_ACT_ERRNO"}`), 0o644); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	manager := NewDockerManagerWithConfig("/var/run/docker.sock", DockerManagerConfig{SeccompProfileDir: dir})
+	disabled := false
+	var payload createContainerRequest
+	err := manager.applyHardening(&payload, Hardening{
+		CapAdd:          []string{},
+		NoNewPrivileges: &disabled,
+		SeccompProfile:  "strict",
+		User:            "1000:1000",
+		DiskQuotaMB:     512,
+	})
+	if err != nil {
+		t.Fatalf("apply hardening: %v", err)
+	}
+	host := payload.HostConfig
+	if len(host.CapAdd) != 0 {
+		t.Fatalf("expected no capabilities to be added, got %v", host.CapAdd)
+	}
+	if !slices.Equal(host.SecurityOpt, []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`}) {
+		t.Fatalf("unexpected security options: %v", host.SecurityOpt)
+	}
+	if payload.User != "1000:1000" || host.StorageOpt["size"] != "512M" {
+		t.Fatalf("unexpected user or storage quota: %q %v", payload.User, host.StorageOpt)
+	}
+
+	if err := manager.applyHardening(&createContainerRequest{}, Hardening{SeccompProfile: "missing"}); err == nil {
+		t.Fatal("expected missing seccomp profile to fail")
+	}
+}
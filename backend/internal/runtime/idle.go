@@ -0,0 +1,234 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdlePolicy reclaims player instances that have seen no network activity
+// for Timeout. For the last Warning of that period the instance API reports
+// when the instance will be reclaimed, so that the player can use it again to
+// keep it; an instance is never reclaimed before its warning has been up for
+// Warning. A zero Timeout keeps instances for their whole TTL.
+type IdlePolicy struct {
+	Timeout time.Duration
+	Warning time.Duration
+}
+
+func (p IdlePolicy) enabled() bool {
+	return p.Timeout > 0
+}
+
+func normalizeIdlePolicy(policy IdlePolicy) IdlePolicy {
+	if policy.Timeout < 0 {
+		policy.Timeout = 0
+	}
+	if policy.Warning < 0 || policy.Warning > policy.Timeout {
+		policy.Warning = policy.Timeout
+	}
+	return policy
+}
+
+type instanceActivity struct {
+	at      time.Time
+	rx, tx  uint64
+	sampled bool
+	open    int
+	// warnedAt is when the current idle stretch first entered its warning
+	// period.
+	warnedAt time.Time
+}
+
+// activityTracker remembers when each active instance last saw traffic:
+// requests through the proxy, connections through the TCP gateway and
+// changes of the network counters sampled from its containers. It lives in
+// memory, so after a restart every instance counts as active from the moment
+// the API started.
+type activityTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	seen    map[int64]instanceActivity
+}
+
+func newActivityTracker(started time.Time) *activityTracker {
+	return &activityTracker{started: started, seen: make(map[int64]instanceActivity)}
+}
+
+func (t *activityTracker) touch(instanceID int64, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instanceID]
+	if at.After(item.at) {
+		item.at = at
+	}
+	t.seen[instanceID] = item
+}
+
+// open counts a proxied request or gateway connection; an instance with one
+// open is not idle however quiet the connection is.
+func (t *activityTracker) open(instanceID int64, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instanceID]
+	item.open++
+	item.at = at
+	t.seen[instanceID] = item
+}
+
+func (t *activityTracker) close(instanceID int64, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instanceID]
+	item.open = max(item.open-1, 0)
+	item.at = at
+	t.seen[instanceID] = item
+}
+
+// observe records a stats sample. Traffic moved when the network counters
+// changed since the previous sample; a process instance, which has no
+// network counters, is active while it is serving a connection.
+func (t *activityTracker) observe(instance InstanceRecord, stats ContainerStats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instance.ID]
+	moved := item.sampled && (stats.NetworkRxBytes != item.rx || stats.NetworkTxBytes != item.tx)
+	if instance.Instance.Node == ProcessNodeName && stats.PIDs > 0 {
+		moved = true
+	}
+	if moved && stats.SampledAt.After(item.at) {
+		item.at = stats.SampledAt
+	}
+	item.rx, item.tx, item.sampled = stats.NetworkRxBytes, stats.NetworkTxBytes, true
+	t.seen[instance.ID] = item
+}
+
+// idleSince is when the instance last saw traffic. It reports false while a
+// connection to the instance is open.
+func (t *activityTracker) idleSince(instance InstanceRecord) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instance.ID]
+	if item.open > 0 {
+		return time.Time{}, false
+	}
+	since := instance.Instance.StartedAt
+	if t.started.After(since) {
+		since = t.started
+	}
+	if item.at.After(since) {
+		since = item.at
+	}
+	return since, true
+}
+
+// warn records that the instance, idle since since, is in its warning period
+// at now, and returns when that warning was first given. Traffic after an
+// earlier warning starts a new idle stretch and so a new warning.
+func (t *activityTracker) warn(instanceID int64, since, now time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.seen[instanceID]
+	if item.warnedAt.IsZero() || item.warnedAt.Before(since) {
+		item.warnedAt = now
+	}
+	t.seen[instanceID] = item
+	return item.warnedAt
+}
+
+func (t *activityTracker) forget(instanceID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, instanceID)
+}
+
+func (t *activityTracker) retain(active map[int64]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.seen {
+		if !active[id] {
+			delete(t.seen, id)
+		}
+	}
+}
+
+// idleDeadline is when a quiet player instance will be reclaimed, once that
+// is within the warning period; nil otherwise.
+func (s *Service) idleDeadline(record InstanceRecord) *time.Time {
+	if !s.cfg.Idle.enabled() || record.Instance.Status != "running" || record.Instance.UserID == SharedOwnerID {
+		return nil
+	}
+	deadline, _, ok := s.idleReclaimAt(record, s.now())
+	if !ok || deadline.After(record.Instance.ExpiresAt) {
+		return nil
+	}
+	return &deadline
+}
+
+// idleReclaimAt is when an idle instance may be reclaimed: Timeout after its
+// last traffic, but no earlier than Warning after the warning was first
+// given. It also returns the start of the idle stretch, and reports false
+// while the instance is in use or not yet in its warning period.
+func (s *Service) idleReclaimAt(record InstanceRecord, now time.Time) (time.Time, time.Time, bool) {
+	policy := s.cfg.Idle
+	since, idle := s.activity.idleSince(record)
+	if !idle {
+		return time.Time{}, time.Time{}, false
+	}
+	deadline := since.Add(policy.Timeout)
+	if deadline.Sub(now) > policy.Warning {
+		return time.Time{}, time.Time{}, false
+	}
+	if warned := s.activity.warn(record.ID, since, now).Add(policy.Warning); warned.After(deadline) {
+		deadline = warned
+	}
+	return deadline, since, true
+}
+
+// ReclaimIdle stops running player instances that have seen no traffic for
+// the idle timeout and whose warning has been up for the warning period.
+func (s *Service) ReclaimIdle(ctx context.Context) (int, error) {
+	if !s.cfg.Idle.enabled() {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.repo.ListActiveInstances(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := s.now().UTC()
+	active := make(map[int64]bool, len(records))
+	reclaimed := 0
+	for _, item := range records {
+		active[item.ID] = true
+		if item.Instance.Status != "running" || item.Instance.UserID == SharedOwnerID {
+			continue
+		}
+		deadline, since, ok := s.idleReclaimAt(item, now)
+		if !ok || now.Before(deadline) {
+			continue
+		}
+		if err := s.manager.Stop(ctx, item.Instance.Node, item.Instance.ContainerID); err != nil {
+			return reclaimed, err
+		}
+		if err := s.repo.TerminateInstance(ctx, item.ID, now); err != nil {
+			return reclaimed, err
+		}
+		s.recordEvent(ctx, item, EventIdleReclaimed, "no network activity since "+since.UTC().Format(time.RFC3339))
+		delete(active, item.ID)
+		reclaimed++
+	}
+	s.activity.retain(active)
+	return reclaimed, nil
+}
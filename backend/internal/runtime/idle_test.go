@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReclaimIdleWarnsThenStopsQuietInstances(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{
+		PublicBaseURL:  "http://localhost:8080",
+		RuntimeBaseURL: "http://localhost:8080",
+		Idle:           IdlePolicy{Timeout: 10 * time.Minute, Warning: 3 * time.Minute},
+	}, manager, repo)
+	baseTime := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	now := baseTime
+	service.now = func() time.Time { return now }
+	service.activity = newActivityTracker(baseTime)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	var instanceID int64
+	for _, item := range repo.active {
+		instanceID = item.ID
+	}
+	sample := func(at time.Time, rx uint64) {
+		t.Helper()
+		now = at
+		manager.stats = map[string]ContainerStats{"container-1": {NetworkRxBytes: rx, NetworkTxBytes: 10, SampledAt: at}}
+		if _, err := service.SampleStats(context.Background()); err != nil {
+			t.Fatalf("sample stats: %v", err)
+		}
+	}
+	idleExpiry := func() *time.Time {
+		t.Helper()
+		got, err := service.GetInstance(context.Background(), 7, "1")
+		if err != nil {
+			t.Fatalf("get instance: %v", err)
+		}
+		return got.IdleExpiresAt
+	}
+
+	sample(baseTime.Add(time.Minute), 100)
+	// Traffic moved the counters: the idle period starts over.
+	sample(baseTime.Add(4*time.Minute), 200)
+	sample(baseTime.Add(9*time.Minute), 200)
+	if got := idleExpiry(); got != nil {
+		t.Fatalf("expected no warning before the warning period, got %s", got)
+	}
+
+	// The warning period began at 09:11 but is first seen at 09:12, so the
+	// player still gets the full three minutes.
+	sample(baseTime.Add(12*time.Minute), 200)
+	if got := idleExpiry(); got == nil || !got.Equal(baseTime.Add(15*time.Minute)) {
+		t.Fatalf("expected the instance to be reclaimed at 09:15, got %v", got)
+	}
+	now = baseTime.Add(14 * time.Minute)
+	if reclaimed, err := service.ReclaimIdle(context.Background()); err != nil || reclaimed != 0 {
+		t.Fatalf("expected nothing reclaimed before the warning ran out, got %d (%v)", reclaimed, err)
+	}
+
+	// An open connection keeps a quiet instance.
+	now = baseTime.Add(20 * time.Minute)
+	service.activity.open(instanceID, baseTime.Add(13*time.Minute))
+	if reclaimed, _ := service.ReclaimIdle(context.Background()); reclaimed != 0 || idleExpiry() != nil {
+		t.Fatalf("expected an open connection to keep the instance, reclaimed %d", reclaimed)
+	}
+	service.activity.close(instanceID, baseTime.Add(13*time.Minute))
+
+	// Idle since 09:13, the instance is past its timeout at 09:23, but the
+	// new idle stretch has not been warned about yet.
+	now = baseTime.Add(23 * time.Minute)
+	if reclaimed, _ := service.ReclaimIdle(context.Background()); reclaimed != 0 {
+		t.Fatalf("expected a warning before the instance is reclaimed, reclaimed %d", reclaimed)
+	}
+	if got := idleExpiry(); got == nil || !got.Equal(baseTime.Add(26*time.Minute)) {
+		t.Fatalf("expected the instance to be reclaimed at 09:26, got %v", got)
+	}
+	now = baseTime.Add(26 * time.Minute)
+
+	reclaimed, err := service.ReclaimIdle(context.Background())
+	if err != nil || reclaimed != 1 {
+		t.Fatalf("expected the idle instance to be reclaimed, got %d (%v)", reclaimed, err)
+	}
+	if len(manager.stoppedIDs) != 1 || len(repo.active) != 0 {
+		t.Fatalf("expected container stopped and instance terminated, stopped=%v", manager.stoppedIDs)
+	}
+	if types := repo.eventTypes(); !slices.Contains(types, EventIdleReclaimed) {
+		t.Fatalf("expected an idle_reclaimed event, got %v", types)
+	}
+}
+
+func TestReclaimIdleSkipsSharedInstances(t *testing.T) {
+	service := &Service{cfg: ServiceConfig{Idle: IdlePolicy{Timeout: time.Minute, Warning: time.Minute}}, activity: newActivityTracker(time.Time{})}
+	service.now = func() time.Time { return time.Date(2025, time.March, 8, 10, 0, 0, 0, time.UTC) }
+	record := InstanceRecord{ID: 1, Instance: Instance{UserID: SharedOwnerID, Status: "running", ExpiresAt: service.now().Add(time.Hour)}}
+	if got := service.idleDeadline(record); got != nil {
+		t.Fatalf("expected shared instances to never idle out, got %s", got)
+	}
+	record.Instance.UserID = 7
+	if got := service.idleDeadline(record); got == nil {
+		t.Fatal("expected a long quiet player instance to report its deadline")
+	}
+}
@@ -0,0 +1,410 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of pulling an image onto a node.
+const (
+	ImagePresent  = "present"
+	ImagePulled   = "pulled"
+	ImageFailed   = "failed"
+	ImageMismatch = "digest_mismatch"
+)
+
+var (
+	ErrImageNotFound       = errors.New("image not found on any docker node")
+	ErrImageDigestConflict = errors.New("image differs between docker nodes")
+	ErrImagesNotSupported  = errors.New("runtime manager does not manage images")
+	imageDigestPattern     = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	errImageDigestMoved    = errors.New("pulled image does not match the pinned digest")
+)
+
+// ValidImageDigest reports whether digest is a Docker image ID a challenge
+// can be pinned to.
+func ValidImageDigest(digest string) bool {
+	return imageDigestPattern.MatchString(digest)
+}
+
+// image is what the challenge's containers are created from: the pinned
+// image ID when there is one, so that retagging the image does not change
+// running challenges, and the image name otherwise.
+func (c ChallengeConfig) image() string {
+	if c.ImageDigest != "" {
+		return c.ImageDigest
+	}
+	return c.ImageName
+}
+
+// NodeImage is the state of one image on one node.
+type NodeImage struct {
+	Node    string `json:"node"`
+	Present bool   `json:"present"`
+	ImageID string `json:"image_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImageCheck reports whether an image is present on every node that can run
+// the challenge. Digest is set for pinned images, which must be present under
+// that ID.
+type ImageCheck struct {
+	Image  string      `json:"image"`
+	Digest string      `json:"digest,omitempty"`
+	Ready  bool        `json:"ready"`
+	Nodes  []NodeImage `json:"nodes"`
+}
+
+// ChallengeImages is the image readiness of one published dynamic challenge:
+// its entrypoint image first, then the images of its services.
+type ChallengeImages struct {
+	ChallengeID string       `json:"challenge_id"`
+	Slug        string       `json:"slug"`
+	Title       string       `json:"title"`
+	Ready       bool         `json:"ready"`
+	Images      []ImageCheck `json:"images"`
+}
+
+// ImagePull is the outcome of pulling one image onto one node.
+type ImagePull struct {
+	Image      string `json:"image"`
+	Digest     string `json:"digest,omitempty"`
+	Node       string `json:"node"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type ImagePullSummary struct {
+	Images  int `json:"images"`
+	Present int `json:"present"`
+	Pulled  int `json:"pulled"`
+	Failed  int `json:"failed"`
+}
+
+// imageManager is implemented by managers that can inspect and pull images on
+// the nodes a challenge may be scheduled onto.
+type imageManager interface {
+	CheckImage(ctx context.Context, cfg ChallengeConfig, image, digest string) (ImageCheck, error)
+	PullImage(ctx context.Context, cfg ChallengeConfig, image, digest string, progress func(ImagePull)) error
+	ResolveImage(ctx context.Context, cfg ChallengeConfig) (string, error)
+}
+
+type challengeImage struct {
+	image  string
+	digest string
+}
+
+// challengeImages lists the images a challenge's containers are created from.
+func challengeImages(cfg ChallengeConfig) []challengeImage {
+	images := []challengeImage{{image: cfg.ImageName, digest: cfg.ImageDigest}}
+	for _, service := range cfg.Services {
+		images = append(images, challengeImage{image: service.Image})
+	}
+	return images
+}
+
+// imageChallenges loads every published dynamic challenge that runs on Docker.
+func (s *Service) imageChallenges(ctx context.Context) ([]ChallengeConfig, imageManager, error) {
+	images, ok := s.manager.(imageManager)
+	if !ok {
+		return nil, nil, ErrImagesNotSupported
+	}
+	ids, err := s.repo.ListDynamicChallengeIDs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	configs := make([]ChallengeConfig, 0, len(ids))
+	for _, id := range ids {
+		record, err := s.repo.GetChallengeConfig(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrRepositoryNotFound) {
+				continue
+			}
+			return nil, nil, err
+		}
+		cfg := record.Challenge
+		if !cfg.Dynamic || record.ID == 0 || cfg.ImageName == "" || cfg.Driver == DriverProcess {
+			continue
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, images, nil
+}
+
+// ImageReadiness checks that the images of every published dynamic challenge
+// are present on the nodes that can run it, so that missing or unpulled images
+// are found before players start instances.
+func (s *Service) ImageReadiness(ctx context.Context) ([]ChallengeImages, error) {
+	configs, images, err := s.imageChallenges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ChallengeImages, 0, len(configs))
+	for _, cfg := range configs {
+		item := ChallengeImages{ChallengeID: cfg.ID, Slug: cfg.Slug, Title: cfg.Title, Ready: true}
+		for _, image := range challengeImages(cfg) {
+			check, err := images.CheckImage(ctx, cfg, image.image, image.digest)
+			if err != nil {
+				return nil, err
+			}
+			item.Ready = item.Ready && check.Ready
+			item.Images = append(item.Images, check)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// PullImages makes sure the images of every published dynamic challenge are
+// present on the nodes that can run it, pulling the ones that are not.
+// progress is told about each image on each node as soon as it is done.
+func (s *Service) PullImages(ctx context.Context, progress func(ImagePull)) (ImagePullSummary, error) {
+	configs, images, err := s.imageChallenges(ctx)
+	if err != nil {
+		return ImagePullSummary{}, err
+	}
+	var summary ImagePullSummary
+	report := func(pull ImagePull) {
+		switch pull.Status {
+		case ImagePresent:
+			summary.Present++
+		case ImagePulled:
+			summary.Pulled++
+		default:
+			summary.Failed++
+		}
+		progress(pull)
+	}
+	// Challenges sharing an image only pull it once per node.
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		for _, image := range challengeImages(cfg) {
+			key := image.image + "@" + image.digest + "|" + strings.Join(sortedLabels(cfg.NodeLabels), ",")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			summary.Images++
+			if err := images.PullImage(ctx, cfg, image.image, image.digest, report); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+func sortedLabels(labels map[string]string) []string {
+	items := make([]string, 0, len(labels))
+	for key, value := range labels {
+		items = append(items, key+"="+value)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// imageNodes are the nodes the challenge can currently be scheduled onto.
+func (p *NodePool) imageNodes(cfg ChallengeConfig) []*dockerNode {
+	var nodes []*dockerNode
+	for _, node := range p.nodes {
+		if node.accepts(cfg) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func (p *NodePool) CheckImage(ctx context.Context, cfg ChallengeConfig, image, digest string) (ImageCheck, error) {
+	nodes := p.imageNodes(cfg)
+	check := ImageCheck{Image: image, Digest: digest, Ready: len(nodes) > 0, Nodes: make([]NodeImage, len(nodes))}
+	ref := image
+	if digest != "" {
+		ref = digest
+	}
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state := NodeImage{Node: node.spec.Name}
+			inspected, err := node.manager.inspectImage(ctx, ref)
+			switch {
+			case err == nil:
+				state.Present = true
+				state.ImageID = inspected.ID
+			case !errors.Is(err, ErrImageNotFound):
+				state.Error = err.Error()
+			}
+			check.Nodes[i] = state
+		}()
+	}
+	wg.Wait()
+	for _, state := range check.Nodes {
+		check.Ready = check.Ready && state.Present
+	}
+	return check, nil
+}
+
+// PullImage pulls image onto every node that can run the challenge and does
+// not have it yet. A pinned image is pulled by name and must come out with the
+// pinned ID; Docker cannot pull an image by its ID.
+func (p *NodePool) PullImage(ctx context.Context, cfg ChallengeConfig, image, digest string, progress func(ImagePull)) error {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, node := range p.imageNodes(cfg) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pull := node.pullImage(ctx, image, digest)
+			mu.Lock()
+			defer mu.Unlock()
+			progress(pull)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (n *dockerNode) pullImage(ctx context.Context, image, digest string) ImagePull {
+	started := time.Now()
+	pull := ImagePull{Image: image, Digest: digest, Node: n.spec.Name, Status: ImagePresent}
+	ref := image
+	if digest != "" {
+		ref = digest
+	}
+	_, err := n.manager.inspectImage(ctx, ref)
+	if errors.Is(err, ErrImageNotFound) {
+		pull.Status = ImagePulled
+		err = n.manager.pullImage(ctx, image)
+		if err == nil && digest != "" {
+			var pulled dockerImage
+			if pulled, err = n.manager.inspectImage(ctx, image); err == nil && pulled.ID != digest {
+				pull.Status = ImageMismatch
+				err = fmt.Errorf("%w: %s is now %s", errImageDigestMoved, image, pulled.ID)
+			}
+		}
+	}
+	if err != nil {
+		if pull.Status != ImageMismatch {
+			pull.Status = ImageFailed
+		}
+		pull.Error = err.Error()
+	}
+	pull.DurationMS = time.Since(started).Milliseconds()
+	return pull
+}
+
+// ResolveImage finds the ID the challenge's image name currently refers to.
+// Every node that has the image must agree on it.
+func (p *NodePool) ResolveImage(ctx context.Context, cfg ChallengeConfig) (string, error) {
+	var (
+		resolved string
+		lastErr  error
+	)
+	for _, node := range p.imageNodes(cfg) {
+		inspected, err := node.manager.inspectImage(ctx, cfg.ImageName)
+		if err != nil {
+			if !errors.Is(err, ErrImageNotFound) {
+				lastErr = fmt.Errorf("docker node %s: %w", node.spec.Name, err)
+			}
+			continue
+		}
+		if resolved != "" && inspected.ID != resolved {
+			return "", fmt.Errorf("%w: %s is %s on one node and %s on %s", ErrImageDigestConflict, cfg.ImageName, resolved, inspected.ID, node.spec.Name)
+		}
+		resolved = inspected.ID
+	}
+	if resolved == "" {
+		if lastErr != nil {
+			return "", lastErr
+		}
+		return "", fmt.Errorf("%w: %s", ErrImageNotFound, cfg.ImageName)
+	}
+	return resolved, nil
+}
+
+type dockerImage struct {
+	ID string `json:"Id"`
+}
+
+func (m *DockerManager) inspectImage(ctx context.Context, ref string) (dockerImage, error) {
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath("/images/"+ref+"/json"), nil)
+	if err != nil {
+		return dockerImage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return dockerImage{}, ErrImageNotFound
+	}
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return dockerImage{}, err
+	}
+	var image dockerImage
+	if err := json.NewDecoder(resp.Body).Decode(&image); err != nil {
+		return dockerImage{}, fmt.Errorf("decode image inspect response: %w", err)
+	}
+	return image, nil
+}
+
+type dockerPullMessage struct {
+	Error string `json:"error"`
+}
+
+// pullImage pulls image from its registry. Docker reports failures in the
+// progress stream after a 200 response, so the whole stream is read.
+func (m *DockerManager) pullImage(ctx context.Context, image string) error {
+	name, tag := splitImageTag(image)
+	query := url.Values{}
+	query.Set("fromImage", name)
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := m.send(ctx, m.streamClient, http.MethodPost, m.apiPath("/images/create?"+query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message dockerPullMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode image pull progress: %w", err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("pull %s: %s", image, message.Error)
+		}
+	}
+}
+
+// splitImageTag separates the tag from an image reference. References
+// pinned by digest are pulled as they are; untagged ones get latest, since an
+// empty tag would pull every tag of the repository.
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
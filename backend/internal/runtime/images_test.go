@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeImageEngine is a Docker engine that only knows about images. Pulling
+// name:tag makes it present with the ID in registry, or fails when the
+// registry does not have it.
+type fakeImageEngine struct {
+	mu       sync.Mutex
+	images   map[string]string
+	registry map[string]string
+	pulls    []string
+}
+
+func newFakeImageNode(t *testing.T, name string, registry map[string]string) (DockerNode, *fakeImageEngine) {
+	t.Helper()
+	engine := &fakeImageEngine{images: make(map[string]string), registry: registry}
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen docker socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(engine)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return DockerNode{Name: name, Host: "unix://" + socket}, engine
+}
+
+func (e *fakeImageEngine) add(ref, id string) {
+	e.images[ref] = id
+	e.images[id] = id
+}
+
+func (e *fakeImageEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+		id, ok := e.images[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"Id":%q}`, id)
+	case r.Method == http.MethodPost && r.URL.Path == "/images/create":
+		ref := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		e.pulls = append(e.pulls, ref)
+		fmt.Fprintln(w, `{"status":"Pulling from registry"}`)
+		id, ok := e.registry[ref]
+		if !ok {
+			fmt.Fprintf(w, `{"error":"manifest for %s not found"}`+"\n", ref)
+			return
+		}
+		e.add(ref, id)
+		fmt.Fprintln(w, `{"status":"Downloaded newer image"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func imageID(n int) string {
+	return fmt.Sprintf("sha256:%064x", n)
+}
+
+func TestNodePoolPullsMissingImagesAndVerifiesPins(t *testing.T) {
+	registry := map[string]string{"ctf/web:dev": imageID(2)}
+	nodeA, engineA := newFakeImageNode(t, "a", registry)
+	nodeB, engineB := newFakeImageNode(t, "b", registry)
+	pool, err := NewNodePool([]DockerNode{nodeA, nodeB}, DockerManagerConfig{})
+	if err != nil {
+		t.Fatalf("new node pool: %v", err)
+	}
+	engineA.add("ctf/web:dev", imageID(1))
+	cfg := ChallengeConfig{ID: "1", ImageName: "ctf/web:dev"}
+
+	check, err := pool.CheckImage(t.Context(), cfg, cfg.ImageName, "")
+	if err != nil || check.Ready || len(check.Nodes) != 2 {
+		t.Fatalf("expected the image to be missing on one node, got %+v (%v)", check, err)
+	}
+	if _, err := pool.ResolveImage(t.Context(), cfg); err != nil {
+		t.Fatalf("resolve with the image on one node: %v", err)
+	}
+
+	// Pinned to the ID node a has, node b pulls a newer build of the tag.
+	pulls := make(map[string]ImagePull)
+	if err := pool.PullImage(t.Context(), cfg, cfg.ImageName, imageID(1), func(pull ImagePull) {
+		pulls[pull.Node] = pull
+	}); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if pulls["a"].Status != ImagePresent || len(engineA.pulls) != 0 {
+		t.Fatalf("expected node a to keep its image, got %+v", pulls["a"])
+	}
+	if pulls["b"].Status != ImageMismatch || !strings.Contains(pulls["b"].Error, imageID(2)) {
+		t.Fatalf("expected node b to report the moved tag, got %+v", pulls["b"])
+	}
+	if _, err := pool.ResolveImage(t.Context(), cfg); !errors.Is(err, ErrImageDigestConflict) {
+		t.Fatalf("expected nodes to disagree on the image, got %v", err)
+	}
+
+	missing := ChallengeConfig{ID: "2", ImageName: "ctf/missing"}
+	if err := pool.PullImage(t.Context(), missing, missing.ImageName, "", func(pull ImagePull) {
+		if pull.Status != ImageFailed || !strings.Contains(pull.Error, "not found") {
+			t.Errorf("expected the registry error on node %s, got %+v", pull.Node, pull)
+		}
+	}); err != nil {
+		t.Fatalf("pull missing: %v", err)
+	}
+	if got := engineB.pulls[len(engineB.pulls)-1]; got != "ctf/missing:latest" {
+		t.Fatalf("expected untagged images to pull latest, got %q", got)
+	}
+}
+
+func TestServicePullsEachImageOnce(t *testing.T) {
+	registry := map[string]string{"ctf/web:dev": imageID(1), "redis:7": imageID(3)}
+	node, engine := newFakeImageNode(t, "a", registry)
+	pool, err := NewNodePool([]DockerNode{node}, DockerManagerConfig{})
+	if err != nil {
+		t.Fatalf("new node pool: %v", err)
+	}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.ImageName = "ctf/web:dev"
+	repo.challenge.Challenge.Services = []ServiceSpec{{Name: "cache", Image: "redis:7"}, {Name: "replica", Image: "redis:7"}}
+	service := NewService(ServiceConfig{}, pool, repo)
+
+	var events []ImagePull
+	summary, err := service.PullImages(t.Context(), func(pull ImagePull) { events = append(events, pull) })
+	if err != nil {
+		t.Fatalf("pull images: %v", err)
+	}
+	if summary.Images != 2 || summary.Pulled != 2 || len(events) != 2 || len(engine.pulls) != 2 {
+		t.Fatalf("expected the challenge and its shared service image to be pulled once, got %+v %+v", summary, events)
+	}
+
+	items, err := service.ImageReadiness(t.Context())
+	if err != nil {
+		t.Fatalf("image readiness: %v", err)
+	}
+	if len(items) != 1 || !items[0].Ready || len(items[0].Images) != 3 {
+		t.Fatalf("expected the challenge to be ready after the pull, got %+v", items)
+	}
+}
+
+func TestSplitImageTag(t *testing.T) {
+	for image, want := range map[string][2]string{
+		"ctf/web:dev":                  {"ctf/web", "dev"},
+		"ctf/web":                      {"ctf/web", "latest"},
+		"registry:5000/ctf/web":        {"registry:5000/ctf/web", "latest"},
+		"registry:5000/ctf/web:v1":     {"registry:5000/ctf/web", "v1"},
+		"ctf/web@sha256:0123456789abc": {"ctf/web@sha256:0123456789abc", ""},
+	} {
+		name, tag := splitImageTag(image)
+		if name != want[0] || tag != want[1] {
+			t.Errorf("splitImageTag(%q) = %q, %q; want %q, %q", image, name, tag, want[0], want[1])
+		}
+	}
+}
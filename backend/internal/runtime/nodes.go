@@ -0,0 +1,624 @@
+package runtime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNodeName names the single node built from DOCKER_SOCKET_PATH
+	// when no node file is configured.
+	DefaultNodeName = "local"
+
+	memoryLabel = "ctf.memory_mb"
+	cpuLabel    = "ctf.cpu_millicores"
+
+	maxNodeLabels = 16
+)
+
+var nodeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// DockerNode is one Docker Engine instances can be scheduled onto.
+type DockerNode struct {
+	Name string `json:"name"`
+	// Host is unix:///path/to/docker.sock or tcp://host:port.
+	Host      string `json:"host"`
+	TLSCACert string `json:"tls_ca_cert,omitempty"`
+	TLSCert   string `json:"tls_cert,omitempty"`
+	TLSKey    string `json:"tls_key,omitempty"`
+	// Address is where the API and players reach ports published on a remote
+	// node. It stays empty for the node the API runs next to.
+	Address string            `json:"address,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// MemoryMB and CPUMilli cap what instances may reserve on the node; zero
+	// uses what the engine reports.
+	MemoryMB int  `json:"memory_mb,omitempty"`
+	CPUMilli int  `json:"cpu_millicores,omitempty"`
+	Draining bool `json:"draining,omitempty"`
+}
+
+// NodeStatus is what administrators see of a node.
+type NodeStatus struct {
+	Name         string            `json:"name"`
+	Host         string            `json:"host"`
+	Address      string            `json:"address,omitempty"`
+	Labels       map[string]string `json:"labels"`
+	Healthy      bool              `json:"healthy"`
+	Error        string            `json:"error,omitempty"`
+	CheckedAt    *time.Time        `json:"checked_at,omitempty"`
+	Draining     bool              `json:"draining"`
+	Containers   int               `json:"containers"`
+	MemoryMB     int               `json:"memory_mb"`
+	UsedMemoryMB int               `json:"used_memory_mb"`
+	CPUMilli     int               `json:"cpu_millicores"`
+	UsedCPUMilli int               `json:"used_cpu_millicores"`
+}
+
+// LoadDockerNodes reads a JSON array of nodes from path.
+func LoadDockerNodes(path string) ([]DockerNode, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read docker nodes: %w", err)
+	}
+	var nodes []DockerNode
+	if err := json.Unmarshal(content, &nodes); err != nil {
+		return nil, fmt.Errorf("decode docker nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("docker nodes file %s lists no nodes", path)
+	}
+	return nodes, nil
+}
+
+// NormalizeNodeLabels validates the labels a challenge requires of its node.
+func NormalizeNodeLabels(labels map[string]string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	if len(labels) > maxNodeLabels {
+		return nil, fmt.Errorf("at most %d node labels are allowed", maxNodeLabels)
+	}
+	normalized := make(map[string]string, len(labels))
+	for key, value := range labels {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("node label keys cannot be empty")
+		}
+		normalized[key] = strings.TrimSpace(value)
+	}
+	return normalized, nil
+}
+
+// NodeAddresses maps remote nodes to the address their published ports are
+// reached at.
+func NodeAddresses(nodes []DockerNode) map[string]string {
+	addresses := make(map[string]string)
+	for _, node := range nodes {
+		if address := strings.TrimSpace(node.Address); address != "" {
+			addresses[strings.TrimSpace(node.Name)] = address
+		}
+	}
+	return addresses
+}
+
+// NodePool schedules instances across Docker nodes and routes every later
+// call to the node a container was started on.
+type NodePool struct {
+	nodes []*dockerNode
+	now   func() time.Time
+	// mu serializes picking a node so that concurrent starts see each
+	// other's reservations.
+	mu sync.Mutex
+}
+
+type dockerNode struct {
+	spec    DockerNode
+	manager *DockerManager
+
+	mu         sync.Mutex
+	draining   bool
+	healthy    bool
+	lastError  string
+	checkedAt  time.Time
+	capacity   nodeResources
+	used       nodeResources
+	containers int
+	pending    nodeResources
+}
+
+type nodeResources struct {
+	MemoryMB int
+	CPUMilli int
+}
+
+func NewNodePool(nodes []DockerNode, cfg DockerManagerConfig) (*NodePool, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("at least one docker node is required")
+	}
+	pool := &NodePool{now: time.Now}
+	seen := make(map[string]bool, len(nodes))
+	for _, spec := range nodes {
+		spec.Name = strings.TrimSpace(spec.Name)
+		spec.Host = strings.TrimSpace(spec.Host)
+		spec.Address = strings.TrimSpace(spec.Address)
+		if !nodeNamePattern.MatchString(spec.Name) {
+			return nil, fmt.Errorf("docker node name %q must be a lowercase DNS label", spec.Name)
+		}
+		if spec.Name == ProcessNodeName {
+			return nil, fmt.Errorf("docker node name %q is reserved for the process driver", spec.Name)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("docker node %q is duplicated", spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.MemoryMB < 0 || spec.CPUMilli < 0 {
+			return nil, fmt.Errorf("docker node %s resource budget cannot be negative", spec.Name)
+		}
+		dial, err := dockerDialer(spec)
+		if err != nil {
+			return nil, fmt.Errorf("docker node %s: %w", spec.Name, err)
+		}
+		nodeCfg := cfg
+		if spec.Address != "" {
+			// The API container does not run on remote nodes.
+			nodeCfg.AttachContainer = ""
+		}
+		pool.nodes = append(pool.nodes, &dockerNode{
+			spec:     spec,
+			manager:  newDockerManager(dial, nodeCfg),
+			draining: spec.Draining,
+		})
+	}
+	return pool, nil
+}
+
+func dockerDialer(spec DockerNode) (func(context.Context) (net.Conn, error), error) {
+	endpoint, err := url.Parse(spec.Host)
+	if err != nil {
+		return nil, fmt.Errorf("parse host %q: %w", spec.Host, err)
+	}
+	switch endpoint.Scheme {
+	case "unix":
+		socketPath := endpoint.Path
+		return func(ctx context.Context) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}, nil
+	case "tcp":
+		if endpoint.Port() == "" {
+			return nil, fmt.Errorf("host %q needs a port", spec.Host)
+		}
+		address := endpoint.Host
+		if spec.TLSCACert == "" && spec.TLSCert == "" && spec.TLSKey == "" {
+			return func(ctx context.Context) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "tcp", address)
+			}, nil
+		}
+		tlsConfig, err := dockerTLSConfig(spec, endpoint.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (net.Conn, error) {
+			dialer := tls.Dialer{Config: tlsConfig}
+			return dialer.DialContext(ctx, "tcp", address)
+		}, nil
+	default:
+		return nil, fmt.Errorf("host %q must use unix:// or tcp://", spec.Host)
+	}
+}
+
+func dockerTLSConfig(spec DockerNode, serverName string) (*tls.Config, error) {
+	if spec.TLSCACert == "" || spec.TLSCert == "" || spec.TLSKey == "" {
+		return nil, fmt.Errorf("tls_ca_cert, tls_cert and tls_key must be set together")
+	}
+	caPEM, err := os.ReadFile(spec.TLSCACert)
+	if err != nil {
+		return nil, fmt.Errorf("read tls ca cert: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("tls ca cert %s has no certificates", spec.TLSCACert)
+	}
+	certificate, err := tls.LoadX509KeyPair(spec.TLSCert, spec.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load tls client cert: %w", err)
+	}
+	return &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{certificate},
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Start runs the container on the node with the most free memory among those
+// that carry the challenge's node labels and can fit its reservation.
+func (p *NodePool) Start(ctx context.Context, req StartRequest) (StartedContainer, error) {
+	need := req.Config.reservation()
+	node, err := p.schedule(ctx, req.Config, need)
+	if err != nil {
+		return StartedContainer{}, err
+	}
+	defer node.release(need)
+
+	if node.remote() {
+		// Containers on remote nodes are only reachable through a published
+		// port, also when the proxy serves them.
+		req.Proxied = false
+		req.Network = ""
+		req.BindAddr = "0.0.0.0"
+	}
+	started, err := node.manager.Start(ctx, req)
+	if err != nil {
+		return StartedContainer{}, err
+	}
+	started.Node = node.spec.Name
+	return started, nil
+}
+
+func (p *NodePool) schedule(ctx context.Context, cfg ChallengeConfig, need nodeResources) (*dockerNode, error) {
+	var candidates []*dockerNode
+	for _, node := range p.nodes {
+		if node.accepts(cfg) {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoNodeAvailable
+	}
+	var refreshes sync.WaitGroup
+	for _, node := range candidates {
+		refreshes.Add(1)
+		go func() {
+			defer refreshes.Done()
+			node.refresh(ctx, p.now())
+		}()
+	}
+	refreshes.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		best     *dockerNode
+		bestFree nodeResources
+	)
+	for _, node := range candidates {
+		free, ok := node.free(need)
+		if !ok {
+			continue
+		}
+		if best == nil || free.MemoryMB > bestFree.MemoryMB || (free.MemoryMB == bestFree.MemoryMB && free.CPUMilli > bestFree.CPUMilli) {
+			best, bestFree = node, free
+		}
+	}
+	if best == nil {
+		return nil, ErrNoNodeAvailable
+	}
+	best.reserve(need)
+	return best, nil
+}
+
+// Stop stops a container on the node it was started on. Containers of nodes
+// that were removed from the configuration are left alone.
+func (p *NodePool) Stop(ctx context.Context, nodeName, containerID string) error {
+	node := p.node(nodeName)
+	if node == nil {
+		return nil
+	}
+	return node.manager.Stop(ctx, containerID)
+}
+
+// Exists reports whether the container still runs. A node that cannot be
+// reached yields ErrNodeUnavailable rather than a guess.
+func (p *NodePool) Exists(ctx context.Context, nodeName, containerID string) (bool, error) {
+	node := p.node(nodeName)
+	if node == nil {
+		return false, nil
+	}
+	exists, err := node.manager.Exists(ctx, containerID)
+	if err != nil {
+		node.fail(err, p.now())
+		return false, fmt.Errorf("%w: %s: %v", ErrNodeUnavailable, node.spec.Name, err)
+	}
+	return exists, nil
+}
+
+// ListManagedContainers lists the containers of every reachable node. It only
+// fails when no node can be reached.
+func (p *NodePool) ListManagedContainers(ctx context.Context) ([]ManagedContainer, error) {
+	var (
+		result  []ManagedContainer
+		lastErr error
+		reached bool
+	)
+	for _, node := range p.nodes {
+		containers, err := node.manager.ListManagedContainers(ctx)
+		if err != nil {
+			node.fail(err, p.now())
+			lastErr = err
+			continue
+		}
+		reached = true
+		for _, container := range containers {
+			container.Node = node.spec.Name
+			result = append(result, container)
+		}
+	}
+	if !reached {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+func (p *NodePool) PruneNetworks(ctx context.Context) (int, error) {
+	var (
+		removed int
+		lastErr error
+		reached bool
+	)
+	for _, node := range p.nodes {
+		count, err := node.manager.PruneNetworks(ctx)
+		if err != nil {
+			node.fail(err, p.now())
+			lastErr = err
+			continue
+		}
+		reached = true
+		removed += count
+	}
+	if !reached {
+		return removed, lastErr
+	}
+	return removed, nil
+}
+
+// Nodes checks every node and reports its state.
+func (p *NodePool) Nodes(ctx context.Context) []NodeStatus {
+	var refreshes sync.WaitGroup
+	for _, node := range p.nodes {
+		refreshes.Add(1)
+		go func() {
+			defer refreshes.Done()
+			node.refresh(ctx, p.now())
+		}()
+	}
+	refreshes.Wait()
+
+	statuses := make([]NodeStatus, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		statuses = append(statuses, node.status())
+	}
+	return statuses
+}
+
+// SetDraining stops or resumes scheduling new instances onto a node. Running
+// instances stay where they are. The setting lasts until the API restarts.
+func (p *NodePool) SetDraining(name string, draining bool) (NodeStatus, error) {
+	node := p.node(name)
+	if node == nil || name == "" {
+		return NodeStatus{}, ErrNodeNotFound
+	}
+	node.mu.Lock()
+	node.draining = draining
+	node.mu.Unlock()
+	return node.status(), nil
+}
+
+// node finds a node by name. Records from before nodes were tracked have no
+// node and belong to the first one.
+func (p *NodePool) node(name string) *dockerNode {
+	if name == "" {
+		return p.nodes[0]
+	}
+	for _, node := range p.nodes {
+		if node.spec.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+func (n *dockerNode) remote() bool {
+	return n.spec.Address != ""
+}
+
+func (n *dockerNode) accepts(cfg ChallengeConfig) bool {
+	n.mu.Lock()
+	draining := n.draining
+	n.mu.Unlock()
+	if draining {
+		return false
+	}
+	// Internal networks need the proxy attached, which only works next to
+	// the API.
+	if cfg.Internal && n.remote() {
+		return false
+	}
+	for key, value := range cfg.NodeLabels {
+		if n.spec.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// refresh reads the node's capacity and what its running instances reserve.
+func (n *dockerNode) refresh(ctx context.Context, now time.Time) {
+	capacity := nodeResources{MemoryMB: n.spec.MemoryMB, CPUMilli: n.spec.CPUMilli}
+	if capacity.MemoryMB == 0 || capacity.CPUMilli == 0 {
+		info, err := n.manager.info(ctx)
+		if err != nil {
+			n.fail(err, now)
+			return
+		}
+		if capacity.MemoryMB == 0 {
+			capacity.MemoryMB = int(info.MemTotal / (1024 * 1024))
+		}
+		if capacity.CPUMilli == 0 {
+			capacity.CPUMilli = info.NCPU * 1000
+		}
+	}
+	containers, used, err := n.manager.usage(ctx)
+	if err != nil {
+		n.fail(err, now)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.healthy = true
+	n.lastError = ""
+	n.checkedAt = now
+	n.capacity = capacity
+	n.used = used
+	n.containers = containers
+}
+
+func (n *dockerNode) fail(err error, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.healthy = false
+	n.lastError = err.Error()
+	n.checkedAt = now
+}
+
+// free is what the node has left once need is reserved.
+func (n *dockerNode) free(need nodeResources) (nodeResources, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.healthy {
+		return nodeResources{}, false
+	}
+	free := nodeResources{
+		MemoryMB: n.capacity.MemoryMB - n.used.MemoryMB - n.pending.MemoryMB - need.MemoryMB,
+		CPUMilli: n.capacity.CPUMilli - n.used.CPUMilli - n.pending.CPUMilli - need.CPUMilli,
+	}
+	return free, free.MemoryMB >= 0 && free.CPUMilli >= 0
+}
+
+func (n *dockerNode) reserve(need nodeResources) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending.MemoryMB += need.MemoryMB
+	n.pending.CPUMilli += need.CPUMilli
+}
+
+// release moves a finished start's reservation into the node's usage until
+// the next refresh counts the container itself.
+func (n *dockerNode) release(need nodeResources) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending.MemoryMB -= need.MemoryMB
+	n.pending.CPUMilli -= need.CPUMilli
+	n.used.MemoryMB += need.MemoryMB
+	n.used.CPUMilli += need.CPUMilli
+}
+
+func (n *dockerNode) status() NodeStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := NodeStatus{
+		Name:         n.spec.Name,
+		Host:         n.spec.Host,
+		Address:      n.spec.Address,
+		Labels:       maps.Clone(n.spec.Labels),
+		Healthy:      n.healthy,
+		Error:        n.lastError,
+		Draining:     n.draining,
+		Containers:   n.containers,
+		MemoryMB:     n.capacity.MemoryMB,
+		UsedMemoryMB: n.used.MemoryMB + n.pending.MemoryMB,
+		CPUMilli:     n.capacity.CPUMilli,
+		UsedCPUMilli: n.used.CPUMilli + n.pending.CPUMilli,
+	}
+	if status.Labels == nil {
+		status.Labels = map[string]string{}
+	}
+	if !n.checkedAt.IsZero() {
+		checkedAt := n.checkedAt
+		status.CheckedAt = &checkedAt
+	}
+	return status
+}
+
+// reservation is what an instance of the challenge reserves on its node: the
+// entrypoint and every companion service.
+func (c ChallengeConfig) reservation() nodeResources {
+	need := nodeResources{MemoryMB: c.MemoryLimitMB, CPUMilli: c.CPUMilli}
+	for _, service := range c.Services {
+		need.MemoryMB += service.MemoryLimitMB
+		need.CPUMilli += service.CPUMilli
+	}
+	return need
+}
+
+type dockerInfo struct {
+	NCPU     int   `json:"NCPU"`
+	MemTotal int64 `json:"MemTotal"`
+}
+
+func (m *DockerManager) info(ctx context.Context) (dockerInfo, error) {
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath("/info"), nil)
+	if err != nil {
+		return dockerInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return dockerInfo{}, err
+	}
+	var info dockerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return dockerInfo{}, fmt.Errorf("decode docker info: %w", err)
+	}
+	return info, nil
+}
+
+// usage counts the running instances on the engine and the resources their
+// entrypoints reserved for the whole group.
+func (m *DockerManager) usage(ctx context.Context) (int, nodeResources, error) {
+	filters := url.QueryEscape(`{"label":["ctf.platform=recruit"]}`)
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath("/containers/json?filters="+filters), nil)
+	if err != nil {
+		return 0, nodeResources{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return 0, nodeResources{}, err
+	}
+	var items []listContainerSummary
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return 0, nodeResources{}, fmt.Errorf("decode list containers response: %w", err)
+	}
+
+	var (
+		count int
+		used  nodeResources
+	)
+	for _, item := range items {
+		if item.Labels[serviceLabel] != "" {
+			continue
+		}
+		count++
+		memoryMB, _ := strconv.Atoi(item.Labels[memoryLabel])
+		cpuMilli, _ := strconv.Atoi(item.Labels[cpuLabel])
+		used.MemoryMB += memoryMB
+		used.CPUMilli += cpuMilli
+	}
+	return count, used, nil
+}
@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestNodePool(t *testing.T, nodes ...DockerNode) (*NodePool, map[string]*fakeDockerEngine) {
+	t.Helper()
+	engines := make(map[string]*fakeDockerEngine, len(nodes))
+	for i := range nodes {
+		engine, socket := newFakeDockerEngine(t)
+		engines[nodes[i].Name] = engine
+		nodes[i].Host = "unix://" + socket
+	}
+	pool, err := NewNodePool(nodes, DockerManagerConfig{})
+	if err != nil {
+		t.Fatalf("new node pool: %v", err)
+	}
+	return pool, engines
+}
+
+func TestNodePoolSchedulesByLabelsAndFreeMemory(t *testing.T) {
+	pool, engines := newTestNodePool(t,
+		DockerNode{Name: "a", Labels: map[string]string{"arch": "arm64"}, MemoryMB: 1024},
+		DockerNode{Name: "b", MemoryMB: 1024},
+	)
+	engines["a"].containers["busy"] = map[string]string{"ctf.platform": "recruit", memoryLabel: "900"}
+	cfg := ChallengeConfig{ID: "1", Slug: "web", ImageName: "ctf/web:dev", ExposedProtocol: "tcp", ContainerPort: 80, MemoryLimitMB: 256}
+
+	started, err := pool.Start(t.Context(), StartRequest{UserID: 7, HostPort: 20000, Config: cfg})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if started.Node != "b" || engines["b"].created[started.ContainerID].Labels[memoryLabel] != "256" {
+		t.Fatalf("expected start on the node with free memory, got %+v", started)
+	}
+
+	cfg.NodeLabels = map[string]string{"arch": "arm64"}
+	if _, err := pool.Start(t.Context(), StartRequest{UserID: 8, HostPort: 20001, Config: cfg}); !errors.Is(err, ErrNoNodeAvailable) {
+		t.Fatalf("expected no node to fit, got %v", err)
+	}
+
+	if err := pool.Stop(t.Context(), "b", started.ContainerID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, ok := engines["b"].containers[started.ContainerID]; ok {
+		t.Fatalf("expected stop to reach node b")
+	}
+}
+
+func TestNodePoolSkipsDrainingNodes(t *testing.T) {
+	pool, _ := newTestNodePool(t, DockerNode{Name: "a"}, DockerNode{Name: "b"})
+	if _, err := pool.SetDraining("a", true); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if _, err := pool.SetDraining("missing", true); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("expected unknown node, got %v", err)
+	}
+
+	cfg := ChallengeConfig{ID: "1", Slug: "web", ImageName: "ctf/web:dev", ExposedProtocol: "tcp", ContainerPort: 80}
+	for userID := int64(1); userID <= 3; userID++ {
+		started, err := pool.Start(t.Context(), StartRequest{UserID: userID, HostPort: 20000 + int(userID), Config: cfg})
+		if err != nil || started.Node != "b" {
+			t.Fatalf("expected start on node b, got %+v err=%v", started, err)
+		}
+	}
+
+	statuses := pool.Nodes(t.Context())
+	if len(statuses) != 2 || !statuses[0].Draining || !statuses[1].Healthy || statuses[1].Containers != 3 {
+		t.Fatalf("unexpected node statuses: %+v", statuses)
+	}
+}
+
+func TestNodePoolPublishesPortsOnRemoteNodes(t *testing.T) {
+	pool, engines := newTestNodePool(t, DockerNode{Name: "edge", Address: "10.0.0.9"})
+	cfg := ChallengeConfig{ID: "1", Slug: "web", ImageName: "ctf/web:dev", ExposedProtocol: "http", ContainerPort: 80}
+
+	started, err := pool.Start(t.Context(), StartRequest{UserID: 7, Proxied: true, Network: "ctf-proxy", Config: cfg})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	created := engines["edge"].created[started.ContainerID]
+	if created.HostConfig.NetworkMode == "ctf-proxy" || created.HostConfig.PortBindings["80/tcp"][0].HostIP != "0.0.0.0" {
+		t.Fatalf("expected remote container to publish its port, got %+v", created.HostConfig)
+	}
+
+	cfg.Internal = true
+	if _, err := pool.Start(t.Context(), StartRequest{UserID: 8, Proxied: true, Config: cfg}); !errors.Is(err, ErrNoNodeAvailable) {
+		t.Fatalf("expected internal challenge to stay off remote nodes, got %v", err)
+	}
+}
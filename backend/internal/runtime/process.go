@@ -0,0 +1,553 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DriverDocker  = "docker"
+	DriverProcess = "process"
+
+	// ProcessNodeName is the node recorded for process instances. Docker
+	// nodes cannot take this name.
+	ProcessNodeName = "process"
+
+	maxProcessConns  = 32
+	processPIDsLimit = 64
+	processLogLimit  = 64 << 10
+	processPath      = "PATH=/usr/local/bin:/usr/bin:/bin"
+)
+
+var (
+	ErrProcessDriverDisabled = errors.New("process driver is not configured")
+	ErrDockerDriverDisabled  = errors.New("docker driver is not configured")
+)
+
+// processEUID and processEGID report the user and group the API runs as;
+// tests replace them.
+var (
+	processEUID = os.Geteuid
+	processEGID = os.Getegid
+)
+
+func NormalizeDriver(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", DriverDocker:
+		return DriverDocker, true
+	case DriverProcess:
+		return DriverProcess, true
+	default:
+		return "", false
+	}
+}
+
+// ValidateProcessRuntime checks that a runtime config can run on the process
+// driver: image_name names a directory under the process root, and the
+// command's first argument is an absolute path inside that directory.
+func ValidateProcessRuntime(imageName, exposedProtocol string, command []string, internal bool, services, nodeLabels int) error {
+	name := strings.TrimSpace(imageName)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("image_name must name a directory under the process root")
+	}
+	if !strings.EqualFold(strings.TrimSpace(exposedProtocol), "tcp") {
+		return fmt.Errorf("the process driver only serves tcp")
+	}
+	if len(command) == 0 || !path.IsAbs(command[0]) {
+		return fmt.Errorf("the process driver needs a command starting with an absolute path")
+	}
+	if internal || services > 0 || nodeLabels > 0 {
+		return fmt.Errorf("network_internal, services and node_labels only apply to the docker driver")
+	}
+	return nil
+}
+
+// ProcessManagerConfig controls how process instances are confined.
+type ProcessManagerConfig struct {
+	// Root holds one directory per challenge, named by its image_name.
+	Root string
+	// UID and GID run the processes as a dedicated user. They are
+	// required with Root and must be neither root nor the API's own user
+	// and group, so that challenges cannot read the API's memory or
+	// environment.
+	UID int
+	GID int
+	// Chroot confines every process to its challenge directory.
+	Chroot bool
+	// CgroupDir is a cgroup v2 directory with the memory, cpu and pids
+	// controllers delegated; each instance gets a child cgroup in it. It is
+	// required with Root.
+	CgroupDir string
+}
+
+// ProcessManager runs challenges as local processes, socat style: every
+// instance listens on its host port and forks the challenge command for each
+// connection, with the connection as stdin and stdout. Instances live in
+// memory and end with the API process.
+type ProcessManager struct {
+	cfg ProcessManagerConfig
+
+	mu        sync.Mutex
+	instances map[string]*processInstance
+}
+
+type processInstance struct {
+	id       string
+	name     string
+	dir      string
+	req      StartRequest
+	listener net.Listener
+	cgroup   *processCgroup
+
+	mu       sync.Mutex
+	procs    map[*os.Process]struct{}
+	logs     []byte
+	closed   bool
+	cpuUsage time.Duration
+	cpuAt    time.Time
+}
+
+func NewProcessManager(cfg ProcessManagerConfig) (*ProcessManager, error) {
+	cfg.Root = strings.TrimSpace(cfg.Root)
+	cfg.CgroupDir = strings.TrimSpace(cfg.CgroupDir)
+	if cfg.UID < 0 || cfg.GID < 0 {
+		return nil, fmt.Errorf("process uid and gid cannot be negative")
+	}
+	// Running challenges as root or as the API itself would hand them the
+	// host or the API's secrets, and without a cgroup nothing limits their
+	// memory, cpu or pids.
+	if cfg.Root != "" {
+		if cfg.UID == 0 || cfg.UID == processEUID() || cfg.GID == 0 || cfg.GID == processEGID() {
+			return nil, fmt.Errorf("the process driver needs a process uid and gid other than root and the API's own")
+		}
+		if cfg.CgroupDir == "" {
+			return nil, fmt.Errorf("the process driver needs a process cgroup directory")
+		}
+	}
+	if cfg.CgroupDir != "" {
+		if err := cleanupProcessCgroups(cfg.CgroupDir); err != nil {
+			return nil, err
+		}
+	}
+	return &ProcessManager{cfg: cfg, instances: make(map[string]*processInstance)}, nil
+}
+
+func (m *ProcessManager) Start(_ context.Context, req StartRequest) (StartedContainer, error) {
+	if m.cfg.Root == "" {
+		return StartedContainer{}, ErrProcessDriverDisabled
+	}
+	dir := filepath.Join(m.cfg.Root, req.Config.ImageName)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return StartedContainer{}, fmt.Errorf("process challenge directory %s is missing", dir)
+	}
+	if len(req.Config.Command) == 0 {
+		return StartedContainer{}, fmt.Errorf("process challenge %s has no command", req.Config.Slug)
+	}
+
+	bindAddr := req.BindAddr
+	if req.Proxied {
+		// Only the TCP gateway in this process connects to the instance.
+		bindAddr = "127.0.0.1"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(req.HostPort)))
+	if err != nil {
+		return StartedContainer{}, fmt.Errorf("listen for process instance: %w", err)
+	}
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		listener.Close()
+		return StartedContainer{}, fmt.Errorf("generate process instance id: %w", err)
+	}
+	inst := &processInstance{
+		id:       "process-" + hex.EncodeToString(suffix),
+		name:     buildContainerName(req),
+		dir:      dir,
+		req:      req,
+		listener: listener,
+		procs:    make(map[*os.Process]struct{}),
+	}
+	if m.cfg.CgroupDir != "" {
+		if inst.cgroup, err = newProcessCgroup(m.cfg.CgroupDir, inst.id, req.Config); err != nil {
+			listener.Close()
+			return StartedContainer{}, err
+		}
+	}
+
+	m.mu.Lock()
+	m.instances[inst.id] = inst
+	m.mu.Unlock()
+	go m.serve(inst)
+
+	return StartedContainer{
+		ContainerID:   inst.id,
+		ContainerName: inst.name,
+		HostIP:        bindAddr,
+		HostPort:      listener.Addr().(*net.TCPAddr).Port,
+		InternalIP:    "127.0.0.1",
+		Node:          ProcessNodeName,
+	}, nil
+}
+
+func (m *ProcessManager) serve(inst *processInstance) {
+	for {
+		conn, err := inst.listener.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(inst, conn)
+	}
+}
+
+// handle runs one copy of the challenge with conn as its stdin and stdout.
+func (m *ProcessManager) handle(inst *processInstance, conn net.Conn) {
+	defer conn.Close()
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	file, err := tcp.File()
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	argv := inst.req.Config.Command
+	cmd := &exec.Cmd{
+		Path:   argv[0],
+		Args:   append([]string(nil), argv...),
+		Env:    append([]string{processPath}, flattenEnv(inst.req.Config.Env)...),
+		Dir:    "/",
+		Stdin:  file,
+		Stdout: file,
+		Stderr: inst,
+	}
+	if !m.cfg.Chroot {
+		cmd.Path = filepath.Join(inst.dir, argv[0])
+		cmd.Dir = inst.dir
+	}
+	if err := m.prepareCommand(inst, cmd); err != nil {
+		inst.logf("start: %v", err)
+		return
+	}
+
+	inst.mu.Lock()
+	if inst.closed || len(inst.procs) >= maxProcessConns {
+		inst.mu.Unlock()
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		inst.mu.Unlock()
+		inst.logf("start: %v", err)
+		return
+	}
+	inst.procs[cmd.Process] = struct{}{}
+	inst.mu.Unlock()
+
+	// The child holds its own copy of the socket.
+	file.Close()
+	conn.Close()
+
+	_ = cmd.Wait()
+	inst.mu.Lock()
+	delete(inst.procs, cmd.Process)
+	inst.mu.Unlock()
+}
+
+// Write collects the stderr of the instance's processes, keeping the most
+// recent processLogLimit bytes.
+func (inst *processInstance) Write(p []byte) (int, error) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	inst.logs = append(inst.logs, p...)
+	if excess := len(inst.logs) - processLogLimit; excess > 0 {
+		inst.logs = append(inst.logs[:0], inst.logs[excess:]...)
+	}
+	return len(p), nil
+}
+
+func (inst *processInstance) logf(format string, args ...any) {
+	_, _ = fmt.Fprintf(inst, "[platform] "+format+"\n", args...)
+}
+
+func (m *ProcessManager) instance(id string) *processInstance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances[id]
+}
+
+// Stop closes the instance's port and kills every process it started.
+func (m *ProcessManager) Stop(_ context.Context, containerID string) error {
+	m.mu.Lock()
+	inst := m.instances[containerID]
+	delete(m.instances, containerID)
+	m.mu.Unlock()
+	if inst == nil {
+		return nil
+	}
+
+	inst.listener.Close()
+	inst.mu.Lock()
+	inst.closed = true
+	for proc := range inst.procs {
+		killProcess(proc)
+	}
+	inst.mu.Unlock()
+	if inst.cgroup != nil {
+		return inst.cgroup.remove()
+	}
+	return nil
+}
+
+func (m *ProcessManager) Exists(_ context.Context, containerID string) (bool, error) {
+	return m.instance(containerID) != nil, nil
+}
+
+func (m *ProcessManager) ListManagedContainers(context.Context) ([]ManagedContainer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	items := make([]ManagedContainer, 0, len(m.instances))
+	for _, inst := range m.instances {
+		items = append(items, ManagedContainer{
+			ContainerID: inst.id,
+			Node:        ProcessNodeName,
+			ChallengeID: inst.req.Config.ID,
+			UserID:      inst.req.UserID,
+			Pooled:      inst.req.Pooled,
+		})
+	}
+	return items, nil
+}
+
+// Stats reports the instance's cgroup usage. Without a cgroup only the
+// number of running processes is known.
+func (m *ProcessManager) Stats(_ context.Context, containerID string) (ContainerStats, error) {
+	inst := m.instance(containerID)
+	if inst == nil {
+		return ContainerStats{}, ErrInstanceNotFound
+	}
+	now := time.Now().UTC()
+	if inst.cgroup == nil {
+		inst.mu.Lock()
+		defer inst.mu.Unlock()
+		return ContainerStats{PIDs: uint64(len(inst.procs)), SampledAt: now}, nil
+	}
+	stats, usage, err := inst.cgroup.stats()
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	stats.SampledAt = now
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if !inst.cpuAt.IsZero() && usage > inst.cpuUsage {
+		if elapsed := now.Sub(inst.cpuAt); elapsed > 0 {
+			stats.CPUPercent = float64(usage-inst.cpuUsage) / float64(elapsed) * 100
+		}
+	}
+	inst.cpuUsage, inst.cpuAt = usage, now
+	return stats, nil
+}
+
+// Logs returns the most recent stderr output of the instance's processes.
+// Following is not supported; the current output is returned instead.
+func (m *ProcessManager) Logs(_ context.Context, containerID string, opts LogOptions) (io.ReadCloser, error) {
+	inst := m.instance(containerID)
+	if inst == nil {
+		return nil, ErrInstanceNotFound
+	}
+	tail := opts.Tail
+	if tail <= 0 {
+		tail = DefaultLogTail
+	}
+	inst.mu.Lock()
+	lines := bytes.SplitAfter(inst.logs, []byte("\n"))
+	inst.mu.Unlock()
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return io.NopCloser(bytes.NewReader(bytes.Join(lines, nil))), nil
+}
+
+func (m *ProcessManager) Exec(context.Context, string, []string) (ExecResult, error) {
+	return ExecResult{}, fmt.Errorf("%w: process instances have no container to run commands in", ErrInvalidExecCommand)
+}
+
+// Drivers routes every call to the driver an instance runs on: the process
+// manager for the process node, the Docker node pool for everything else.
+type Drivers struct {
+	docker  dockerDriver
+	process *ProcessManager
+}
+
+type dockerDriver interface {
+	Manager
+	Logs(ctx context.Context, node, containerID string, opts LogOptions) (io.ReadCloser, error)
+	Exec(ctx context.Context, node, containerID string, cmd []string) (ExecResult, error)
+}
+
+// NewDrivers combines the drivers; either may be nil when it is not used.
+func NewDrivers(docker *NodePool, process *ProcessManager) *Drivers {
+	drivers := &Drivers{process: process}
+	if docker != nil {
+		drivers.docker = docker
+	}
+	return drivers
+}
+
+func (d *Drivers) Start(ctx context.Context, req StartRequest) (StartedContainer, error) {
+	if req.Config.Driver == DriverProcess {
+		if d.process == nil {
+			return StartedContainer{}, ErrProcessDriverDisabled
+		}
+		return d.process.Start(ctx, req)
+	}
+	if d.docker == nil {
+		return StartedContainer{}, ErrDockerDriverDisabled
+	}
+	return d.docker.Start(ctx, req)
+}
+
+func (d *Drivers) Stop(ctx context.Context, node, containerID string) error {
+	if node == ProcessNodeName {
+		if d.process == nil {
+			return nil
+		}
+		return d.process.Stop(ctx, containerID)
+	}
+	if d.docker == nil {
+		return ErrDockerDriverDisabled
+	}
+	return d.docker.Stop(ctx, node, containerID)
+}
+
+func (d *Drivers) Exists(ctx context.Context, node, containerID string) (bool, error) {
+	if node == ProcessNodeName {
+		if d.process == nil {
+			return false, nil
+		}
+		return d.process.Exists(ctx, containerID)
+	}
+	if d.docker == nil {
+		return false, ErrDockerDriverDisabled
+	}
+	return d.docker.Exists(ctx, node, containerID)
+}
+
+func (d *Drivers) ListManagedContainers(ctx context.Context) ([]ManagedContainer, error) {
+	var items []ManagedContainer
+	if d.docker != nil {
+		containers, err := d.docker.ListManagedContainers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, containers...)
+	}
+	if d.process != nil {
+		processes, err := d.process.ListManagedContainers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, processes...)
+	}
+	return items, nil
+}
+
+func (d *Drivers) PruneNetworks(ctx context.Context) (int, error) {
+	if d.docker == nil {
+		return 0, nil
+	}
+	return d.docker.PruneNetworks(ctx)
+}
+
+func (d *Drivers) Stats(ctx context.Context, node, containerID string) (ContainerStats, error) {
+	if node == ProcessNodeName {
+		if d.process == nil {
+			return ContainerStats{}, ErrInstanceNotFound
+		}
+		return d.process.Stats(ctx, containerID)
+	}
+	if d.docker == nil {
+		return ContainerStats{}, ErrDockerDriverDisabled
+	}
+	return d.docker.Stats(ctx, node, containerID)
+}
+
+func (d *Drivers) Logs(ctx context.Context, node, containerID string, opts LogOptions) (io.ReadCloser, error) {
+	if node == ProcessNodeName {
+		if d.process == nil {
+			return nil, ErrInstanceNotFound
+		}
+		return d.process.Logs(ctx, containerID, opts)
+	}
+	if d.docker == nil {
+		return nil, ErrDockerDriverDisabled
+	}
+	return d.docker.Logs(ctx, node, containerID, opts)
+}
+
+func (d *Drivers) Exec(ctx context.Context, node, containerID string, cmd []string) (ExecResult, error) {
+	if node == ProcessNodeName {
+		if d.process == nil {
+			return ExecResult{}, ErrInstanceNotFound
+		}
+		return d.process.Exec(ctx, containerID, cmd)
+	}
+	if d.docker == nil {
+		return ExecResult{}, ErrDockerDriverDisabled
+	}
+	return d.docker.Exec(ctx, node, containerID, cmd)
+}
+
+// CheckImage checks the image on the Docker nodes; process challenges have
+// a directory instead of an image.
+func (d *Drivers) CheckImage(ctx context.Context, cfg ChallengeConfig, image, digest string) (ImageCheck, error) {
+	images, ok := d.docker.(imageManager)
+	if !ok {
+		return ImageCheck{}, ErrDockerDriverDisabled
+	}
+	return images.CheckImage(ctx, cfg, image, digest)
+}
+
+// PullImage pulls the image onto the Docker nodes that can run the challenge.
+func (d *Drivers) PullImage(ctx context.Context, cfg ChallengeConfig, image, digest string, progress func(ImagePull)) error {
+	images, ok := d.docker.(imageManager)
+	if !ok {
+		return ErrDockerDriverDisabled
+	}
+	return images.PullImage(ctx, cfg, image, digest, progress)
+}
+
+// ResolveImage finds the ID the challenge's image name refers to on the
+// Docker nodes.
+func (d *Drivers) ResolveImage(ctx context.Context, cfg ChallengeConfig) (string, error) {
+	images, ok := d.docker.(imageManager)
+	if !ok {
+		return "", ErrDockerDriverDisabled
+	}
+	return images.ResolveImage(ctx, cfg)
+}
+
+// WatchEvents follows the Docker event stream; process instances do not
+// outlive their listener, so they have no events of their own.
+func (d *Drivers) WatchEvents(ctx context.Context, handle func(ContainerEvent), onError func(node string, err error)) {
+	if source, ok := d.docker.(containerEventSource); ok {
+		source.WatchEvents(ctx, handle, onError)
+	}
+}
@@ -0,0 +1,272 @@
+//go:build linux
+
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var errProcessExecHelperMissing = errors.New("this binary cannot serve as the process exec helper")
+
+// Limits of every process started by the process driver, on top of the
+// instance's cgroup. The exec helper sets them before the challenge runs.
+var processRlimits = []struct {
+	resource int
+	value    uint64
+}{
+	{syscall.RLIMIT_CORE, 0},
+	{syscall.RLIMIT_CPU, 60},
+	{syscall.RLIMIT_FSIZE, 16 << 20},
+	{syscall.RLIMIT_NOFILE, 64},
+}
+
+// processExecHelper is the argv[0] under which the API binary re-executes
+// itself to confine a challenge process before exec: Go cannot run code
+// between fork and exec, and rlimits set from the parent afterwards would
+// leave the first instructions of the challenge unlimited.
+const processExecHelper = "ctf-process-exec"
+
+// processExecHelperReady is set once the running binary has called
+// RunProcessExecHelperIfRequested, and so can serve as the exec helper.
+var processExecHelperReady atomic.Bool
+
+// RunProcessExecHelperIfRequested turns the process into the exec helper of
+// the process driver when the API started it as one, and never returns in
+// that case. A binary that starts process challenges must call it first
+// thing in main.
+func RunProcessExecHelperIfRequested() {
+	if len(os.Args) > 0 && os.Args[0] == processExecHelper {
+		runProcessExecHelper(os.Args[1:])
+	}
+	processExecHelperReady.Store(true)
+}
+
+// prepareCommand turns cmd into a run of the exec helper, which applies the
+// rlimits, chroot and user and then executes the challenge. The helper
+// starts in the instance's cgroup.
+func (m *ProcessManager) prepareCommand(inst *processInstance, cmd *exec.Cmd) error {
+	if !processExecHelperReady.Load() {
+		return errProcessExecHelperMissing
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate exec helper: %w", err)
+	}
+	chroot := ""
+	if m.cfg.Chroot {
+		chroot = inst.dir
+	}
+	cmd.Args = append([]string{
+		processExecHelper,
+		strconv.Itoa(os.Getpid()),
+		chroot,
+		strconv.Itoa(m.cfg.UID),
+		strconv.Itoa(m.cfg.GID),
+		cmd.Path,
+	}, cmd.Args...)
+	cmd.Path = self
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if inst.cgroup != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = inst.cgroup.fd
+	}
+	return nil
+}
+
+// runProcessExecHelper confines the helper process and replaces it with the
+// challenge. Its arguments are the API's pid, the chroot directory or "",
+// the uid and gid, the program path and the program's argv. It never returns.
+func runProcessExecHelper(args []string) {
+	fail := func(format string, a ...any) {
+		fmt.Fprintf(os.Stderr, "start: "+format+"\n", a...)
+		os.Exit(127)
+	}
+	if len(args) < 6 {
+		fail("exec helper needs pid, chroot, uid, gid, path and argv")
+	}
+	parent, _ := strconv.Atoi(args[0])
+	chroot := args[1]
+	uid, _ := strconv.Atoi(args[2])
+	gid, _ := strconv.Atoi(args[3])
+	path, argv := args[4], args[5:]
+
+	// Credentials are switched with raw syscalls on this thread only; exec
+	// below runs on the same thread and takes them along.
+	goruntime.LockOSThread()
+	for _, limit := range processRlimits {
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			fail("rlimit %d: %v", limit.resource, err)
+		}
+	}
+	if chroot != "" {
+		if err := syscall.Chroot(chroot); err != nil {
+			fail("chroot: %v", err)
+		}
+		if err := syscall.Chdir("/"); err != nil {
+			fail("chdir: %v", err)
+		}
+	}
+	if uid > 0 {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SETGROUPS, 0, 0, 0); errno != 0 {
+			fail("setgroups: %v", errno)
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SETGID, uintptr(gid), 0, 0); errno != 0 {
+			fail("setgid: %v", errno)
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SETUID, uintptr(uid), 0, 0); errno != 0 {
+			fail("setuid: %v", errno)
+		}
+		// Changing credentials clears the parent death signal.
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(syscall.SIGKILL), 0); errno != 0 {
+			fail("set parent death signal: %v", errno)
+		}
+		if os.Getppid() != parent {
+			os.Exit(1)
+		}
+	}
+	err := syscall.Exec(path, argv, os.Environ())
+	fail("exec %s: %v", path, err)
+}
+
+// killProcess kills the process group a connection's process leads, so that
+// children it forked go with it.
+func killProcess(proc *os.Process) {
+	if err := syscall.Kill(-proc.Pid, syscall.SIGKILL); err != nil {
+		_ = proc.Kill()
+	}
+}
+
+// processCgroup is the cgroup v2 group of one process instance.
+type processCgroup struct {
+	path string
+	fd   int
+}
+
+func newProcessCgroup(parent, name string, cfg ChallengeConfig) (*processCgroup, error) {
+	dir := filepath.Join(parent, name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create process cgroup: %w", err)
+	}
+	memory := "max"
+	if cfg.MemoryLimitMB > 0 {
+		memory = strconv.FormatInt(int64(cfg.MemoryLimitMB)<<20, 10)
+	}
+	cpu := "max 100000"
+	if cfg.CPUMilli > 0 {
+		cpu = fmt.Sprintf("%d 100000", cfg.CPUMilli*100)
+	}
+	settings := [][2]string{
+		{"memory.max", memory},
+		{"memory.swap.max", "0"},
+		{"cpu.max", cpu},
+		{"pids.max", strconv.Itoa(processPIDsLimit)},
+	}
+	for _, setting := range settings {
+		if err := os.WriteFile(filepath.Join(dir, setting[0]), []byte(setting[1]), 0o644); err != nil && !(setting[0] == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			_ = os.Remove(dir)
+			return nil, fmt.Errorf("configure process cgroup %s: %w", setting[0], err)
+		}
+	}
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		_ = os.Remove(dir)
+		return nil, fmt.Errorf("open process cgroup: %w", err)
+	}
+	return &processCgroup{path: dir, fd: fd}, nil
+}
+
+// remove kills whatever is left in the cgroup and deletes it.
+func (c *processCgroup) remove() error {
+	_ = syscall.Close(c.fd)
+	return removeProcessCgroup(c.path)
+}
+
+func removeProcessCgroup(dir string) error {
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0o644); err != nil {
+		// cgroup.kill needs Linux 5.14; kill the members one by one before.
+		if procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")); err == nil {
+			for _, field := range strings.Fields(string(procs)) {
+				if pid, err := strconv.Atoi(field); err == nil {
+					_ = syscall.Kill(pid, syscall.SIGKILL)
+				}
+			}
+		}
+	}
+	var err error
+	for range 50 {
+		if err = os.Remove(dir); err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fmt.Errorf("remove process cgroup: %w", err)
+}
+
+// cleanupProcessCgroups removes instance cgroups left behind by a previous
+// run of the API.
+func cleanupProcessCgroups(parent string) error {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return fmt.Errorf("read process cgroup directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "process-") {
+			if err := removeProcessCgroup(filepath.Join(parent, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stats reads the cgroup's usage and its total CPU time so far.
+func (c *processCgroup) stats() (ContainerStats, time.Duration, error) {
+	var stats ContainerStats
+	read := func(name string) (uint64, error) {
+		content, err := os.ReadFile(filepath.Join(c.path, name))
+		if err != nil {
+			return 0, fmt.Errorf("read process cgroup %s: %w", name, err)
+		}
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, nil
+		}
+		return strconv.ParseUint(value, 10, 64)
+	}
+	var err error
+	if stats.MemoryBytes, err = read("memory.current"); err != nil {
+		return stats, 0, err
+	}
+	if stats.MemoryLimitBytes, err = read("memory.max"); err != nil {
+		return stats, 0, err
+	}
+	if stats.PIDs, err = read("pids.current"); err != nil {
+		return stats, 0, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(c.path, "cpu.stat"))
+	if err != nil {
+		return stats, 0, fmt.Errorf("read process cgroup cpu.stat: %w", err)
+	}
+	var usage time.Duration
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+			micros, _ := strconv.ParseInt(value, 10, 64)
+			usage = time.Duration(micros) * time.Microsecond
+		}
+	}
+	return stats, usage, nil
+}
@@ -0,0 +1,47 @@
+//go:build !linux
+
+package runtime
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+var errProcessIsolationUnsupported = errors.New("process isolation needs linux")
+
+// RunProcessExecHelperIfRequested does nothing where the process driver
+// cannot confine processes.
+func RunProcessExecHelperIfRequested() {}
+
+// prepareCommand refuses to start processes the configured confinement
+// cannot be applied to.
+func (m *ProcessManager) prepareCommand(*processInstance, *exec.Cmd) error {
+	if m.cfg.Chroot || m.cfg.UID > 0 {
+		return errProcessIsolationUnsupported
+	}
+	return nil
+}
+
+func killProcess(proc *os.Process) {
+	_ = proc.Kill()
+}
+
+type processCgroup struct{}
+
+func newProcessCgroup(string, string, ChallengeConfig) (*processCgroup, error) {
+	return nil, errProcessIsolationUnsupported
+}
+
+func (c *processCgroup) remove() error {
+	return nil
+}
+
+func (c *processCgroup) stats() (ContainerStats, time.Duration, error) {
+	return ContainerStats{}, 0, errProcessIsolationUnsupported
+}
+
+func cleanupProcessCgroups(string) error {
+	return errProcessIsolationUnsupported
+}
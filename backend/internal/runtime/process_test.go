@@ -0,0 +1,212 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary serve as the exec helper of the process
+// driver, as cmd/api does.
+func TestMain(m *testing.M) {
+	RunProcessExecHelperIfRequested()
+	os.Exit(m.Run())
+}
+
+// newEchoProcessManager returns a process manager whose root holds one
+// challenge, "echo", that logs a line and echoes its input back.
+func newEchoProcessManager(t *testing.T) *ProcessManager {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, "echo")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("create challenge directory: %v", err)
+	}
+	script := "#!/bin/sh\necho started >&2\nexec cat\n"
+	if err := os.WriteFile(filepath.Join(dir, "run.sh"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write challenge: %v", err)
+	}
+	// The tests cannot switch users or create cgroups, so they build the
+	// manager without the confinement NewProcessManager insists on.
+	return &ProcessManager{cfg: ProcessManagerConfig{Root: root}, instances: make(map[string]*processInstance)}
+}
+
+func echoProcessConfig() ChallengeConfig {
+	return ChallengeConfig{
+		ID:              "1",
+		Slug:            "echo",
+		Dynamic:         true,
+		Driver:          DriverProcess,
+		ImageName:       "echo",
+		ExposedProtocol: "tcp",
+		ContainerPort:   9999,
+		Command:         []string{"/run.sh"},
+		TTL:             30 * time.Minute,
+	}
+}
+
+func dialEcho(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial process instance: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, "hello\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("expected the challenge to echo, got %q (%v)", line, err)
+	}
+}
+
+func TestProcessManagerServesConnections(t *testing.T) {
+	manager := newEchoProcessManager(t)
+	ctx := context.Background()
+
+	started, err := manager.Start(ctx, StartRequest{UserID: 7, Config: echoProcessConfig(), BindAddr: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if started.Node != ProcessNodeName || started.HostPort == 0 {
+		t.Fatalf("unexpected started instance %#v", started)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(started.HostPort))
+	dialEcho(t, addr)
+
+	logs, err := manager.Logs(ctx, started.ContainerID, LogOptions{})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	content, _ := io.ReadAll(logs)
+	if !strings.Contains(string(content), "started") {
+		t.Fatalf("expected stderr in the logs, got %q", content)
+	}
+	containers, err := manager.ListManagedContainers(ctx)
+	if err != nil || len(containers) != 1 || containers[0].ContainerID != started.ContainerID || containers[0].UserID != 7 {
+		t.Fatalf("unexpected managed containers %#v (%v)", containers, err)
+	}
+
+	if err := manager.Stop(ctx, started.ContainerID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if exists, _ := manager.Exists(ctx, started.ContainerID); exists {
+		t.Fatalf("expected stopped instance to be gone")
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Fatalf("expected the port to be closed after stop")
+	}
+}
+
+func TestProcessRlimitsApplyFromExec(t *testing.T) {
+	if goruntime.GOOS != "linux" {
+		t.Skip("rlimits are only applied on linux")
+	}
+	manager := newEchoProcessManager(t)
+	script := "#!/bin/sh\necho \"$(ulimit -n) $(ulimit -c)\"\n"
+	if err := os.WriteFile(filepath.Join(manager.cfg.Root, "echo", "limits.sh"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write challenge: %v", err)
+	}
+	cfg := echoProcessConfig()
+	cfg.Command = []string{"/limits.sh"}
+	started, err := manager.Start(context.Background(), StartRequest{UserID: 7, Config: cfg, BindAddr: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Stop(context.Background(), started.ContainerID) })
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(started.HostPort)), 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial process instance: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "64 0\n" {
+		t.Fatalf("expected the rlimits to be in place when the challenge starts, got %q (%v)", line, err)
+	}
+}
+
+func TestServiceStartsProcessInstances(t *testing.T) {
+	manager := newEchoProcessManager(t)
+	repo := newFakeRepository()
+	repo.challenge.Challenge = echoProcessConfig()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, NewDrivers(nil, manager), repo)
+	ctx := context.Background()
+
+	instance, _, err := service.StartInstance(ctx, 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if instance.Node != ProcessNodeName {
+		t.Fatalf("expected a process instance, got node %q", instance.Node)
+	}
+	dialEcho(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(instance.HostPort)))
+
+	if _, err := service.DeleteInstance(ctx, 7, "1"); err != nil {
+		t.Fatalf("delete instance: %v", err)
+	}
+	if exists, _ := manager.Exists(ctx, instance.ContainerID); exists {
+		t.Fatalf("expected deleting the instance to stop its process")
+	}
+
+	repo.challenge.Challenge.Driver = DriverDocker
+	if _, _, err := service.StartInstance(ctx, 8, "1"); !errors.Is(err, ErrDockerDriverDisabled) {
+		t.Fatalf("expected docker challenges to fail without docker, got %v", err)
+	}
+}
+
+func TestValidateProcessRuntime(t *testing.T) {
+	if err := ValidateProcessRuntime("echo", "tcp", []string{"/run.sh"}, false, 0, 0); err != nil {
+		t.Fatalf("expected valid process runtime: %v", err)
+	}
+	for name, err := range map[string]error{
+		"nested directory": ValidateProcessRuntime("a/b", "tcp", []string{"/run.sh"}, false, 0, 0),
+		"http":             ValidateProcessRuntime("echo", "http", []string{"/run.sh"}, false, 0, 0),
+		"relative command": ValidateProcessRuntime("echo", "tcp", []string{"run.sh"}, false, 0, 0),
+		"services":         ValidateProcessRuntime("echo", "tcp", []string{"/run.sh"}, false, 1, 0),
+	} {
+		if err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestNewProcessManagerRefusesUnconfinedProcesses(t *testing.T) {
+	euid, egid := processEUID, processEGID
+	processEUID = func() int { return 1000 }
+	processEGID = func() int { return 1000 }
+	t.Cleanup(func() { processEUID, processEGID = euid, egid })
+
+	cases := map[string]ProcessManagerConfig{
+		"root uid":  {Root: "/srv/challenges", GID: 2000, CgroupDir: "/sys/fs/cgroup/ctf"},
+		"root gid":  {Root: "/srv/challenges", UID: 2000, CgroupDir: "/sys/fs/cgroup/ctf"},
+		"api uid":   {Root: "/srv/challenges", UID: 1000, GID: 2000, CgroupDir: "/sys/fs/cgroup/ctf"},
+		"api gid":   {Root: "/srv/challenges", UID: 2000, GID: 1000, CgroupDir: "/sys/fs/cgroup/ctf"},
+		"no cgroup": {Root: "/srv/challenges", UID: 2000, GID: 2000},
+	}
+	for name, cfg := range cases {
+		if _, err := NewProcessManager(cfg); err == nil {
+			t.Fatalf("%s: expected the process manager to be refused", name)
+		}
+	}
+	if _, err := NewProcessManager(ProcessManagerConfig{}); err != nil {
+		t.Fatalf("expected a disabled process driver to be accepted, got %v", err)
+	}
+}
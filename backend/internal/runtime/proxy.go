@@ -0,0 +1,295 @@
+package runtime
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ProxyAccessParam  = "ctf_access"
+	ProxyAccessCookie = "ctf_instance_access"
+	proxyTicketTTL    = 12 * time.Hour
+)
+
+var errProxyTicketInvalid = errors.New("invalid instance access ticket")
+
+type proxyTicket struct {
+	ProxyID string `json:"pid"`
+	UserID  int64  `json:"uid"`
+	Exp     int64  `json:"exp"`
+}
+
+func (c ProxyConfig) Enabled() bool {
+	return c.Domain != ""
+}
+
+func (c ProxyConfig) handles(protocol string) bool {
+	if !c.Enabled() {
+		return false
+	}
+	switch strings.ToLower(protocol) {
+	case "", "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
+func normalizeProxyConfig(cfg ProxyConfig) ProxyConfig {
+	cfg.Domain = strings.Trim(strings.ToLower(strings.TrimSpace(cfg.Domain)), ".")
+	cfg.Scheme = strings.ToLower(strings.TrimSpace(cfg.Scheme))
+	if cfg.Scheme != "http" {
+		cfg.Scheme = "https"
+	}
+	cfg.Network = strings.TrimSpace(cfg.Network)
+	return cfg
+}
+
+// Proxy serves <proxy-id>.<domain> requests from the API listener and
+// forwards them to the instance container's internal address. Every request
+// must carry a ticket from the signed link the platform hands out; when access
+// cookies are required, the proxy swaps the ticket for a host-only cookie on
+// first visit, otherwise the ticket stays in the query of each request.
+// Tickets are signed over the instance's access token, so rotating the token
+// on restart revokes the links and cookies issued before.
+type Proxy struct {
+	cfg       ProxyConfig
+	repo      Repository
+	now       func() time.Time
+	transport http.RoundTripper
+	activity  *activityTracker
+}
+
+func NewProxy(cfg ProxyConfig, repo Repository) *Proxy {
+	cfg = normalizeProxyConfig(cfg)
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Proxy{cfg: cfg, repo: repo, now: time.Now}
+}
+
+func (p *Proxy) Enabled() bool {
+	return p != nil
+}
+
+func (p *Proxy) ProxyIDFromHost(host string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	label, found := strings.CutSuffix(strings.ToLower(host), "."+p.cfg.Domain)
+	if !found || label == "" || strings.Contains(label, ".") {
+		return "", false
+	}
+	return label, true
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	proxyID, ok := p.ProxyIDFromHost(r.Host)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	record, err := p.repo.GetInstanceByProxyID(r.Context(), proxyID)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			http.Error(w, "instance not found or no longer running", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "instance lookup failed", http.StatusBadGateway)
+		return
+	}
+	upstream, err := url.Parse(record.Instance.UpstreamURL)
+	if err != nil || upstream.Host == "" {
+		http.Error(w, "instance is not reachable", http.StatusBadGateway)
+		return
+	}
+
+	if !p.authorize(w, r, record.Instance) {
+		return
+	}
+
+	reverse := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+			stripProxyCookie(pr.Out)
+		},
+		Transport: p.transport,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, _ error) {
+			http.Error(w, "instance is not reachable", http.StatusBadGateway)
+		},
+	}
+	// A request in flight, such as a websocket, keeps the instance active.
+	p.activity.open(record.ID, p.now())
+	defer func() { p.activity.close(record.ID, p.now()) }()
+	reverse.ServeHTTP(w, r)
+}
+
+// authorize admits a request that carries a valid ticket, either as the
+// ctf_access query parameter or in the access cookie. With access cookies
+// required, a ticket in the query is swapped for the cookie and the browser is
+// redirected to the clean URL; otherwise the ticket is removed from the query
+// and the request is forwarded as is. It writes the error response and
+// returns false when the request is refused.
+func (p *Proxy) authorize(w http.ResponseWriter, r *http.Request, instance Instance) bool {
+	query := r.URL.Query()
+	if value := query.Get(ProxyAccessParam); value != "" {
+		ticket, err := verifyProxyTicket(p.cfg.Secret, value, instance, p.now())
+		if err != nil {
+			http.Error(w, "instance access link is invalid or expired", http.StatusUnauthorized)
+			return false
+		}
+		query.Del(ProxyAccessParam)
+		if !p.cfg.RequireAccessCookie {
+			r.URL.RawQuery = query.Encode()
+			return true
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     ProxyAccessCookie,
+			Value:    value,
+			Path:     "/",
+			Expires:  time.Unix(ticket.Exp, 0).UTC(),
+			HttpOnly: true,
+			Secure:   p.cfg.Scheme == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		target := *r.URL
+		target.RawQuery = query.Encode()
+		http.Redirect(w, r, target.RequestURI(), http.StatusFound)
+		return false
+	}
+	cookie, err := r.Cookie(ProxyAccessCookie)
+	if err != nil {
+		http.Error(w, "open this instance from the platform to get access", http.StatusUnauthorized)
+		return false
+	}
+	if _, err := verifyProxyTicket(p.cfg.Secret, cookie.Value, instance, p.now()); err != nil {
+		http.Error(w, "instance access has expired, open it from the platform again", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func stripProxyCookie(r *http.Request) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != ProxyAccessCookie {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+func (s *Service) buildProxyURL(instance Instance, viewerID int64) string {
+	proxyURL := fmt.Sprintf("%s://%s.%s/", s.cfg.Proxy.Scheme, instance.ProxyID, s.cfg.Proxy.Domain)
+	ticket := signProxyTicket(s.cfg.Proxy.Secret, instance.AccessToken, proxyTicket{
+		ProxyID: instance.ProxyID,
+		UserID:  viewerID,
+		Exp:     s.now().UTC().Add(proxyTicketTTL).Unix(),
+	})
+	return proxyURL + "?" + ProxyAccessParam + "=" + url.QueryEscape(ticket)
+}
+
+// proxyRoute assigns the upstream address for a container that was started
+// without a published port, and the subdomain when the proxy serves it.
+// previousID keeps the subdomain stable when a shared instance is replaced.
+func (s *Service) proxyRoute(cfg ChallengeConfig, started StartedContainer, previousID string) (string, string, error) {
+	proxied := s.cfg.Proxy.handles(cfg.ExposedProtocol)
+	if !proxied && !s.cfg.Gateway.handles(cfg.ExposedProtocol) {
+		return "", "", nil
+	}
+	host, port := started.InternalIP, cfg.ContainerPort
+	switch {
+	case s.cfg.NodeAddresses[started.Node] != "":
+		// Remote nodes publish the port instead of sharing a network with the
+		// proxy.
+		host, port = s.cfg.NodeAddresses[started.Node], started.HostPort
+	case started.Node == ProcessNodeName:
+		// Process instances listen in the API itself, on loopback.
+		port = started.HostPort
+	}
+	if host == "" || port == 0 {
+		return "", "", fmt.Errorf("container %s has no internal address", started.ContainerID)
+	}
+	if !proxied {
+		return "", "tcp://" + net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	proxyID := previousID
+	if proxyID == "" {
+		generated, err := newRouteID()
+		if err != nil {
+			return "", "", err
+		}
+		proxyID = generated
+	}
+	scheme := "http"
+	if strings.EqualFold(cfg.ExposedProtocol, "https") {
+		scheme = "https"
+	}
+	upstream := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+	return proxyID, upstream, nil
+}
+
+// newRouteID returns a random DNS-safe label used for proxy subdomains and
+// gateway tokens.
+func newRouteID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate route id: %w", err)
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)), nil
+}
+
+func signProxyTicket(secret, accessToken string, ticket proxyTicket) string {
+	payload, _ := json.Marshal(ticket)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + proxyTicketSignature(secret, accessToken, encoded)
+}
+
+func verifyProxyTicket(secret, value string, instance Instance, now time.Time) (proxyTicket, error) {
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(proxyTicketSignature(secret, instance.AccessToken, encoded))) {
+		return proxyTicket{}, errProxyTicketInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return proxyTicket{}, errProxyTicketInvalid
+	}
+	var ticket proxyTicket
+	if err := json.Unmarshal(payload, &ticket); err != nil {
+		return proxyTicket{}, errProxyTicketInvalid
+	}
+	if ticket.ProxyID != instance.ProxyID || now.Unix() >= ticket.Exp {
+		return proxyTicket{}, errProxyTicketInvalid
+	}
+	// Every player gets their own ticket for a shared instance; a player
+	// instance only admits its owner.
+	if instance.UserID != SharedOwnerID && ticket.UserID != instance.UserID {
+		return proxyTicket{}, errProxyTicketInvalid
+	}
+	return ticket, nil
+}
+
+func proxyTicketSignature(secret, accessToken, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("instance-proxy:" + accessToken + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,271 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newProxyTestService(t *testing.T, requireCookie bool) (*Service, *fakeRepository, *httptest.Server) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(ProxyAccessCookie); err == nil {
+			t.Errorf("expected access cookie to be stripped before reaching the instance")
+		}
+		_, _ = io.WriteString(w, "hello from "+r.Host+r.URL.Path)
+	}))
+	t.Cleanup(upstream.Close)
+	host, port, err := net.SplitHostPort(upstream.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("split upstream address: %v", err)
+	}
+
+	manager := &fakeManager{internalIP: host}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.ContainerPort, _ = strconv.Atoi(port)
+	service := NewService(ServiceConfig{
+		PublicBaseURL: "http://localhost:8080",
+		Proxy: ProxyConfig{
+			Domain:              "Inst.Example.com.",
+			Scheme:              "https",
+			Secret:              "proxy-secret",
+			RequireAccessCookie: requireCookie,
+		},
+	}, manager, repo)
+	return service, repo, upstream
+}
+
+func TestStartInstanceUsesProxySubdomainWithoutHostPort(t *testing.T) {
+	service, _, _ := newProxyTestService(t, true)
+
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if instance.HostPort != 0 || instance.ProxyID == "" {
+		t.Fatalf("expected proxied instance without host port, got %#v", instance)
+	}
+	accessURL, err := url.Parse(instance.AccessURL)
+	if err != nil {
+		t.Fatalf("parse access url: %v", err)
+	}
+	if accessURL.Scheme != "https" || accessURL.Host != instance.ProxyID+".inst.example.com" {
+		t.Fatalf("unexpected access url %q", instance.AccessURL)
+	}
+	if accessURL.Query().Get(ProxyAccessParam) == "" {
+		t.Fatalf("expected access ticket in %q", instance.AccessURL)
+	}
+}
+
+func TestProxyExchangesTicketForCookieAndForwards(t *testing.T) {
+	service, _, _ := newProxyTestService(t, true)
+	proxy := service.Proxy()
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	host := instance.ProxyID + ".inst.example.com"
+
+	anonymous := httptest.NewRecorder()
+	proxy.ServeHTTP(anonymous, httptest.NewRequest(http.MethodGet, "https://"+host+"/", nil))
+	if anonymous.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without access cookie, got %d", anonymous.Code)
+	}
+
+	entry := httptest.NewRecorder()
+	proxy.ServeHTTP(entry, httptest.NewRequest(http.MethodGet, instance.AccessURL, nil))
+	if entry.Code != http.StatusFound || entry.Header().Get("Location") != "/" {
+		t.Fatalf("expected redirect to clean url, got %d %q", entry.Code, entry.Header().Get("Location"))
+	}
+	cookies := entry.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != ProxyAccessCookie || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("expected secure access cookie, got %#v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://"+host+"/flag", nil)
+	req.AddCookie(cookies[0])
+	res := httptest.NewRecorder()
+	proxy.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Body.String() != "hello from "+host+"/flag" {
+		t.Fatalf("expected proxied response, got %d %q", res.Code, res.Body.String())
+	}
+}
+
+func TestProxyRejectsTicketForAnotherInstance(t *testing.T) {
+	service, repo, _ := newProxyTestService(t, true)
+	proxy := service.Proxy()
+	first, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	second, _, err := service.StartInstance(context.Background(), 8, "1")
+	if err != nil {
+		t.Fatalf("start second instance: %v", err)
+	}
+	stolen := strings.Replace(first.AccessURL, first.ProxyID, second.ProxyID, 1)
+
+	res := httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, stolen, nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected foreign ticket to be rejected, got %d", res.Code)
+	}
+
+	proxy.now = func() time.Time { return time.Now().Add(proxyTicketTTL + time.Minute) }
+	expired := httptest.NewRecorder()
+	proxy.ServeHTTP(expired, httptest.NewRequest(http.MethodGet, first.AccessURL, nil))
+	if expired.Code != http.StatusUnauthorized {
+		t.Fatalf("expected expired ticket to be rejected, got %d", expired.Code)
+	}
+
+	if _, err := service.DeleteInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("delete instance: %v", err)
+	}
+	if _, err := repo.GetInstanceByProxyID(context.Background(), first.ProxyID); err != ErrRepositoryNotFound {
+		t.Fatalf("expected terminated instance to leave the proxy table, got %v", err)
+	}
+	gone := httptest.NewRecorder()
+	proxy.ServeHTTP(gone, httptest.NewRequest(http.MethodGet, "https://"+first.ProxyID+".inst.example.com/", nil))
+	if gone.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for terminated instance, got %d", gone.Code)
+	}
+}
+
+func TestProxyRejectsTicketOfAnotherUser(t *testing.T) {
+	service, repo, _ := newProxyTestService(t, true)
+	proxy := service.Proxy()
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	record, err := repo.GetInstanceByProxyID(context.Background(), instance.ProxyID)
+	if err != nil {
+		t.Fatalf("get instance: %v", err)
+	}
+	ticket := signProxyTicket("proxy-secret", record.Instance.AccessToken, proxyTicket{
+		ProxyID: instance.ProxyID,
+		UserID:  8,
+		Exp:     time.Now().Add(time.Hour).Unix(),
+	})
+	foreign := "https://" + instance.ProxyID + ".inst.example.com/?" + ProxyAccessParam + "=" + url.QueryEscape(ticket)
+
+	res := httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, foreign, nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a ticket of another user to be rejected, got %d", res.Code)
+	}
+	res = httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, instance.AccessURL, nil))
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected the owner's ticket to work, got %d", res.Code)
+	}
+}
+
+func TestRestartRevokesProxyLinksAndCookies(t *testing.T) {
+	service, repo, _ := newProxyTestService(t, true)
+	repo.challenge.Challenge.MaxRestartCount = 1
+	proxy := service.Proxy()
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	entry := httptest.NewRecorder()
+	proxy.ServeHTTP(entry, httptest.NewRequest(http.MethodGet, instance.AccessURL, nil))
+	cookies := entry.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected an access cookie, got %d %#v", entry.Code, cookies)
+	}
+
+	restarted, err := service.RestartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("restart instance: %v", err)
+	}
+	if restarted.ProxyID != instance.ProxyID || restarted.AccessURL == instance.AccessURL {
+		t.Fatalf("expected the same subdomain with a new link, got %q then %q", instance.AccessURL, restarted.AccessURL)
+	}
+
+	stale := httptest.NewRequest(http.MethodGet, "https://"+instance.ProxyID+".inst.example.com/", nil)
+	stale.AddCookie(cookies[0])
+	res := httptest.NewRecorder()
+	proxy.ServeHTTP(res, stale)
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the cookie from before the restart to be rejected, got %d", res.Code)
+	}
+	res = httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, instance.AccessURL, nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the link from before the restart to be rejected, got %d", res.Code)
+	}
+	res = httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, restarted.AccessURL, nil))
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected the new link to work, got %d", res.Code)
+	}
+}
+
+func TestProxyWithoutAccessCookieRequiresTicketInQuery(t *testing.T) {
+	service, _, _ := newProxyTestService(t, false)
+	proxy := service.Proxy()
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if !strings.Contains(instance.AccessURL, ProxyAccessParam) {
+		t.Fatalf("expected access ticket in %q", instance.AccessURL)
+	}
+
+	anonymous := httptest.NewRecorder()
+	proxy.ServeHTTP(anonymous, httptest.NewRequest(http.MethodGet, "https://"+instance.ProxyID+".inst.example.com/", nil))
+	if anonymous.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a ticket, got %d", anonymous.Code)
+	}
+
+	res := httptest.NewRecorder()
+	proxy.ServeHTTP(res, httptest.NewRequest(http.MethodGet, instance.AccessURL, nil))
+	if res.Code != http.StatusOK || len(res.Result().Cookies()) != 0 {
+		t.Fatalf("expected proxied response without cookie, got %d %q", res.Code, res.Body.String())
+	}
+}
+
+func TestProxyIDFromHostRequiresSingleLabel(t *testing.T) {
+	proxy := NewProxy(ProxyConfig{Domain: "inst.example.com"}, newFakeRepository())
+	cases := map[string]bool{
+		"abc.inst.example.com":      true,
+		"ABC.inst.example.com:8443": true,
+		"inst.example.com":          false,
+		"a.b.inst.example.com":      false,
+		"abc.example.com":           false,
+		"abcinst.example.com":       false,
+	}
+	for host, want := range cases {
+		if _, ok := proxy.ProxyIDFromHost(host); ok != want {
+			t.Fatalf("host %q: expected %v, got %v", host, want, ok)
+		}
+	}
+}
+
+func TestProxyRouteUsesPublishedPortOnRemoteNodes(t *testing.T) {
+	service := NewService(ServiceConfig{
+		Proxy:         ProxyConfig{Domain: "inst.example.com", Secret: "proxy-secret"},
+		Gateway:       GatewayConfig{Addr: ":9000", UpstreamHost: "host.docker.internal"},
+		NodeAddresses: map[string]string{"edge": "10.0.0.9"},
+	}, &fakeManager{}, newFakeRepository())
+	cfg := ChallengeConfig{ExposedProtocol: "http", ContainerPort: 80}
+
+	_, upstream, err := service.proxyRoute(cfg, StartedContainer{ContainerID: "c1", Node: "edge", HostPort: 32768}, "")
+	if err != nil || upstream != "http://10.0.0.9:32768" {
+		t.Fatalf("unexpected upstream %q err=%v", upstream, err)
+	}
+	if addr := service.cfg.Gateway.upstreamAddr(Instance{Node: "edge", HostPort: 32769}); addr != "10.0.0.9:32769" {
+		t.Fatalf("unexpected gateway upstream %q", addr)
+	}
+	if addr := service.cfg.Gateway.upstreamAddr(Instance{Node: "local", HostPort: 32769}); addr != "host.docker.internal:32769" {
+		t.Fatalf("unexpected local gateway upstream %q", addr)
+	}
+}
@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Quotas that stopped an instance from starting.
+const (
+	QuotaUserInstances   = "user_instances"
+	QuotaUserMemory      = "user_memory"
+	QuotaGlobalInstances = "global_instances"
+	QuotaGlobalMemory    = "global_memory"
+)
+
+// Quotas cap instances across challenges, on top of each challenge's
+// MaxActiveInstances. Memory is the sum of MemoryLimitMB over an instance's
+// containers, as reserved when the instance started. A zero quota is not
+// enforced.
+type Quotas struct {
+	UserInstances   int
+	UserMemoryMB    int
+	GlobalInstances int
+	GlobalMemoryMB  int
+}
+
+func (q Quotas) enabled() bool {
+	return q.UserInstances > 0 || q.UserMemoryMB > 0 || q.GlobalInstances > 0 || q.GlobalMemoryMB > 0
+}
+
+// ActiveInstance is one of a player's running or starting instances, listed
+// when a quota stops them from starting another.
+type ActiveInstance struct {
+	ChallengeID string    `json:"challenge_id"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Status      string    `json:"status"`
+	MemoryMB    int       `json:"memory_mb"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// InstanceUsage totals every active instance, shared ones included.
+type InstanceUsage struct {
+	Instances int
+	MemoryMB  int
+}
+
+// QuotaError reports which quota a start would exceed, and the player's
+// active instances so that they can pick one to stop.
+type QuotaError struct {
+	Quota     string
+	Limit     int
+	Used      int
+	Requested int
+	Active    []ActiveInstance
+}
+
+func (e *QuotaError) Error() string {
+	switch e.Quota {
+	case QuotaUserInstances:
+		return fmt.Sprintf("you already have %d active instances, the limit is %d; stop one to start another", e.Used, e.Limit)
+	case QuotaUserMemory:
+		return fmt.Sprintf("your active instances use %d MB of your %d MB memory budget and this challenge needs %d MB; stop one to start another", e.Used, e.Limit, e.Requested)
+	default:
+		return "the platform is running as many instances as it can host; try again when some have expired"
+	}
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrInstanceQuotaExceeded
+}
+
+// Global reports whether the platform-wide budget rather than the player's
+// own quota was exceeded.
+func (e *QuotaError) Global() bool {
+	return e.Quota == QuotaGlobalInstances || e.Quota == QuotaGlobalMemory
+}
+
+// checkQuotas refuses a new instance of cfg for userID when it would exceed
+// one of the cross-challenge quotas. It runs under the admission lock.
+func (s *Service) checkQuotas(ctx context.Context, userID int64, cfg ChallengeConfig) error {
+	quotas := s.cfg.Quotas
+	if !quotas.enabled() {
+		return nil
+	}
+	need := cfg.reservation().MemoryMB
+
+	var (
+		active   []ActiveInstance
+		quotaErr *QuotaError
+	)
+	userQuotas := quotas.UserInstances > 0 || quotas.UserMemoryMB > 0
+	if userQuotas {
+		var err error
+		if active, err = s.repo.ListUserActiveInstances(ctx, userID); err != nil {
+			return err
+		}
+		used := 0
+		for _, item := range active {
+			used += item.MemoryMB
+		}
+		switch {
+		case quotas.UserInstances > 0 && len(active) >= quotas.UserInstances:
+			quotaErr = &QuotaError{Quota: QuotaUserInstances, Limit: quotas.UserInstances, Used: len(active), Requested: 1}
+		case quotas.UserMemoryMB > 0 && used+need > quotas.UserMemoryMB:
+			quotaErr = &QuotaError{Quota: QuotaUserMemory, Limit: quotas.UserMemoryMB, Used: used, Requested: need}
+		}
+	}
+
+	if quotaErr == nil && (quotas.GlobalInstances > 0 || quotas.GlobalMemoryMB > 0) {
+		usage, err := s.repo.GetInstanceUsage(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case quotas.GlobalInstances > 0 && usage.Instances >= quotas.GlobalInstances:
+			quotaErr = &QuotaError{Quota: QuotaGlobalInstances, Limit: quotas.GlobalInstances, Used: usage.Instances, Requested: 1}
+		case quotas.GlobalMemoryMB > 0 && usage.MemoryMB+need > quotas.GlobalMemoryMB:
+			quotaErr = &QuotaError{Quota: QuotaGlobalMemory, Limit: quotas.GlobalMemoryMB, Used: usage.MemoryMB, Requested: need}
+		}
+		if quotaErr != nil && !userQuotas {
+			if active, err = s.repo.ListUserActiveInstances(ctx, userID); err != nil {
+				return err
+			}
+		}
+	}
+	if quotaErr != nil {
+		quotaErr.Active = active
+		return quotaErr
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package runtime
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ReadinessTCP  = "tcp"
+	ReadinessHTTP = "http"
+
+	// FailureReadinessProbe is recorded on instances torn down because their
+	// readiness probe never passed.
+	FailureReadinessProbe = "readiness_probe_failed"
+
+	defaultReadinessTimeout = 60 * time.Second
+	maxReadinessTimeout     = 10 * time.Minute
+	readinessInterval       = 500 * time.Millisecond
+	readinessAttemptTimeout = 2 * time.Second
+	readinessSettleTimeout  = 15 * time.Second
+)
+
+// ReadinessProbe is checked after the container starts; the instance stays
+// "creating" and hides its access details until the probe passes.
+type ReadinessProbe struct {
+	Type           string `json:"type,omitempty"`
+	Path           string `json:"path,omitempty"`
+	ExpectedStatus int    `json:"expected_status,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+func (p ReadinessProbe) Enabled() bool {
+	return p.Type != ""
+}
+
+func (p ReadinessProbe) timeout() time.Duration {
+	if p.TimeoutSeconds <= 0 {
+		return defaultReadinessTimeout
+	}
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+// NormalizeReadinessProbe validates a probe and fills in the HTTP defaults. An
+// empty type disables the probe.
+func NormalizeReadinessProbe(p ReadinessProbe) (ReadinessProbe, error) {
+	p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+	switch p.Type {
+	case "", "none":
+		return ReadinessProbe{}, nil
+	case ReadinessTCP:
+		p.Path = ""
+		p.ExpectedStatus = 0
+	case ReadinessHTTP:
+		p.Path = strings.TrimSpace(p.Path)
+		if p.Path == "" {
+			p.Path = "/"
+		}
+		if !strings.HasPrefix(p.Path, "/") {
+			return ReadinessProbe{}, fmt.Errorf("readiness path %q must start with /", p.Path)
+		}
+		if p.ExpectedStatus == 0 {
+			p.ExpectedStatus = http.StatusOK
+		}
+		if p.ExpectedStatus < 100 || p.ExpectedStatus > 599 {
+			return ReadinessProbe{}, fmt.Errorf("readiness expected_status %d is not an HTTP status", p.ExpectedStatus)
+		}
+	default:
+		return ReadinessProbe{}, fmt.Errorf("readiness type %q is not supported, only tcp and http are allowed", p.Type)
+	}
+	if p.TimeoutSeconds < 0 || time.Duration(p.TimeoutSeconds)*time.Second > maxReadinessTimeout {
+		return ReadinessProbe{}, fmt.Errorf("readiness timeout must be between 0 and %s", maxReadinessTimeout)
+	}
+	return p, nil
+}
+
+// runReadinessProbe retries the probe against address until it passes or ctx
+// expires.
+func runReadinessProbe(ctx context.Context, cfg ChallengeConfig, address string) error {
+	probe := cfg.Readiness
+	client := &http.Client{
+		Timeout: readinessAttemptTimeout,
+		Transport: &http.Transport{
+			// Challenge images ship self-signed certificates.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	defer client.CloseIdleConnections()
+
+	attempt := func() error {
+		if probe.Type == ReadinessTCP {
+			dialer := net.Dialer{Timeout: readinessAttemptTimeout}
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+		scheme := "http"
+		if strings.EqualFold(cfg.ExposedProtocol, "https") {
+			scheme = "https"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+address+probe.Path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != probe.ExpectedStatus {
+			return fmt.Errorf("readiness probe got status %d, want %d", resp.StatusCode, probe.ExpectedStatus)
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("instance not ready: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeAddress is where the API reaches an instance.
+func (s *Service) probeAddress(instance Instance) string {
+	return s.cfg.Gateway.upstreamAddr(instance)
+}
+
+// upstreamAddr is where the API reaches an instance: the container address
+// for instances behind the proxy or the gateway, the published host port
+// otherwise.
+func (c GatewayConfig) upstreamAddr(instance Instance) string {
+	if instance.UpstreamURL != "" {
+		if parsed, err := url.Parse(instance.UpstreamURL); err == nil && parsed.Host != "" {
+			return parsed.Host
+		}
+	}
+	host := c.nodeAddresses[instance.Node]
+	if host == "" && instance.Node != ProcessNodeName {
+		// Process instances listen in the API process itself.
+		host = c.UpstreamHost
+	}
+	if host == "" {
+		host = instance.HostIP
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(instance.HostPort))
+}
+
+// initialStatus is the status a freshly started instance is recorded with.
+func initialStatus(cfg ChallengeConfig) string {
+	if cfg.Readiness.Enabled() {
+		return "creating"
+	}
+	return "running"
+}
+
+// watchReadiness probes a "creating" instance in the background and marks it
+// running, or fails it and stops its container. The status updates only apply
+// while the record is still active, so an instance deleted meanwhile is left
+// alone.
+func (s *Service) watchReadiness(cfg ChallengeConfig, record InstanceRecord) {
+	if record.Instance.Status != "creating" {
+		return
+	}
+	s.probes.Add(1)
+	go func() {
+		defer s.probes.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Readiness.timeout())
+		probeErr := s.probe(ctx, cfg, s.probeAddress(record.Instance))
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), readinessSettleTimeout)
+		defer cancel()
+		if probeErr == nil {
+			if err := s.repo.MarkInstanceRunning(ctx, record.ID); err == nil {
+				s.recordEvent(ctx, record, EventReady, "")
+			}
+			return
+		}
+		s.failInstance(ctx, record, FailureReadinessProbe, probeErr)
+	}()
+}
+
+// failInstance marks an instance failed for reason and stops its container.
+// cause, when known, is kept in the instance's event history.
+func (s *Service) failInstance(ctx context.Context, record InstanceRecord, reason string, cause error) {
+	if err := s.repo.FailInstance(ctx, record.ID, s.now().UTC(), reason); err != nil {
+		return
+	}
+	eventType, detail := failureEvent(reason, cause)
+	s.recordEvent(ctx, record, eventType, detail)
+	if record.Instance.ContainerID == "" {
+		return
+	}
+	_ = s.manager.Stop(ctx, record.Instance.Node, record.Instance.ContainerID)
+}
+
+// readinessAbandoned reports whether a creating instance has outlived its
+// probe, e.g. because the API restarted while probing it.
+func (s *Service) readinessAbandoned(ctx context.Context, item InstanceRecord, now time.Time) (bool, error) {
+	timeout := defaultReadinessTimeout
+	record, err := s.repo.GetChallengeConfig(ctx, item.Instance.ChallengeID)
+	switch {
+	case err == nil:
+		timeout = record.Challenge.Readiness.timeout()
+	case !errors.Is(err, ErrRepositoryNotFound):
+		return false, err
+	}
+	return now.After(item.Instance.StartedAt.Add(timeout + readinessSettleTimeout)), nil
+}
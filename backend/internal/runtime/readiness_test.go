@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeReadinessProbe(t *testing.T) {
+	probe, err := NormalizeReadinessProbe(ReadinessProbe{Type: " HTTP "})
+	if err != nil {
+		t.Fatalf("normalize probe: %v", err)
+	}
+	if probe.Path != "/" || probe.ExpectedStatus != http.StatusOK {
+		t.Fatalf("expected http defaults, got %+v", probe)
+	}
+	if probe, _ := NormalizeReadinessProbe(ReadinessProbe{Type: "none", Path: "/x"}); probe.Enabled() {
+		t.Fatalf("expected none to disable the probe, got %+v", probe)
+	}
+
+	cases := map[string]ReadinessProbe{
+		"not supported":   {Type: "grpc"},
+		"must start":      {Type: "http", Path: "health"},
+		"not an HTTP":     {Type: "http", ExpectedStatus: 42},
+		"timeout must be": {Type: "tcp", TimeoutSeconds: 3600},
+	}
+	for want, input := range cases {
+		if _, err := NormalizeReadinessProbe(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q error for %+v, got %v", want, input, err)
+		}
+	}
+}
+
+func TestRunReadinessProbeWaitsForExpectedStatus(t *testing.T) {
+	ready := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-ready:
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	time.AfterFunc(200*time.Millisecond, func() { close(ready) })
+
+	cfg := ChallengeConfig{ExposedProtocol: "http", Readiness: ReadinessProbe{Type: ReadinessHTTP, Path: "/health", ExpectedStatus: http.StatusNoContent}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runReadinessProbe(ctx, cfg, strings.TrimPrefix(server.URL, "http://")); err != nil {
+		t.Fatalf("expected probe to pass, got %v", err)
+	}
+}
+
+func TestRunReadinessProbeTCPTimesOut(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	cfg := ChallengeConfig{Readiness: ReadinessProbe{Type: ReadinessTCP}}
+	if err := runReadinessProbe(ctx, cfg, address); err == nil || !strings.Contains(err.Error(), "instance not ready") {
+		t.Fatalf("expected tcp probe to time out, got %v", err)
+	}
+}
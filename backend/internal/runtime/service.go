@@ -13,18 +13,62 @@ import (
 type Service struct {
 	manager Manager
 	repo    Repository
+	proxy   *Proxy
+	gateway *TCPGateway
 	cfg     ServiceConfig
 	now     func() time.Time
-	mu      sync.Mutex
+	probe   func(context.Context, ChallengeConfig, string) error
+	probes  sync.WaitGroup
+	queue   *startQueue
+	pool    *warmPool
+	stats   *statsTracker
+	exits   *exitTracker
+	// activity is when each instance last saw traffic, for IdlePolicy.
+	activity *activityTracker
+	refills  sync.WaitGroup
+	admit    sync.Mutex
+	mu       sync.Mutex
 }
 
-func (s *Service) buildAccessURL(cfg ChallengeConfig, hostIP string, hostPort int) string {
+// present fills in what a viewer needs to reach the instance. A creating
+// instance reports its queue position or readiness deadline instead of any
+// access details.
+func (s *Service) present(cfg ChallengeConfig, instance Instance, viewerID int64) Instance {
+	if instance.Status == "creating" {
+		if instance.ContainerID == "" {
+			instance.QueuePosition = s.queue.position(instance.ChallengeID, instance.UserID)
+		} else if cfg.Readiness.Enabled() {
+			deadline := instance.StartedAt.Add(cfg.Readiness.timeout())
+			instance.ReadyDeadline = &deadline
+		}
+		instance.AccessURL = ""
+		instance.GatewayToken = ""
+		instance.GatewayTLSAddr = ""
+		return instance
+	}
+	instance.AccessURL = s.buildAccessURL(cfg, instance, viewerID)
+	instance.GatewayTLSAddr = s.gatewayTLSAddr(instance.GatewayToken)
+	return instance
+}
+
+// buildAccessURL is the address players open. Behind the proxy or the TCP
+// gateway it carries the instance's token; otherwise it is the published host
+// port, which anyone who reaches the host can connect to.
+func (s *Service) buildAccessURL(cfg ChallengeConfig, instance Instance, viewerID int64) string {
+	if instance.ProxyID != "" && s.cfg.Proxy.Enabled() {
+		return s.buildProxyURL(instance, viewerID)
+	}
+	if instance.GatewayToken != "" && s.cfg.Gateway.Enabled() {
+		return "tcp://" + instance.GatewayToken + "@" + s.cfg.Gateway.PublicAddr
+	}
 	base := s.cfg.RuntimeBaseURL
-	if strings.TrimSpace(hostIP) != "" && strings.Contains(base, "localhost") {
+	if address := s.cfg.NodeAddresses[instance.Node]; address != "" {
+		base = "//" + address
+	} else if strings.TrimSpace(instance.HostIP) != "" && strings.Contains(base, "localhost") {
 		// In local dev, docker port bindings are commonly exposed on 127.0.0.1.
-		base = strings.ReplaceAll(base, "localhost", hostIP)
+		base = strings.ReplaceAll(base, "localhost", instance.HostIP)
 	}
-	return buildAccessURL(cfg.ExposedProtocol, base, hostPort)
+	return buildAccessURL(cfg.ExposedProtocol, base, instance.HostPort)
 }
 
 func NewService(cfg ServiceConfig, manager Manager, repo Repository) *Service {
@@ -50,23 +94,69 @@ func NewService(cfg ServiceConfig, manager Manager, repo Repository) *Service {
 		cfg.PortMin = 0
 		cfg.PortMax = 0
 	}
+	cfg.Isolation, _ = NormalizeNetworkIsolation(cfg.Isolation)
+	if cfg.Isolation == "" {
+		cfg.Isolation = NetworkIsolationNone
+	}
+	cfg.Proxy = normalizeProxyConfig(cfg.Proxy)
+	cfg.Gateway = normalizeGatewayConfig(cfg.Gateway, cfg.RuntimeBaseURL)
+	if cfg.Gateway.Network == "" {
+		cfg.Gateway.Network = cfg.Proxy.Network
+	}
+	cfg.Gateway.nodeAddresses = cfg.NodeAddresses
+	if cfg.StartWorkers < 0 {
+		cfg.StartWorkers = 0
+	}
+	cfg.StatsLimits = normalizeStatsLimits(cfg.StatsLimits)
+	cfg.Idle = normalizeIdlePolicy(cfg.Idle)
+
+	var queue *startQueue
+	if cfg.StartWorkers > 0 {
+		queue = newStartQueue(cfg.StartQueueSize)
+	}
+
+	activity := newActivityTracker(time.Now())
+	proxy := NewProxy(cfg.Proxy, repo)
+	if proxy != nil {
+		proxy.activity = activity
+	}
+	gateway := NewTCPGateway(cfg.Gateway, repo)
+	if gateway != nil {
+		gateway.activity = activity
+	}
 
 	return &Service{
-		manager: manager,
-		repo:    repo,
-		cfg:     cfg,
-		now:     time.Now,
+		manager:  manager,
+		repo:     repo,
+		proxy:    proxy,
+		gateway:  gateway,
+		cfg:      cfg,
+		now:      time.Now,
+		probe:    runReadinessProbe,
+		queue:    queue,
+		pool:     newWarmPool(),
+		stats:    newStatsTracker(),
+		exits:    newExitTracker(),
+		activity: activity,
 	}
 }
 
+func (s *Service) Proxy() *Proxy {
+	return s.proxy
+}
+
+func (s *Service) Gateway() *TCPGateway {
+	return s.gateway
+}
+
 func (s *Service) Challenges(ctx context.Context) ([]ChallengeSummary, error) {
 	return s.repo.ListChallenges(ctx)
 }
 
+// StartInstance claims an instance for the player and provisions it, either
+// right away or through the start queue. A queued instance is returned as
+// creating with its queue position.
 func (s *Service) StartInstance(ctx context.Context, userID int64, challengeRef string) (Instance, bool, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	record, err := s.repo.GetChallengeConfig(ctx, challengeRef)
 	if err != nil {
 		if errors.Is(err, ErrRepositoryNotFound) {
@@ -82,71 +172,48 @@ func (s *Service) StartInstance(ctx context.Context, userID int64, challengeRef
 	if record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 {
 		return Instance{}, false, ErrRuntimeConfigMissing
 	}
+	if cfg.IsShared() {
+		shared, err := s.activeSharedInstance(ctx, cfg, userID)
+		return shared, false, err
+	}
 
 	existing, err := s.repo.GetActiveInstance(ctx, userID, cfg.ID)
 	if err == nil {
-		existing.Instance.AccessURL = s.buildAccessURL(cfg, existing.Instance.HostIP, existing.Instance.HostPort)
+		existing.Instance = s.present(cfg, existing.Instance, userID)
 		return existing.Instance, false, nil
 	}
 	if !errors.Is(err, ErrRepositoryNotFound) {
 		return Instance{}, false, err
 	}
-
-	if cfg.MaxActiveInstances > 0 {
-		activeCount, err := s.repo.CountActiveInstances(ctx, cfg.ID)
-		if err != nil {
-			return Instance{}, false, err
-		}
-		if activeCount >= cfg.MaxActiveInstances {
-			return Instance{}, false, ErrInstanceCapacityReached
-		}
-	}
-
-	if cfg.UserCooldown > 0 {
-		latest, err := s.repo.GetLatestInstance(ctx, userID, cfg.ID)
-		if err != nil && !errors.Is(err, ErrRepositoryNotFound) {
-			return Instance{}, false, err
-		}
-		if err == nil {
-			nextAllowedAt := latest.Instance.StartedAt.Add(cfg.UserCooldown)
-			if nextAllowedAt.After(s.now().UTC()) {
-				return Instance{}, false, ErrInstanceCooldownActive
-			}
-		}
+	if cfg.Internal && !s.cfg.Proxy.handles(cfg.ExposedProtocol) {
+		return Instance{}, false, ErrInternalNetworkNeedsProxy
 	}
 
-	started, hostPort, err := s.startContainer(ctx, userID, cfg)
+	claim, err := s.claimInstance(ctx, userID, record)
 	if err != nil {
+		// Lost the race against a concurrent start for the same player.
+		if existing, lookupErr := s.repo.GetActiveInstance(ctx, userID, cfg.ID); lookupErr == nil {
+			existing.Instance = s.present(cfg, existing.Instance, userID)
+			return existing.Instance, false, nil
+		}
 		return Instance{}, false, err
 	}
 
-	now := s.now().UTC()
-	instance := Instance{
-		ChallengeID:   cfg.ID,
-		UserID:        userID,
-		Status:        "running",
-		AccessURL:     s.buildAccessURL(cfg, started.HostIP, hostPort),
-		HostPort:      hostPort,
-		RenewCount:    0,
-		StartedAt:     now,
-		ExpiresAt:     now.Add(cfg.TTL),
-		ContainerID:   started.ContainerID,
-		ContainerName: started.ContainerName,
-		HostIP:        started.HostIP,
+	// A warm container only needs to be recorded, so it skips the queue.
+	if s.queue != nil && !s.pool.ready(cfg) {
+		if !s.queue.push(startJob{cfg: cfg, record: claim}) {
+			s.failInstance(context.Background(), claim, FailureStartQueueFull, ErrStartQueueFull)
+			return Instance{}, false, ErrStartQueueFull
+		}
+		claim.Instance = s.present(cfg, claim.Instance, userID)
+		return claim.Instance, true, nil
 	}
 
-	saved, err := s.repo.CreateInstance(ctx, record.ID, instance)
+	saved, err := s.provision(ctx, cfg, claim)
 	if err != nil {
-		_ = s.manager.Stop(context.Background(), started.ContainerID)
-
-		if existing, lookupErr := s.repo.GetActiveInstance(ctx, userID, cfg.ID); lookupErr == nil {
-			existing.Instance.AccessURL = s.buildAccessURL(cfg, existing.Instance.HostIP, existing.Instance.HostPort)
-			return existing.Instance, false, nil
-		}
 		return Instance{}, false, err
 	}
-
-	saved.Instance.AccessURL = s.buildAccessURL(cfg, saved.Instance.HostIP, saved.Instance.HostPort)
+	saved.Instance = s.present(cfg, saved.Instance, userID)
 	return saved.Instance, true, nil
 }
 
@@ -163,15 +230,24 @@ func (s *Service) GetInstance(ctx context.Context, userID int64, challengeRef st
 	if !cfg.Dynamic {
 		return Instance{}, ErrChallengeNotDynamic
 	}
+	if cfg.IsShared() {
+		return s.activeSharedInstance(ctx, cfg, userID)
+	}
 
 	instanceRecord, err := s.repo.GetActiveInstance(ctx, userID, cfg.ID)
 	if err != nil {
 		if errors.Is(err, ErrRepositoryNotFound) {
+			if latest, latestErr := s.repo.GetLatestInstance(ctx, userID, cfg.ID); latestErr == nil {
+				if failed := failureError(latest.Instance); failed != nil {
+					return Instance{}, failed
+				}
+			}
 			return Instance{}, ErrInstanceNotFound
 		}
 		return Instance{}, err
 	}
-	instanceRecord.Instance.AccessURL = s.buildAccessURL(cfg, instanceRecord.Instance.HostIP, instanceRecord.Instance.HostPort)
+	instanceRecord.Instance = s.present(cfg, instanceRecord.Instance, userID)
+	instanceRecord.Instance.IdleExpiresAt = s.idleDeadline(instanceRecord)
 	return instanceRecord.Instance, nil
 }
 
@@ -194,6 +270,9 @@ func (s *Service) RenewInstance(ctx context.Context, userID int64, challengeRef
 	if record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 {
 		return Instance{}, ErrRuntimeConfigMissing
 	}
+	if cfg.IsShared() {
+		return Instance{}, ErrSharedInstanceReadOnly
+	}
 
 	instanceRecord, err := s.repo.GetActiveInstance(ctx, userID, cfg.ID)
 	if err != nil {
@@ -218,7 +297,118 @@ func (s *Service) RenewInstance(ctx context.Context, userID int64, challengeRef
 		}
 		return Instance{}, err
 	}
-	updated.Instance.AccessURL = s.buildAccessURL(cfg, updated.Instance.HostIP, updated.Instance.HostPort)
+	s.recordEvent(ctx, updated, EventRenewed, "expires_at "+updated.Instance.ExpiresAt.UTC().Format(time.RFC3339))
+	// Renewing shows the player still wants the instance.
+	s.activity.touch(updated.ID, now)
+	updated.Instance = s.present(cfg, updated.Instance, userID)
+	return updated.Instance, nil
+}
+
+// RestartInstance replaces the player's container with a fresh one. The
+// instance keeps its expiry, renewals and subdomain, and its host port unless
+// something else took it meanwhile; its access and gateway tokens are rotated.
+// Restarts are limited by MaxRestartCount instead of the user cooldown.
+func (s *Service) RestartInstance(ctx context.Context, userID int64, challengeRef string) (Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.repo.GetChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return Instance{}, ErrChallengeNotFound
+		}
+		return Instance{}, err
+	}
+
+	cfg := record.Challenge
+	if !cfg.Dynamic {
+		return Instance{}, ErrChallengeNotDynamic
+	}
+	if record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 {
+		return Instance{}, ErrRuntimeConfigMissing
+	}
+	if cfg.IsShared() {
+		return Instance{}, ErrSharedInstanceReadOnly
+	}
+
+	instanceRecord, err := s.repo.GetActiveInstance(ctx, userID, cfg.ID)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return Instance{}, ErrInstanceNotFound
+		}
+		return Instance{}, err
+	}
+	if instanceRecord.Instance.Status != "running" {
+		return Instance{}, ErrInstanceNotReady
+	}
+	if instanceRecord.Instance.RestartCount >= cfg.MaxRestartCount {
+		return Instance{}, ErrInstanceRestartLimitReached
+	}
+
+	previous := instanceRecord.Instance
+	if err := s.manager.Stop(ctx, previous.Node, previous.ContainerID); err != nil {
+		return Instance{}, err
+	}
+	// The old container is gone from here on, so any failure fails the
+	// instance and the player can start a new one without a cooldown.
+	instanceRecord.Instance.ContainerID = ""
+	started, hostPort, err := s.startContainer(ctx, StartRequest{UserID: userID, Config: cfg}, previous.HostPort, previous.HostPort)
+	if err != nil {
+		reason := FailureStartFailed
+		if errors.Is(err, ErrInstancePortExhausted) {
+			reason = FailurePortExhausted
+		}
+		s.failInstance(context.Background(), instanceRecord, reason, err)
+		return Instance{}, err
+	}
+	instanceRecord.Instance.ContainerID = started.ContainerID
+	instanceRecord.Instance.Node = started.Node
+
+	proxyID, upstreamURL, err := s.proxyRoute(cfg, started, previous.ProxyID)
+	if err != nil {
+		s.failInstance(context.Background(), instanceRecord, FailureStartFailed, err)
+		return Instance{}, err
+	}
+	// A restart rotates the tokens, so links and gateway tokens handed out
+	// for the old container stop working.
+	gatewayToken, err := s.gatewayToken(cfg, "")
+	if err != nil {
+		s.failInstance(context.Background(), instanceRecord, FailureStartFailed, err)
+		return Instance{}, err
+	}
+	accessToken, err := newRouteID()
+	if err != nil {
+		s.failInstance(context.Background(), instanceRecord, FailureStartFailed, err)
+		return Instance{}, err
+	}
+	updated, err := s.repo.RestartInstance(ctx, instanceRecord.ID, Instance{
+		Status:        initialStatus(cfg),
+		HostPort:      hostPort,
+		StartedAt:     s.now().UTC(),
+		ContainerID:   started.ContainerID,
+		ContainerName: started.ContainerName,
+		HostIP:        started.HostIP,
+		Node:          started.Node,
+		ProxyID:       proxyID,
+		UpstreamURL:   upstreamURL,
+		GatewayToken:  gatewayToken,
+		AccessToken:   accessToken,
+	})
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+			return Instance{}, ErrInstanceNotFound
+		}
+		s.failInstance(context.Background(), instanceRecord, FailureStartFailed, err)
+		return Instance{}, err
+	}
+
+	s.recordEvent(ctx, updated, EventRestarted, "")
+	if updated.Instance.Status == "running" {
+		s.recordEvent(ctx, updated, EventReady, "")
+	}
+	s.watchReadiness(cfg, updated)
+	updated.Instance = s.present(cfg, updated.Instance, userID)
 	return updated.Instance, nil
 }
 
@@ -238,6 +428,9 @@ func (s *Service) DeleteInstance(ctx context.Context, userID int64, challengeRef
 	if !cfg.Dynamic {
 		return Instance{}, ErrChallengeNotDynamic
 	}
+	if cfg.IsShared() {
+		return Instance{}, ErrSharedInstanceReadOnly
+	}
 
 	instanceRecord, err := s.repo.GetActiveInstance(ctx, userID, cfg.ID)
 	if err != nil {
@@ -247,7 +440,7 @@ func (s *Service) DeleteInstance(ctx context.Context, userID int64, challengeRef
 		return Instance{}, err
 	}
 
-	if err := s.manager.Stop(ctx, instanceRecord.Instance.ContainerID); err != nil {
+	if err := s.manager.Stop(ctx, instanceRecord.Instance.Node, instanceRecord.Instance.ContainerID); err != nil {
 		return Instance{}, err
 	}
 
@@ -255,10 +448,11 @@ func (s *Service) DeleteInstance(ctx context.Context, userID int64, challengeRef
 	if err := s.repo.TerminateInstance(ctx, instanceRecord.ID, now); err != nil {
 		return Instance{}, err
 	}
+	s.recordEvent(ctx, instanceRecord, EventTerminated, "")
 
 	instanceRecord.Instance.Status = "terminated"
 	instanceRecord.Instance.TerminatedAt = &now
-	instanceRecord.Instance.AccessURL = s.buildAccessURL(cfg, instanceRecord.Instance.HostIP, instanceRecord.Instance.HostPort)
+	instanceRecord.Instance = s.present(cfg, instanceRecord.Instance, userID)
 	return instanceRecord.Instance, nil
 }
 
@@ -273,73 +467,213 @@ func (s *Service) SweepExpired(ctx context.Context) (int, error) {
 
 	terminated := 0
 	for _, item := range expired {
-		if err := s.manager.Stop(ctx, item.Instance.ContainerID); err != nil {
+		if err := s.manager.Stop(ctx, item.Instance.Node, item.Instance.ContainerID); err != nil {
 			return terminated, err
 		}
 		if err := s.repo.TerminateInstance(ctx, item.ID, s.now().UTC()); err != nil {
 			return terminated, err
 		}
+		s.recordEvent(ctx, item, EventExpired, "")
 		terminated++
 	}
 	return terminated, nil
 }
 
-func (s *Service) Reconcile(ctx context.Context) (ReconcileReport, error) {
+// StopChallengeInstances ends every active instance of a challenge, its
+// shared instance and queued starts included, and records detail with each.
+// A start worker skips a claim that was ended and stops a container it was
+// already creating for it.
+func (s *Service) StopChallengeInstances(ctx context.Context, challengeID string, detail string) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	report := ReconcileReport{}
 	active, err := s.repo.ListActiveInstances(ctx)
 	if err != nil {
-		return report, err
+		return 0, err
 	}
 
-	now := s.now().UTC()
-	managedByKey := make(map[string]ManagedContainer)
+	stopped := 0
+	for _, item := range active {
+		if item.Instance.ChallengeID != challengeID {
+			continue
+		}
+		if item.Instance.ContainerID != "" {
+			if err := s.manager.Stop(ctx, item.Instance.Node, item.Instance.ContainerID); err != nil {
+				return stopped, err
+			}
+		}
+		if err := s.repo.TerminateInstance(ctx, item.ID, s.now().UTC()); err != nil {
+			return stopped, err
+		}
+		s.recordEvent(ctx, item, EventTerminatedByAdmin, detail)
+		s.stats.forget(item.ID)
+		s.activity.forget(item.ID)
+		stopped++
+	}
+	return stopped, nil
+}
+
+func (s *Service) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ReconcileReport{}
+	// Containers are listed before records: starts no longer hold s.mu, and a
+	// container only exists once its instance has been claimed, so every
+	// listed container has its record in the later listing. For the same
+	// reason a start may be between creating its network and its container
+	// when networks are pruned at the end; the Docker manager holds such
+	// networks and the prune leaves them alone.
 	containers, err := s.manager.ListManagedContainers(ctx)
 	if err != nil {
 		return report, err
 	}
+	active, err := s.repo.ListActiveInstances(ctx)
+	if err != nil {
+		return report, err
+	}
+	// A claimed warm container still carries the pool labels, so its owner
+	// comes from the instance record that holds it.
+	owners := make(map[string]InstanceRecord, len(active))
+	for _, item := range active {
+		if item.Instance.ContainerID != "" {
+			owners[item.Instance.ContainerID] = item
+		}
+	}
+	managedByKey := make(map[string]ManagedContainer)
+	var pooled []ManagedContainer
 	for _, container := range containers {
+		if container.Pooled {
+			owner, ok := owners[container.ContainerID]
+			if !ok {
+				pooled = append(pooled, container)
+				continue
+			}
+			container.UserID = owner.Instance.UserID
+			container.Pooled = false
+		}
 		managedByKey[managedContainerKey(container.ChallengeID, container.UserID)] = container
 	}
 
+	now := s.now().UTC()
 	for _, item := range active {
 		key := managedContainerKey(item.Instance.ChallengeID, item.Instance.UserID)
-		exists, err := s.manager.Exists(ctx, item.Instance.ContainerID)
+		if item.Instance.ContainerID == "" {
+			delete(managedByKey, key)
+			if s.claimAbandoned(item, now) {
+				s.failInstance(ctx, item, FailureStartFailed, errClaimAbandoned)
+				report.TerminatedRecords++
+			}
+			continue
+		}
+		exists, err := s.manager.Exists(ctx, item.Instance.Node, item.Instance.ContainerID)
 		if err != nil {
+			// Records on a node that cannot be reached are checked again once
+			// it is back.
+			if errors.Is(err, ErrNodeUnavailable) {
+				delete(managedByKey, key)
+				continue
+			}
 			return report, err
 		}
+		if exists && item.Instance.Status == "creating" {
+			abandoned, err := s.readinessAbandoned(ctx, item, now)
+			if err != nil {
+				return report, err
+			}
+			if abandoned {
+				delete(managedByKey, key)
+				s.failInstance(ctx, item, FailureReadinessProbe, errReadinessAbandoned)
+				report.TerminatedRecords++
+				continue
+			}
+		}
 		if !exists {
 			delete(managedByKey, key)
 			if err := s.repo.TerminateInstance(ctx, item.ID, now); err != nil {
 				return report, err
 			}
+			s.recordEvent(ctx, item, EventReconciledMissing, "container "+item.Instance.ContainerID+" is gone")
 			report.TerminatedRecords++
+			if item.Instance.UserID == SharedOwnerID {
+				restarted, err := s.relaunchSharedInstance(ctx, item)
+				if err != nil {
+					return report, err
+				}
+				if restarted {
+					report.RestartedShared++
+				}
+			}
 			continue
 		}
 		delete(managedByKey, key)
 	}
 
 	for _, container := range managedByKey {
-		if err := s.manager.Stop(ctx, container.ContainerID); err != nil {
+		if err := s.manager.Stop(ctx, container.Node, container.ContainerID); err != nil {
 			return report, err
 		}
 		report.RemovedContainers++
 	}
+	// Unclaimed pooled containers this process does not know about are left
+	// over from a previous run.
+	for _, container := range pooled {
+		if s.pool.holds(container) {
+			continue
+		}
+		if err := s.manager.Stop(ctx, container.Node, container.ContainerID); err != nil {
+			return report, err
+		}
+		report.RemovedContainers++
+	}
+	if err := s.fillWarmPools(ctx); err != nil {
+		return report, err
+	}
+
+	removed, err := s.manager.PruneNetworks(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.RemovedNetworks = removed
 
 	return report, nil
 }
 
-func (s *Service) startContainer(ctx context.Context, userID int64, cfg ChallengeConfig) (StartedContainer, int, error) {
+// startContainer starts the container described by req, choosing how it is
+// exposed and which host port it gets. preferredPort is tried first;
+// heldPort is a port the caller's own active instance still holds, which
+// does not count as taken.
+func (s *Service) startContainer(ctx context.Context, req StartRequest, preferredPort, heldPort int) (StartedContainer, int, error) {
+	cfg := req.Config
+	req.ChallengeID = cfg.ID
+	req.Isolation = s.cfg.Isolation
+	// Instances behind the proxy or the gateway publish no host port, so
+	// they cannot be reached without going through the token check.
+	if s.cfg.Proxy.handles(cfg.ExposedProtocol) || s.cfg.Gateway.handles(cfg.ExposedProtocol) {
+		req.Proxied = true
+		req.Network = s.cfg.Proxy.Network
+		if !s.cfg.Proxy.handles(cfg.ExposedProtocol) {
+			req.Network = s.cfg.Gateway.Network
+		}
+		started, err := s.manager.Start(ctx, req)
+		return started, 0, err
+	}
+	if cfg.Internal {
+		// Internal networks have no route to the host, so a published port
+		// would never be reachable.
+		return StartedContainer{}, 0, ErrInternalNetworkNeedsProxy
+	}
+	req.BindAddr = s.cfg.BindAddr
 	if s.cfg.PortMin <= 0 || s.cfg.PortMax <= 0 || s.cfg.PortMin > s.cfg.PortMax {
-		started, err := s.manager.Start(ctx, StartRequest{
-			ChallengeID: cfg.ID,
-			UserID:      userID,
-			BindAddr:    s.cfg.BindAddr,
-			HostPort:    0,
-			Config:      cfg,
-		})
+		if preferredPort > 0 {
+			req.HostPort = preferredPort
+			started, err := s.manager.Start(ctx, req)
+			if err == nil || !isPortBindError(err) {
+				return started, started.HostPort, err
+			}
+		}
+		req.HostPort = 0
+		started, err := s.manager.Start(ctx, req)
 		return started, started.HostPort, err
 	}
 
@@ -348,23 +682,30 @@ func (s *Service) startContainer(ctx context.Context, userID int64, cfg Challeng
 		return StartedContainer{}, 0, err
 	}
 	used := make(map[int]struct{}, len(ports))
-	for _, port := range ports {
+	for _, port := range append(ports, s.pool.hostPorts()...) {
 		if port > 0 {
+			if port == heldPort {
+				heldPort = 0
+				continue
+			}
 			used[port] = struct{}{}
 		}
 	}
 
+	candidates := make([]int, 0, s.cfg.PortMax-s.cfg.PortMin+2)
+	if preferredPort >= s.cfg.PortMin && preferredPort <= s.cfg.PortMax {
+		candidates = append(candidates, preferredPort)
+	}
 	for port := s.cfg.PortMin; port <= s.cfg.PortMax; port++ {
+		candidates = append(candidates, port)
+	}
+
+	for _, port := range candidates {
 		if _, ok := used[port]; ok {
 			continue
 		}
-		started, err := s.manager.Start(ctx, StartRequest{
-			ChallengeID: cfg.ID,
-			UserID:      userID,
-			BindAddr:    s.cfg.BindAddr,
-			HostPort:    port,
-			Config:      cfg,
-		})
+		req.HostPort = port
+		started, err := s.manager.Start(ctx, req)
 		if err != nil {
 			if isPortBindError(err) {
 				used[port] = struct{}{}
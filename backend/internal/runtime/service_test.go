@@ -2,12 +2,15 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
 
 type fakeManager struct {
+	mu               sync.Mutex
 	startCalls       int
 	stopCalls        int
 	containers       map[string]ManagedContainer
@@ -15,15 +18,33 @@ type fakeManager struct {
 	stoppedIDs       []string
 	listManagedError error
 	existsError      error
+	internalIP       string
+	lastStart        StartRequest
+	orphanNetworks   int
+	stats            map[string]ContainerStats
+	startError       error
 }
 
 func (m *fakeManager) Start(_ context.Context, req StartRequest) (StartedContainer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.startCalls++
+	m.lastStart = req
+	if m.startError != nil {
+		return StartedContainer{}, m.startError
+	}
 	containerID := fmt.Sprintf("container-%d", m.startCalls)
 	if m.containers == nil {
 		m.containers = make(map[string]ManagedContainer)
 	}
-	m.containers[containerID] = ManagedContainer{ContainerID: containerID, ChallengeID: req.ChallengeID, UserID: req.UserID}
+	m.containers[containerID] = ManagedContainer{ContainerID: containerID, ChallengeID: req.ChallengeID, UserID: req.UserID, Pooled: req.Pooled}
+	if req.Proxied {
+		return StartedContainer{
+			ContainerID:   containerID,
+			ContainerName: fmt.Sprintf("demo-%d", m.startCalls),
+			InternalIP:    m.internalIP,
+		}, nil
+	}
 	return StartedContainer{
 		ContainerID:   containerID,
 		ContainerName: fmt.Sprintf("demo-%d", m.startCalls),
@@ -39,7 +60,9 @@ func defaultedPort(value int, fallback int) int {
 	return fallback
 }
 
-func (m *fakeManager) Stop(_ context.Context, containerID string) error {
+func (m *fakeManager) Stop(_ context.Context, _, containerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.stopCalls++
 	m.stoppedIDs = append(m.stoppedIDs, containerID)
 	if m.containers != nil {
@@ -48,7 +71,9 @@ func (m *fakeManager) Stop(_ context.Context, containerID string) error {
 	return nil
 }
 
-func (m *fakeManager) Exists(_ context.Context, containerID string) (bool, error) {
+func (m *fakeManager) Exists(_ context.Context, _, containerID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.existsError != nil {
 		return false, m.existsError
 	}
@@ -59,7 +84,24 @@ func (m *fakeManager) Exists(_ context.Context, containerID string) (bool, error
 	return ok, nil
 }
 
+func (m *fakeManager) Stats(_ context.Context, _, containerID string) (ContainerStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.containers[containerID]; !ok {
+		return ContainerStats{}, ErrInstanceNotFound
+	}
+	return m.stats[containerID], nil
+}
+
+func (m *fakeManager) PruneNetworks(context.Context) (int, error) {
+	removed := m.orphanNetworks
+	m.orphanNetworks = 0
+	return removed, nil
+}
+
 func (m *fakeManager) ListManagedContainers(_ context.Context) ([]ManagedContainer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.listManagedError != nil {
 		return nil, m.listManagedError
 	}
@@ -75,6 +117,9 @@ type fakeRepository struct {
 	active    map[string]InstanceRecord
 	history   map[string]InstanceRecord
 	nextID    int64
+	exitCodes []int
+	eventsMu  sync.Mutex
+	events    []InstanceEvent
 }
 
 func newFakeRepository() *fakeRepository {
@@ -157,6 +202,29 @@ func (r *fakeRepository) RenewInstance(_ context.Context, instanceID int64, expi
 	return InstanceRecord{}, ErrRepositoryNotFound
 }
 
+func (r *fakeRepository) RestartInstance(_ context.Context, instanceID int64, instance Instance) (InstanceRecord, error) {
+	for key, item := range r.active {
+		if item.ID == instanceID && item.Instance.Status == "running" {
+			item.Instance.RestartCount++
+			item.Instance.Status = instance.Status
+			item.Instance.HostPort = instance.HostPort
+			item.Instance.StartedAt = instance.StartedAt
+			item.Instance.ContainerID = instance.ContainerID
+			item.Instance.ContainerName = instance.ContainerName
+			item.Instance.HostIP = instance.HostIP
+			item.Instance.Node = instance.Node
+			item.Instance.ProxyID = instance.ProxyID
+			item.Instance.UpstreamURL = instance.UpstreamURL
+			item.Instance.GatewayToken = instance.GatewayToken
+			item.Instance.AccessToken = instance.AccessToken
+			r.active[key] = item
+			r.history[key] = item
+			return item, nil
+		}
+	}
+	return InstanceRecord{}, ErrRepositoryNotFound
+}
+
 func (r *fakeRepository) TerminateInstance(_ context.Context, instanceID int64, terminatedAt time.Time) error {
 	for key, item := range r.active {
 		if item.ID == instanceID {
@@ -170,6 +238,72 @@ func (r *fakeRepository) TerminateInstance(_ context.Context, instanceID int64,
 	return ErrRepositoryNotFound
 }
 
+func (r *fakeRepository) ListWarmPoolChallengeIDs(context.Context) ([]string, error) {
+	if r.challenge.Challenge.WarmPoolSize > 0 {
+		return []string{r.challenge.Challenge.ID}, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRepository) ListDynamicChallengeIDs(context.Context) ([]string, error) {
+	if r.challenge.Challenge.Dynamic {
+		return []string{r.challenge.Challenge.ID}, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRepository) AttachInstanceContainer(_ context.Context, instanceID int64, instance Instance) error {
+	for key, item := range r.active {
+		if item.ID == instanceID && item.Instance.Status == "creating" && item.Instance.ContainerID == "" {
+			item.Instance = instance
+			r.active[key] = item
+			r.history[key] = item
+			return nil
+		}
+	}
+	return ErrRepositoryNotFound
+}
+
+func (r *fakeRepository) MarkInstanceRunning(_ context.Context, instanceID int64) error {
+	for key, item := range r.active {
+		if item.ID == instanceID && item.Instance.Status == "creating" {
+			item.Instance.Status = "running"
+			r.active[key] = item
+			r.history[key] = item
+			return nil
+		}
+	}
+	return ErrRepositoryNotFound
+}
+
+func (r *fakeRepository) FailInstance(_ context.Context, instanceID int64, failedAt time.Time, reason string) error {
+	for key, item := range r.active {
+		if item.ID == instanceID && (item.Instance.Status == "creating" || item.Instance.Status == "running") {
+			item.Instance.Status = "failed"
+			item.Instance.TerminatedAt = &failedAt
+			item.Instance.FailureReason = reason
+			delete(r.active, key)
+			r.history[key] = item
+			return nil
+		}
+	}
+	return ErrRepositoryNotFound
+}
+
+func (r *fakeRepository) ExitInstance(_ context.Context, instanceID int64, exitedAt time.Time, exitCode int) error {
+	for key, item := range r.active {
+		if item.ID == instanceID {
+			item.Instance.Status = "terminated"
+			item.Instance.TerminatedAt = &exitedAt
+			delete(r.active, key)
+			r.history[key] = item
+			r.exitCodes = append(r.exitCodes, exitCode)
+			return nil
+		}
+	}
+	return ErrRepositoryNotFound
+}
+
 func (r *fakeRepository) ListExpiredInstances(_ context.Context, now time.Time) ([]InstanceRecord, error) {
 	items := make([]InstanceRecord, 0)
 	for _, item := range r.active {
@@ -198,6 +332,25 @@ func (r *fakeRepository) CountActiveInstances(_ context.Context, challengeID str
 	return count, nil
 }
 
+func (r *fakeRepository) ListUserActiveInstances(_ context.Context, userID int64) ([]ActiveInstance, error) {
+	var items []ActiveInstance
+	for _, item := range r.active {
+		if item.Instance.UserID == userID {
+			items = append(items, ActiveInstance{ChallengeID: item.Instance.ChallengeID, Status: item.Instance.Status, MemoryMB: item.Instance.MemoryMB, ExpiresAt: item.Instance.ExpiresAt})
+		}
+	}
+	return items, nil
+}
+
+func (r *fakeRepository) GetInstanceUsage(context.Context) (InstanceUsage, error) {
+	var usage InstanceUsage
+	for _, item := range r.active {
+		usage.Instances++
+		usage.MemoryMB += item.Instance.MemoryMB
+	}
+	return usage, nil
+}
+
 func (r *fakeRepository) GetLatestInstance(_ context.Context, userID int64, challengeID string) (InstanceRecord, error) {
 	key := fmt.Sprintf("%d:%s", userID, challengeID)
 	item, ok := r.history[key]
@@ -207,6 +360,59 @@ func (r *fakeRepository) GetLatestInstance(_ context.Context, userID int64, chal
 	return item, nil
 }
 
+func (r *fakeRepository) GetInstanceByProxyID(_ context.Context, proxyID string) (InstanceRecord, error) {
+	for _, item := range r.active {
+		if item.Instance.ProxyID == proxyID {
+			return item, nil
+		}
+	}
+	return InstanceRecord{}, ErrRepositoryNotFound
+}
+
+func (r *fakeRepository) GetInstanceByGatewayToken(_ context.Context, token string) (InstanceRecord, error) {
+	for _, item := range r.active {
+		if item.Instance.GatewayToken == token {
+			return item, nil
+		}
+	}
+	return InstanceRecord{}, ErrRepositoryNotFound
+}
+
+func (r *fakeRepository) RecordInstanceEvent(_ context.Context, event InstanceEvent) error {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	event.ID = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *fakeRepository) ListInstanceEvents(_ context.Context, filter InstanceEventFilter) ([]InstanceEvent, error) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	items := make([]InstanceEvent, 0)
+	for i := len(r.events) - 1; i >= 0 && len(items) < filter.Limit; i-- {
+		event := r.events[i]
+		if (filter.InstanceID == 0 || event.InstanceID == filter.InstanceID) &&
+			(filter.ChallengeID == "" || event.ChallengeID == filter.ChallengeID) &&
+			(filter.UserID == 0 || event.UserID == filter.UserID) &&
+			(filter.Type == "" || event.Type == filter.Type) {
+			items = append(items, event)
+		}
+	}
+	return items, nil
+}
+
+// eventTypes lists the recorded event types oldest first.
+func (r *fakeRepository) eventTypes() []string {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	types := make([]string, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
 func (r *fakeRepository) ListActiveInstances(context.Context) ([]InstanceRecord, error) {
 	items := make([]InstanceRecord, 0, len(r.active))
 	for _, item := range r.active {
@@ -286,6 +492,109 @@ func TestRenewInstanceFailsWhenRenewLimitReached(t *testing.T) {
 	}
 }
 
+func TestRestartInstanceKeepsExpiryAndRenewals(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.MaxRestartCount = 1
+	repo.challenge.Challenge.UserCooldown = time.Hour
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	baseTime := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return baseTime }
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	renewed, err := service.RenewInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("renew instance: %v", err)
+	}
+
+	service.now = func() time.Time { return baseTime.Add(10 * time.Minute) }
+	restarted, err := service.RestartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("restart instance: %v", err)
+	}
+	if restarted.RestartCount != 1 || restarted.RenewCount != 1 || !restarted.ExpiresAt.Equal(renewed.ExpiresAt) {
+		t.Fatalf("expected restart to keep expiry and renewals, got %#v", restarted)
+	}
+	if manager.startCalls != 2 || len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != "container-1" {
+		t.Fatalf("expected old container replaced, starts=%d stopped=%v", manager.startCalls, manager.stoppedIDs)
+	}
+	if current := repo.active["7:1"]; current.Instance.ContainerID != "container-2" || current.Instance.Status != "running" {
+		t.Fatalf("expected record to point at the new container, got %#v", current.Instance)
+	}
+
+	if _, err := service.RestartInstance(context.Background(), 7, "1"); err != ErrInstanceRestartLimitReached {
+		t.Fatalf("expected restart limit error, got %v", err)
+	}
+}
+
+func TestRestartInstanceKeepsItsPortInTheRange(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.MaxRestartCount = 1
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080", PortMin: 20000, PortMax: 20010}, manager, repo)
+
+	first, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if _, _, err := service.StartInstance(context.Background(), 8, "1"); err != nil {
+		t.Fatalf("start second instance: %v", err)
+	}
+	restarted, err := service.RestartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("restart instance: %v", err)
+	}
+	if first.HostPort != 20000 || restarted.HostPort != first.HostPort {
+		t.Fatalf("expected the restart to keep port %d, got %d", first.HostPort, restarted.HostPort)
+	}
+}
+
+func TestRestartInstanceRequiresRunningInstance(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.MaxRestartCount = 3
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+
+	if _, err := service.RestartInstance(context.Background(), 7, "1"); err != ErrInstanceNotFound {
+		t.Fatalf("expected missing instance error, got %v", err)
+	}
+	if _, err := repo.CreateInstance(context.Background(), repo.challenge.ID, Instance{ChallengeID: "1", UserID: 7, Status: "creating"}); err != nil {
+		t.Fatalf("create claim: %v", err)
+	}
+	if _, err := service.RestartInstance(context.Background(), 7, "1"); err != ErrInstanceNotReady {
+		t.Fatalf("expected not ready error, got %v", err)
+	}
+	if manager.startCalls != 0 {
+		t.Fatalf("expected no container to be started, got %d", manager.startCalls)
+	}
+}
+
+func TestAccessURLWithoutIngressIsTheRawHostPort(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.ExposedProtocol = "tcp"
+	// The proxy serves http only, so a tcp instance without the gateway
+	// is published on a host port like in a deployment with neither.
+	service := NewService(ServiceConfig{
+		PublicBaseURL:  "https://ctf.example.com",
+		RuntimeBaseURL: "https://ctf.example.com",
+		Proxy:          ProxyConfig{Domain: "inst.example.com", Secret: "secret"},
+	}, manager, repo)
+
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if manager.lastStart.Proxied || instance.HostPort == 0 {
+		t.Fatalf("expected the instance to publish a host port, got %+v", manager.lastStart)
+	}
+	if want := fmt.Sprintf("tcp://ctf.example.com:%d", instance.HostPort); instance.AccessURL != want || instance.GatewayToken != "" {
+		t.Fatalf("expected the raw host port %q without a token, got %q (token %q)", want, instance.AccessURL, instance.GatewayToken)
+	}
+}
+
 func TestSweepExpiredStopsContainers(t *testing.T) {
 	manager := &fakeManager{}
 	repo := newFakeRepository()
@@ -317,6 +626,44 @@ func TestSweepExpiredStopsContainers(t *testing.T) {
 	}
 }
 
+func TestStopChallengeInstancesEndsInstancesAndClaims(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	service.now = func() time.Time { return time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC) }
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	running, _ := repo.GetActiveInstance(context.Background(), 7, "1")
+	service.activity.touch(running.ID, service.now())
+	claim, _ := repo.CreateInstance(context.Background(), 101, Instance{ChallengeID: "1", UserID: 8, Status: "creating"})
+	other, _ := repo.CreateInstance(context.Background(), 102, Instance{ChallengeID: "2", UserID: 7, Status: "running", ContainerID: "other"})
+
+	stopped, err := service.StopChallengeInstances(context.Background(), "1", "challenge archived by user 9")
+	if err != nil {
+		t.Fatalf("stop challenge instances: %v", err)
+	}
+	if stopped != 2 || manager.stopCalls != 1 {
+		t.Fatalf("expected the instance and the claim to end with one container stopped, got %d ended and %d stop calls", stopped, manager.stopCalls)
+	}
+	for _, item := range []InstanceRecord{running, claim} {
+		if _, err := repo.GetActiveInstance(context.Background(), item.Instance.UserID, item.Instance.ChallengeID); !errors.Is(err, ErrRepositoryNotFound) {
+			t.Fatalf("expected instance %d to be terminated, got %v", item.ID, err)
+		}
+	}
+	if _, err := repo.GetActiveInstance(context.Background(), other.Instance.UserID, other.Instance.ChallengeID); err != nil {
+		t.Fatalf("expected the instance of another challenge to stay active, got %v", err)
+	}
+	if _, ok := service.activity.seen[running.ID]; ok {
+		t.Fatalf("expected the activity of the stopped instance to be dropped")
+	}
+	last := repo.events[len(repo.events)-1]
+	if last.InstanceID != claim.ID || last.Type != EventTerminatedByAdmin || last.Detail != "challenge archived by user 9" {
+		t.Fatalf("expected a termination event, got %+v", repo.events)
+	}
+}
+
 func TestDeleteInstanceStopsContainerAndRemovesRecord(t *testing.T) {
 	manager := &fakeManager{}
 	repo := newFakeRepository()
@@ -379,6 +726,7 @@ func TestReconcileStopsOrphanManagedContainers(t *testing.T) {
 		containers: map[string]ManagedContainer{
 			"orphan-1": {ContainerID: "orphan-1", ChallengeID: "1", UserID: 77},
 		},
+		orphanNetworks: 2,
 	}
 	repo := newFakeRepository()
 	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
@@ -399,6 +747,36 @@ func TestReconcileStopsOrphanManagedContainers(t *testing.T) {
 	if len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != "orphan-1" {
 		t.Fatalf("expected orphan container to be stopped, got %#v", manager.stoppedIDs)
 	}
+	if report.RemovedNetworks != 2 {
+		t.Fatalf("expected two pruned networks, got %d", report.RemovedNetworks)
+	}
+}
+
+func TestStartInstancePassesNetworkIsolation(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", Isolation: " User "}, manager, repo)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if manager.lastStart.Isolation != NetworkIsolationUser {
+		t.Fatalf("expected user isolation on start request, got %q", manager.lastStart.Isolation)
+	}
+}
+
+func TestStartInstanceRejectsInternalChallengeWithoutProxy(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.Internal = true
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080"}, manager, repo)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != ErrInternalNetworkNeedsProxy {
+		t.Fatalf("expected internal network error, got %v", err)
+	}
+	if manager.startCalls != 0 {
+		t.Fatalf("expected no container start, got %d", manager.startCalls)
+	}
 }
 
 func TestStartInstanceFailsWhenChallengeCapacityReached(t *testing.T) {
@@ -438,6 +816,40 @@ func TestStartInstanceFailsWhenUserCooldownActive(t *testing.T) {
 	}
 }
 
+func TestStartInstanceEnforcesQuotasAcrossChallenges(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.active["7:2"] = InstanceRecord{ID: 99, Instance: Instance{ChallengeID: "2", UserID: 7, Status: "running", MemoryMB: 256}}
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080", Quotas: Quotas{UserInstances: 1}}, manager, repo)
+	ctx := context.Background()
+
+	_, _, err := service.StartInstance(ctx, 7, "1")
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, ErrInstanceQuotaExceeded) || quotaErr.Quota != QuotaUserInstances {
+		t.Fatalf("expected the instance quota, got %v", err)
+	}
+	if len(quotaErr.Active) != 1 || quotaErr.Active[0].ChallengeID != "2" {
+		t.Fatalf("expected the error to list the active instance, got %+v", quotaErr.Active)
+	}
+
+	service.cfg.Quotas = Quotas{UserInstances: 2, UserMemoryMB: 500}
+	if _, _, err := service.StartInstance(ctx, 7, "1"); !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaUserMemory || quotaErr.Used != 256 || quotaErr.Requested != 256 {
+		t.Fatalf("expected the memory budget, got %v", err)
+	}
+
+	service.cfg.Quotas = Quotas{GlobalMemoryMB: 512}
+	instance, _, err := service.StartInstance(ctx, 7, "1")
+	if err != nil {
+		t.Fatalf("start within the global budget: %v", err)
+	}
+	if repo.active["7:1"].Instance.MemoryMB != 256 {
+		t.Fatalf("expected the instance to record its memory, got %+v", instance)
+	}
+	if _, _, err := service.StartInstance(ctx, 8, "1"); !errors.As(err, &quotaErr) || !quotaErr.Global() || len(quotaErr.Active) != 0 {
+		t.Fatalf("expected the global budget, got %v", err)
+	}
+}
+
 func TestStartInstanceAllocatesPortFromPool(t *testing.T) {
 	manager := &fakeManager{}
 	repo := newFakeRepository()
@@ -463,3 +875,213 @@ func TestStartInstanceAllocatesPortFromPool(t *testing.T) {
 		t.Fatalf("expected allocated port 20001, got %d", second.HostPort)
 	}
 }
+
+func newSharedTestService(t *testing.T) (*Service, *fakeManager, *fakeRepository) {
+	t.Helper()
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.Mode = ModeShared
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	service.now = func() time.Time { return time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC) }
+	return service, manager, repo
+}
+
+func TestSharedInstanceIsStartedOnceAndServedToPlayers(t *testing.T) {
+	service, manager, _ := newSharedTestService(t)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != ErrSharedInstanceNotRunning {
+		t.Fatalf("expected players to wait for the shared instance, got %v", err)
+	}
+
+	started, created, err := service.StartSharedInstance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("start shared instance: %v", err)
+	}
+	if !created || !started.Shared {
+		t.Fatalf("expected a new shared instance, got created=%v %#v", created, started)
+	}
+	if _, created, err := service.StartSharedInstance(context.Background(), "web-welcome"); err != nil || created {
+		t.Fatalf("expected shared start to be idempotent, got created=%v err=%v", created, err)
+	}
+
+	for _, userID := range []int64{7, 8} {
+		instance, created, err := service.StartInstance(context.Background(), userID, "1")
+		if err != nil {
+			t.Fatalf("start for user %d: %v", userID, err)
+		}
+		if created || instance.ContainerID != started.ContainerID {
+			t.Fatalf("expected user %d to receive the shared instance, got %#v", userID, instance)
+		}
+	}
+	if manager.startCalls != 1 {
+		t.Fatalf("expected one runtime start call, got %d", manager.startCalls)
+	}
+	if _, err := service.RenewInstance(context.Background(), 7, "1"); err != ErrSharedInstanceReadOnly {
+		t.Fatalf("expected renew to be rejected, got %v", err)
+	}
+	if _, err := service.DeleteInstance(context.Background(), 7, "1"); err != ErrSharedInstanceReadOnly {
+		t.Fatalf("expected delete to be rejected, got %v", err)
+	}
+}
+
+func TestSweepExpiredSkipsSharedInstances(t *testing.T) {
+	service, manager, _ := newSharedTestService(t)
+	if _, _, err := service.StartSharedInstance(context.Background(), "1"); err != nil {
+		t.Fatalf("start shared instance: %v", err)
+	}
+	service.now = func() time.Time { return time.Date(2025, time.March, 9, 9, 0, 0, 0, time.UTC) }
+
+	terminated, err := service.SweepExpired(context.Background())
+	if err != nil {
+		t.Fatalf("sweep expired: %v", err)
+	}
+	if terminated != 0 || manager.stopCalls != 0 {
+		t.Fatalf("expected shared instance to survive sweep, terminated=%d stops=%d", terminated, manager.stopCalls)
+	}
+}
+
+func TestReconcileRelaunchesMissingSharedInstanceOnSamePort(t *testing.T) {
+	service, manager, _ := newSharedTestService(t)
+	started, _, err := service.StartSharedInstance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("start shared instance: %v", err)
+	}
+	manager.missingIDs = map[string]bool{started.ContainerID: true}
+
+	report, err := service.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.TerminatedRecords != 1 || report.RestartedShared != 1 {
+		t.Fatalf("expected shared instance to be relaunched, got %#v", report)
+	}
+	current, err := service.SharedInstance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("load shared instance: %v", err)
+	}
+	if current.ContainerID == started.ContainerID || current.HostPort != started.HostPort {
+		t.Fatalf("expected new container on port %d, got %#v", started.HostPort, current)
+	}
+}
+
+func TestRestartSharedInstanceKeepsPort(t *testing.T) {
+	service, manager, _ := newSharedTestService(t)
+	started, _, err := service.StartSharedInstance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("start shared instance: %v", err)
+	}
+
+	restarted, err := service.RestartSharedInstance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("restart shared instance: %v", err)
+	}
+	if restarted.ContainerID == started.ContainerID || restarted.HostPort != started.HostPort {
+		t.Fatalf("expected new container on port %d, got %#v", started.HostPort, restarted)
+	}
+	if len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != started.ContainerID {
+		t.Fatalf("expected old container to be stopped, got %#v", manager.stoppedIDs)
+	}
+
+	if _, err := service.StopSharedInstance(context.Background(), "1"); err != nil {
+		t.Fatalf("stop shared instance: %v", err)
+	}
+	if _, err := service.SharedInstance(context.Background(), "1"); err != ErrSharedInstanceNotRunning {
+		t.Fatalf("expected stopped shared instance, got %v", err)
+	}
+}
+
+func TestSharedInstanceRejectsPerUserChallenge(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{PublicBaseURL: "http://localhost:8080", RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+
+	if _, _, err := service.StartSharedInstance(context.Background(), "1"); err != ErrChallengeNotShared {
+		t.Fatalf("expected not shared error, got %v", err)
+	}
+}
+
+func newReadinessTestService(t *testing.T, probeErr chan error) (*Service, *fakeManager, *fakeRepository) {
+	t.Helper()
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.Readiness = ReadinessProbe{Type: ReadinessHTTP, Path: "/health", ExpectedStatus: 200, TimeoutSeconds: 30}
+	service := NewService(ServiceConfig{RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	service.probe = func(context.Context, ChallengeConfig, string) error { return <-probeErr }
+	return service, manager, repo
+}
+
+func TestStartInstanceStaysCreatingUntilReady(t *testing.T) {
+	probeErr := make(chan error)
+	service, _, _ := newReadinessTestService(t, probeErr)
+
+	instance, created, err := service.StartInstance(context.Background(), 42, "1")
+	if err != nil || !created {
+		t.Fatalf("start instance: created=%v err=%v", created, err)
+	}
+	if instance.Status != "creating" || instance.AccessURL != "" || instance.ReadyDeadline == nil {
+		t.Fatalf("expected creating instance without access url, got %+v", instance)
+	}
+
+	probeErr <- nil
+	service.probes.Wait()
+
+	current, err := service.GetInstance(context.Background(), 42, "1")
+	if err != nil {
+		t.Fatalf("get instance: %v", err)
+	}
+	if current.Status != "running" || current.AccessURL == "" || current.ReadyDeadline != nil {
+		t.Fatalf("expected running instance with access url, got %+v", current)
+	}
+}
+
+func TestStartInstanceTearsDownWhenNotReady(t *testing.T) {
+	probeErr := make(chan error, 1)
+	service, manager, repo := newReadinessTestService(t, probeErr)
+	repo.challenge.Challenge.UserCooldown = time.Hour
+
+	instance, _, err := service.StartInstance(context.Background(), 42, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	probeErr <- fmt.Errorf("connection refused")
+	service.probes.Wait()
+
+	if len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != instance.ContainerID {
+		t.Fatalf("expected container to be stopped, got %v", manager.stoppedIDs)
+	}
+	if _, err := service.GetInstance(context.Background(), 42, "1"); err != ErrInstanceReadinessFailed {
+		t.Fatalf("expected readiness failure, got %v", err)
+	}
+
+	probeErr <- nil
+	if _, created, err := service.StartInstance(context.Background(), 42, "1"); err != nil || !created {
+		t.Fatalf("expected failed start to skip cooldown, created=%v err=%v", created, err)
+	}
+	service.probes.Wait()
+}
+
+func TestReconcileFailsAbandonedCreatingInstances(t *testing.T) {
+	service, manager, repo := newReadinessTestService(t, nil)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	manager.containers = map[string]ManagedContainer{"stuck": {ContainerID: "stuck", ChallengeID: "1", UserID: 42}}
+	repo.active["42:1"] = InstanceRecord{ID: 9, Instance: Instance{
+		ChallengeID: "1",
+		UserID:      42,
+		Status:      "creating",
+		ContainerID: "stuck",
+		StartedAt:   now.Add(-time.Hour),
+		ExpiresAt:   now.Add(time.Hour),
+	}}
+
+	report, err := service.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.TerminatedRecords != 1 || repo.history["42:1"].Instance.Status != "failed" {
+		t.Fatalf("expected abandoned instance to fail, report=%+v history=%+v", report, repo.history["42:1"])
+	}
+	if len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != "stuck" {
+		t.Fatalf("expected stuck container to be stopped, got %v", manager.stoppedIDs)
+	}
+}
@@ -0,0 +1,76 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// EntrypointAlias is the DNS name of the exposed container inside a
+	// multi-container group.
+	EntrypointAlias = "app"
+
+	maxGroupServices = 8
+)
+
+var serviceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,30}[a-z0-9]$`)
+
+// ServiceSpec is a companion container of a multi-container challenge, such
+// as a database or an admin bot. Companions start in list order before the
+// entrypoint and are reachable from the rest of the group by Name.
+type ServiceSpec struct {
+	Name          string            `json:"name"`
+	Image         string            `json:"image"`
+	Env           map[string]string `json:"env,omitempty"`
+	Command       []string          `json:"command,omitempty"`
+	MemoryLimitMB int               `json:"memory_limit_mb,omitempty"`
+	CPUMilli      int               `json:"cpu_limit_millicores,omitempty"`
+}
+
+// NormalizeServices validates companion services and trims their fields.
+func NormalizeServices(services []ServiceSpec) ([]ServiceSpec, error) {
+	if len(services) == 0 {
+		return nil, nil
+	}
+	if len(services) > maxGroupServices {
+		return nil, fmt.Errorf("at most %d services are allowed", maxGroupServices)
+	}
+
+	seen := make(map[string]bool, len(services))
+	normalized := make([]ServiceSpec, 0, len(services))
+	for _, service := range services {
+		service.Name = strings.ToLower(strings.TrimSpace(service.Name))
+		service.Image = strings.TrimSpace(service.Image)
+		if !serviceNamePattern.MatchString(service.Name) {
+			return nil, fmt.Errorf("service name %q must be a lowercase DNS label", service.Name)
+		}
+		if service.Name == EntrypointAlias {
+			return nil, fmt.Errorf("service name %q is reserved for the entrypoint", EntrypointAlias)
+		}
+		if seen[service.Name] {
+			return nil, fmt.Errorf("service name %q is duplicated", service.Name)
+		}
+		seen[service.Name] = true
+		if service.Image == "" {
+			return nil, fmt.Errorf("service %s requires an image", service.Name)
+		}
+		if service.MemoryLimitMB < 0 || service.CPUMilli < 0 {
+			return nil, fmt.Errorf("service %s resource limits cannot be negative", service.Name)
+		}
+		if len(service.Env) == 0 {
+			service.Env = nil
+		}
+		if len(service.Command) == 0 {
+			service.Command = nil
+		}
+		normalized = append(normalized, service)
+	}
+	return normalized, nil
+}
+
+// IsGroup reports whether the challenge runs companion services next to its
+// entrypoint.
+func (c ChallengeConfig) IsGroup() bool {
+	return len(c.Services) > 0
+}
@@ -0,0 +1,202 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// sharedInstanceExpiry is the expires_at stored for shared instances. They run
+// until an administrator stops them, so the expiry sweep must never pick them up.
+var sharedInstanceExpiry = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+func (s *Service) SharedInstance(ctx context.Context, challengeRef string) (Instance, error) {
+	record, err := s.sharedChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		return Instance{}, err
+	}
+	return s.activeSharedInstance(ctx, record.Challenge, SharedOwnerID)
+}
+
+func (s *Service) StartSharedInstance(ctx context.Context, challengeRef string) (Instance, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.sharedChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		return Instance{}, false, err
+	}
+	if existing, err := s.activeSharedInstance(ctx, record.Challenge, SharedOwnerID); err == nil {
+		return existing, false, nil
+	} else if !errors.Is(err, ErrSharedInstanceNotRunning) {
+		return Instance{}, false, err
+	}
+
+	instance, err := s.launchSharedInstance(ctx, record, Instance{})
+	if err != nil {
+		return Instance{}, false, err
+	}
+	return instance, true, nil
+}
+
+func (s *Service) StopSharedInstance(ctx context.Context, challengeRef string) (Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.sharedChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		return Instance{}, err
+	}
+	return s.stopSharedInstance(ctx, record.Challenge)
+}
+
+func (s *Service) RestartSharedInstance(ctx context.Context, challengeRef string) (Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.sharedChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		return Instance{}, err
+	}
+	stopped, err := s.stopSharedInstance(ctx, record.Challenge)
+	if err != nil && !errors.Is(err, ErrSharedInstanceNotRunning) {
+		return Instance{}, err
+	}
+	return s.launchSharedInstance(ctx, record, stopped)
+}
+
+func (s *Service) sharedChallengeConfig(ctx context.Context, challengeRef string) (RuntimeConfigRecord, error) {
+	record, err := s.repo.GetChallengeConfig(ctx, challengeRef)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return RuntimeConfigRecord{}, ErrChallengeNotFound
+		}
+		return RuntimeConfigRecord{}, err
+	}
+	cfg := record.Challenge
+	if !cfg.Dynamic {
+		return RuntimeConfigRecord{}, ErrChallengeNotDynamic
+	}
+	if record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 {
+		return RuntimeConfigRecord{}, ErrRuntimeConfigMissing
+	}
+	if !cfg.IsShared() {
+		return RuntimeConfigRecord{}, ErrChallengeNotShared
+	}
+	return record, nil
+}
+
+func (s *Service) activeSharedInstance(ctx context.Context, cfg ChallengeConfig, viewerID int64) (Instance, error) {
+	record, err := s.repo.GetActiveInstance(ctx, SharedOwnerID, cfg.ID)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return Instance{}, ErrSharedInstanceNotRunning
+		}
+		return Instance{}, err
+	}
+	return s.decorateSharedInstance(cfg, record.Instance, viewerID), nil
+}
+
+// launchSharedInstance starts a new shared container. previous is the instance
+// being replaced, if any, so its port, proxy subdomain and tokens can be reused
+// and links players already opened keep working.
+func (s *Service) launchSharedInstance(ctx context.Context, record RuntimeConfigRecord, previous Instance) (Instance, error) {
+	cfg := record.Challenge
+	started, hostPort, err := s.startContainer(ctx, StartRequest{UserID: SharedOwnerID, Config: cfg}, previous.HostPort, 0)
+	if err != nil {
+		return Instance{}, err
+	}
+	proxyID, upstreamURL, err := s.proxyRoute(cfg, started, previous.ProxyID)
+	if err != nil {
+		_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+		return Instance{}, err
+	}
+	gatewayToken, err := s.gatewayToken(cfg, previous.GatewayToken)
+	if err != nil {
+		_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+		return Instance{}, err
+	}
+	accessToken := previous.AccessToken
+	if accessToken == "" {
+		if accessToken, err = newRouteID(); err != nil {
+			_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+			return Instance{}, err
+		}
+	}
+
+	now := s.now().UTC()
+	saved, err := s.repo.CreateInstance(ctx, record.ID, Instance{
+		ChallengeID:   cfg.ID,
+		UserID:        SharedOwnerID,
+		Status:        initialStatus(cfg),
+		HostPort:      hostPort,
+		StartedAt:     now,
+		ExpiresAt:     sharedInstanceExpiry,
+		ContainerID:   started.ContainerID,
+		ContainerName: started.ContainerName,
+		HostIP:        started.HostIP,
+		Node:          started.Node,
+		ProxyID:       proxyID,
+		UpstreamURL:   upstreamURL,
+		GatewayToken:  gatewayToken,
+		AccessToken:   accessToken,
+		MemoryMB:      cfg.reservation().MemoryMB,
+	})
+	if err != nil {
+		_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+		return Instance{}, err
+	}
+	s.recordEvent(ctx, saved, EventCreated, "")
+	if saved.Instance.Status == "running" {
+		s.recordEvent(ctx, saved, EventReady, "")
+	}
+	s.watchReadiness(cfg, saved)
+	return s.decorateSharedInstance(cfg, saved.Instance, SharedOwnerID), nil
+}
+
+func (s *Service) stopSharedInstance(ctx context.Context, cfg ChallengeConfig) (Instance, error) {
+	record, err := s.repo.GetActiveInstance(ctx, SharedOwnerID, cfg.ID)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return Instance{}, ErrSharedInstanceNotRunning
+		}
+		return Instance{}, err
+	}
+	if err := s.manager.Stop(ctx, record.Instance.Node, record.Instance.ContainerID); err != nil {
+		return Instance{}, err
+	}
+	now := s.now().UTC()
+	if err := s.repo.TerminateInstance(ctx, record.ID, now); err != nil {
+		return Instance{}, err
+	}
+	s.recordEvent(ctx, record, EventTerminatedByAdmin, "")
+	record.Instance.Status = "terminated"
+	record.Instance.TerminatedAt = &now
+	return s.decorateSharedInstance(cfg, record.Instance, SharedOwnerID), nil
+}
+
+// relaunchSharedInstance replaces a shared container that disappeared outside
+// the platform. Challenges that are no longer published or no longer shared
+// are left stopped.
+func (s *Service) relaunchSharedInstance(ctx context.Context, item InstanceRecord) (bool, error) {
+	record, err := s.repo.GetChallengeConfig(ctx, item.Instance.ChallengeID)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	cfg := record.Challenge
+	if !cfg.Dynamic || !cfg.IsShared() || record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 {
+		return false, nil
+	}
+	if _, err := s.launchSharedInstance(ctx, record, item.Instance); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Service) decorateSharedInstance(cfg ChallengeConfig, instance Instance, viewerID int64) Instance {
+	instance.Shared = true
+	return s.present(cfg, instance, viewerID)
+}
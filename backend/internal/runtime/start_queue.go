@@ -0,0 +1,291 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	FailureStartFailed    = "start_failed"
+	FailurePortExhausted  = "port_exhausted"
+	FailureStartQueueFull = "start_queue_full"
+
+	defaultStartQueueSize = 256
+	provisionTimeout      = 2 * time.Minute
+	// Claimed instances this process is not provisioning are failed by
+	// Reconcile once they are this old, e.g. after the API restarted with
+	// starts still queued.
+	claimAbandonTimeout = 10 * time.Minute
+)
+
+type startJob struct {
+	cfg    ChallengeConfig
+	record InstanceRecord
+}
+
+// startQueue hands claimed instances to a fixed pool of workers so that one
+// slow Docker start does not hold up every other player's request.
+type startQueue struct {
+	jobs chan startJob
+
+	mu       sync.Mutex
+	waiting  []string
+	inFlight map[string]struct{}
+}
+
+func newStartQueue(size int) *startQueue {
+	if size <= 0 {
+		size = defaultStartQueueSize
+	}
+	return &startQueue{
+		jobs:     make(chan startJob, size),
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+func (q *startQueue) push(job startJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.jobs <- job:
+		q.waiting = append(q.waiting, jobKey(job))
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *startQueue) take(job startJob) {
+	key := jobKey(job)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if index := slices.Index(q.waiting, key); index >= 0 {
+		q.waiting = slices.Delete(q.waiting, index, index+1)
+	}
+	q.inFlight[key] = struct{}{}
+}
+
+func (q *startQueue) done(job startJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, jobKey(job))
+}
+
+// position is the 1-based place of a waiting start, or 0 once a worker has
+// picked it up.
+func (q *startQueue) position(challengeID string, userID int64) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Index(q.waiting, managedContainerKey(challengeID, userID)) + 1
+}
+
+func (q *startQueue) tracks(challengeID string, userID int64) bool {
+	if q == nil {
+		return false
+	}
+	key := managedContainerKey(challengeID, userID)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, busy := q.inFlight[key]
+	return busy || slices.Contains(q.waiting, key)
+}
+
+func jobKey(job startJob) string {
+	return managedContainerKey(job.record.Instance.ChallengeID, job.record.Instance.UserID)
+}
+
+// RunStartWorkers provisions queued starts until ctx is done. It is a no-op
+// when the service provisions inside the request.
+func (s *Service) RunStartWorkers(ctx context.Context) {
+	if s.queue == nil {
+		return
+	}
+	var workers sync.WaitGroup
+	for range s.cfg.StartWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue.jobs:
+					s.queue.take(job)
+					s.runStartJob(job)
+					s.queue.done(job)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+}
+
+func (s *Service) runStartJob(job startJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+	defer cancel()
+
+	// Skip claims the player deleted while they were waiting.
+	current, err := s.repo.GetActiveInstance(ctx, job.record.Instance.UserID, job.record.Instance.ChallengeID)
+	if err != nil || current.ID != job.record.ID || current.Instance.ContainerID != "" {
+		return
+	}
+	_, _ = s.provision(ctx, job.cfg, job.record)
+}
+
+// claimInstance records a creating instance with no container yet. The unique
+// active-instance index rejects a second claim for the same player, so only
+// the capacity and cooldown checks need to be serialized.
+func (s *Service) claimInstance(ctx context.Context, userID int64, record RuntimeConfigRecord) (InstanceRecord, error) {
+	s.admit.Lock()
+	defer s.admit.Unlock()
+
+	cfg := record.Challenge
+	if cfg.MaxActiveInstances > 0 {
+		activeCount, err := s.repo.CountActiveInstances(ctx, cfg.ID)
+		if err != nil {
+			return InstanceRecord{}, err
+		}
+		if activeCount >= cfg.MaxActiveInstances {
+			return InstanceRecord{}, ErrInstanceCapacityReached
+		}
+	}
+
+	if err := s.checkQuotas(ctx, userID, cfg); err != nil {
+		return InstanceRecord{}, err
+	}
+
+	if cfg.UserCooldown > 0 {
+		latest, err := s.repo.GetLatestInstance(ctx, userID, cfg.ID)
+		if err != nil && !errors.Is(err, ErrRepositoryNotFound) {
+			return InstanceRecord{}, err
+		}
+		// A start the platform gave up on does not count.
+		if err == nil && !failedByPlatform(latest.Instance) {
+			nextAllowedAt := latest.Instance.StartedAt.Add(cfg.UserCooldown)
+			if nextAllowedAt.After(s.now().UTC()) {
+				return InstanceRecord{}, ErrInstanceCooldownActive
+			}
+		}
+	}
+
+	accessToken, err := newRouteID()
+	if err != nil {
+		return InstanceRecord{}, err
+	}
+	now := s.now().UTC()
+	claim, err := s.repo.CreateInstance(ctx, record.ID, Instance{
+		ChallengeID: cfg.ID,
+		UserID:      userID,
+		Status:      "creating",
+		StartedAt:   now,
+		ExpiresAt:   now.Add(cfg.TTL),
+		MemoryMB:    cfg.reservation().MemoryMB,
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return InstanceRecord{}, err
+	}
+	s.recordEvent(ctx, claim, EventCreated, "")
+	return claim, nil
+}
+
+// provision gives a claimed instance a warm container or starts a new one,
+// and attaches it to the record. A start that fails marks the claim failed.
+func (s *Service) provision(ctx context.Context, cfg ChallengeConfig, claim InstanceRecord) (InstanceRecord, error) {
+	if warm, ok := s.takeWarm(cfg); ok {
+		defer s.pool.settle(warm.started.ContainerID)
+		return s.attach(ctx, cfg, claim, warm.started, warm.hostPort)
+	}
+	started, hostPort, err := s.startContainer(ctx, StartRequest{UserID: claim.Instance.UserID, Config: cfg}, 0, 0)
+	if err != nil {
+		reason := FailureStartFailed
+		if errors.Is(err, ErrInstancePortExhausted) {
+			reason = FailurePortExhausted
+		}
+		s.failInstance(context.Background(), claim, reason, err)
+		return InstanceRecord{}, err
+	}
+	return s.attach(ctx, cfg, claim, started, hostPort)
+}
+
+// attach records a running container as the claimed instance. A claim that
+// was deleted meanwhile gets its container stopped again.
+func (s *Service) attach(ctx context.Context, cfg ChallengeConfig, claim InstanceRecord, started StartedContainer, hostPort int) (InstanceRecord, error) {
+	pending := claim
+	proxyID, upstreamURL, err := s.proxyRoute(cfg, started, "")
+	if err == nil {
+		var gatewayToken string
+		gatewayToken, err = s.gatewayToken(cfg, "")
+		if err == nil {
+			now := s.now().UTC()
+			claim.Instance.Status = initialStatus(cfg)
+			claim.Instance.HostPort = hostPort
+			claim.Instance.StartedAt = now
+			claim.Instance.ExpiresAt = now.Add(cfg.TTL)
+			claim.Instance.ContainerID = started.ContainerID
+			claim.Instance.ContainerName = started.ContainerName
+			claim.Instance.HostIP = started.HostIP
+			claim.Instance.Node = started.Node
+			claim.Instance.ProxyID = proxyID
+			claim.Instance.UpstreamURL = upstreamURL
+			claim.Instance.GatewayToken = gatewayToken
+			err = s.repo.AttachInstanceContainer(ctx, claim.ID, claim.Instance)
+		}
+	}
+	if err != nil {
+		_ = s.manager.Stop(context.Background(), started.Node, started.ContainerID)
+		if errors.Is(err, ErrRepositoryNotFound) {
+			return InstanceRecord{}, ErrInstanceNotFound
+		}
+		s.failInstance(context.Background(), pending, FailureStartFailed, err)
+		return InstanceRecord{}, err
+	}
+
+	if claim.Instance.Status == "running" {
+		s.recordEvent(ctx, claim, EventReady, "")
+	}
+	s.watchReadiness(cfg, claim)
+	return claim, nil
+}
+
+// claimAbandoned reports whether a claim without a container is no longer
+// being provisioned by anyone.
+func (s *Service) claimAbandoned(item InstanceRecord, now time.Time) bool {
+	if s.queue.tracks(item.Instance.ChallengeID, item.Instance.UserID) {
+		return false
+	}
+	return now.After(item.Instance.StartedAt.Add(claimAbandonTimeout))
+}
+
+// failedByPlatform reports whether an instance was given up on by the
+// platform rather than stopped by its player. An instance killed for its
+// resource usage was running and counts as the player's.
+func failedByPlatform(instance Instance) bool {
+	return instance.Status == "failed" && instance.FailureReason != "" && instance.FailureReason != FailureResourceLimit
+}
+
+// failureError is what a player sees for their most recent start when it
+// failed without them ever getting an instance.
+func failureError(instance Instance) error {
+	if instance.Status != "failed" {
+		return nil
+	}
+	switch instance.FailureReason {
+	case FailureReadinessProbe:
+		return ErrInstanceReadinessFailed
+	case FailurePortExhausted:
+		return ErrInstancePortExhausted
+	case FailureStartFailed:
+		return ErrInstanceStartFailed
+	case FailureResourceLimit:
+		return ErrInstanceResourceLimit
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newQueuedTestService(queueSize int) (*Service, *fakeManager, *fakeRepository) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	service := NewService(ServiceConfig{RuntimeBaseURL: "http://localhost:8080", StartWorkers: 1, StartQueueSize: queueSize}, manager, repo)
+	return service, manager, repo
+}
+
+// runNextStart does what a start worker does for the oldest queued start.
+func runNextStart(service *Service) {
+	job := <-service.queue.jobs
+	service.queue.take(job)
+	service.runStartJob(job)
+	service.queue.done(job)
+}
+
+func TestStartInstanceQueuesStartsInOrder(t *testing.T) {
+	service, manager, _ := newQueuedTestService(4)
+
+	first, created, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil || !created {
+		t.Fatalf("start instance: created=%v err=%v", created, err)
+	}
+	if first.Status != "creating" || first.QueuePosition != 1 || first.AccessURL != "" {
+		t.Fatalf("expected first start to wait at position 1, got %+v", first)
+	}
+	second, _, err := service.StartInstance(context.Background(), 8, "1")
+	if err != nil || second.QueuePosition != 2 {
+		t.Fatalf("expected second start at position 2, got %+v err=%v", second, err)
+	}
+	again, created, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil || created || again.QueuePosition != 1 {
+		t.Fatalf("expected repeated start to reuse the queued claim, got %+v created=%v err=%v", again, created, err)
+	}
+	if manager.startCalls != 0 {
+		t.Fatalf("expected no container before a worker runs, got %d starts", manager.startCalls)
+	}
+
+	runNextStart(service)
+
+	current, err := service.GetInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("get instance: %v", err)
+	}
+	if current.Status != "running" || current.AccessURL == "" || current.QueuePosition != 0 {
+		t.Fatalf("expected provisioned instance, got %+v", current)
+	}
+	waiting, err := service.GetInstance(context.Background(), 8, "1")
+	if err != nil || waiting.QueuePosition != 1 {
+		t.Fatalf("expected remaining start to move up, got %+v err=%v", waiting, err)
+	}
+}
+
+func TestStartInstanceRejectsWhenQueueIsFull(t *testing.T) {
+	service, _, repo := newQueuedTestService(1)
+	repo.challenge.Challenge.UserCooldown = time.Hour
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if _, _, err := service.StartInstance(context.Background(), 8, "1"); err != ErrStartQueueFull {
+		t.Fatalf("expected full queue, got %v", err)
+	}
+	if got := repo.history["8:1"].Instance; got.Status != "failed" || got.FailureReason != FailureStartQueueFull {
+		t.Fatalf("expected rejected claim to be failed, got %+v", got)
+	}
+
+	runNextStart(service)
+	if _, created, err := service.StartInstance(context.Background(), 8, "1"); err != nil || !created {
+		t.Fatalf("expected retry to skip cooldown, created=%v err=%v", created, err)
+	}
+}
+
+func TestDeletedQueuedStartIsNotProvisioned(t *testing.T) {
+	service, manager, _ := newQueuedTestService(4)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if _, err := service.DeleteInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("delete instance: %v", err)
+	}
+	runNextStart(service)
+
+	if manager.startCalls != 0 {
+		t.Fatalf("expected deleted claim to be skipped, got %d starts", manager.startCalls)
+	}
+}
+
+func TestReconcileFailsAbandonedClaims(t *testing.T) {
+	service, _, repo := newQueuedTestService(4)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	repo.active["42:1"] = InstanceRecord{ID: 9, Instance: Instance{
+		ChallengeID: "1",
+		UserID:      42,
+		Status:      "creating",
+		StartedAt:   now.Add(-time.Hour),
+		ExpiresAt:   now.Add(time.Hour),
+	}}
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+
+	report, err := service.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.TerminatedRecords != 1 || repo.history["42:1"].Instance.FailureReason != FailureStartFailed {
+		t.Fatalf("expected abandoned claim to fail, report=%+v history=%+v", report, repo.history["42:1"])
+	}
+	if repo.active["7:1"].Instance.Status != "creating" {
+		t.Fatalf("expected queued claim to be left alone, got %+v", repo.active["7:1"])
+	}
+}
+
+func TestStopChallengeInstancesEndsQueuedStarts(t *testing.T) {
+	service, manager, repo := newQueuedTestService(4)
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	stopped, err := service.StopChallengeInstances(context.Background(), "1", "challenge archived by user 9")
+	if err != nil || stopped != 1 {
+		t.Fatalf("expected the queued start to end, got %d (%v)", stopped, err)
+	}
+
+	runNextStart(service)
+
+	if manager.startCalls != 0 {
+		t.Fatalf("expected the worker to skip the ended claim, got %d starts", manager.startCalls)
+	}
+	if history := repo.history["7:1"]; history.Instance.Status != "terminated" {
+		t.Fatalf("expected the claim to stay terminated, got %+v", history.Instance)
+	}
+}
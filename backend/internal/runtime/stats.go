@@ -0,0 +1,331 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// FailureResourceLimit is recorded on instances killed because their
+	// usage stayed above a configured limit.
+	FailureResourceLimit = "resource_limit_exceeded"
+
+	defaultStatsSustain = 5 * time.Minute
+	statsWorkers        = 8
+)
+
+// StatsLimits kill instances whose usage stays above a threshold for Sustain.
+// A zero threshold is not enforced. CPUPercent counts one fully used core as
+// 100; MemoryPercent is relative to the container memory limit.
+type StatsLimits struct {
+	CPUPercent    float64
+	MemoryPercent float64
+	PIDs          int
+	Sustain       time.Duration
+}
+
+func (l StatsLimits) enabled() bool {
+	return l.CPUPercent > 0 || l.MemoryPercent > 0 || l.PIDs > 0
+}
+
+func (l StatsLimits) exceeded(stats ContainerStats) bool {
+	if l.CPUPercent > 0 && stats.CPUPercent > l.CPUPercent {
+		return true
+	}
+	if l.MemoryPercent > 0 && stats.MemoryLimitBytes > 0 && float64(stats.MemoryBytes)*100/float64(stats.MemoryLimitBytes) > l.MemoryPercent {
+		return true
+	}
+	return l.PIDs > 0 && stats.PIDs > uint64(l.PIDs)
+}
+
+func normalizeStatsLimits(limits StatsLimits) StatsLimits {
+	if limits.CPUPercent < 0 {
+		limits.CPUPercent = 0
+	}
+	if limits.MemoryPercent < 0 {
+		limits.MemoryPercent = 0
+	}
+	if limits.PIDs < 0 {
+		limits.PIDs = 0
+	}
+	if limits.Sustain <= 0 {
+		limits.Sustain = defaultStatsSustain
+	}
+	return limits
+}
+
+// ContainerStats is one sample of a container's resource usage.
+type ContainerStats struct {
+	CPUPercent       float64   `json:"cpu_percent"`
+	MemoryBytes      uint64    `json:"memory_bytes"`
+	MemoryLimitBytes uint64    `json:"memory_limit_bytes"`
+	NetworkRxBytes   uint64    `json:"network_rx_bytes"`
+	NetworkTxBytes   uint64    `json:"network_tx_bytes"`
+	PIDs             uint64    `json:"pids"`
+	SampledAt        time.Time `json:"sampled_at"`
+}
+
+func (c ContainerStats) add(other ContainerStats) ContainerStats {
+	c.CPUPercent += other.CPUPercent
+	c.MemoryBytes += other.MemoryBytes
+	c.MemoryLimitBytes += other.MemoryLimitBytes
+	c.NetworkRxBytes += other.NetworkRxBytes
+	c.NetworkTxBytes += other.NetworkTxBytes
+	c.PIDs += other.PIDs
+	if other.SampledAt.After(c.SampledAt) {
+		c.SampledAt = other.SampledAt
+	}
+	return c
+}
+
+// StatsReport summarizes one sampling pass. Nodes holds the summed usage of
+// the instances sampled on each Docker node.
+type StatsReport struct {
+	Sampled   int
+	Failed    int
+	Killed    int
+	Instances map[string]int
+	Nodes     map[string]ContainerStats
+}
+
+type statsSample struct {
+	stats     ContainerStats
+	overSince time.Time
+}
+
+// statsTracker keeps the latest sample of every active instance.
+type statsTracker struct {
+	mu      sync.Mutex
+	samples map[int64]statsSample
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{samples: make(map[int64]statsSample)}
+}
+
+// record stores a sample and returns since when the instance has been over
+// its limits, or the zero time when it is not.
+func (t *statsTracker) record(instanceID int64, stats ContainerStats, over bool) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sample := t.samples[instanceID]
+	sample.stats = stats
+	switch {
+	case !over:
+		sample.overSince = time.Time{}
+	case sample.overSince.IsZero():
+		sample.overSince = stats.SampledAt
+	}
+	t.samples[instanceID] = sample
+	return sample.overSince
+}
+
+// retain drops samples of instances that are no longer active.
+func (t *statsTracker) retain(active map[int64]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.samples {
+		if !active[id] {
+			delete(t.samples, id)
+		}
+	}
+}
+
+func (t *statsTracker) forget(instanceID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.samples, instanceID)
+}
+
+func (t *statsTracker) snapshot() map[int64]ContainerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	items := make(map[int64]ContainerStats, len(t.samples))
+	for id, sample := range t.samples {
+		items[id] = sample.stats
+	}
+	return items
+}
+
+// InstanceStats returns the latest sample of every active instance by
+// instance id.
+func (s *Service) InstanceStats() map[int64]ContainerStats {
+	return s.stats.snapshot()
+}
+
+// SampleStats reads the resource usage of every running instance and kills
+// player instances that stayed above the configured limits for too long.
+// Shared instances are sampled but left to administrators.
+func (s *Service) SampleStats(ctx context.Context) (StatsReport, error) {
+	report := StatsReport{Instances: make(map[string]int), Nodes: make(map[string]ContainerStats)}
+	records, err := s.repo.ListActiveInstances(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	type result struct {
+		record InstanceRecord
+		stats  ContainerStats
+		err    error
+	}
+	running := make([]InstanceRecord, 0, len(records))
+	active := make(map[int64]bool, len(records))
+	for _, item := range records {
+		if item.Instance.Status != "running" || item.Instance.ContainerID == "" {
+			continue
+		}
+		running = append(running, item)
+		active[item.ID] = true
+	}
+	s.stats.retain(active)
+
+	results := make([]result, len(running))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(statsWorkers, len(running)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item := running[i]
+				stats, err := s.manager.Stats(ctx, item.Instance.Node, item.Instance.ContainerID)
+				results[i] = result{record: item, stats: stats, err: err}
+			}
+		}()
+	}
+	for i := range running {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	limits := s.cfg.StatsLimits
+	for _, res := range results {
+		if res.err != nil {
+			// Containers that are gone are cleaned up by Reconcile.
+			if !errors.Is(res.err, ErrInstanceNotFound) {
+				report.Failed++
+			}
+			s.stats.forget(res.record.ID)
+			continue
+		}
+		report.Sampled++
+		node := res.record.Instance.Node
+		report.Instances[node]++
+		report.Nodes[node] = report.Nodes[node].add(res.stats)
+
+		over := limits.enabled() && res.record.Instance.UserID != SharedOwnerID && limits.exceeded(res.stats)
+		overSince := s.stats.record(res.record.ID, res.stats, over)
+		s.activity.observe(res.record, res.stats)
+		if over && res.stats.SampledAt.Sub(overSince) >= limits.Sustain {
+			s.failInstance(ctx, res.record, FailureResourceLimit, fmt.Errorf("cpu %.1f%%, memory %d of %d bytes, %d pids since %s",
+				res.stats.CPUPercent, res.stats.MemoryBytes, res.stats.MemoryLimitBytes, res.stats.PIDs, overSince.Format(time.RFC3339)))
+			s.stats.forget(res.record.ID)
+			report.Killed++
+		}
+	}
+	return report, nil
+}
+
+// Stats samples the resource usage of a container.
+func (p *NodePool) Stats(ctx context.Context, nodeName, containerID string) (ContainerStats, error) {
+	node := p.node(nodeName)
+	if node == nil {
+		return ContainerStats{}, ErrNodeNotFound
+	}
+	return node.manager.Stats(ctx, containerID)
+}
+
+type dockerStats struct {
+	Read     time.Time `json:"read"`
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage  uint64   `json:"total_usage"`
+			PercpuUsage []uint64 `json:"percpu_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint32 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	PreCPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+	} `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// Stats reads one sample from the Docker stats endpoint. Without one-shot the
+// daemon waits for a second CPU reading, so precpu_stats is filled in and the
+// CPU share can be computed the same way `docker stats` does.
+func (m *DockerManager) Stats(ctx context.Context, containerID string) (ContainerStats, error) {
+	resp, err := m.request(ctx, http.MethodGet, m.apiPath(fmt.Sprintf("/containers/%s/stats?stream=false", containerID)), nil)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer resp.Body.Close()
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		if isDockerStatus(err, http.StatusNotFound) {
+			return ContainerStats{}, ErrInstanceNotFound
+		}
+		return ContainerStats{}, err
+	}
+	var raw dockerStats
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return ContainerStats{}, fmt.Errorf("decode container stats: %w", err)
+	}
+	return raw.containerStats(), nil
+}
+
+func (raw dockerStats) containerStats() ContainerStats {
+	stats := ContainerStats{
+		MemoryBytes:      raw.MemoryStats.Usage,
+		MemoryLimitBytes: raw.MemoryStats.Limit,
+		PIDs:             raw.PidsStats.Current,
+		SampledAt:        raw.Read.UTC(),
+	}
+	if stats.SampledAt.IsZero() {
+		stats.SampledAt = time.Now().UTC()
+	}
+
+	// Page cache is reclaimable and not counted, as in `docker stats`.
+	cache := raw.MemoryStats.Stats["inactive_file"]
+	if cache == 0 {
+		cache = raw.MemoryStats.Stats["total_inactive_file"]
+	}
+	if cache < stats.MemoryBytes {
+		stats.MemoryBytes -= cache
+	}
+
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 && cpus > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	for _, network := range raw.Networks {
+		stats.NetworkRxBytes += network.RxBytes
+		stats.NetworkTxBytes += network.TxBytes
+	}
+	return stats
+}
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDockerStatsComputesUsage(t *testing.T) {
+	manager := newDiagnosticsDocker(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/c1/stats" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("unexpected stats query %q", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{
+			"read": "2025-03-08T09:00:00Z",
+			"cpu_stats": {"cpu_usage": {"total_usage": 3000}, "system_cpu_usage": 20000, "online_cpus": 2},
+			"precpu_stats": {"cpu_usage": {"total_usage": 1000}, "system_cpu_usage": 10000},
+			"memory_stats": {"usage": 100, "limit": 400, "stats": {"inactive_file": 20}},
+			"networks": {"eth0": {"rx_bytes": 5, "tx_bytes": 7}, "eth1": {"rx_bytes": 1, "tx_bytes": 1}},
+			"pids_stats": {"current": 4}
+		}`))
+	})
+
+	stats, err := manager.Stats(context.Background(), "c1")
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if math.Abs(stats.CPUPercent-40) > 0.001 || stats.MemoryBytes != 80 || stats.MemoryLimitBytes != 400 {
+		t.Fatalf("unexpected cpu or memory usage %#v", stats)
+	}
+	if stats.NetworkRxBytes != 6 || stats.NetworkTxBytes != 8 || stats.PIDs != 4 {
+		t.Fatalf("unexpected network or pids usage %#v", stats)
+	}
+	if !stats.SampledAt.Equal(time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected sample time %s", stats.SampledAt)
+	}
+
+	if _, err := manager.Stats(context.Background(), "gone"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Fatalf("expected missing container error, got %v", err)
+	}
+}
+
+func TestSampleStatsKillsSustainedOveruse(t *testing.T) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.UserCooldown = time.Hour
+	service := NewService(ServiceConfig{
+		PublicBaseURL:  "http://localhost:8080",
+		RuntimeBaseURL: "http://localhost:8080",
+		StatsLimits:    StatsLimits{CPUPercent: 90, Sustain: time.Minute},
+	}, manager, repo)
+	baseTime := time.Date(2025, time.March, 8, 9, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return baseTime }
+
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	sample := func(at time.Time, cpu float64) StatsReport {
+		t.Helper()
+		manager.stats = map[string]ContainerStats{"container-1": {CPUPercent: cpu, MemoryBytes: 10, SampledAt: at}}
+		report, err := service.SampleStats(context.Background())
+		if err != nil {
+			t.Fatalf("sample stats: %v", err)
+		}
+		return report
+	}
+
+	if report := sample(baseTime, 150); report.Sampled != 1 || report.Killed != 0 || report.Nodes[""].MemoryBytes != 10 {
+		t.Fatalf("unexpected first report %#v", report)
+	}
+	// Dropping below the limit resets the sustain window.
+	sample(baseTime.Add(30*time.Second), 10)
+	if report := sample(baseTime.Add(70*time.Second), 150); report.Killed != 0 {
+		t.Fatalf("expected the sustain window to restart, got %#v", report)
+	}
+	if got := service.InstanceStats(); len(got) != 1 {
+		t.Fatalf("expected one tracked instance, got %#v", got)
+	}
+	if report := sample(baseTime.Add(130*time.Second), 150); report.Killed != 1 {
+		t.Fatalf("expected instance to be killed, got %#v", report)
+	}
+	if len(manager.stoppedIDs) != 1 || len(service.InstanceStats()) != 0 {
+		t.Fatalf("expected container stopped and stats dropped, stopped=%v", manager.stoppedIDs)
+	}
+	if _, err := service.GetInstance(context.Background(), 7, "1"); !errors.Is(err, ErrInstanceResourceLimit) {
+		t.Fatalf("expected resource limit error, got %v", err)
+	}
+	// A killed instance still counts towards the cooldown.
+	if _, _, err := service.StartInstance(context.Background(), 7, "1"); !errors.Is(err, ErrInstanceCooldownActive) {
+		t.Fatalf("expected cooldown after kill, got %v", err)
+	}
+}
+
+func TestStatsLimitsExceeded(t *testing.T) {
+	limits := StatsLimits{MemoryPercent: 50, PIDs: 10}
+	cases := []struct {
+		stats ContainerStats
+		want  bool
+	}{
+		{ContainerStats{MemoryBytes: 60, MemoryLimitBytes: 100}, true},
+		{ContainerStats{MemoryBytes: 40, MemoryLimitBytes: 100}, false},
+		{ContainerStats{MemoryBytes: 60}, false},
+		{ContainerStats{PIDs: 11}, true},
+		{ContainerStats{CPUPercent: 400}, false},
+	}
+	for _, tc := range cases {
+		if got := limits.exceeded(tc.stats); got != tc.want {
+			t.Fatalf("exceeded(%#v) = %v, want %v", tc.stats, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxGatewayTokenLength = 128
+	// gatewayPromptDelay is how long a plain connection may stay silent before
+	// the gateway asks for the token. Clients that send the token right away,
+	// such as scripts, never see the prompt in their stream.
+	gatewayPromptDelay = time.Second
+)
+
+func (c GatewayConfig) Enabled() bool {
+	return c.Addr != ""
+}
+
+func (c GatewayConfig) handles(protocol string) bool {
+	return c.Enabled() && strings.EqualFold(protocol, "tcp")
+}
+
+func (c GatewayConfig) tlsEnabled() bool {
+	return c.TLSAddr != "" && c.TLSDomain != ""
+}
+
+func normalizeGatewayConfig(cfg GatewayConfig, runtimeBaseURL string) GatewayConfig {
+	cfg.Addr = strings.TrimSpace(cfg.Addr)
+	cfg.TLSAddr = strings.TrimSpace(cfg.TLSAddr)
+	cfg.TLSDomain = strings.Trim(strings.ToLower(strings.TrimSpace(cfg.TLSDomain)), ".")
+	cfg.UpstreamHost = strings.TrimSpace(cfg.UpstreamHost)
+	cfg.Network = strings.TrimSpace(cfg.Network)
+	cfg.PublicAddr = strings.TrimSpace(cfg.PublicAddr)
+	if cfg.PublicAddr == "" && cfg.Addr != "" {
+		cfg.PublicAddr = defaultGatewayPublicAddr(runtimeBaseURL, cfg.Addr)
+	}
+	cfg.TLSPublicAddr = strings.TrimSpace(cfg.TLSPublicAddr)
+	if cfg.TLSPublicAddr == "" && cfg.TLSAddr != "" {
+		_, port, _ := net.SplitHostPort(cfg.TLSAddr)
+		cfg.TLSPublicAddr = port
+	}
+	if cfg.MaxConnsPerInstance <= 0 {
+		cfg.MaxConnsPerInstance = 8
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 5 * time.Minute
+	}
+	if cfg.HandshakeTimeout <= 0 {
+		cfg.HandshakeTimeout = 10 * time.Second
+	}
+	return cfg
+}
+
+func defaultGatewayPublicAddr(runtimeBaseURL, listenAddr string) string {
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
+	}
+	hostname := "localhost"
+	if parsed, err := url.Parse(runtimeBaseURL); err == nil && parsed.Hostname() != "" {
+		hostname = parsed.Hostname()
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// TCPGateway multiplexes tcp instances behind one public port. A plain
+// connection must start with the instance token on its own line, and is
+// prompted for it only after staying silent for a moment; a TLS
+// connection is routed by the first label of its SNI name. Everything after
+// that is spliced to the instance's container address.
+type TCPGateway struct {
+	cfg  GatewayConfig
+	repo Repository
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	promptDelay time.Duration
+
+	mu    sync.Mutex
+	conns map[string]int
+
+	activity *activityTracker
+}
+
+func NewTCPGateway(cfg GatewayConfig, repo Repository) *TCPGateway {
+	cfg = normalizeGatewayConfig(cfg, "")
+	if !cfg.Enabled() {
+		return nil
+	}
+	var dialer net.Dialer
+	return &TCPGateway{
+		cfg:         cfg,
+		repo:        repo,
+		dial:        dialer.DialContext,
+		promptDelay: gatewayPromptDelay,
+		conns:       make(map[string]int),
+	}
+}
+
+func (g *TCPGateway) Enabled() bool {
+	return g != nil
+}
+
+// Serve listens on the configured addresses until ctx is cancelled.
+func (g *TCPGateway) Serve(ctx context.Context) error {
+	plain, err := net.Listen("tcp", g.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("listen tcp gateway: %w", err)
+	}
+	listeners := []net.Listener{plain}
+	handlers := []func(net.Conn){g.handlePlain}
+
+	if g.cfg.tlsEnabled() {
+		certificate, err := tls.LoadX509KeyPair(g.cfg.TLSCertFile, g.cfg.TLSKeyFile)
+		if err != nil {
+			_ = plain.Close()
+			return fmt.Errorf("load tcp gateway certificate: %w", err)
+		}
+		secure, err := net.Listen("tcp", g.cfg.TLSAddr)
+		if err != nil {
+			_ = plain.Close()
+			return fmt.Errorf("listen tcp gateway tls: %w", err)
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+		listeners = append(listeners, secure)
+		handlers = append(handlers, func(conn net.Conn) { g.handleTLS(conn, tlsConfig) })
+	}
+	return g.serveListeners(ctx, listeners, handlers)
+}
+
+func (g *TCPGateway) serveListeners(ctx context.Context, listeners []net.Listener, handlers []func(net.Conn)) error {
+	go func() {
+		<-ctx.Done()
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}()
+
+	errCh := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		go func(listener net.Listener, handle func(net.Conn)) {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+						errCh <- nil
+						return
+					}
+					errCh <- fmt.Errorf("accept tcp gateway connection: %w", err)
+					return
+				}
+				go handle(conn)
+			}
+		}(listener, handlers[i])
+	}
+
+	var firstErr error
+	for range listeners {
+		if err := <-errCh; err != nil && firstErr == nil {
+			firstErr = err
+			for _, listener := range listeners {
+				_ = listener.Close()
+			}
+		}
+	}
+	return firstErr
+}
+
+func (g *TCPGateway) handlePlain(conn net.Conn) {
+	defer conn.Close()
+
+	deadline := time.Now().Add(g.cfg.HandshakeTimeout)
+	reader := bufio.NewReaderSize(conn, maxGatewayTokenLength+2)
+	if g.promptDelay > 0 && g.promptDelay < g.cfg.HandshakeTimeout {
+		_ = conn.SetReadDeadline(time.Now().Add(g.promptDelay))
+		if _, err := reader.Peek(1); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				return
+			}
+			_ = conn.SetWriteDeadline(deadline)
+			_, _ = io.WriteString(conn, "instance token: ")
+		}
+	}
+	_ = conn.SetDeadline(deadline)
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			_, _ = io.WriteString(conn, "invalid instance token\n")
+		}
+		return
+	}
+	token := strings.TrimSpace(string(line))
+
+	buffered, _ := reader.Peek(reader.Buffered())
+	g.route(conn, strings.ToLower(token), buffered)
+}
+
+func (g *TCPGateway) handleTLS(conn net.Conn, tlsConfig *tls.Config) {
+	defer conn.Close()
+
+	secure := tls.Server(conn, tlsConfig)
+	_ = conn.SetDeadline(time.Now().Add(g.cfg.HandshakeTimeout))
+	if err := secure.Handshake(); err != nil {
+		return
+	}
+	serverName := strings.ToLower(secure.ConnectionState().ServerName)
+	token, found := strings.CutSuffix(serverName, "."+g.cfg.TLSDomain)
+	if !found || token == "" || strings.Contains(token, ".") {
+		_, _ = io.WriteString(secure, "unknown instance host\n")
+		return
+	}
+	g.route(secure, token, nil)
+}
+
+func (g *TCPGateway) route(client net.Conn, token string, buffered []byte) {
+	if token == "" {
+		_, _ = io.WriteString(client, "instance token required\n")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.cfg.HandshakeTimeout)
+	defer cancel()
+
+	record, err := g.repo.GetInstanceByGatewayToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrRepositoryNotFound) {
+			_, _ = io.WriteString(client, "unknown or expired instance token\n")
+			return
+		}
+		_, _ = io.WriteString(client, "instance lookup failed\n")
+		return
+	}
+	if !g.acquire(token) {
+		_, _ = io.WriteString(client, "too many connections to this instance\n")
+		return
+	}
+	defer g.release(token)
+
+	upstream, err := g.dial(ctx, "tcp", g.upstreamAddr(record.Instance))
+	if err != nil {
+		_, _ = io.WriteString(client, "instance is not reachable\n")
+		return
+	}
+	defer upstream.Close()
+
+	if len(buffered) > 0 {
+		if _, err := upstream.Write(buffered); err != nil {
+			return
+		}
+	}
+	_ = client.SetDeadline(time.Time{})
+	g.activity.open(record.ID, time.Now())
+	defer func() { g.activity.close(record.ID, time.Now()) }()
+	splice(client, upstream, g.cfg.IdleTimeout)
+}
+
+func (g *TCPGateway) upstreamAddr(instance Instance) string {
+	return g.cfg.upstreamAddr(instance)
+}
+
+func (g *TCPGateway) acquire(token string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conns[token] >= g.cfg.MaxConnsPerInstance {
+		return false
+	}
+	g.conns[token]++
+	return true
+}
+
+func (g *TCPGateway) release(token string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.conns[token]--
+	if g.conns[token] <= 0 {
+		delete(g.conns, token)
+	}
+}
+
+// splice copies both directions until either side closes or no bytes have
+// moved in either direction for idle.
+func splice(client, upstream net.Conn, idle time.Duration) {
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+	done := make(chan struct{}, 2)
+
+	pipe := func(dst, src net.Conn) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				lastActivity.Store(time.Now().UnixNano())
+				if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+
+	ticker := time.NewTicker(max(idle/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			_ = client.Close()
+			_ = upstream.Close()
+			<-done
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, lastActivity.Load())) >= idle {
+				_ = client.Close()
+				_ = upstream.Close()
+				<-done
+				<-done
+				return
+			}
+		}
+	}
+}
+
+func (s *Service) gatewayToken(cfg ChallengeConfig, previousToken string) (string, error) {
+	if !s.cfg.Gateway.handles(cfg.ExposedProtocol) {
+		return "", nil
+	}
+	if previousToken != "" {
+		return previousToken, nil
+	}
+	return newRouteID()
+}
+
+func (s *Service) gatewayTLSAddr(token string) string {
+	if token == "" || !s.cfg.Gateway.tlsEnabled() {
+		return ""
+	}
+	host := token + "." + s.cfg.Gateway.TLSDomain
+	if s.cfg.Gateway.TLSPublicAddr == "" {
+		return host
+	}
+	return net.JoinHostPort(host, s.cfg.Gateway.TLSPublicAddr)
+}
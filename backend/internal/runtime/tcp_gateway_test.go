@@ -0,0 +1,222 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startEchoListener(t *testing.T) (string, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber
+}
+
+func newGatewayTestService(t *testing.T, cfg GatewayConfig) (*Service, *fakeRepository, string) {
+	t.Helper()
+	host, port := startEchoListener(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen gateway: %v", err)
+	}
+	cfg.Addr = listener.Addr().String()
+
+	repo := newFakeRepository()
+	repo.challenge.Challenge.ExposedProtocol = "tcp"
+	repo.challenge.Challenge.ContainerPort = port
+	// The echo listener stands in for the container's internal address.
+	manager := &fakeManager{internalIP: host}
+	service := NewService(ServiceConfig{RuntimeBaseURL: "http://ctf.example.com"}, manager, repo)
+	service.cfg.Gateway = normalizeGatewayConfig(cfg, service.cfg.RuntimeBaseURL)
+	service.gateway = NewTCPGateway(service.cfg.Gateway, repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- service.gateway.serveListeners(ctx, []net.Listener{listener}, []func(net.Conn){service.gateway.handlePlain})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return service, repo, cfg.Addr
+}
+
+func dialGateway(t *testing.T, addr, token string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	if _, err := io.WriteString(conn, token+"\n"); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	return conn, reader
+}
+
+func TestStartInstanceAssignsGatewayTokenForTCP(t *testing.T) {
+	service, _, _ := newGatewayTestService(t, GatewayConfig{})
+	manager := service.manager.(*fakeManager)
+
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	if instance.GatewayToken == "" {
+		t.Fatal("expected tcp instance to receive a gateway token")
+	}
+	_, port, _ := net.SplitHostPort(service.cfg.Gateway.Addr)
+	if instance.AccessURL != "tcp://"+instance.GatewayToken+"@ctf.example.com:"+port {
+		t.Fatalf("expected gateway access url with the token, got %q", instance.AccessURL)
+	}
+	if instance.HostPort != 0 || !manager.lastStart.Proxied {
+		t.Fatalf("expected no published host port, got port %d request %+v", instance.HostPort, manager.lastStart)
+	}
+}
+
+func TestTCPGatewayRoutesByToken(t *testing.T) {
+	service, _, addr := newGatewayTestService(t, GatewayConfig{})
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+
+	conn, reader := dialGateway(t, addr, strings.ToUpper(instance.GatewayToken))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("expected echoed payload, got %q (%v)", line, err)
+	}
+}
+
+func TestTCPGatewayPromptsSilentClients(t *testing.T) {
+	service, _, addr := newGatewayTestService(t, GatewayConfig{})
+	service.gateway.promptDelay = 20 * time.Millisecond
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial gateway: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	prompt := make([]byte, len("instance token: "))
+	if _, err := io.ReadFull(reader, prompt); err != nil || string(prompt) != "instance token: " {
+		t.Fatalf("expected token prompt, got %q (%v)", prompt, err)
+	}
+	if _, err := io.WriteString(conn, instance.GatewayToken+"\nping\n"); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("expected echoed payload after the prompt, got %q (%v)", line, err)
+	}
+}
+
+func TestRestartRotatesGatewayToken(t *testing.T) {
+	service, repo, addr := newGatewayTestService(t, GatewayConfig{})
+	repo.challenge.Challenge.MaxRestartCount = 1
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	restarted, err := service.RestartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("restart instance: %v", err)
+	}
+	if restarted.GatewayToken == "" || restarted.GatewayToken == instance.GatewayToken {
+		t.Fatalf("expected a new gateway token, got %q then %q", instance.GatewayToken, restarted.GatewayToken)
+	}
+	_, reader := dialGateway(t, addr, instance.GatewayToken)
+	if line, _ := reader.ReadString('\n'); line != "unknown or expired instance token\n" {
+		t.Fatalf("expected the old token to be rejected, got %q", line)
+	}
+}
+
+func TestTCPGatewayRejectsUnknownToken(t *testing.T) {
+	_, _, addr := newGatewayTestService(t, GatewayConfig{})
+
+	_, reader := dialGateway(t, addr, "nope")
+	line, _ := reader.ReadString('\n')
+	if line != "unknown or expired instance token\n" {
+		t.Fatalf("expected unknown token message, got %q", line)
+	}
+}
+
+func TestTCPGatewayLimitsConnectionsPerInstance(t *testing.T) {
+	service, _, addr := newGatewayTestService(t, GatewayConfig{MaxConnsPerInstance: 1})
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+
+	first, firstReader := dialGateway(t, addr, instance.GatewayToken)
+	_, _ = io.WriteString(first, "hold\n")
+	if line, err := firstReader.ReadString('\n'); err != nil || line != "hold\n" {
+		t.Fatalf("expected first connection to be routed, got %q (%v)", line, err)
+	}
+
+	_, secondReader := dialGateway(t, addr, instance.GatewayToken)
+	line, _ := secondReader.ReadString('\n')
+	if line != "too many connections to this instance\n" {
+		t.Fatalf("expected connection limit message, got %q", line)
+	}
+}
+
+func TestTCPGatewayClosesIdleConnections(t *testing.T) {
+	service, _, addr := newGatewayTestService(t, GatewayConfig{IdleTimeout: 100 * time.Millisecond})
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+
+	_, reader := dialGateway(t, addr, instance.GatewayToken)
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Fatalf("expected idle connection to be closed, got %v", err)
+	}
+}
+
+func TestGatewayTLSAddrUsesTokenSubdomain(t *testing.T) {
+	service := NewService(ServiceConfig{
+		Gateway: GatewayConfig{Addr: ":9000", TLSAddr: ":9443", TLSDomain: "TCP.Example.com."},
+	}, &fakeManager{}, newFakeRepository())
+
+	if got := service.gatewayTLSAddr("abc"); got != "abc.tcp.example.com:9443" {
+		t.Fatalf("unexpected tls address %q", got)
+	}
+	if got := service.gatewayTLSAddr(""); got != "" {
+		t.Fatalf("expected empty tls address without token, got %q", got)
+	}
+}
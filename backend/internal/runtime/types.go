@@ -3,19 +3,48 @@ package runtime
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 )
 
 var (
-	ErrChallengeNotFound         = errors.New("challenge not found")
-	ErrChallengeNotDynamic       = errors.New("challenge is not dynamic")
-	ErrRuntimeConfigMissing      = errors.New("runtime config missing")
-	ErrInstanceNotFound          = errors.New("instance not found")
-	ErrInstanceRenewLimitReached = errors.New("instance renew limit reached")
-	ErrInstanceCapacityReached   = errors.New("instance capacity reached")
-	ErrInstanceCooldownActive    = errors.New("instance cooldown active")
-	ErrInstancePortExhausted     = errors.New("instance port exhausted")
-	ErrRepositoryNotFound        = errors.New("repository record not found")
+	ErrChallengeNotFound           = errors.New("challenge not found")
+	ErrChallengeNotDynamic         = errors.New("challenge is not dynamic")
+	ErrRuntimeConfigMissing        = errors.New("runtime config missing")
+	ErrInstanceNotFound            = errors.New("instance not found")
+	ErrInstanceRenewLimitReached   = errors.New("instance renew limit reached")
+	ErrInstanceRestartLimitReached = errors.New("instance restart limit reached")
+	ErrInstanceNotReady            = errors.New("instance is still being created")
+	ErrInstanceCapacityReached     = errors.New("instance capacity reached")
+	ErrInstanceCooldownActive      = errors.New("instance cooldown active")
+	ErrInstanceQuotaExceeded       = errors.New("instance quota exceeded")
+	ErrInstancePortExhausted       = errors.New("instance port exhausted")
+	ErrRepositoryNotFound          = errors.New("repository record not found")
+	ErrChallengeNotShared          = errors.New("challenge does not use shared runtime mode")
+	ErrSharedInstanceNotRunning    = errors.New("shared instance is not running")
+	ErrSharedInstanceReadOnly      = errors.New("shared instance is managed by administrators")
+	ErrInternalNetworkNeedsProxy   = errors.New("internal network challenges must be served through the instance proxy")
+	ErrInstanceReadinessFailed     = errors.New("instance did not become ready and was stopped")
+	ErrInstanceStartFailed         = errors.New("instance failed to start")
+	ErrStartQueueFull              = errors.New("instance start queue is full")
+	ErrNoNodeAvailable             = errors.New("no docker node can run the instance")
+	ErrNodeUnavailable             = errors.New("docker node is unavailable")
+	ErrInvalidExecCommand          = errors.New("invalid exec command")
+	ErrNodeNotFound                = errors.New("docker node not found")
+	ErrInstanceResourceLimit       = errors.New("instance was stopped for exceeding its resource limits")
+)
+
+const (
+	ModePerUser = "per-user"
+	ModeShared  = "shared"
+
+	// SharedOwnerID is the UserID recorded for the single instance of a shared
+	// challenge; the store persists it as a NULL user_id.
+	SharedOwnerID int64 = 0
+
+	NetworkIsolationNone     = "none"
+	NetworkIsolationInstance = "instance"
+	NetworkIsolationUser     = "user"
 )
 
 type ServiceConfig struct {
@@ -24,6 +53,58 @@ type ServiceConfig struct {
 	BindAddr       string
 	PortMin        int
 	PortMax        int
+	Isolation      string
+	Proxy          ProxyConfig
+	Gateway        GatewayConfig
+	// StartWorkers containers are provisioned concurrently from a queue of
+	// StartQueueSize pending starts; zero provisions inside the request.
+	StartWorkers   int
+	StartQueueSize int
+	// NodeAddresses maps remote Docker nodes to the host their published
+	// ports are reached at.
+	NodeAddresses map[string]string
+	// StatsLimits kill player instances that keep using too much CPU,
+	// memory or processes.
+	StatsLimits StatsLimits
+	// Quotas cap each player's and the platform's instances across
+	// challenges.
+	Quotas Quotas
+	// Idle reclaims player instances nobody has used for a while.
+	Idle IdlePolicy
+}
+
+// ProxyConfig enables the embedded HTTP reverse proxy. When Domain is set,
+// http and https instances are reached through <proxy-id>.<Domain> instead of
+// a published host port. Requests always need the signed ticket from the
+// access URL; RequireAccessCookie only decides whether the proxy swaps it for a
+// cookie or expects it in the query of each request.
+type ProxyConfig struct {
+	Domain              string
+	Scheme              string
+	Secret              string
+	Network             string
+	RequireAccessCookie bool
+}
+
+// GatewayConfig enables the TCP gateway. When Addr is set, tcp instances get
+// a token and no published host port; players connect to PublicAddr and send
+// the token, or connect over TLS to <token>.<TLSDomain> on the TLS listener.
+// The gateway reaches the containers on Network, which defaults to the proxy
+// network.
+type GatewayConfig struct {
+	Addr                string
+	PublicAddr          string
+	Network             string
+	UpstreamHost        string
+	TLSAddr             string
+	TLSPublicAddr       string
+	TLSDomain           string
+	TLSCertFile         string
+	TLSKeyFile          string
+	MaxConnsPerInstance int
+	IdleTimeout         time.Duration
+	HandshakeTimeout    time.Duration
+	nodeAddresses       map[string]string
 }
 
 type ChallengeConfig struct {
@@ -33,17 +114,27 @@ type ChallengeConfig struct {
 	Category           string
 	Points             int
 	Dynamic            bool
+	Mode               string
+	Driver             string
+	Internal           bool
 	ImageName          string
+	ImageDigest        string
 	ExposedProtocol    string
 	ContainerPort      int
 	TTL                time.Duration
 	MaxRenewCount      int
+	MaxRestartCount    int
 	MemoryLimitMB      int
 	CPUMilli           int
 	MaxActiveInstances int
 	UserCooldown       time.Duration
 	Env                map[string]string
 	Command            []string
+	Hardening          Hardening
+	Services           []ServiceSpec
+	Readiness          ReadinessProbe
+	WarmPoolSize       int
+	NodeLabels         map[string]string
 }
 
 type ChallengeSummary struct {
@@ -57,18 +148,35 @@ type ChallengeSummary struct {
 }
 
 type Instance struct {
-	ChallengeID   string     `json:"challenge_id"`
-	UserID        int64      `json:"user_id,omitempty"`
-	Status        string     `json:"status"`
-	AccessURL     string     `json:"access_url,omitempty"`
-	HostPort      int        `json:"host_port,omitempty"`
-	RenewCount    int        `json:"renew_count"`
-	StartedAt     time.Time  `json:"started_at"`
-	ExpiresAt     time.Time  `json:"expires_at"`
-	TerminatedAt  *time.Time `json:"terminated_at,omitempty"`
-	ContainerID   string     `json:"-"`
-	ContainerName string     `json:"-"`
-	HostIP        string     `json:"-"`
+	ChallengeID    string     `json:"challenge_id"`
+	UserID         int64      `json:"user_id,omitempty"`
+	Shared         bool       `json:"shared,omitempty"`
+	Status         string     `json:"status"`
+	AccessURL      string     `json:"access_url,omitempty"`
+	HostPort       int        `json:"host_port,omitempty"`
+	RenewCount     int        `json:"renew_count"`
+	RestartCount   int        `json:"restart_count"`
+	StartedAt      time.Time  `json:"started_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	TerminatedAt   *time.Time `json:"terminated_at,omitempty"`
+	FailureReason  string     `json:"failure_reason,omitempty"`
+	ReadyDeadline  *time.Time `json:"ready_deadline,omitempty"`
+	QueuePosition  int        `json:"queue_position,omitempty"`
+	IdleExpiresAt  *time.Time `json:"idle_expires_at,omitempty"`
+	ContainerID    string     `json:"-"`
+	ContainerName  string     `json:"-"`
+	HostIP         string     `json:"-"`
+	ProxyID        string     `json:"-"`
+	UpstreamURL    string     `json:"-"`
+	GatewayToken   string     `json:"-"`
+	GatewayTLSAddr string     `json:"-"`
+	Node           string     `json:"-"`
+	// AccessToken is the instance's secret for the proxy: access links are
+	// signed over it, so a new token revokes every link handed out before.
+	AccessToken string `json:"-"`
+	// MemoryMB is the memory reserved for the instance's containers when it
+	// started, counted against the quotas.
+	MemoryMB int `json:"-"`
 }
 
 type RuntimeConfigRecord struct {
@@ -84,13 +192,20 @@ type InstanceRecord struct {
 
 type ManagedContainer struct {
 	ContainerID string
+	Node        string
 	ChallengeID string
 	UserID      int64
+	// Pooled containers were started for the warm pool. Docker labels cannot
+	// change, so a claimed warm container keeps the flag and user 0; its
+	// owner is the instance record holding its ContainerID.
+	Pooled bool
 }
 
 type ReconcileReport struct {
 	TerminatedRecords int
 	RemovedContainers int
+	RestartedShared   int
+	RemovedNetworks   int
 }
 
 type Repository interface {
@@ -99,12 +214,26 @@ type Repository interface {
 	GetActiveInstance(context.Context, int64, string) (InstanceRecord, error)
 	CreateInstance(context.Context, int64, Instance) (InstanceRecord, error)
 	RenewInstance(context.Context, int64, time.Time) (InstanceRecord, error)
+	RestartInstance(context.Context, int64, Instance) (InstanceRecord, error)
 	TerminateInstance(context.Context, int64, time.Time) error
 	ListExpiredInstances(context.Context, time.Time) ([]InstanceRecord, error)
 	ListActiveInstances(context.Context) ([]InstanceRecord, error)
 	ListActiveHostPorts(context.Context) ([]int, error)
 	CountActiveInstances(context.Context, string) (int, error)
+	ListUserActiveInstances(context.Context, int64) ([]ActiveInstance, error)
+	GetInstanceUsage(context.Context) (InstanceUsage, error)
 	GetLatestInstance(context.Context, int64, string) (InstanceRecord, error)
+	GetInstanceByProxyID(context.Context, string) (InstanceRecord, error)
+	GetInstanceByGatewayToken(context.Context, string) (InstanceRecord, error)
+	ListWarmPoolChallengeIDs(context.Context) ([]string, error)
+	ListDynamicChallengeIDs(context.Context) ([]string, error)
+	AttachInstanceContainer(context.Context, int64, Instance) error
+	MarkInstanceRunning(context.Context, int64) error
+	FailInstance(context.Context, int64, time.Time, string) error
+	// ExitInstance terminates an instance whose container exited on its own.
+	ExitInstance(ctx context.Context, instanceID int64, exitedAt time.Time, exitCode int) error
+	RecordInstanceEvent(context.Context, InstanceEvent) error
+	ListInstanceEvents(context.Context, InstanceEventFilter) ([]InstanceEvent, error)
 }
 
 type StartRequest struct {
@@ -112,6 +241,10 @@ type StartRequest struct {
 	UserID      int64
 	BindAddr    string
 	HostPort    int
+	Proxied     bool
+	Network     string
+	Isolation   string
+	Pooled      bool
 	Config      ChallengeConfig
 }
 
@@ -120,11 +253,46 @@ type StartedContainer struct {
 	ContainerName string
 	HostIP        string
 	HostPort      int
+	InternalIP    string
+	Node          string
+}
+
+func (c ChallengeConfig) IsShared() bool {
+	return c.Mode == ModeShared
+}
+
+func NormalizeMode(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ModePerUser:
+		return ModePerUser, true
+	case ModeShared:
+		return ModeShared, true
+	default:
+		return "", false
+	}
+}
+
+// NormalizeNetworkIsolation maps RUNTIME_NETWORK_ISOLATION values onto the
+// supported modes; an empty value means no isolation.
+func NormalizeNetworkIsolation(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", NetworkIsolationNone:
+		return NetworkIsolationNone, true
+	case NetworkIsolationInstance:
+		return NetworkIsolationInstance, true
+	case NetworkIsolationUser:
+		return NetworkIsolationUser, true
+	default:
+		return "", false
+	}
 }
 
 type Manager interface {
 	Start(context.Context, StartRequest) (StartedContainer, error)
-	Stop(context.Context, string) error
-	Exists(context.Context, string) (bool, error)
+	// Stop and Exists take the node the container was started on.
+	Stop(ctx context.Context, node, containerID string) error
+	Exists(ctx context.Context, node, containerID string) (bool, error)
 	ListManagedContainers(context.Context) ([]ManagedContainer, error)
+	PruneNetworks(context.Context) (int, error)
+	Stats(ctx context.Context, node, containerID string) (ContainerStats, error)
 }
@@ -0,0 +1,257 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+const (
+	poolLabel = "ctf.pool"
+
+	MaxWarmPoolSize = 32
+)
+
+func ValidateWarmPoolSize(size int, mode string) error {
+	if size < 0 {
+		return fmt.Errorf("cannot be negative")
+	}
+	if size > MaxWarmPoolSize {
+		return fmt.Errorf("cannot exceed %d", MaxWarmPoolSize)
+	}
+	if size > 0 && mode == ModeShared {
+		return fmt.Errorf("is not supported for shared challenges")
+	}
+	return nil
+}
+
+type warmContainer struct {
+	started  StartedContainer
+	hostPort int
+	cfg      ChallengeConfig
+}
+
+// warmPool holds containers started ahead of demand. Idle containers are
+// only known to this process; a container being handed to a player stays
+// tracked as claiming until its instance record points at it.
+type warmPool struct {
+	mu       sync.Mutex
+	idle     map[string][]warmContainer
+	claiming map[string]struct{}
+	filling  map[string]bool
+}
+
+func newWarmPool() *warmPool {
+	return &warmPool{
+		idle:     make(map[string][]warmContainer),
+		claiming: make(map[string]struct{}),
+		filling:  make(map[string]bool),
+	}
+}
+
+// take hands out an idle container started from cfg's current settings.
+func (p *warmPool) take(cfg ChallengeConfig) (warmContainer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	idle := p.idle[cfg.ID]
+	index := slices.IndexFunc(idle, func(item warmContainer) bool { return samePoolConfig(item.cfg, cfg) })
+	if index < 0 {
+		return warmContainer{}, false
+	}
+	taken := idle[index]
+	p.idle[cfg.ID] = slices.Delete(idle, index, index+1)
+	p.claiming[taken.started.ContainerID] = struct{}{}
+	return taken, true
+}
+
+func (p *warmPool) ready(cfg ChallengeConfig) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.ContainsFunc(p.idle[cfg.ID], func(item warmContainer) bool { return samePoolConfig(item.cfg, cfg) })
+}
+
+func (p *warmPool) settle(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.claiming, containerID)
+}
+
+func (p *warmPool) add(item warmContainer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle[item.cfg.ID] = append(p.idle[item.cfg.ID], item)
+}
+
+func (p *warmPool) size(challengeID string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle[challengeID])
+}
+
+// trim removes containers that were started from outdated settings or exceed
+// the configured size, and returns them for stopping.
+func (p *warmPool) trim(cfg ChallengeConfig) []warmContainer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var kept, removed []warmContainer
+	for _, item := range p.idle[cfg.ID] {
+		if len(kept) < cfg.WarmPoolSize && samePoolConfig(item.cfg, cfg) {
+			kept = append(kept, item)
+			continue
+		}
+		removed = append(removed, item)
+	}
+	p.idle[cfg.ID] = kept
+	return removed
+}
+
+func (p *warmPool) drain(challengeID string) []warmContainer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	removed := p.idle[challengeID]
+	delete(p.idle, challengeID)
+	return removed
+}
+
+func (p *warmPool) challengeIDs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, 0, len(p.idle))
+	for id := range p.idle {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (p *warmPool) startFilling(challengeID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.filling[challengeID] {
+		return false
+	}
+	p.filling[challengeID] = true
+	return true
+}
+
+func (p *warmPool) doneFilling(challengeID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.filling, challengeID)
+}
+
+// holds reports whether a pooled container found in Docker is still wanted:
+// idle, being claimed, or possibly just started by a refill in progress.
+func (p *warmPool) holds(container ManagedContainer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.claiming[container.ContainerID]; ok || p.filling[container.ChallengeID] {
+		return true
+	}
+	return slices.ContainsFunc(p.idle[container.ChallengeID], func(item warmContainer) bool {
+		return item.started.ContainerID == container.ContainerID
+	})
+}
+
+func (p *warmPool) hostPorts() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ports []int
+	for _, items := range p.idle {
+		for _, item := range items {
+			ports = append(ports, item.hostPort)
+		}
+	}
+	return ports
+}
+
+// samePoolConfig compares the settings a container was started from, ignoring
+// those that only matter once a player owns it.
+func samePoolConfig(a, b ChallengeConfig) bool {
+	return reflect.DeepEqual(poolConfig(a), poolConfig(b))
+}
+
+func poolConfig(cfg ChallengeConfig) ChallengeConfig {
+	cfg.Title = ""
+	cfg.Category = ""
+	cfg.Points = 0
+	cfg.TTL = 0
+	cfg.MaxRenewCount = 0
+	cfg.MaxRestartCount = 0
+	cfg.MaxActiveInstances = 0
+	cfg.UserCooldown = 0
+	cfg.WarmPoolSize = 0
+	return cfg
+}
+
+// takeWarm hands a pooled container to a claimed instance and refills the
+// pool in the background. The caller settles the container once it is
+// attached or stopped.
+func (s *Service) takeWarm(cfg ChallengeConfig) (warmContainer, bool) {
+	if cfg.WarmPoolSize <= 0 {
+		return warmContainer{}, false
+	}
+	taken, ok := s.pool.take(cfg)
+	s.refillWarmPool(cfg)
+	return taken, ok
+}
+
+// refillWarmPool tops the challenge's pool up to its configured size, one
+// refill per challenge at a time.
+func (s *Service) refillWarmPool(cfg ChallengeConfig) {
+	if !s.pool.startFilling(cfg.ID) {
+		return
+	}
+	s.refills.Add(1)
+	go func() {
+		defer s.refills.Done()
+		defer s.pool.doneFilling(cfg.ID)
+		ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+		defer cancel()
+
+		for _, item := range s.pool.trim(cfg) {
+			_ = s.manager.Stop(ctx, item.started.Node, item.started.ContainerID)
+		}
+		for s.pool.size(cfg.ID) < cfg.WarmPoolSize {
+			started, hostPort, err := s.startContainer(ctx, StartRequest{UserID: SharedOwnerID, Pooled: true, Config: cfg}, 0, 0)
+			if err != nil {
+				return
+			}
+			s.pool.add(warmContainer{started: started, hostPort: hostPort, cfg: cfg})
+		}
+	}()
+}
+
+// fillWarmPools refills every configured pool and drains pools of challenges
+// that no longer want one.
+func (s *Service) fillWarmPools(ctx context.Context) error {
+	ids, err := s.repo.ListWarmPoolChallengeIDs(ctx)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		record, err := s.repo.GetChallengeConfig(ctx, id)
+		if err != nil {
+			continue
+		}
+		cfg := record.Challenge
+		if !cfg.Dynamic || cfg.IsShared() || record.ID == 0 || cfg.ImageName == "" || cfg.ContainerPort == 0 || cfg.WarmPoolSize <= 0 {
+			continue
+		}
+		wanted[cfg.ID] = true
+		s.refillWarmPool(cfg)
+	}
+	for _, id := range s.pool.challengeIDs() {
+		if wanted[id] {
+			continue
+		}
+		for _, item := range s.pool.drain(id) {
+			if err := s.manager.Stop(ctx, item.started.Node, item.started.ContainerID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func newWarmPoolTestService(size int) (*Service, *fakeManager, *fakeRepository) {
+	manager := &fakeManager{}
+	repo := newFakeRepository()
+	repo.challenge.Challenge.WarmPoolSize = size
+	service := NewService(ServiceConfig{RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	return service, manager, repo
+}
+
+func TestStartInstanceClaimsWarmContainer(t *testing.T) {
+	service, manager, repo := newWarmPoolTestService(2)
+	repo.challenge.Challenge.MaxActiveInstances = 1
+
+	if _, err := service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	service.refills.Wait()
+	if manager.startCalls != 2 || !manager.lastStart.Pooled || manager.lastStart.UserID != SharedOwnerID {
+		t.Fatalf("expected two pooled containers, got %d starts, last %+v", manager.startCalls, manager.lastStart)
+	}
+
+	instance, created, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil || !created {
+		t.Fatalf("start instance: created=%v err=%v", created, err)
+	}
+	service.refills.Wait()
+	if instance.Status != "running" || instance.AccessURL == "" {
+		t.Fatalf("expected warm instance to be running, got %+v", instance)
+	}
+	if container := manager.containers[instance.ContainerID]; !container.Pooled {
+		t.Fatalf("expected instance to use a pooled container, got %+v", container)
+	}
+	if manager.startCalls != 3 || service.pool.size("1") != 2 {
+		t.Fatalf("expected pool to be refilled, got %d starts and %d idle", manager.startCalls, service.pool.size("1"))
+	}
+
+	report, err := service.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.RemovedContainers != 0 || manager.stopCalls != 0 {
+		t.Fatalf("expected claimed and idle pooled containers to be kept, got %+v", report)
+	}
+}
+
+func TestWarmPoolReplacesContainersFromOutdatedConfig(t *testing.T) {
+	service, manager, repo := newWarmPoolTestService(1)
+	if _, err := service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	service.refills.Wait()
+	stale := manager.lastStart
+
+	repo.challenge.Challenge.ImageName = "ctf/web-welcome:v2"
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	service.refills.Wait()
+
+	if manager.containers[instance.ContainerID].Pooled {
+		t.Fatalf("expected a cold start instead of an outdated warm container")
+	}
+	if len(manager.stoppedIDs) != 1 || manager.lastStart.Config.ImageName != "ctf/web-welcome:v2" || stale.Config.ImageName == "ctf/web-welcome:v2" {
+		t.Fatalf("expected outdated pooled container to be replaced, stopped %v last %+v", manager.stoppedIDs, manager.lastStart)
+	}
+}
+
+func TestReconcileAfterRestartKeepsClaimedWarmContainers(t *testing.T) {
+	service, manager, repo := newWarmPoolTestService(1)
+	if _, err := service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	service.refills.Wait()
+	instance, _, err := service.StartInstance(context.Background(), 7, "1")
+	if err != nil {
+		t.Fatalf("start instance: %v", err)
+	}
+	service.refills.Wait()
+
+	restarted := NewService(ServiceConfig{RuntimeBaseURL: "http://localhost:8080"}, manager, repo)
+	repo.challenge.Challenge.WarmPoolSize = 0
+	report, err := restarted.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.RemovedContainers != 1 || len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] == instance.ContainerID {
+		t.Fatalf("expected only the idle warm container to be removed, report=%+v stopped=%v", report, manager.stoppedIDs)
+	}
+}
+
+func TestReconcileRemovesUnknownPooledContainers(t *testing.T) {
+	service, manager, _ := newWarmPoolTestService(0)
+	manager.containers = map[string]ManagedContainer{
+		"leftover": {ContainerID: "leftover", ChallengeID: "1", UserID: SharedOwnerID, Pooled: true},
+	}
+
+	report, err := service.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.RemovedContainers != 1 || len(manager.stoppedIDs) != 1 || manager.stoppedIDs[0] != "leftover" {
+		t.Fatalf("expected leftover pooled container to be removed, report=%+v stopped=%v", report, manager.stoppedIDs)
+	}
+}
+
+func TestDockerPooledContainersGetOwnNetworkUnderUserIsolation(t *testing.T) {
+	engine, socket := newFakeDockerEngine(t)
+	manager := NewDockerManager(socket)
+
+	started, err := manager.Start(t.Context(), StartRequest{
+		ChallengeID: "1",
+		UserID:      SharedOwnerID,
+		BindAddr:    "127.0.0.1",
+		HostPort:    20000,
+		Pooled:      true,
+		Isolation:   NetworkIsolationUser,
+		Config:      ChallengeConfig{ID: "1", Slug: "web", ImageName: "ctf/web:dev", ExposedProtocol: "tcp", ContainerPort: 80},
+	})
+	if err != nil {
+		t.Fatalf("start pooled container: %v", err)
+	}
+	created := engine.created[started.ContainerID]
+	if created.Labels[poolLabel] != "true" || !strings.HasPrefix(created.HostConfig.NetworkMode, "ctf-net-web-pool-") {
+		t.Fatalf("unexpected pooled container: labels=%v network=%q", created.Labels, created.HostConfig.NetworkMode)
+	}
+
+	containers, err := manager.ListManagedContainers(t.Context())
+	if err != nil {
+		t.Fatalf("list managed containers: %v", err)
+	}
+	if len(containers) != 1 || !containers[0].Pooled {
+		t.Fatalf("expected pooled container to be reported as pooled, got %+v", containers)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"ctf/backend/internal/admin"
 	"ctf/backend/internal/challengecfg"
+	"ctf/backend/internal/runtime"
 )
 
 type AdminRepository struct {
@@ -23,7 +24,7 @@ func NewAdminRepository(db *sql.DB) *AdminRepository {
 
 func (r *AdminRepository) ListChallenges(ctx context.Context, actor admin.Actor) ([]admin.ChallengeSummary, error) {
 	query := `
-SELECT c.id, c.slug, c.title, cat.slug, c.points, c.status, c.dynamic_enabled
+SELECT c.id, c.slug, c.title, cat.slug, c.points, c.status, c.dynamic_enabled, c.archived_at
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
 `
@@ -45,10 +46,17 @@ WHERE ca.user_id = $1
 
 	items := make([]admin.ChallengeSummary, 0)
 	for rows.Next() {
-		var item admin.ChallengeSummary
-		if err := rows.Scan(&item.ID, &item.Slug, &item.Title, &item.Category, &item.Points, &item.Status, &item.DynamicEnabled); err != nil {
+		var (
+			item       admin.ChallengeSummary
+			archivedAt sql.NullTime
+		)
+		if err := rows.Scan(&item.ID, &item.Slug, &item.Title, &item.Category, &item.Points, &item.Status, &item.DynamicEnabled, &archivedAt); err != nil {
 			return nil, fmt.Errorf("scan admin challenge: %w", err)
 		}
+		if archivedAt.Valid {
+			t := archivedAt.Time
+			item.ArchivedAt = &t
+		}
 		item.Status = challengecfg.NormalizeStatus(item.Status)
 		item.Visible = challengecfg.IsPublished(item.Status)
 		items = append(items, item)
@@ -61,7 +69,7 @@ WHERE ca.user_id = $1
 
 func (r *AdminRepository) GetChallenge(ctx context.Context, actor admin.Actor, challengeID int64) (admin.ChallengeDetail, error) {
 	challengeQuery := `
-SELECT c.id, c.slug, c.title, cat.slug, c.description, c.points, c.difficulty, c.flag_type, c.flag_value, c.status, c.dynamic_enabled, c.sort_order
+SELECT c.id, c.slug, c.title, cat.slug, c.description, c.points, c.difficulty, c.flag_type, c.flag_value, c.status, c.dynamic_enabled, c.sort_order, c.archived_at
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
 `
@@ -78,7 +86,10 @@ LIMIT 1
 `
 	}
 
-	var detail admin.ChallengeDetail
+	var (
+		detail     admin.ChallengeDetail
+		archivedAt sql.NullTime
+	)
 	if err := r.db.QueryRowContext(ctx, challengeQuery, args...).Scan(
 		&detail.ID,
 		&detail.Slug,
@@ -92,12 +103,17 @@ LIMIT 1
 		&detail.Status,
 		&detail.DynamicEnabled,
 		&detail.SortOrder,
+		&archivedAt,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return admin.ChallengeDetail{}, admin.ErrResourceNotFound
 		}
 		return admin.ChallengeDetail{}, fmt.Errorf("get admin challenge: %w", err)
 	}
+	if archivedAt.Valid {
+		t := archivedAt.Time
+		detail.ArchivedAt = &t
+	}
 
 	authors, err := r.listChallengeAuthors(ctx, challengeID)
 	if err != nil {
@@ -596,6 +612,181 @@ RETURNING id, title, content, pinned, published, published_at
 	return item, nil
 }
 
+func (r *AdminRepository) SetChallengeImageDigest(ctx context.Context, challengeID int64, imageName, digest string) error {
+	const query = `
+UPDATE challenge_runtime_configs
+SET image_digest = $3, updated_at = NOW()
+WHERE challenge_id = $1 AND image_name = $2
+RETURNING id
+`
+	var id int64
+	if err := r.db.QueryRowContext(ctx, query, challengeID, imageName, digest).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return admin.ErrResourceNotFound
+		}
+		return fmt.Errorf("set challenge image digest: %w", err)
+	}
+	return nil
+}
+
+// SetChallengeArchivedAt archives a challenge, or restores it when archivedAt
+// is nil.
+func (r *AdminRepository) SetChallengeArchivedAt(ctx context.Context, challengeID int64, archivedAt *time.Time) error {
+	const query = `
+UPDATE challenges
+SET archived_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id
+`
+	var id int64
+	if err := r.db.QueryRowContext(ctx, query, challengeID, archivedAt).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return admin.ErrResourceNotFound
+		}
+		return fmt.Errorf("set challenge archived_at: %w", err)
+	}
+	return nil
+}
+
+// DeleteChallenge removes a challenge with its attachment records, runtime
+// config, instances, submissions and solves.
+func (r *AdminRepository) DeleteChallenge(ctx context.Context, challengeID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM challenges WHERE id = $1`, challengeID)
+	if err != nil {
+		return fmt.Errorf("delete challenge: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return admin.ErrResourceNotFound
+	}
+	return nil
+}
+
+func (r *AdminRepository) CreateChallengeRevision(ctx context.Context, input admin.CreateChallengeRevisionInput) (admin.ChallengeRevision, error) {
+	snapshotJSON, err := json.Marshal(input.Snapshot)
+	if err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("encode challenge revision snapshot: %w", err)
+	}
+	changes := input.Changes
+	if changes == nil {
+		changes = []admin.FieldChange{}
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("encode challenge revision changes: %w", err)
+	}
+	var sourceVersion any
+	if input.SourceVersion > 0 {
+		sourceVersion = input.SourceVersion
+	}
+
+	const query = `
+INSERT INTO challenge_revisions (challenge_id, version, action, source_version, actor_user_id, snapshot_json, changes_json)
+SELECT $1, COALESCE(MAX(version), 0) + 1, $2::TEXT, $3::INTEGER, $4::BIGINT, $5::JSONB, $6::JSONB
+FROM challenge_revisions
+WHERE challenge_id = $1
+RETURNING id, version, created_at
+`
+	revision := admin.ChallengeRevision{
+		ChallengeID:   input.ChallengeID,
+		Action:        input.Action,
+		SourceVersion: input.SourceVersion,
+		ActorUserID:   input.ActorUserID,
+		Changes:       changes,
+	}
+	snapshot := input.Snapshot
+	revision.Snapshot = &snapshot
+	if err := r.db.QueryRowContext(ctx, query, input.ChallengeID, input.Action, sourceVersion, input.ActorUserID, snapshotJSON, changesJSON).Scan(
+		&revision.ID,
+		&revision.Version,
+		&revision.CreatedAt,
+	); err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("create challenge revision: %w", err)
+	}
+	return revision, nil
+}
+
+func (r *AdminRepository) ListChallengeRevisions(ctx context.Context, challengeID int64) ([]admin.ChallengeRevision, error) {
+	const query = `
+SELECT cr.id, cr.challenge_id, cr.version, cr.action, COALESCE(cr.source_version, 0), cr.actor_user_id, COALESCE(u.username, ''), cr.changes_json, cr.created_at
+FROM challenge_revisions cr
+LEFT JOIN users u ON u.id = cr.actor_user_id
+WHERE cr.challenge_id = $1
+ORDER BY cr.version DESC
+`
+	rows, err := r.db.QueryContext(ctx, query, challengeID)
+	if err != nil {
+		return nil, fmt.Errorf("list challenge revisions: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]admin.ChallengeRevision, 0)
+	for rows.Next() {
+		item, err := scanChallengeRevision(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate challenge revisions: %w", err)
+	}
+	return items, nil
+}
+
+func (r *AdminRepository) GetChallengeRevision(ctx context.Context, challengeID int64, version int) (admin.ChallengeRevision, error) {
+	const query = `
+SELECT cr.id, cr.challenge_id, cr.version, cr.action, COALESCE(cr.source_version, 0), cr.actor_user_id, COALESCE(u.username, ''), cr.changes_json, cr.created_at, cr.snapshot_json
+FROM challenge_revisions cr
+LEFT JOIN users u ON u.id = cr.actor_user_id
+WHERE cr.challenge_id = $1 AND cr.version = $2
+`
+	var snapshotJSON []byte
+	row := r.db.QueryRowContext(ctx, query, challengeID, version)
+	item, err := scanChallengeRevision(func(dest ...any) error {
+		return row.Scan(append(dest, &snapshotJSON)...)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return admin.ChallengeRevision{}, admin.ErrRevisionNotFound
+		}
+		return admin.ChallengeRevision{}, err
+	}
+	var snapshot admin.UpsertChallengeInput
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("decode challenge revision snapshot: %w", err)
+	}
+	item.Snapshot = &snapshot
+	return item, nil
+}
+
+func scanChallengeRevision(scan func(dest ...any) error) (admin.ChallengeRevision, error) {
+	var (
+		item        admin.ChallengeRevision
+		actorUserID sql.NullInt64
+		changesJSON []byte
+	)
+	if err := scan(&item.ID, &item.ChallengeID, &item.Version, &item.Action, &item.SourceVersion, &actorUserID, &item.ActorUsername, &changesJSON, &item.CreatedAt); err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("scan challenge revision: %w", err)
+	}
+	if actorUserID.Valid {
+		value := actorUserID.Int64
+		item.ActorUserID = &value
+	}
+	item.Changes = []admin.FieldChange{}
+	if err := json.Unmarshal(changesJSON, &item.Changes); err != nil {
+		return admin.ChallengeRevision{}, fmt.Errorf("decode challenge revision changes: %w", err)
+	}
+	return item, nil
+}
+
+func (r *AdminRepository) CountChallengeSolves(ctx context.Context, challengeID int64) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM solves WHERE challenge_id = $1`, challengeID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count challenge solves: %w", err)
+	}
+	return count, nil
+}
+
 func (r *AdminRepository) ListSubmissions(ctx context.Context) ([]admin.SubmissionRecord, error) {
 	const query = `
 SELECT s.id, c.id, c.slug, u.username, s.is_correct, s.submitted_at, s.source_ip
@@ -626,10 +817,10 @@ ORDER BY s.submitted_at DESC, s.id DESC
 
 func (r *AdminRepository) ListInstances(ctx context.Context) ([]admin.InstanceRecord, error) {
 	const query = `
-SELECT ci.id, c.id, c.slug, u.username, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id
+SELECT ci.id, c.id, c.slug, COALESCE(u.username, ''), ci.user_id IS NULL, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id, ci.docker_node, ci.exit_code
 FROM challenge_instances ci
 JOIN challenges c ON c.id = ci.challenge_id
-JOIN users u ON u.id = ci.user_id
+LEFT JOIN users u ON u.id = ci.user_id
 ORDER BY ci.created_at DESC, ci.id DESC
 `
 	rows, err := r.db.QueryContext(ctx, query)
@@ -643,14 +834,19 @@ ORDER BY ci.created_at DESC, ci.id DESC
 		var (
 			item         admin.InstanceRecord
 			terminatedAt sql.NullTime
+			exitCode     sql.NullInt64
 		)
-		if err := rows.Scan(&item.ID, &item.ChallengeID, &item.ChallengeSlug, &item.Username, &item.Status, &item.HostPort, &item.ExpiresAt, &terminatedAt, &item.ContainerID); err != nil {
+		if err := rows.Scan(&item.ID, &item.ChallengeID, &item.ChallengeSlug, &item.Username, &item.Shared, &item.Status, &item.HostPort, &item.ExpiresAt, &terminatedAt, &item.ContainerID, &item.Node, &exitCode); err != nil {
 			return nil, fmt.Errorf("scan instance: %w", err)
 		}
 		if terminatedAt.Valid {
 			t := terminatedAt.Time
 			item.TerminatedAt = &t
 		}
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			item.ExitCode = &code
+		}
 		items = append(items, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -661,27 +857,31 @@ ORDER BY ci.created_at DESC, ci.id DESC
 
 func (r *AdminRepository) GetInstance(ctx context.Context, instanceID int64) (admin.InstanceRecord, error) {
 	const query = `
-SELECT ci.id, c.id, c.slug, u.username, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id
+SELECT ci.id, c.id, c.slug, COALESCE(u.username, ''), ci.user_id IS NULL, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id, ci.docker_node, ci.exit_code
 FROM challenge_instances ci
 JOIN challenges c ON c.id = ci.challenge_id
-JOIN users u ON u.id = ci.user_id
+LEFT JOIN users u ON u.id = ci.user_id
 WHERE ci.id = $1
 LIMIT 1
 `
 	var (
 		item         admin.InstanceRecord
 		terminatedAt sql.NullTime
+		exitCode     sql.NullInt64
 	)
 	if err := r.db.QueryRowContext(ctx, query, instanceID).Scan(
 		&item.ID,
 		&item.ChallengeID,
 		&item.ChallengeSlug,
 		&item.Username,
+		&item.Shared,
 		&item.Status,
 		&item.HostPort,
 		&item.ExpiresAt,
 		&terminatedAt,
 		&item.ContainerID,
+		&item.Node,
+		&exitCode,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return admin.InstanceRecord{}, admin.ErrResourceNotFound
@@ -692,31 +892,53 @@ LIMIT 1
 		t := terminatedAt.Time
 		item.TerminatedAt = &t
 	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		item.ExitCode = &code
+	}
 	return item, nil
 }
 
+func (r *AdminRepository) CreateInstanceEvent(ctx context.Context, instanceID int64, eventType, detail string) error {
+	const query = `
+INSERT INTO instance_events (instance_id, challenge_id, user_id, event_type, detail)
+SELECT id, challenge_id, user_id, $2, $3
+FROM challenge_instances
+WHERE id = $1
+`
+
+	if _, err := r.db.ExecContext(ctx, query, instanceID, eventType, detail); err != nil {
+		return fmt.Errorf("create instance event: %w", err)
+	}
+	return nil
+}
+
 func (r *AdminRepository) TerminateInstance(ctx context.Context, instanceID int64, terminatedAt time.Time) (admin.InstanceRecord, error) {
 	const query = `
 UPDATE challenge_instances ci
 SET status = 'terminated', terminated_at = $2, updated_at = NOW()
-FROM challenges c, users u
-WHERE ci.id = $1 AND c.id = ci.challenge_id AND u.id = ci.user_id
-RETURNING ci.id, c.id, c.slug, u.username, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id
+FROM challenges c
+WHERE ci.id = $1 AND c.id = ci.challenge_id
+RETURNING ci.id, c.id, c.slug, COALESCE((SELECT u.username FROM users u WHERE u.id = ci.user_id), ''), ci.user_id IS NULL, ci.status, ci.host_port, ci.expires_at, ci.terminated_at, ci.docker_container_id, ci.docker_node, ci.exit_code
 `
 	var (
 		item       admin.InstanceRecord
 		terminated sql.NullTime
+		exitCode   sql.NullInt64
 	)
 	err := r.db.QueryRowContext(ctx, query, instanceID, terminatedAt).Scan(
 		&item.ID,
 		&item.ChallengeID,
 		&item.ChallengeSlug,
 		&item.Username,
+		&item.Shared,
 		&item.Status,
 		&item.HostPort,
 		&item.ExpiresAt,
 		&terminated,
 		&item.ContainerID,
+		&item.Node,
+		&exitCode,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -728,6 +950,10 @@ RETURNING ci.id, c.id, c.slug, u.username, ci.status, ci.host_port, ci.expires_a
 		t := terminated.Time
 		item.TerminatedAt = &t
 	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		item.ExitCode = &code
+	}
 	return item, nil
 }
 
@@ -789,8 +1015,10 @@ ORDER BY id ASC
 
 func (r *AdminRepository) getChallengeRuntimeConfig(ctx context.Context, challengeID int64) (admin.RuntimeConfig, error) {
 	const query = `
-SELECT enabled, image_name, exposed_protocol, container_port, default_ttl_seconds, max_renew_count, memory_limit_mb, cpu_limit_millicores,
-       max_active_instances, user_cooldown_seconds, COALESCE(env_json, '{}'::jsonb), COALESCE(command_json, '[]'::jsonb)
+SELECT enabled, mode, network_internal, image_name, exposed_protocol, container_port, default_ttl_seconds, max_renew_count, memory_limit_mb, cpu_limit_millicores,
+       max_active_instances, user_cooldown_seconds, COALESCE(env_json, '{}'::jsonb), COALESCE(command_json, '[]'::jsonb),
+       COALESCE(hardening_json, '{}'::jsonb), COALESCE(services_json, '[]'::jsonb),
+       COALESCE(readiness_json, '{}'::jsonb), warm_pool_size, COALESCE(node_labels_json, '{}'::jsonb), max_restart_count, driver, image_digest
 FROM challenge_runtime_configs
 WHERE challenge_id = $1
 LIMIT 1
@@ -799,6 +1027,8 @@ LIMIT 1
 	var (
 		cfg                admin.RuntimeConfig
 		enabled            bool
+		mode               string
+		networkInternal    bool
 		imageName          string
 		protocol           string
 		containerPort      int
@@ -810,9 +1040,19 @@ LIMIT 1
 		userCooldown       int
 		envJSON            []byte
 		commandJSON        []byte
+		hardeningJSON      []byte
+		servicesJSON       []byte
+		readinessJSON      []byte
+		warmPoolSize       int
+		nodeLabelsJSON     []byte
+		maxRestartCount    int
+		driver             string
+		imageDigest        string
 	)
 	if err := r.db.QueryRowContext(ctx, query, challengeID).Scan(
 		&enabled,
+		&mode,
+		&networkInternal,
 		&imageName,
 		&protocol,
 		&containerPort,
@@ -824,6 +1064,14 @@ LIMIT 1
 		&userCooldown,
 		&envJSON,
 		&commandJSON,
+		&hardeningJSON,
+		&servicesJSON,
+		&readinessJSON,
+		&warmPoolSize,
+		&nodeLabelsJSON,
+		&maxRestartCount,
+		&driver,
+		&imageDigest,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return admin.RuntimeConfig{}, nil
@@ -831,15 +1079,21 @@ LIMIT 1
 		return admin.RuntimeConfig{}, fmt.Errorf("get admin challenge runtime config: %w", err)
 	}
 	cfg.Enabled = enabled
+	cfg.Mode = mode
+	cfg.Driver = driver
+	cfg.ImageDigest = imageDigest
+	cfg.Internal = networkInternal
 	cfg.ImageName = imageName
 	cfg.ExposedProtocol = protocol
 	cfg.ContainerPort = containerPort
 	cfg.DefaultTTL = defaultTTL
 	cfg.MaxRenewCount = maxRenewCount
+	cfg.MaxRestartCount = maxRestartCount
 	cfg.MemoryLimitMB = memoryLimitMB
 	cfg.CPUMilli = cpuLimitMilli
 	cfg.MaxActiveInstances = maxActiveInstances
 	cfg.UserCooldown = userCooldown
+	cfg.WarmPoolSize = warmPoolSize
 	if len(envJSON) > 0 {
 		cfg.Env = make(map[string]string)
 		if err := json.Unmarshal(envJSON, &cfg.Env); err != nil {
@@ -851,6 +1105,26 @@ LIMIT 1
 			return admin.RuntimeConfig{}, fmt.Errorf("decode admin runtime command: %w", err)
 		}
 	}
+	if len(hardeningJSON) > 0 {
+		if err := json.Unmarshal(hardeningJSON, &cfg.Hardening); err != nil {
+			return admin.RuntimeConfig{}, fmt.Errorf("decode admin runtime hardening: %w", err)
+		}
+	}
+	if len(servicesJSON) > 0 {
+		if err := json.Unmarshal(servicesJSON, &cfg.Services); err != nil {
+			return admin.RuntimeConfig{}, fmt.Errorf("decode admin runtime services: %w", err)
+		}
+	}
+	if len(readinessJSON) > 0 {
+		if err := json.Unmarshal(readinessJSON, &cfg.Readiness); err != nil {
+			return admin.RuntimeConfig{}, fmt.Errorf("decode admin runtime readiness: %w", err)
+		}
+	}
+	if len(nodeLabelsJSON) > 0 {
+		if err := json.Unmarshal(nodeLabelsJSON, &cfg.NodeLabels); err != nil {
+			return admin.RuntimeConfig{}, fmt.Errorf("decode admin runtime node labels: %w", err)
+		}
+	}
 	return cfg, nil
 }
 
@@ -866,6 +1140,26 @@ func upsertChallengeRuntimeConfig(ctx context.Context, tx *sql.Tx, challengeID i
 	if err != nil {
 		return fmt.Errorf("encode runtime command: %w", err)
 	}
+	hardeningJSON, err := json.Marshal(cfg.Hardening)
+	if err != nil {
+		return fmt.Errorf("encode runtime hardening: %w", err)
+	}
+	servicesJSON, err := json.Marshal(cfg.Services)
+	if err != nil {
+		return fmt.Errorf("encode runtime services: %w", err)
+	}
+	readinessJSON, err := json.Marshal(cfg.Readiness)
+	if err != nil {
+		return fmt.Errorf("encode runtime readiness: %w", err)
+	}
+	nodeLabels := cfg.NodeLabels
+	if nodeLabels == nil {
+		nodeLabels = map[string]string{}
+	}
+	nodeLabelsJSON, err := json.Marshal(nodeLabels)
+	if err != nil {
+		return fmt.Errorf("encode runtime node labels: %w", err)
+	}
 
 	const query = `
 INSERT INTO challenge_runtime_configs (
@@ -882,8 +1176,17 @@ INSERT INTO challenge_runtime_configs (
     env_json,
     command_json,
     enabled,
+    mode,
+    network_internal,
+    hardening_json,
+    services_json,
+    readiness_json,
+    warm_pool_size,
+    node_labels_json,
+    max_restart_count,
+    driver,
     updated_at
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW())
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NOW())
 ON CONFLICT (challenge_id) DO UPDATE SET
     image_name = EXCLUDED.image_name,
     exposed_protocol = EXCLUDED.exposed_protocol,
@@ -897,8 +1200,26 @@ ON CONFLICT (challenge_id) DO UPDATE SET
     env_json = EXCLUDED.env_json,
     command_json = EXCLUDED.command_json,
     enabled = EXCLUDED.enabled,
+    mode = EXCLUDED.mode,
+    network_internal = EXCLUDED.network_internal,
+    hardening_json = EXCLUDED.hardening_json,
+    services_json = EXCLUDED.services_json,
+    readiness_json = EXCLUDED.readiness_json,
+    warm_pool_size = EXCLUDED.warm_pool_size,
+    node_labels_json = EXCLUDED.node_labels_json,
+    max_restart_count = EXCLUDED.max_restart_count,
+    driver = EXCLUDED.driver,
+    image_digest = CASE WHEN challenge_runtime_configs.image_name = EXCLUDED.image_name THEN challenge_runtime_configs.image_digest ELSE '' END,
     updated_at = NOW()
 `
+	mode := cfg.Mode
+	if mode == "" {
+		mode = runtime.ModePerUser
+	}
+	driver := cfg.Driver
+	if driver == "" {
+		driver = runtime.DriverDocker
+	}
 	if _, err := tx.ExecContext(ctx, query,
 		challengeID,
 		cfg.ImageName,
@@ -913,6 +1234,15 @@ ON CONFLICT (challenge_id) DO UPDATE SET
 		envJSON,
 		commandJSON,
 		cfg.Enabled,
+		mode,
+		cfg.Internal,
+		hardeningJSON,
+		servicesJSON,
+		readinessJSON,
+		cfg.WarmPoolSize,
+		nodeLabelsJSON,
+		cfg.MaxRestartCount,
+		driver,
 	); err != nil {
 		return fmt.Errorf("upsert runtime config: %w", err)
 	}
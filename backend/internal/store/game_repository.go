@@ -68,7 +68,7 @@ func (r *GameRepository) GetChallenge(ctx context.Context, challengeRef string)
 SELECT c.id, c.slug, c.title, cat.slug, c.points, c.difficulty, c.description, c.flag_type, c.dynamic_enabled, c.flag_value
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
-WHERE c.status = 'published' AND c.id = $1
+WHERE c.status = 'published' AND c.archived_at IS NULL AND c.id = $1
 LIMIT 1
 `
 			arg = id
@@ -79,7 +79,7 @@ LIMIT 1
 SELECT c.id, c.slug, c.title, cat.slug, c.points, c.difficulty, c.description, c.flag_type, c.dynamic_enabled, c.flag_value
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
-WHERE c.status = 'published' AND lower(c.slug) = lower($1)
+WHERE c.status = 'published' AND c.archived_at IS NULL AND lower(c.slug) = lower($1)
 LIMIT 1
 `
 	}
@@ -26,7 +26,7 @@ func (r *RuntimeRepository) ListChallenges(ctx context.Context) ([]runtime.Chall
 SELECT c.id::text, c.slug, c.title, cat.slug, c.points, c.difficulty, c.dynamic_enabled
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
-WHERE c.status = 'published'
+WHERE c.status = 'published' AND c.archived_at IS NULL
 ORDER BY c.id ASC
 `
 
@@ -76,12 +76,22 @@ SELECT
     rc.cpu_limit_millicores,
     rc.max_active_instances,
     rc.user_cooldown_seconds,
+    rc.mode,
+    COALESCE(rc.network_internal, FALSE),
     COALESCE(rc.env_json, '{}'::jsonb),
-    COALESCE(rc.command_json, '[]'::jsonb)
+    COALESCE(rc.command_json, '[]'::jsonb),
+    COALESCE(rc.hardening_json, '{}'::jsonb),
+    COALESCE(rc.services_json, '[]'::jsonb),
+    COALESCE(rc.readiness_json, '{}'::jsonb),
+    COALESCE(rc.warm_pool_size, 0),
+    COALESCE(rc.node_labels_json, '{}'::jsonb),
+    COALESCE(rc.max_restart_count, 0),
+    COALESCE(rc.driver, 'docker'),
+    COALESCE(rc.image_digest, '')
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
 LEFT JOIN challenge_runtime_configs rc ON rc.challenge_id = c.id AND rc.enabled = TRUE
-WHERE c.status = 'published' AND c.id = $1
+WHERE c.status = 'published' AND c.archived_at IS NULL AND c.id = $1
 LIMIT 1
 `
 			arg = id
@@ -106,12 +116,22 @@ SELECT
     rc.cpu_limit_millicores,
     rc.max_active_instances,
     rc.user_cooldown_seconds,
+    rc.mode,
+    COALESCE(rc.network_internal, FALSE),
     COALESCE(rc.env_json, '{}'::jsonb),
-    COALESCE(rc.command_json, '[]'::jsonb)
+    COALESCE(rc.command_json, '[]'::jsonb),
+    COALESCE(rc.hardening_json, '{}'::jsonb),
+    COALESCE(rc.services_json, '[]'::jsonb),
+    COALESCE(rc.readiness_json, '{}'::jsonb),
+    COALESCE(rc.warm_pool_size, 0),
+    COALESCE(rc.node_labels_json, '{}'::jsonb),
+    COALESCE(rc.max_restart_count, 0),
+    COALESCE(rc.driver, 'docker'),
+    COALESCE(rc.image_digest, '')
 FROM challenges c
 JOIN categories cat ON cat.id = c.category_id
 LEFT JOIN challenge_runtime_configs rc ON rc.challenge_id = c.id AND rc.enabled = TRUE
-WHERE c.status = 'published' AND lower(c.slug) = lower($1)
+WHERE c.status = 'published' AND c.archived_at IS NULL AND lower(c.slug) = lower($1)
 LIMIT 1
 `
 	}
@@ -133,8 +153,18 @@ LIMIT 1
 		cpuLimitMilli      sql.NullInt32
 		maxActiveInstances sql.NullInt32
 		userCooldown       sql.NullInt32
+		mode               sql.NullString
+		networkInternal    bool
 		envJSON            []byte
 		commandJSON        []byte
+		hardeningJSON      []byte
+		servicesJSON       []byte
+		readinessJSON      []byte
+		warmPoolSize       int
+		nodeLabelsJSON     []byte
+		maxRestartCount    int
+		driver             string
+		imageDigest        string
 	)
 
 	err := r.db.QueryRowContext(ctx, query, arg).Scan(
@@ -154,8 +184,18 @@ LIMIT 1
 		&cpuLimitMilli,
 		&maxActiveInstances,
 		&userCooldown,
+		&mode,
+		&networkInternal,
 		&envJSON,
 		&commandJSON,
+		&hardeningJSON,
+		&servicesJSON,
+		&readinessJSON,
+		&warmPoolSize,
+		&nodeLabelsJSON,
+		&maxRestartCount,
+		&driver,
+		&imageDigest,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -175,14 +215,20 @@ LIMIT 1
 
 	if runtimeConfigID.Valid {
 		cfg.ImageName = imageName.String
+		cfg.ImageDigest = imageDigest
 		cfg.ExposedProtocol = exposedProtocol.String
 		cfg.ContainerPort = int(containerPort.Int32)
 		cfg.TTL = time.Duration(defaultTTL.Int32) * time.Second
 		cfg.MaxRenewCount = int(maxRenewCount.Int32)
+		cfg.MaxRestartCount = maxRestartCount
 		cfg.MemoryLimitMB = int(memoryLimitMB.Int32)
 		cfg.CPUMilli = int(cpuLimitMilli.Int32)
 		cfg.MaxActiveInstances = int(maxActiveInstances.Int32)
 		cfg.UserCooldown = time.Duration(userCooldown.Int32) * time.Second
+		cfg.Mode, _ = runtime.NormalizeMode(mode.String)
+		cfg.Driver, _ = runtime.NormalizeDriver(driver)
+		cfg.Internal = networkInternal
+		cfg.WarmPoolSize = warmPoolSize
 	}
 
 	if len(envJSON) > 0 {
@@ -196,6 +242,26 @@ LIMIT 1
 			return runtime.RuntimeConfigRecord{}, fmt.Errorf("decode runtime command: %w", err)
 		}
 	}
+	if len(hardeningJSON) > 0 {
+		if err := json.Unmarshal(hardeningJSON, &cfg.Hardening); err != nil {
+			return runtime.RuntimeConfigRecord{}, fmt.Errorf("decode runtime hardening: %w", err)
+		}
+	}
+	if len(servicesJSON) > 0 {
+		if err := json.Unmarshal(servicesJSON, &cfg.Services); err != nil {
+			return runtime.RuntimeConfigRecord{}, fmt.Errorf("decode runtime services: %w", err)
+		}
+	}
+	if len(readinessJSON) > 0 {
+		if err := json.Unmarshal(readinessJSON, &cfg.Readiness); err != nil {
+			return runtime.RuntimeConfigRecord{}, fmt.Errorf("decode runtime readiness: %w", err)
+		}
+	}
+	if len(nodeLabelsJSON) > 0 {
+		if err := json.Unmarshal(nodeLabelsJSON, &cfg.NodeLabels); err != nil {
+			return runtime.RuntimeConfigRecord{}, fmt.Errorf("decode runtime node labels: %w", err)
+		}
+	}
 
 	return runtime.RuntimeConfigRecord{
 		ID:        runtimeConfigID.Int64,
@@ -203,24 +269,41 @@ LIMIT 1
 	}, nil
 }
 
+// instanceOwnerFilter selects the instances of one player, or the shared
+// instance (stored with a NULL user_id) for SharedOwnerID. The two cases use
+// separate conditions so that both can use their index on user_id.
+func instanceOwnerFilter(userID int64, challengeID string) (string, []any) {
+	if userID == runtime.SharedOwnerID {
+		return "ci.user_id IS NULL AND ci.challenge_id::text = $1", []any{challengeID}
+	}
+	return "ci.user_id = $1 AND ci.challenge_id::text = $2", []any{userID, challengeID}
+}
+
 func (r *RuntimeRepository) GetActiveInstance(ctx context.Context, userID int64, challengeID string) (runtime.InstanceRecord, error) {
-	const query = `
+	const queryTemplate = `
 SELECT
     ci.id,
     ci.runtime_config_id,
     ci.challenge_id::text,
-    ci.user_id,
+    COALESCE(ci.user_id, 0),
     ci.status,
     ci.host_port,
     ci.renew_count,
+    ci.restart_count,
     ci.started_at,
     ci.expires_at,
     ci.terminated_at,
     ci.docker_container_id,
     ci.docker_container_name,
-    ci.host_ip
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
 FROM challenge_instances ci
-WHERE ci.user_id = $1 AND ci.challenge_id::text = $2 AND ci.status IN ('creating', 'running')
+WHERE %s AND ci.status IN ('creating', 'running')
 LIMIT 1
 `
 
@@ -229,7 +312,8 @@ LIMIT 1
 		terminated sql.NullTime
 	)
 
-	err := r.db.QueryRowContext(ctx, query, userID, challengeID).Scan(
+	filter, args := instanceOwnerFilter(userID, challengeID)
+	err := r.db.QueryRowContext(ctx, fmt.Sprintf(queryTemplate, filter), args...).Scan(
 		&record.ID,
 		&record.RuntimeConfigID,
 		&record.Instance.ChallengeID,
@@ -237,12 +321,19 @@ LIMIT 1
 		&record.Instance.Status,
 		&record.Instance.HostPort,
 		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
 		&record.Instance.StartedAt,
 		&record.Instance.ExpiresAt,
 		&terminated,
 		&record.Instance.ContainerID,
 		&record.Instance.ContainerName,
 		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -271,8 +362,14 @@ INSERT INTO challenge_instances (
     status,
     renew_count,
     started_at,
-    expires_at
-) VALUES ($1::bigint, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    expires_at,
+    proxy_id,
+    upstream_url,
+    gateway_token,
+    docker_node,
+    memory_mb,
+    access_token
+) VALUES ($1::bigint, NULLIF($2::bigint, 0), $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, NULLIF($14, ''), $15, $16, $17)
 RETURNING id
 `
 
@@ -289,6 +386,12 @@ RETURNING id
 		instance.RenewCount,
 		instance.StartedAt,
 		instance.ExpiresAt,
+		instance.ProxyID,
+		instance.UpstreamURL,
+		instance.GatewayToken,
+		instance.Node,
+		instance.MemoryMB,
+		instance.AccessToken,
 	).Scan(&id)
 	if err != nil {
 		return runtime.InstanceRecord{}, fmt.Errorf("create instance: %w", err)
@@ -310,16 +413,23 @@ RETURNING
     ci.id,
     ci.runtime_config_id,
     ci.challenge_id::text,
-    ci.user_id,
+    COALESCE(ci.user_id, 0),
     ci.status,
     ci.host_port,
     ci.renew_count,
+    ci.restart_count,
     ci.started_at,
     ci.expires_at,
     ci.terminated_at,
     ci.docker_container_id,
     ci.docker_container_name,
-    ci.host_ip
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
 `
 
 	var (
@@ -334,12 +444,19 @@ RETURNING
 		&record.Instance.Status,
 		&record.Instance.HostPort,
 		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
 		&record.Instance.StartedAt,
 		&record.Instance.ExpiresAt,
 		&terminated,
 		&record.Instance.ContainerID,
 		&record.Instance.ContainerName,
 		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
@@ -353,6 +470,232 @@ RETURNING
 	return record, nil
 }
 
+// RestartInstance swaps the container of a running instance and counts the
+// restart. Expiry and renewals are left untouched.
+func (r *RuntimeRepository) RestartInstance(ctx context.Context, instanceID int64, instance runtime.Instance) (runtime.InstanceRecord, error) {
+	const query = `
+UPDATE challenge_instances ci
+SET
+    restart_count = ci.restart_count + 1,
+    docker_container_id = $2,
+    docker_container_name = $3,
+    host_ip = $4,
+    host_port = $5,
+    status = $6,
+    proxy_id = NULLIF($7, ''),
+    upstream_url = $8,
+    gateway_token = NULLIF($9, ''),
+    docker_node = $10,
+    started_at = $11,
+    access_token = $12,
+    updated_at = NOW()
+WHERE ci.id = $1 AND ci.status = 'running'
+RETURNING
+    ci.id,
+    ci.runtime_config_id,
+    ci.challenge_id::text,
+    COALESCE(ci.user_id, 0),
+    ci.status,
+    ci.host_port,
+    ci.renew_count,
+    ci.restart_count,
+    ci.started_at,
+    ci.expires_at,
+    ci.terminated_at,
+    ci.docker_container_id,
+    ci.docker_container_name,
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
+`
+
+	var (
+		record     runtime.InstanceRecord
+		terminated sql.NullTime
+	)
+	if err := r.db.QueryRowContext(ctx, query,
+		instanceID,
+		instance.ContainerID,
+		instance.ContainerName,
+		instance.HostIP,
+		instance.HostPort,
+		instance.Status,
+		instance.ProxyID,
+		instance.UpstreamURL,
+		instance.GatewayToken,
+		instance.Node,
+		instance.StartedAt,
+		instance.AccessToken,
+	).Scan(
+		&record.ID,
+		&record.RuntimeConfigID,
+		&record.Instance.ChallengeID,
+		&record.Instance.UserID,
+		&record.Instance.Status,
+		&record.Instance.HostPort,
+		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
+		&record.Instance.StartedAt,
+		&record.Instance.ExpiresAt,
+		&terminated,
+		&record.Instance.ContainerID,
+		&record.Instance.ContainerName,
+		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+		}
+		return runtime.InstanceRecord{}, fmt.Errorf("restart instance: %w", err)
+	}
+	if terminated.Valid {
+		t := terminated.Time
+		record.Instance.TerminatedAt = &t
+	}
+	return record, nil
+}
+
+func (r *RuntimeRepository) GetInstanceByProxyID(ctx context.Context, proxyID string) (runtime.InstanceRecord, error) {
+	const query = `
+SELECT
+    ci.id,
+    ci.runtime_config_id,
+    ci.challenge_id::text,
+    COALESCE(ci.user_id, 0),
+    ci.status,
+    ci.host_port,
+    ci.renew_count,
+    ci.restart_count,
+    ci.started_at,
+    ci.expires_at,
+    ci.terminated_at,
+    ci.docker_container_id,
+    ci.docker_container_name,
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
+FROM challenge_instances ci
+WHERE ci.proxy_id = $1 AND ci.status = 'running'
+LIMIT 1
+`
+
+	var (
+		record     runtime.InstanceRecord
+		terminated sql.NullTime
+	)
+	if err := r.db.QueryRowContext(ctx, query, proxyID).Scan(
+		&record.ID,
+		&record.RuntimeConfigID,
+		&record.Instance.ChallengeID,
+		&record.Instance.UserID,
+		&record.Instance.Status,
+		&record.Instance.HostPort,
+		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
+		&record.Instance.StartedAt,
+		&record.Instance.ExpiresAt,
+		&terminated,
+		&record.Instance.ContainerID,
+		&record.Instance.ContainerName,
+		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+		}
+		return runtime.InstanceRecord{}, fmt.Errorf("get instance by proxy id: %w", err)
+	}
+	if terminated.Valid {
+		t := terminated.Time
+		record.Instance.TerminatedAt = &t
+	}
+	return record, nil
+}
+
+func (r *RuntimeRepository) GetInstanceByGatewayToken(ctx context.Context, token string) (runtime.InstanceRecord, error) {
+	const query = `
+SELECT
+    ci.id,
+    ci.runtime_config_id,
+    ci.challenge_id::text,
+    COALESCE(ci.user_id, 0),
+    ci.status,
+    ci.host_port,
+    ci.renew_count,
+    ci.restart_count,
+    ci.started_at,
+    ci.expires_at,
+    ci.terminated_at,
+    ci.docker_container_id,
+    ci.docker_container_name,
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
+FROM challenge_instances ci
+WHERE ci.gateway_token = $1 AND ci.status = 'running'
+LIMIT 1
+`
+
+	var (
+		record     runtime.InstanceRecord
+		terminated sql.NullTime
+	)
+	if err := r.db.QueryRowContext(ctx, query, token).Scan(
+		&record.ID,
+		&record.RuntimeConfigID,
+		&record.Instance.ChallengeID,
+		&record.Instance.UserID,
+		&record.Instance.Status,
+		&record.Instance.HostPort,
+		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
+		&record.Instance.StartedAt,
+		&record.Instance.ExpiresAt,
+		&terminated,
+		&record.Instance.ContainerID,
+		&record.Instance.ContainerName,
+		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
+		}
+		return runtime.InstanceRecord{}, fmt.Errorf("get instance by gateway token: %w", err)
+	}
+	if terminated.Valid {
+		t := terminated.Time
+		record.Instance.TerminatedAt = &t
+	}
+	return record, nil
+}
+
 func (r *RuntimeRepository) TerminateInstance(ctx context.Context, instanceID int64, terminatedAt time.Time) error {
 	const query = `
 UPDATE challenge_instances
@@ -370,6 +713,157 @@ WHERE id = $1
 	return nil
 }
 
+func (r *RuntimeRepository) ListWarmPoolChallengeIDs(ctx context.Context) ([]string, error) {
+	const query = `
+SELECT c.id::text
+FROM challenges c
+JOIN challenge_runtime_configs rc ON rc.challenge_id = c.id AND rc.enabled = TRUE
+WHERE c.status = 'published' AND c.archived_at IS NULL AND c.dynamic_enabled = TRUE AND rc.mode = 'per-user' AND rc.warm_pool_size > 0
+ORDER BY c.id
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list warm pool challenges: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan warm pool challenge: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate warm pool challenges: %w", err)
+	}
+	return ids, nil
+}
+
+func (r *RuntimeRepository) ListDynamicChallengeIDs(ctx context.Context) ([]string, error) {
+	const query = `
+SELECT c.id::text
+FROM challenges c
+JOIN challenge_runtime_configs rc ON rc.challenge_id = c.id AND rc.enabled = TRUE
+WHERE c.status = 'published' AND c.archived_at IS NULL AND c.dynamic_enabled = TRUE
+ORDER BY c.id
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list dynamic challenges: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan dynamic challenge: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate dynamic challenges: %w", err)
+	}
+	return ids, nil
+}
+
+func (r *RuntimeRepository) AttachInstanceContainer(ctx context.Context, instanceID int64, instance runtime.Instance) error {
+	const query = `
+UPDATE challenge_instances
+SET
+    docker_container_id = $2,
+    docker_container_name = $3,
+    host_ip = $4,
+    host_port = $5,
+    status = $6,
+    started_at = $7,
+    expires_at = $8,
+    proxy_id = NULLIF($9, ''),
+    upstream_url = $10,
+    gateway_token = NULLIF($11, ''),
+    docker_node = $12,
+    updated_at = NOW()
+WHERE id = $1 AND status = 'creating' AND docker_container_id = ''
+`
+
+	result, err := r.db.ExecContext(ctx, query,
+		instanceID,
+		instance.ContainerID,
+		instance.ContainerName,
+		instance.HostIP,
+		instance.HostPort,
+		instance.Status,
+		instance.StartedAt,
+		instance.ExpiresAt,
+		instance.ProxyID,
+		instance.UpstreamURL,
+		instance.GatewayToken,
+		instance.Node,
+	)
+	if err != nil {
+		return fmt.Errorf("attach instance container: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return runtime.ErrRepositoryNotFound
+	}
+	return nil
+}
+
+func (r *RuntimeRepository) MarkInstanceRunning(ctx context.Context, instanceID int64) error {
+	const query = `
+UPDATE challenge_instances
+SET status = 'running', updated_at = NOW()
+WHERE id = $1 AND status = 'creating'
+`
+
+	result, err := r.db.ExecContext(ctx, query, instanceID)
+	if err != nil {
+		return fmt.Errorf("mark instance running: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return runtime.ErrRepositoryNotFound
+	}
+	return nil
+}
+
+func (r *RuntimeRepository) FailInstance(ctx context.Context, instanceID int64, failedAt time.Time, reason string) error {
+	const query = `
+UPDATE challenge_instances
+SET status = 'failed', terminated_at = $2, failure_reason = $3, updated_at = NOW()
+WHERE id = $1 AND status IN ('creating', 'running')
+`
+
+	result, err := r.db.ExecContext(ctx, query, instanceID, failedAt, reason)
+	if err != nil {
+		return fmt.Errorf("fail instance: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return runtime.ErrRepositoryNotFound
+	}
+	return nil
+}
+
+func (r *RuntimeRepository) ExitInstance(ctx context.Context, instanceID int64, exitedAt time.Time, exitCode int) error {
+	const query = `
+UPDATE challenge_instances
+SET status = 'terminated', terminated_at = $2, exit_code = $3, updated_at = NOW()
+WHERE id = $1 AND status IN ('creating', 'running')
+`
+
+	result, err := r.db.ExecContext(ctx, query, instanceID, exitedAt, exitCode)
+	if err != nil {
+		return fmt.Errorf("exit instance: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return runtime.ErrRepositoryNotFound
+	}
+	return nil
+}
+
 func (r *RuntimeRepository) CountActiveInstances(ctx context.Context, challengeID string) (int, error) {
 	const query = `
 SELECT COUNT(*)
@@ -384,24 +878,74 @@ WHERE challenge_id::text = $1 AND status IN ('creating', 'running')
 	return count, nil
 }
 
-func (r *RuntimeRepository) GetLatestInstance(ctx context.Context, userID int64, challengeID string) (runtime.InstanceRecord, error) {
+func (r *RuntimeRepository) ListUserActiveInstances(ctx context.Context, userID int64) ([]runtime.ActiveInstance, error) {
+	const query = `
+SELECT ci.challenge_id::text, c.slug, c.title, ci.status, ci.memory_mb, ci.expires_at
+FROM challenge_instances ci
+JOIN challenges c ON c.id = ci.challenge_id
+WHERE ci.user_id = $1 AND ci.status IN ('creating', 'running')
+ORDER BY ci.started_at ASC, ci.id ASC
+`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list user active instances: %w", err)
+	}
+	defer rows.Close()
+
+	var items []runtime.ActiveInstance
+	for rows.Next() {
+		var item runtime.ActiveInstance
+		if err := rows.Scan(&item.ChallengeID, &item.Slug, &item.Title, &item.Status, &item.MemoryMB, &item.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan user active instance: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate user active instances: %w", err)
+	}
+	return items, nil
+}
+
+func (r *RuntimeRepository) GetInstanceUsage(ctx context.Context) (runtime.InstanceUsage, error) {
 	const query = `
+SELECT COUNT(*), COALESCE(SUM(memory_mb), 0)
+FROM challenge_instances
+WHERE status IN ('creating', 'running')
+`
+
+	var usage runtime.InstanceUsage
+	if err := r.db.QueryRowContext(ctx, query).Scan(&usage.Instances, &usage.MemoryMB); err != nil {
+		return runtime.InstanceUsage{}, fmt.Errorf("get instance usage: %w", err)
+	}
+	return usage, nil
+}
+
+func (r *RuntimeRepository) GetLatestInstance(ctx context.Context, userID int64, challengeID string) (runtime.InstanceRecord, error) {
+	const queryTemplate = `
 SELECT
     ci.id,
     ci.runtime_config_id,
     ci.challenge_id::text,
-    ci.user_id,
+    COALESCE(ci.user_id, 0),
     ci.status,
     ci.host_port,
     ci.renew_count,
+    ci.restart_count,
     ci.started_at,
     ci.expires_at,
     ci.terminated_at,
     ci.docker_container_id,
     ci.docker_container_name,
-    ci.host_ip
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
 FROM challenge_instances ci
-WHERE ci.user_id = $1 AND ci.challenge_id::text = $2
+WHERE %s
 ORDER BY ci.started_at DESC, ci.id DESC
 LIMIT 1
 `
@@ -410,7 +954,8 @@ LIMIT 1
 		record     runtime.InstanceRecord
 		terminated sql.NullTime
 	)
-	if err := r.db.QueryRowContext(ctx, query, userID, challengeID).Scan(
+	filter, args := instanceOwnerFilter(userID, challengeID)
+	if err := r.db.QueryRowContext(ctx, fmt.Sprintf(queryTemplate, filter), args...).Scan(
 		&record.ID,
 		&record.RuntimeConfigID,
 		&record.Instance.ChallengeID,
@@ -418,12 +963,19 @@ LIMIT 1
 		&record.Instance.Status,
 		&record.Instance.HostPort,
 		&record.Instance.RenewCount,
+		&record.Instance.RestartCount,
 		&record.Instance.StartedAt,
 		&record.Instance.ExpiresAt,
 		&terminated,
 		&record.Instance.ContainerID,
 		&record.Instance.ContainerName,
 		&record.Instance.HostIP,
+		&record.Instance.ProxyID,
+		&record.Instance.UpstreamURL,
+		&record.Instance.GatewayToken,
+		&record.Instance.AccessToken,
+		&record.Instance.FailureReason,
+		&record.Instance.Node,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return runtime.InstanceRecord{}, runtime.ErrRepositoryNotFound
@@ -443,16 +995,23 @@ SELECT
     ci.id,
     ci.runtime_config_id,
     ci.challenge_id::text,
-    ci.user_id,
+    COALESCE(ci.user_id, 0),
     ci.status,
     ci.host_port,
     ci.renew_count,
+    ci.restart_count,
     ci.started_at,
     ci.expires_at,
     ci.terminated_at,
     ci.docker_container_id,
     ci.docker_container_name,
-    ci.host_ip
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
 FROM challenge_instances ci
 WHERE ci.status IN ('creating', 'running')
 ORDER BY ci.id ASC
@@ -478,12 +1037,19 @@ ORDER BY ci.id ASC
 			&record.Instance.Status,
 			&record.Instance.HostPort,
 			&record.Instance.RenewCount,
+			&record.Instance.RestartCount,
 			&record.Instance.StartedAt,
 			&record.Instance.ExpiresAt,
 			&terminated,
 			&record.Instance.ContainerID,
 			&record.Instance.ContainerName,
 			&record.Instance.HostIP,
+			&record.Instance.ProxyID,
+			&record.Instance.UpstreamURL,
+			&record.Instance.GatewayToken,
+			&record.Instance.AccessToken,
+			&record.Instance.FailureReason,
+			&record.Instance.Node,
 		); err != nil {
 			return nil, fmt.Errorf("scan active instance: %w", err)
 		}
@@ -532,18 +1098,25 @@ SELECT
     ci.id,
     ci.runtime_config_id,
     ci.challenge_id::text,
-    ci.user_id,
+    COALESCE(ci.user_id, 0),
     ci.status,
     ci.host_port,
     ci.renew_count,
+    ci.restart_count,
     ci.started_at,
     ci.expires_at,
     ci.terminated_at,
     ci.docker_container_id,
     ci.docker_container_name,
-    ci.host_ip
+    ci.host_ip,
+    COALESCE(ci.proxy_id, ''),
+    ci.upstream_url,
+    COALESCE(ci.gateway_token, ''),
+    ci.access_token,
+    ci.failure_reason,
+    ci.docker_node
 FROM challenge_instances ci
-WHERE ci.status IN ('creating', 'running') AND ci.expires_at <= $1
+WHERE ci.status IN ('creating', 'running') AND ci.user_id IS NOT NULL AND ci.expires_at <= $1
 ORDER BY ci.expires_at ASC
 `
 
@@ -567,12 +1140,19 @@ ORDER BY ci.expires_at ASC
 			&record.Instance.Status,
 			&record.Instance.HostPort,
 			&record.Instance.RenewCount,
+			&record.Instance.RestartCount,
 			&record.Instance.StartedAt,
 			&record.Instance.ExpiresAt,
 			&terminated,
 			&record.Instance.ContainerID,
 			&record.Instance.ContainerName,
 			&record.Instance.HostIP,
+			&record.Instance.ProxyID,
+			&record.Instance.UpstreamURL,
+			&record.Instance.GatewayToken,
+			&record.Instance.AccessToken,
+			&record.Instance.FailureReason,
+			&record.Instance.Node,
 		); err != nil {
 			return nil, fmt.Errorf("scan expired instance: %w", err)
 		}
@@ -587,3 +1167,72 @@ ORDER BY ci.expires_at ASC
 	}
 	return items, nil
 }
+
+func (r *RuntimeRepository) RecordInstanceEvent(ctx context.Context, event runtime.InstanceEvent) error {
+	const query = `
+INSERT INTO instance_events (instance_id, challenge_id, user_id, event_type, detail, created_at)
+VALUES ($1, $2::bigint, NULLIF($3::bigint, 0), $4, $5, $6)
+`
+
+	if _, err := r.db.ExecContext(ctx, query, event.InstanceID, event.ChallengeID, event.UserID, event.Type, event.Detail, event.CreatedAt); err != nil {
+		return fmt.Errorf("record instance event: %w", err)
+	}
+	return nil
+}
+
+func (r *RuntimeRepository) ListInstanceEvents(ctx context.Context, filter runtime.InstanceEventFilter) ([]runtime.InstanceEvent, error) {
+	const query = `
+SELECT
+    ie.id,
+    ie.instance_id,
+    ie.challenge_id::text,
+    c.slug,
+    COALESCE(ie.user_id, 0),
+    COALESCE(u.username, ''),
+    ie.event_type,
+    ie.detail,
+    ie.created_at
+FROM instance_events ie
+JOIN challenges c ON c.id = ie.challenge_id
+LEFT JOIN users u ON u.id = ie.user_id
+WHERE ($1::bigint = 0 OR ie.instance_id = $1)
+  AND ($2 = '' OR ie.challenge_id::text = $2)
+  AND ($3::bigint = 0 OR ie.user_id = $3)
+  AND ($4 = '' OR ie.event_type = $4)
+  AND ($5::timestamptz IS NULL OR ie.created_at >= $5)
+  AND ($6::timestamptz IS NULL OR ie.created_at < $6)
+ORDER BY ie.created_at DESC, ie.id DESC
+LIMIT $7
+`
+
+	rows, err := r.db.QueryContext(ctx, query,
+		filter.InstanceID,
+		filter.ChallengeID,
+		filter.UserID,
+		filter.Type,
+		nullTime(filter.Since),
+		nullTime(filter.Until),
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list instance events: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]runtime.InstanceEvent, 0)
+	for rows.Next() {
+		var item runtime.InstanceEvent
+		if err := rows.Scan(&item.ID, &item.InstanceID, &item.ChallengeID, &item.ChallengeSlug, &item.UserID, &item.Username, &item.Type, &item.Detail, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan instance event: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate instance events: %w", err)
+	}
+	return items, nil
+}
+
+func nullTime(value time.Time) sql.NullTime {
+	return sql.NullTime{Time: value, Valid: !value.IsZero()}
+}
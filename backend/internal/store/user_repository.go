@@ -87,6 +87,18 @@ func (r *UserRepository) UpdateLastLogin(ctx context.Context, userID int64, logg
 	return nil
 }
 
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
+	const query = `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return runtime.ErrRepositoryNotFound
+	}
+	return nil
+}
+
 func (r *UserRepository) getOne(ctx context.Context, query string, arg any) (auth.User, error) {
 	var (
 		user        auth.User
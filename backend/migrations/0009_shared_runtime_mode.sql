@@ -0,0 +1,9 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT 'per-user';
+
+ALTER TABLE challenge_instances
+    ALTER COLUMN user_id DROP NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_challenge_instances_running_shared
+    ON challenge_instances (challenge_id)
+    WHERE user_id IS NULL AND status IN ('creating', 'running');
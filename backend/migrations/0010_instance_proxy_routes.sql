@@ -0,0 +1,7 @@
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS proxy_id TEXT,
+    ADD COLUMN IF NOT EXISTS upstream_url TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_challenge_instances_running_proxy_id
+    ON challenge_instances (proxy_id)
+    WHERE proxy_id IS NOT NULL AND status IN ('creating', 'running');
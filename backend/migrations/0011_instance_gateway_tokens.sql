@@ -0,0 +1,6 @@
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS gateway_token TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_challenge_instances_running_gateway_token
+    ON challenge_instances (gateway_token)
+    WHERE gateway_token IS NOT NULL AND status IN ('creating', 'running');
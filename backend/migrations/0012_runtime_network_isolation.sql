@@ -0,0 +1,2 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS network_internal BOOLEAN NOT NULL DEFAULT FALSE;
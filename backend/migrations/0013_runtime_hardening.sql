@@ -0,0 +1,2 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS hardening_json JSONB NOT NULL DEFAULT '{}'::jsonb;
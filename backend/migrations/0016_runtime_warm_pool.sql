@@ -0,0 +1,2 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS warm_pool_size INT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS node_labels_json JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS docker_node TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE challenge_runtime_configs
+    ADD COLUMN IF NOT EXISTS max_restart_count INT NOT NULL DEFAULT 0;
+
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS restart_count INT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS instance_events (
+    id BIGSERIAL PRIMARY KEY,
+    instance_id BIGINT NOT NULL REFERENCES challenge_instances(id) ON DELETE CASCADE,
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_instance_events_instance
+    ON instance_events (instance_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_instance_events_user_challenge
+    ON instance_events (user_id, challenge_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_instance_events_type_created
+    ON instance_events (event_type, created_at DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS exit_code INT;
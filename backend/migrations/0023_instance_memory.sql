@@ -0,0 +1,6 @@
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS memory_mb INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_challenge_instances_active_user
+    ON challenge_instances (user_id)
+    WHERE status IN ('creating', 'running');
@@ -0,0 +1,2 @@
+ALTER TABLE challenge_instances
+    ADD COLUMN IF NOT EXISTS access_token TEXT NOT NULL DEFAULT '';
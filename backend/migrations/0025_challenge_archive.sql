@@ -0,0 +1,2 @@
+ALTER TABLE challenges
+    ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS challenge_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    source_version INTEGER,
+    actor_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    snapshot_json JSONB NOT NULL,
+    changes_json JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (challenge_id, version)
+);
@@ -0,0 +1,3 @@
+UPDATE challenge_instances
+SET expires_at = TIMESTAMPTZ '9999-12-31 00:00:00+00'
+WHERE user_id IS NULL;
@@ -1,6 +1,19 @@
+import { proofOfWork } from './pow'
+
 export type ApiError = {
   error: string
   message: string
+  quota?: string
+  active_instances?: ActiveInstanceSummary[]
+}
+
+export type ActiveInstanceSummary = {
+  challenge_id: string
+  slug: string
+  title: string
+  status: string
+  memory_mb: number
+  expires_at: string
 }
 
 export type AuthUser = {
@@ -112,9 +125,37 @@ export type RuntimeInstance = {
   access_url?: string
   host_port?: number
   renew_count: number
+  restart_count?: number
   started_at: string
   expires_at: string
   terminated_at?: string | null
+  ready_deadline?: string | null
+  idle_expires_at?: string | null
+  queue_position?: number
+  // Only GET /instances/me carries the latest events.
+  events?: InstanceEvent[]
+}
+
+export type InstanceEvent = {
+  id: number
+  instance_id: number
+  challenge_id: string
+  challenge_slug?: string
+  user_id?: number
+  username?: string
+  type: string
+  detail?: string
+  created_at: string
+}
+
+export type InstanceEventQuery = {
+  instance_id?: number
+  challenge_id?: string
+  user_id?: number
+  type?: string
+  since?: string
+  until?: string
+  limit?: number
 }
 
 export type SubmissionResult = {
@@ -148,19 +189,99 @@ export type UserSolve = {
   solved_at: string
 }
 
+export type AdminRuntimeMode = 'per-user' | 'shared'
+
+export type AdminRuntimeDriver = 'docker' | 'process'
+
+export type AdminRuntimeHardening = {
+  read_only_rootfs?: boolean
+  tmpfs?: Record<string, string>
+  cap_add?: string[] | null
+  no_new_privileges?: boolean
+  pids_limit?: number
+  ulimits?: { name: string; soft: number; hard: number }[]
+  seccomp_profile?: string
+  user?: string
+  disk_quota_mb?: number
+}
+
+export type AdminRuntimeService = {
+  name: string
+  image: string
+  env?: Record<string, string>
+  command?: string[]
+  memory_limit_mb?: number
+  cpu_limit_millicores?: number
+}
+
+export type AdminRuntimeReadiness = {
+  type?: '' | 'tcp' | 'http'
+  path?: string
+  expected_status?: number
+  timeout_seconds?: number
+}
+
 export type AdminRuntimeConfig = {
   enabled: boolean
+  mode?: AdminRuntimeMode
+  driver?: AdminRuntimeDriver
+  internal?: boolean
   image_name: string
+  image_digest?: string
   exposed_protocol: string
   container_port: number
   default_ttl_seconds: number
   max_renew_count: number
+  max_restart_count?: number
   memory_limit_mb: number
   cpu_limit_millicores: number
   max_active_instances: number
   user_cooldown_seconds: number
   env?: Record<string, string>
   command?: string[]
+  hardening?: AdminRuntimeHardening
+  services?: AdminRuntimeService[]
+  readiness?: AdminRuntimeReadiness
+  warm_pool_size?: number
+  node_labels?: Record<string, string>
+}
+
+export type AdminNodeImage = {
+  node: string
+  present: boolean
+  image_id?: string
+  error?: string
+}
+
+export type AdminImageCheck = {
+  image: string
+  digest?: string
+  ready: boolean
+  nodes: AdminNodeImage[]
+}
+
+export type AdminChallengeImages = {
+  challenge_id: string
+  slug: string
+  title: string
+  ready: boolean
+  images: AdminImageCheck[]
+}
+
+export type AdminImagePull = {
+  image: string
+  digest?: string
+  node: string
+  status: 'present' | 'pulled' | 'failed' | 'digest_mismatch'
+  error?: string
+  duration_ms: number
+}
+
+export type AdminImagePullSummary = {
+  images: number
+  present: number
+  pulled: number
+  failed: number
 }
 
 export type AdminAttachment = {
@@ -187,6 +308,7 @@ export type AdminChallengeSummary = {
   status: string
   visible: boolean
   dynamic_enabled: boolean
+  archived_at?: string
 }
 
 export type AdminChallengeDetail = {
@@ -203,11 +325,48 @@ export type AdminChallengeDetail = {
   visible: boolean
   dynamic_enabled: boolean
   sort_order: number
+  archived_at?: string
   authors: AdminChallengeAuthor[]
   attachments: AdminAttachment[]
   runtime_config: AdminRuntimeConfig
 }
 
+export type AdminFieldChange = {
+  field: string
+  before?: unknown
+  after?: unknown
+}
+
+export type AdminChallengeWarning = {
+  code: string
+  message: string
+}
+
+export type AdminChallengeRevision = {
+  id: number
+  challenge_id: number
+  version: number
+  action: 'create' | 'update' | 'rollback' | 'external'
+  source_version?: number
+  actor_user_id?: number
+  actor_username?: string
+  changes: AdminFieldChange[]
+  created_at: string
+}
+
+export type AdminChallengeRevisionDiff = {
+  from: number
+  to: number
+  changes: AdminFieldChange[]
+  warnings?: AdminChallengeWarning[]
+}
+
+export type AdminChallengeChange = {
+  challenge: AdminChallengeSummary
+  revision?: number
+  warnings?: AdminChallengeWarning[]
+}
+
 export type AdminChallengeInput = {
   slug: string
   title: string
@@ -243,6 +402,22 @@ export type AdminSubmission = {
   source_ip: string
 }
 
+export type AdminExecResult = {
+  exit_code: number
+  output: string
+  truncated: boolean
+}
+
+export type AdminInstanceStats = {
+  cpu_percent: number
+  memory_bytes: number
+  memory_limit_bytes: number
+  network_rx_bytes: number
+  network_tx_bytes: number
+  pids: number
+  sampled_at: string
+}
+
 export type AdminInstance = {
   id: number
   challenge_id: number
@@ -253,6 +428,9 @@ export type AdminInstance = {
   expires_at: string
   terminated_at?: string | null
   container_id: string
+  node?: string
+  exit_code?: number
+  stats?: AdminInstanceStats
 }
 
 export type AdminMyRuntimeInstance = {
@@ -261,6 +439,7 @@ export type AdminMyRuntimeInstance = {
   access_url?: string
   host_port?: number
   renew_count: number
+  restart_count?: number
   started_at: string
   expires_at: string
   terminated_at?: string | null
@@ -313,6 +492,7 @@ async function request<T>(path: string, init?: RequestInit, token?: string): Pro
     const error = new Error(payload?.message ?? `HTTP ${response.status}`)
     ;(error as Error & { code?: string; status?: number }).code = payload?.error
     ;(error as Error & { code?: string; status?: number }).status = response.status
+    ;(error as Error & { activeInstances?: ActiveInstanceSummary[] }).activeInstances = payload?.active_instances
     throw error
   }
   return (await response.json()) as T
@@ -322,16 +502,18 @@ export const api = {
   contest() {
     return request<ContestResponse>('/api/v1/contest')
   },
-  register(input: { username: string; email: string; password: string; display_name: string }) {
+  async register(input: { username: string; email: string; password: string; display_name: string }) {
+    const pow = await proofOfWork('register')
     return request<AuthResponse>('/api/v1/auth/register', {
       method: 'POST',
-      body: JSON.stringify(input),
+      body: JSON.stringify({ ...input, ...pow }),
     })
   },
-  login(identifier: string, password: string) {
+  async login(identifier: string, password: string) {
+    const pow = await proofOfWork('login')
     return request<AuthResponse>('/api/v1/auth/login', {
       method: 'POST',
-      body: JSON.stringify({ identifier, password }),
+      body: JSON.stringify({ identifier, password, ...pow }),
     })
   },
   me(token: string) {
@@ -368,9 +550,15 @@ export const api = {
   renewInstance(token: string, challengeID: string) {
     return request<RuntimeInstance>(`/api/v1/challenges/${challengeID}/instances/me/renew`, { method: 'POST' }, token)
   },
+  restartInstance(token: string, challengeID: string) {
+    return request<RuntimeInstance>(`/api/v1/challenges/${challengeID}/instances/me/restart`, { method: 'POST' }, token)
+  },
   deleteInstance(token: string, challengeID: string) {
     return request<RuntimeInstance>(`/api/v1/challenges/${challengeID}/instances/me`, { method: 'DELETE' }, token)
   },
+  instanceEvents(token: string, challengeID: string) {
+    return request<{ items: InstanceEvent[] }>(`/api/v1/challenges/${challengeID}/instances/me/events`, undefined, token)
+  },
   mySubmissions(token: string) {
     return request<{ items: UserSubmission[] }>('/api/v1/me/submissions', undefined, token)
   },
@@ -420,7 +608,7 @@ export const api = {
     )
   },
   updateAdminChallenge(token: string, challengeID: number, payload: AdminChallengeInput) {
-    return request<{ challenge: AdminChallengeSummary }>(
+    return request<AdminChallengeChange>(
       `/api/v1/admin/challenges/${challengeID}`,
       {
         method: 'PATCH',
@@ -429,6 +617,50 @@ export const api = {
       token,
     )
   },
+  adminChallengeRevisions(token: string, challengeID: number) {
+    return request<{ items: AdminChallengeRevision[] }>(`/api/v1/admin/challenges/${challengeID}/revisions`, undefined, token)
+  },
+  adminDiffChallengeRevisions(token: string, challengeID: number, from: number, to: number) {
+    return request<AdminChallengeRevisionDiff>(`/api/v1/admin/challenges/${challengeID}/revisions/diff?from=${from}&to=${to}`, undefined, token)
+  },
+  rollbackAdminChallenge(token: string, challengeID: number, version: number) {
+    return request<AdminChallengeChange>(`/api/v1/admin/challenges/${challengeID}/revisions/${version}/rollback`, { method: 'POST' }, token)
+  },
+  archiveAdminChallenge(token: string, challengeID: number) {
+    return request<{ challenge: AdminChallengeDetail }>(`/api/v1/admin/challenges/${challengeID}/archive`, { method: 'POST' }, token)
+  },
+  restoreAdminChallenge(token: string, challengeID: number) {
+    return request<{ challenge: AdminChallengeDetail }>(`/api/v1/admin/challenges/${challengeID}/restore`, { method: 'POST' }, token)
+  },
+  deleteAdminChallenge(token: string, challengeID: number, confirmSlug: string) {
+    return request<{ challenge: AdminChallengeDetail }>(
+      `/api/v1/admin/challenges/${challengeID}`,
+      {
+        method: 'DELETE',
+        body: JSON.stringify({ confirm_slug: confirmSlug }),
+      },
+      token,
+    )
+  },
+  async exportAdminChallenge(token: string, challengeID: number, format: 'zip' | 'tar.gz' = 'zip') {
+    const response = await fetch(`/api/v1/admin/challenges/${challengeID}/export?format=${format}`, {
+      headers: { Authorization: `Bearer ${token}` },
+    })
+    if (!response.ok) {
+      let payload: ApiError | null = null
+      try {
+        payload = (await response.json()) as ApiError
+      } catch {
+        payload = null
+      }
+      const error = new Error(payload?.message ?? `HTTP ${response.status}`)
+      ;(error as Error & { code?: string; status?: number }).code = payload?.error
+      ;(error as Error & { code?: string; status?: number }).status = response.status
+      throw error
+    }
+    const filename = /filename="([^"]+)"/.exec(response.headers.get('Content-Disposition') ?? '')?.[1] ?? `challenge-${challengeID}.${format}`
+    return { blob: await response.blob(), filename }
+  },
   uploadAdminAttachment(token: string, challengeID: number, file: File) {
     const form = new FormData()
     form.append('file', file)
@@ -463,6 +695,27 @@ export const api = {
   adminInstances(token: string) {
     return request<{ items: AdminInstance[] }>('/api/v1/admin/instances', undefined, token)
   },
+  adminInstanceEvents(token: string, query: InstanceEventQuery = {}) {
+    const params = new URLSearchParams()
+    for (const [key, value] of Object.entries(query)) {
+      if (value !== undefined && value !== '') params.set(key, String(value))
+    }
+    const suffix = params.toString() ? `?${params.toString()}` : ''
+    return request<{ items: InstanceEvent[] }>(`/api/v1/admin/instance-events${suffix}`, undefined, token)
+  },
+  adminInstanceLogs(token: string, instanceID: number, tail = 200) {
+    return request<{ logs: string }>(`/api/v1/admin/instances/${instanceID}/logs?tail=${tail}`, undefined, token)
+  },
+  adminExecInstance(token: string, instanceID: number, command: string[]) {
+    return request<AdminExecResult>(
+      `/api/v1/admin/instances/${instanceID}/exec`,
+      {
+        method: 'POST',
+        body: JSON.stringify({ command }),
+      },
+      token,
+    )
+  },
   terminateAdminInstance(token: string, instanceID: number) {
     return request<{ instance: AdminInstance }>(`/api/v1/admin/instances/${instanceID}/terminate`, { method: 'POST' }, token)
   },
@@ -505,6 +758,63 @@ export const api = {
     )
   },
 
+  adminRuntimeImages(token: string) {
+    return request<{ items: AdminChallengeImages[] }>('/api/v1/admin/runtime/images', undefined, token)
+  },
+  async adminPullRuntimeImages(token: string, onProgress: (pull: AdminImagePull) => void) {
+    const response = await fetch('/api/v1/admin/runtime/images/pull', {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${token}` },
+    })
+    if (!response.ok || !response.body) {
+      let payload: ApiError | null = null
+      try {
+        payload = (await response.json()) as ApiError
+      } catch {
+        payload = null
+      }
+      const error = new Error(payload?.message ?? `HTTP ${response.status}`)
+      ;(error as Error & { code?: string; status?: number }).code = payload?.error
+      ;(error as Error & { code?: string; status?: number }).status = response.status
+      throw error
+    }
+    const reader = response.body.pipeThrough(new TextDecoderStream()).getReader()
+    let buffer = ''
+    let summary: AdminImagePullSummary | null = null
+    let failure = ''
+    for (;;) {
+      const { value, done } = await reader.read()
+      if (done) break
+      buffer += value
+      let end = buffer.indexOf('\n\n')
+      while (end >= 0) {
+        const lines = buffer.slice(0, end).split('\n')
+        buffer = buffer.slice(end + 2)
+        end = buffer.indexOf('\n\n')
+        const event = lines.find((line) => line.startsWith('event: '))?.slice(7)
+        const data = JSON.parse(lines.find((line) => line.startsWith('data: '))?.slice(6) ?? 'null')
+        if (event === 'progress') onProgress(data as AdminImagePull)
+        if (event === 'error') failure = (data as { error: string }).error
+        if (event === 'end') summary = data as AdminImagePullSummary
+      }
+    }
+    if (failure || !summary) throw new Error(failure || '镜像拉取中断。')
+    return summary
+  },
+  adminPinChallengeImage(token: string, challengeID: number, digest?: string) {
+    return request<{ runtime_config: AdminRuntimeConfig }>(
+      `/api/v1/admin/challenges/${challengeID}/image-pin`,
+      {
+        method: 'POST',
+        body: JSON.stringify(digest ? { digest } : {}),
+      },
+      token,
+    )
+  },
+  adminUnpinChallengeImage(token: string, challengeID: number) {
+    return request<{ runtime_config: AdminRuntimeConfig }>(`/api/v1/admin/challenges/${challengeID}/image-pin`, { method: 'DELETE' }, token)
+  },
+
   adminGetMyInstance(token: string, challengeID: number) {
     return request<AdminMyRuntimeInstance>(`/api/v1/admin/challenges/${challengeID}/instances/me`, undefined, token)
   },
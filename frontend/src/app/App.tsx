@@ -6,6 +6,7 @@ import {
   type AuthUser,
   type ContestInfo,
   type ContestPhase,
+  type InstanceEvent,
   type PublicAnnouncement,
   type PublicChallengeSummary,
   type RuntimeInstance,
@@ -87,6 +88,23 @@ function makeSolveTrend(items: Array<{ solved_at: string }>, buckets = 24): { co
   return { counts, normalized }
 }
 
+const instanceEventLabels: Record<string, string> = {
+  created: '创建',
+  ready: '就绪',
+  renewed: '续期',
+  restarted: '重置',
+  expired: '到期回收',
+  idle_reclaimed: '空闲回收',
+  terminated: '已删除',
+  terminated_by_admin: '管理员终止',
+  reconciled_missing: '容器丢失',
+  start_failed: '启动失败',
+  readiness_failed: '就绪检查失败',
+  resource_limit_exceeded: '资源超限终止',
+  oom_killed: '内存耗尽终止',
+  exited: '容器异常退出',
+}
+
 function formatRelative(date: Date, now = safeNow()): string {
   const diffMs = date.getTime() - now.getTime()
   const diffSec = Math.round(diffMs / 1000)
@@ -289,6 +307,7 @@ export function App(): React.JSX.Element {
 
   const [instance, setInstance] = useState<RuntimeInstance | null>(null)
   const [instanceLoading, setInstanceLoading] = useState(false)
+  const [instanceEvents, setInstanceEvents] = useState<InstanceEvent[]>([])
 
   const [scoreboard, setScoreboard] = useState<ScoreboardEntry[]>([])
   const [scoreboardLoading, setScoreboardLoading] = useState(false)
@@ -306,6 +325,7 @@ export function App(): React.JSX.Element {
     setAuthUser(null)
     setSubmissionResult(null)
     setInstance(null)
+    setInstanceEvents([])
     if (message) {
       setAuthNotice({ tone: 'neutral', text: message })
     }
@@ -452,6 +472,7 @@ export function App(): React.JSX.Element {
     setChallengeLoading(true)
     setSubmissionResult(null)
     setInstance(null)
+    setInstanceEvents([])
     void api
       .challenge(activeChallengeID)
       .then((response) => {
@@ -549,8 +570,21 @@ export function App(): React.JSX.Element {
     } finally {
       setInstanceLoading(false)
     }
+    // History outlives the instance, so it is refreshed even when the lookup fails.
+    try {
+      const response = await api.instanceEvents(token, String(activeChallenge.id))
+      setInstanceEvents(response.items)
+    } catch {
+      setInstanceEvents([])
+    }
   }, [activeChallenge, contestPhase?.runtime_allowed, guardedNotice, token])
 
+  useEffect(() => {
+    if (instance?.status !== 'creating') return
+    const timer = window.setTimeout(() => void loadInstance(), 2000)
+    return () => window.clearTimeout(timer)
+  }, [instance, loadInstance])
+
   const startInstance = useCallback(async () => {
     if (!token || !activeChallenge) {
       setAuthNotice({ tone: 'neutral', text: '请先登录并选择题目。' })
@@ -586,6 +620,20 @@ export function App(): React.JSX.Element {
     }
   }, [activeChallenge, guardedNotice, token])
 
+  const restartInstance = useCallback(async () => {
+    if (!token || !activeChallenge) return
+    setInstanceLoading(true)
+    setAuthNotice(null)
+    try {
+      const next = await api.restartInstance(token, String(activeChallenge.id))
+      setInstance(next)
+    } catch (error) {
+      setAuthNotice(guardedNotice(error, '实例重置失败。'))
+    } finally {
+      setInstanceLoading(false)
+    }
+  }, [activeChallenge, guardedNotice, token])
+
   const terminateInstance = useCallback(async () => {
     if (!token || !activeChallenge) return
     setInstanceLoading(true)
@@ -1162,6 +1210,9 @@ export function App(): React.JSX.Element {
                           <button className="ghost-button" type="button" disabled={!contestPhase?.runtime_allowed || instanceLoading} onClick={() => void renewInstance()}>
                             续期
                           </button>
+                          <button className="ghost-button" type="button" disabled={!contestPhase?.runtime_allowed || instanceLoading} onClick={() => void restartInstance()}>
+                            重置
+                          </button>
                           <button className="ghost-button danger-button" type="button" disabled={!contestPhase?.runtime_allowed || instanceLoading} onClick={() => void terminateInstance()}>
                             删除
                           </button>
@@ -1176,6 +1227,10 @@ export function App(): React.JSX.Element {
                                 <a className="link-button" href={instance.access_url} target="_blank" rel="noreferrer">
                                   打开
                                 </a>
+                              ) : instance?.status === 'creating' && instance.queue_position ? (
+                                `排队中，前方还有 ${instance.queue_position - 1} 个启动请求`
+                              ) : instance?.status === 'creating' ? (
+                                '实例启动中，就绪后提供访问地址'
                               ) : (
                                 '启动后提供访问地址'
                               )}
@@ -1190,15 +1245,40 @@ export function App(): React.JSX.Element {
                                   ? '…'
                                   : '—'}
                             </strong>
-                            <small className="hint-text">expires at {instance?.expires_at ?? '—'}</small>
+                            <small className="hint-text">
+                              {instance?.idle_expires_at
+                                ? `长时间无访问，将于 ${formatDateTimeCompact(parseRfc3339(instance.idle_expires_at) ?? safeNow())} 回收，访问或续期即可保留`
+                                : `expires at ${instance?.expires_at ?? '—'}`}
+                            </small>
                           </div>
                           <div className="runtime-metric">
                             <span className="eyebrow">Renew</span>
                             <strong>{instance?.renew_count ?? 0}</strong>
                             <small className="hint-text">续期次数</small>
                           </div>
+                          <div className="runtime-metric">
+                            <span className="eyebrow">Restart</span>
+                            <strong>{instance?.restart_count ?? 0}</strong>
+                            <small className="hint-text">重置次数</small>
+                          </div>
                         </div>
 
+                        {instanceEvents.length > 0 ? (
+                          <details className="detail-row">
+                            <summary style={{ cursor: 'pointer' }}>
+                              <strong>实例记录</strong>
+                            </summary>
+                            <div className="hint-text" style={{ marginTop: 8 }}>
+                              {instanceEvents.slice(0, 10).map((item) => (
+                                <div key={item.id}>
+                                  · {formatDateTimeCompact(parseRfc3339(item.created_at) ?? safeNow())} #{item.instance_id}{' '}
+                                  {instanceEventLabels[item.type] ?? item.type}
+                                </div>
+                              ))}
+                            </div>
+                          </details>
+                        ) : null}
+
                         <details className="detail-row">
                           <summary style={{ cursor: 'pointer' }}>
                             <strong>常见失败原因</strong>
@@ -1206,6 +1286,7 @@ export function App(): React.JSX.Element {
                           <div className="hint-text" style={{ marginTop: 8 }}>
                             <div>· instance_capacity_reached：题目并发上限</div>
                             <div>· instance_cooldown_active：用户冷却中</div>
+                            <div>· instance_quota_exceeded：个人或平台实例配额已满</div>
                             <div>· instance_port_exhausted：端口池耗尽</div>
                           </div>
                         </details>
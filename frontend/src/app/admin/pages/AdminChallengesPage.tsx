@@ -1,6 +1,6 @@
 import React, { useEffect, useMemo, useState } from 'react'
 
-import { api, type AdminAttachment, type AdminChallengeAuthor, type AdminChallengeInput, type AdminChallengeSummary } from '../../../api'
+import { api, type AdminAttachment, type AdminChallengeAuthor, type AdminChallengeImages, type AdminImagePull, type AdminChallengeInput, type AdminChallengeRevision, type AdminChallengeRevisionDiff, type AdminChallengeSummary, type AdminChallengeWarning, type AdminRuntimeDriver, type AdminRuntimeHardening, type AdminRuntimeMode, type AdminRuntimeReadiness } from '../../../api'
 import { NoticeBanner } from '../../components/NoticeBanner'
 import type { Notice } from '../../utils/errors'
 import { errorToNotice } from '../../utils/errors'
@@ -16,6 +16,15 @@ function formatBytes(bytes: number): string {
   return `${value.toFixed(fixed)} ${units[idx]}`
 }
 
+function formatRevisionValue(value: unknown): string {
+  if (value === undefined || value === null) return '—'
+  return typeof value === 'string' ? value : JSON.stringify(value)
+}
+
+function warningText(warnings?: AdminChallengeWarning[]): string {
+  return (warnings ?? []).map((item) => item.message).join('；')
+}
+
 const CHALLENGE_STATUSES = ['draft', 'review', 'ready', 'published'] as const
 const DIFFICULTIES = ['easy', 'normal', 'hard'] as const
 
@@ -35,11 +44,14 @@ function defaultChallengeInput(): AdminChallengeInput {
     sort_order: 10,
     runtime_config: {
       enabled: false,
+      mode: 'per-user',
+      driver: 'docker',
       image_name: '',
       exposed_protocol: 'http',
       container_port: 80,
       default_ttl_seconds: 1800,
       max_renew_count: 0,
+      max_restart_count: 0,
       memory_limit_mb: 256,
       cpu_limit_millicores: 500,
       max_active_instances: 0,
@@ -65,6 +77,10 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
 
   const [attachments, setAttachments] = useState<AdminAttachment[]>([])
 
+  const [revisions, setRevisions] = useState<AdminChallengeRevision[]>([])
+  const [revisionsLoading, setRevisionsLoading] = useState(false)
+  const [revisionDiff, setRevisionDiff] = useState<AdminChallengeRevisionDiff | null>(null)
+
   const [authors, setAuthors] = useState<AdminChallengeAuthor[]>([])
   const [authorsLoading, setAuthorsLoading] = useState(false)
   const [usersLoading, setUsersLoading] = useState(false)
@@ -78,6 +94,10 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
 
   const [buildResult, setBuildResult] = useState<{ stdout: string; stderr: string; exit_code: number; duration_ms: number; command: string[]; error?: string } | null>(null)
 
+  const [imageItems, setImageItems] = useState<AdminChallengeImages[] | null>(null)
+  const [imagePulls, setImagePulls] = useState<AdminImagePull[]>([])
+  const [imageBusy, setImageBusy] = useState(false)
+
   const [myInstance, setMyInstance] = useState<null | {
     status: string
     access_url?: string
@@ -119,6 +139,14 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
     patchRuntime(key, { env: update })
   }
 
+  const patchRuntimeHardening = (key: string, update: Partial<AdminRuntimeHardening>): void => {
+    patchRuntime(key, { hardening: { ...(draft.runtime_config?.hardening ?? {}), ...update } })
+  }
+
+  const patchRuntimeReadiness = (key: string, update: Partial<AdminRuntimeReadiness>): void => {
+    patchRuntime(key, { readiness: { ...(draft.runtime_config?.readiness ?? {}), ...update } })
+  }
+
   const activeSummary = useMemo(() => items.find((item) => item.id === activeID) ?? null, [activeID, items])
 
   const deriveTemplateFromDraft = useMemo(() => {
@@ -149,6 +177,11 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
     return hasAdminPermission({ role: meRole } as any, 'user:write')
   }, [meRole])
 
+  const canDeleteChallenge = useMemo(() => {
+    // Backend: hard delete is admin-only.
+    return hasAdminPermission({ role: meRole } as any, 'challenge:delete')
+  }, [meRole])
+
   const loadList = async (): Promise<void> => {
     setLoading(true)
     setNotice(null)
@@ -212,6 +245,54 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
     }
   }
 
+  const loadRevisions = async (id: number): Promise<void> => {
+    setRevisionsLoading(true)
+    setRevisionDiff(null)
+    try {
+      const response = await api.adminChallengeRevisions(props.token, id)
+      setRevisions(response.items)
+    } catch (error) {
+      setRevisions([])
+      setNotice(errorToNotice(error, '历史版本加载失败。'))
+    } finally {
+      setRevisionsLoading(false)
+    }
+  }
+
+  const showRevisionDiff = async (version: number): Promise<void> => {
+    if (!activeID || !revisions.length) return
+    try {
+      setRevisionDiff(await api.adminDiffChallengeRevisions(props.token, activeID, version, revisions[0].version))
+    } catch (error) {
+      setNotice(errorToNotice(error, '版本对比失败。'))
+    }
+  }
+
+  const rollbackRevision = async (version: number): Promise<void> => {
+    if (!activeID || !revisions.length) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      const diff = await api.adminDiffChallengeRevisions(props.token, activeID, revisions[0].version, version)
+      const fields = diff.changes.map((item) => item.field).join(', ') || '无'
+      const warning = diff.warnings?.length ? `\n\n警告：${warningText(diff.warnings)}` : ''
+      if (!window.confirm(`回滚到 v${version}？将改动：${fields}${warning}`)) return
+      const response = await api.rollbackAdminChallenge(props.token, activeID, version)
+      if (response.warnings?.length) {
+        setNotice({ tone: 'danger', text: `已回滚到 v${version}，请注意：${warningText(response.warnings)}` })
+      } else {
+        setNotice({ tone: 'ok', text: `已回滚到 v${version}。` })
+      }
+      await loadDetail(activeID)
+      await loadRevisions(activeID)
+      await loadList()
+    } catch (error) {
+      setNotice(errorToNotice(error, '回滚失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
   const loadMyInstance = async (): Promise<void> => {
     if (!activeID) return
     setMyInstanceLoading(true)
@@ -331,7 +412,10 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
   }, [])
 
   useEffect(() => {
-    if (activeID) void loadDetail(activeID)
+    if (activeID) {
+      void loadDetail(activeID)
+      void loadRevisions(activeID)
+    }
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, [activeID])
 
@@ -345,11 +429,16 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
     setSaving(true)
     setNotice(null)
     try {
-      await api.updateAdminChallenge(props.token, activeID, draft)
-      setNotice({ tone: 'ok', text: '已保存题目。' })
+      const response = await api.updateAdminChallenge(props.token, activeID, draft)
+      if (response.warnings?.length) {
+        setNotice({ tone: 'danger', text: `已保存题目，请注意：${warningText(response.warnings)}` })
+      } else {
+        setNotice({ tone: 'ok', text: '已保存题目。' })
+      }
       setLastSavedDraft(draft)
       setDirtyFields(new Set())
       await loadList()
+      await loadRevisions(activeID)
     } catch (error) {
       setNotice(errorToNotice(error, '保存题目失败。'))
     } finally {
@@ -495,6 +584,150 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
     }
   }
 
+  const checkImages = async (): Promise<void> => {
+    setImageBusy(true)
+    setNotice(null)
+    try {
+      const response = await api.adminRuntimeImages(props.token)
+      setImageItems(response.items)
+    } catch (error) {
+      setNotice(errorToNotice(error, '镜像检查失败。'))
+    } finally {
+      setImageBusy(false)
+    }
+  }
+
+  const pullImages = async (): Promise<void> => {
+    setImageBusy(true)
+    setNotice(null)
+    setImagePulls([])
+    try {
+      const summary = await api.adminPullRuntimeImages(props.token, (pull) => setImagePulls((current) => [...current, pull]))
+      setNotice({
+        tone: summary.failed ? 'danger' : 'ok',
+        text: `预拉取完成：${summary.images} 个镜像，已存在 ${summary.present}，新拉取 ${summary.pulled}，失败 ${summary.failed}`,
+      })
+      const response = await api.adminRuntimeImages(props.token)
+      setImageItems(response.items)
+    } catch (error) {
+      setNotice(errorToNotice(error, '镜像预拉取失败。'))
+    } finally {
+      setImageBusy(false)
+    }
+  }
+
+  const applyImageDigest = (digest: string | undefined): void => {
+    const update = (current: AdminChallengeInput): AdminChallengeInput => ({
+      ...current,
+      runtime_config: { ...(current.runtime_config ?? defaultChallengeInput().runtime_config!), image_digest: digest },
+    })
+    setDraft(update)
+    setLastSavedDraft(update)
+  }
+
+  const pinImage = async (): Promise<void> => {
+    if (!activeID) return
+    setImageBusy(true)
+    setNotice(null)
+    try {
+      const response = await api.adminPinChallengeImage(props.token, activeID)
+      applyImageDigest(response.runtime_config.image_digest)
+      setNotice({ tone: 'ok', text: `已固定镜像：${response.runtime_config.image_digest ?? ''}` })
+    } catch (error) {
+      setNotice(errorToNotice(error, '固定镜像失败。'))
+    } finally {
+      setImageBusy(false)
+    }
+  }
+
+  const unpinImage = async (): Promise<void> => {
+    if (!activeID) return
+    setImageBusy(true)
+    setNotice(null)
+    try {
+      const response = await api.adminUnpinChallengeImage(props.token, activeID)
+      applyImageDigest(response.runtime_config.image_digest)
+      setNotice({ tone: 'ok', text: '已解除镜像固定。' })
+    } catch (error) {
+      setNotice(errorToNotice(error, '解除固定失败。'))
+    } finally {
+      setImageBusy(false)
+    }
+  }
+
+  const archiveChallenge = async (): Promise<void> => {
+    if (!activeID || !activeSummary) return
+    if (!window.confirm(`归档 ${activeSummary.slug}？选手将看不到该题，运行中的实例会被停止，解题记录保留。`)) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      const response = await api.archiveAdminChallenge(props.token, activeID)
+      setItems((list) => list.map((item) => (item.id === activeID ? { ...item, archived_at: response.challenge.archived_at } : item)))
+      setNotice({ tone: 'ok', text: '题目已归档。' })
+    } catch (error) {
+      setNotice(errorToNotice(error, '归档失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const restoreChallenge = async (): Promise<void> => {
+    if (!activeID) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      await api.restoreAdminChallenge(props.token, activeID)
+      setItems((list) => list.map((item) => (item.id === activeID ? { ...item, archived_at: undefined } : item)))
+      setNotice({ tone: 'ok', text: '题目已恢复。' })
+    } catch (error) {
+      setNotice(errorToNotice(error, '恢复失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const exportChallenge = async (): Promise<void> => {
+    if (!activeID) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      const { blob, filename } = await api.exportAdminChallenge(props.token, activeID)
+      const url = URL.createObjectURL(blob)
+      const link = document.createElement('a')
+      link.href = url
+      link.download = filename
+      link.click()
+      URL.revokeObjectURL(url)
+      setNotice({
+        tone: 'ok',
+        text: dirtyFields.size ? `已导出 ${filename}（只包含已保存的内容）。` : `已导出 ${filename}，解压后可用 import-challenges 导入。`,
+      })
+    } catch (error) {
+      setNotice(errorToNotice(error, '导出失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const deleteChallenge = async (): Promise<void> => {
+    if (!activeID || !activeSummary) return
+    const confirmSlug = window.prompt(`永久删除题目及其提交、解题记录和附件文件，无法恢复。请输入 slug（${activeSummary.slug}）确认：`)
+    if (confirmSlug === null) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      await api.deleteAdminChallenge(props.token, activeID, confirmSlug)
+      setItems((list) => list.filter((item) => item.id !== activeID))
+      setActiveID(null)
+      setDraft(defaultChallengeInput())
+      setNotice({ tone: 'ok', text: `已删除 ${activeSummary.slug}。` })
+    } catch (error) {
+      setNotice(errorToNotice(error, '删除失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
   const runtimeEnabled = Boolean(draft.runtime_config?.enabled)
   const runtimeEnv = draft.runtime_config?.env ?? {}
   const runtimeCommandText = useMemo(() => {
@@ -612,6 +845,48 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
           ) : null}
         </details>
 
+        <details className="detail-row" style={{ marginTop: 12 }}>
+          <summary style={{ cursor: 'pointer' }}>
+            <strong>镜像就绪</strong>
+          </summary>
+
+          <div className="hint-text" style={{ marginTop: 10 }}>
+            检查已发布动态题的镜像是否已在所有可调度节点上，比赛前预拉取缺失的镜像。
+          </div>
+
+          <div className="wrap-actions" style={{ marginTop: 12 }}>
+            <button className="ghost-button" type="button" disabled={imageBusy} onClick={() => void checkImages()}>
+              {imageBusy ? '处理中…' : '检查镜像'}
+            </button>
+            <button className="primary-button" type="button" disabled={imageBusy || !canDoServerLocal} onClick={() => void pullImages()}>
+              {imageBusy ? '处理中…' : '预拉取全部'}
+            </button>
+          </div>
+
+          {imageItems ? (
+            <div className="detail-stack" style={{ marginTop: 12 }}>
+              {imageItems.map((item) => (
+                <div key={item.challenge_id} className="hint-text">
+                  <strong>{item.ready ? '✓' : '✗'} {item.slug}</strong>
+                  {item.images.map((image) => (
+                    <div key={image.image}>
+                      {image.image}
+                      {image.digest ? `@${image.digest.slice(7, 19)}` : ''} ·{' '}
+                      {image.nodes.map((node) => `${node.node}${node.present ? '' : node.error ? '（不可达）' : '（缺失）'}`).join(', ') || '无可调度节点'}
+                    </div>
+                  ))}
+                </div>
+              ))}
+            </div>
+          ) : null}
+
+          {imagePulls.length ? (
+            <pre className="code-block" style={{ marginTop: 12 }}>
+              {imagePulls.map((pull) => `${pull.node}\t${pull.status}\t${pull.image}${pull.error ? `\t${pull.error}` : ''}`).join('\n')}
+            </pre>
+          ) : null}
+        </details>
+
         <div className="challenge-card-list" style={{ marginTop: 12 }}>
           {items.map((item) => (
             <button
@@ -625,7 +900,7 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                 <small>
                   {item.category} · {item.points} pts · {item.dynamic_enabled ? 'Dyn' : 'Static'}
                 </small>
-                <small>{item.status}</small>
+                <small>{item.archived_at ? 'archived' : item.status}</small>
               </div>
             </button>
           ))}
@@ -642,6 +917,30 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
             </div>
             <div className="inline-actions">
               {dirtyFields.size ? <span className="badge badge-accent">未保存 {dirtyFields.size}</span> : <span className="badge">已同步</span>}
+              {activeSummary?.archived_at ? <span className="badge">已归档</span> : null}
+              {activeSummary ? (
+                <button className="ghost-button" type="button" disabled={saving} onClick={() => void exportChallenge()}>
+                  导出
+                </button>
+              ) : null}
+              {activeSummary ? (
+                activeSummary.archived_at ? (
+                  <>
+                    <button className="ghost-button" type="button" disabled={saving} onClick={() => void restoreChallenge()}>
+                      恢复
+                    </button>
+                    {canDeleteChallenge ? (
+                      <button className="ghost-button danger-button" type="button" disabled={saving} onClick={() => void deleteChallenge()}>
+                        永久删除
+                      </button>
+                    ) : null}
+                  </>
+                ) : (
+                  <button className="ghost-button danger-button" type="button" disabled={saving} onClick={() => void archiveChallenge()}>
+                    归档
+                  </button>
+                )
+              ) : null}
               {activeID ? (
                 <button className="primary-button" type="button" disabled={saving || detailLoading} onClick={() => void save()}>
                   {saving ? '保存中…' : '保存'}
@@ -786,6 +1085,36 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                   <option value="udp">udp</option>
                 </select>
               </label>
+              <label className="field">
+                <span>mode</span>
+                <select
+                  value={draft.runtime_config?.mode ?? 'per-user'}
+                  onChange={(e) => patchRuntime('runtime.mode', { mode: e.target.value as AdminRuntimeMode })}
+                >
+                  <option value="per-user">per-user</option>
+                  <option value="shared">shared</option>
+                </select>
+              </label>
+              <label className="field">
+                <span>driver</span>
+                <select
+                  value={draft.runtime_config?.driver ?? 'docker'}
+                  onChange={(e) => patchRuntime('runtime.driver', { driver: e.target.value as AdminRuntimeDriver })}
+                >
+                  <option value="docker">docker</option>
+                  <option value="process">process（目录名填入 image_name）</option>
+                </select>
+              </label>
+              <label className="field">
+                <span>internal（禁止出网）</span>
+                <select
+                  value={String(Boolean(draft.runtime_config?.internal))}
+                  onChange={(e) => patchRuntime('runtime.internal', { internal: e.target.value === 'true' })}
+                >
+                  <option value="false">false</option>
+                  <option value="true">true</option>
+                </select>
+              </label>
 
               <label className="field" style={{ gridColumn: '1 / -1' }}>
                 <span>image_name</span>
@@ -797,6 +1126,24 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                 <small className="hint-text">建议与 templates 目录同名；动态实例启动时会直接拉取/使用该 tag。</small>
               </label>
 
+              {(draft.runtime_config?.driver ?? 'docker') === 'docker' ? (
+                <div className="field" style={{ gridColumn: '1 / -1' }}>
+                  <span>image_digest</span>
+                  <div className="wrap-actions">
+                    <code>{draft.runtime_config?.image_digest || '未固定'}</code>
+                    <button className="ghost-button" type="button" disabled={imageBusy || !activeID || runtimeDirty} onClick={() => void pinImage()}>
+                      固定当前镜像
+                    </button>
+                    {draft.runtime_config?.image_digest ? (
+                      <button className="ghost-button" type="button" disabled={imageBusy || !activeID} onClick={() => void unpinImage()}>
+                        解除固定
+                      </button>
+                    ) : null}
+                  </div>
+                  <small className="hint-text">固定后实例按镜像 ID 创建，重新构建同名镜像不影响比赛中的题目；修改 image_name 会自动解除固定。</small>
+                </div>
+              ) : null}
+
               <label className="field">
                 <span>container_port</span>
                 <input
@@ -844,6 +1191,17 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                   onChange={(e) => patchRuntime('runtime.max_renew_count', { max_renew_count: Number(e.target.value) })}
                 />
               </label>
+
+              <label className="field">
+                <span>max_restart_count</span>
+                <input
+                  type="number"
+                  min={0}
+                  value={draft.runtime_config?.max_restart_count ?? 0}
+                  disabled={draft.runtime_config?.mode === 'shared'}
+                  onChange={(e) => patchRuntime('runtime.max_restart_count', { max_restart_count: Number(e.target.value) })}
+                />
+              </label>
               <label className="field">
                 <span>max_active_instances</span>
                 <input
@@ -864,6 +1222,36 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                 />
               </label>
 
+              <label className="field">
+                <span>warm_pool_size</span>
+                <input
+                  type="number"
+                  min={0}
+                  max={32}
+                  value={draft.runtime_config?.warm_pool_size ?? 0}
+                  disabled={draft.runtime_config?.mode === 'shared'}
+                  onChange={(e) => patchRuntime('runtime.warm_pool_size', { warm_pool_size: Number(e.target.value) })}
+                />
+              </label>
+
+              <label className="field">
+                <span>node_labels</span>
+                <input
+                  value={Object.entries(draft.runtime_config?.node_labels ?? {})
+                    .map(([k, v]) => `${k}=${v}`)
+                    .join(',')}
+                  onChange={(e) => {
+                    const labels: Record<string, string> = {}
+                    for (const part of e.target.value.split(',')) {
+                      const [k, ...rest] = part.split('=')
+                      if (k.trim()) labels[k.trim()] = rest.join('=').trim()
+                    }
+                    patchRuntime('runtime.node_labels', { node_labels: labels })
+                  }}
+                  placeholder="gpu=true,zone=a"
+                />
+              </label>
+
               <label className="field" style={{ gridColumn: '1 / -1' }}>
                 <span>command</span>
                 <input
@@ -880,6 +1268,108 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
                 />
                 <small className="hint-text">简单按空格切分（不支持引号转义）；复杂 command 建议通过导入 spec 写入。</small>
               </label>
+
+              <label className="field">
+                <span>read_only_rootfs</span>
+                <select
+                  value={String(Boolean(draft.runtime_config?.hardening?.read_only_rootfs))}
+                  onChange={(e) => patchRuntimeHardening('runtime.hardening.read_only_rootfs', { read_only_rootfs: e.target.value === 'true' })}
+                >
+                  <option value="false">false</option>
+                  <option value="true">true</option>
+                </select>
+              </label>
+
+              <label className="field">
+                <span>pids_limit（0 为默认 256）</span>
+                <input
+                  type="number"
+                  min={0}
+                  value={draft.runtime_config?.hardening?.pids_limit ?? 0}
+                  onChange={(e) => patchRuntimeHardening('runtime.hardening.pids_limit', { pids_limit: Number(e.target.value) })}
+                />
+              </label>
+
+              <label className="field">
+                <span>seccomp_profile</span>
+                <input
+                  value={draft.runtime_config?.hardening?.seccomp_profile ?? ''}
+                  onChange={(e) => patchRuntimeHardening('runtime.hardening.seccomp_profile', { seccomp_profile: e.target.value })}
+                  placeholder="default"
+                />
+              </label>
+
+              <label className="field">
+                <span>user</span>
+                <input
+                  value={draft.runtime_config?.hardening?.user ?? ''}
+                  onChange={(e) => patchRuntimeHardening('runtime.hardening.user', { user: e.target.value })}
+                  placeholder="镜像默认用户"
+                />
+                <small className="hint-text">capability、tmpfs、ulimit 等其他加固项请通过导入 spec 的 runtime.hardening 写入。</small>
+              </label>
+
+              <label className="field">
+                <span>readiness.type</span>
+                <select
+                  value={draft.runtime_config?.readiness?.type ?? ''}
+                  onChange={(e) => patchRuntimeReadiness('runtime.readiness.type', { type: e.target.value as AdminRuntimeReadiness['type'] })}
+                >
+                  <option value="">none</option>
+                  <option value="tcp">tcp</option>
+                  <option value="http">http</option>
+                </select>
+                <small className="hint-text">开启后实例保持 creating，探测通过才返回访问地址。</small>
+              </label>
+
+              <label className="field">
+                <span>readiness.timeout_seconds（0 为默认 60）</span>
+                <input
+                  type="number"
+                  min={0}
+                  value={draft.runtime_config?.readiness?.timeout_seconds ?? 0}
+                  onChange={(e) => patchRuntimeReadiness('runtime.readiness.timeout_seconds', { timeout_seconds: Number(e.target.value) })}
+                />
+              </label>
+
+              {draft.runtime_config?.readiness?.type === 'http' ? (
+                <>
+                  <label className="field">
+                    <span>readiness.path</span>
+                    <input
+                      value={draft.runtime_config?.readiness?.path ?? ''}
+                      onChange={(e) => patchRuntimeReadiness('runtime.readiness.path', { path: e.target.value })}
+                      placeholder="/"
+                    />
+                  </label>
+
+                  <label className="field">
+                    <span>readiness.expected_status</span>
+                    <input
+                      type="number"
+                      min={0}
+                      value={draft.runtime_config?.readiness?.expected_status ?? 200}
+                      onChange={(e) => patchRuntimeReadiness('runtime.readiness.expected_status', { expected_status: Number(e.target.value) })}
+                    />
+                  </label>
+                </>
+              ) : null}
+
+              <div className="field" style={{ gridColumn: '1 / -1' }}>
+                <span>services（伴随容器）</span>
+                {(draft.runtime_config?.services ?? []).length === 0 ? (
+                  <small className="hint-text">无；当前为单容器题目。</small>
+                ) : (
+                  <ul>
+                    {(draft.runtime_config?.services ?? []).map((service) => (
+                      <li key={service.name}>
+                        <code>{service.name}</code> · {service.image}
+                      </li>
+                    ))}
+                  </ul>
+                )}
+                <small className="hint-text">伴随容器按顺序先于入口容器启动，可通过服务名互相访问，入口容器的服务名为 app；请通过导入 spec 的 runtime.services 编辑。</small>
+              </div>
             </div>
 
             <div className="divider-line" style={{ marginTop: 14 }}>
@@ -1033,6 +1523,66 @@ export function AdminChallengesPage(props: { token: string }): React.JSX.Element
           </section>
         ) : null}
 
+        {activeID ? (
+          <section className="panel">
+            <header className="panel-head">
+              <div>
+                <p className="eyebrow">Revisions</p>
+                <h2>历史版本</h2>
+                <p className="panel-subtitle">每次保存、回滚都会记录一个版本；external 表示导入等编辑器之外的改动。</p>
+              </div>
+              <div className="inline-actions">
+                <button className="ghost-button" type="button" disabled={revisionsLoading} onClick={() => activeID && void loadRevisions(activeID)}>
+                  {revisionsLoading ? '加载中…' : '刷新'}
+                </button>
+              </div>
+            </header>
+
+            {revisions.length ? (
+              <div className="attachment-list" style={{ marginTop: 12 }}>
+                {revisions.map((item, index) => (
+                  <div key={item.version} className="attachment-row">
+                    <div style={{ display: 'grid', gap: 2 }}>
+                      <strong>
+                        v{item.version} · {item.action}
+                        {item.source_version ? ` ← v${item.source_version}` : ''}
+                        {item.actor_username ? ` · @${item.actor_username}` : ''}
+                      </strong>
+                      <small className="hint-text">
+                        {item.created_at} · {item.changes.length ? item.changes.map((change) => change.field).join(', ') : '初始版本'}
+                      </small>
+                    </div>
+                    {index > 0 ? (
+                      <div className="inline-actions">
+                        <button className="ghost-button" type="button" onClick={() => void showRevisionDiff(item.version)}>
+                          对比当前
+                        </button>
+                        <button className="ghost-button danger-button" type="button" disabled={saving} onClick={() => void rollbackRevision(item.version)}>
+                          回滚
+                        </button>
+                      </div>
+                    ) : (
+                      <span className="badge">当前</span>
+                    )}
+                  </div>
+                ))}
+              </div>
+            ) : (
+              <div className="hint-text">暂无历史版本，首次保存后开始记录。</div>
+            )}
+
+            {revisionDiff ? (
+              <pre className="code-block" style={{ marginTop: 12 }}>
+                {[
+                  `v${revisionDiff.from} → v${revisionDiff.to}`,
+                  ...revisionDiff.changes.map((item) => `${item.field}\t${formatRevisionValue(item.before)} → ${formatRevisionValue(item.after)}`),
+                  ...(revisionDiff.warnings ?? []).map((item) => `! ${item.message}`),
+                ].join('\n')}
+              </pre>
+            ) : null}
+          </section>
+        ) : null}
+
         {activeID ? (
           <section className="panel">
             <header className="panel-head">
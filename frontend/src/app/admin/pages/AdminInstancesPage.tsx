@@ -5,6 +5,15 @@ import { NoticeBanner } from '../../components/NoticeBanner'
 import type { Notice } from '../../utils/errors'
 import { errorToNotice } from '../../utils/errors'
 
+function formatBytes(bytes: number): string {
+  if (!Number.isFinite(bytes) || bytes <= 0) return '0 B'
+  const units = ['B', 'KB', 'MB', 'GB']
+  const idx = Math.min(units.length - 1, Math.max(0, Math.floor(Math.log(bytes) / Math.log(1024))))
+  const value = bytes / 1024 ** idx
+  const fixed = value >= 10 || idx === 0 ? 0 : 1
+  return `${value.toFixed(fixed)} ${units[idx]}`
+}
+
 export function AdminInstancesPage(props: { token: string }): React.JSX.Element {
   const [loading, setLoading] = useState(false)
   const [saving, setSaving] = useState(false)
@@ -12,6 +21,7 @@ export function AdminInstancesPage(props: { token: string }): React.JSX.Element
 
   const [items, setItems] = useState<AdminInstance[]>([])
   const [filter, setFilter] = useState('')
+  const [inspection, setInspection] = useState<{ id: number; title: string; text: string } | null>(null)
 
   const load = async (): Promise<void> => {
     setLoading(true)
@@ -52,6 +62,58 @@ export function AdminInstancesPage(props: { token: string }): React.JSX.Element
     }
   }
 
+  const showLogs = async (instanceID: number): Promise<void> => {
+    setSaving(true)
+    setNotice(null)
+    try {
+      const response = await api.adminInstanceLogs(props.token, instanceID)
+      setInspection({ id: instanceID, title: '最近日志', text: response.logs })
+    } catch (error) {
+      setNotice(errorToNotice(error, '读取实例日志失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const showEvents = async (instanceID: number): Promise<void> => {
+    setSaving(true)
+    setNotice(null)
+    try {
+      const response = await api.adminInstanceEvents(props.token, { instance_id: instanceID })
+      const text = response.items
+        .map((event) => `${event.created_at}  ${event.type}${event.detail ? `  ${event.detail}` : ''}`)
+        .join('\n')
+      setInspection({ id: instanceID, title: '生命周期事件', text })
+    } catch (error) {
+      setNotice(errorToNotice(error, '读取实例事件失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const exec = async (instanceID: number): Promise<void> => {
+    const input = prompt(`在实例 #${instanceID} 中执行诊断命令（按空格切分，不经过 shell，会写入审计日志）`, 'ps aux')
+    const command = (input ?? '')
+      .split(' ')
+      .map((p) => p.trim())
+      .filter(Boolean)
+    if (command.length === 0) return
+    setSaving(true)
+    setNotice(null)
+    try {
+      const result = await api.adminExecInstance(props.token, instanceID, command)
+      setInspection({
+        id: instanceID,
+        title: `${command.join(' ')} · exit ${result.exit_code}${result.truncated ? ' · 输出已截断' : ''}`,
+        text: result.output,
+      })
+    } catch (error) {
+      setNotice(errorToNotice(error, '执行诊断命令失败。'))
+    } finally {
+      setSaving(false)
+    }
+  }
+
   return (
     <section className="admin-traffic-view">
       <section className="panel">
@@ -99,10 +161,38 @@ export function AdminInstancesPage(props: { token: string }): React.JSX.Element
                   <span className="badge">{item.challenge_slug}</span>
                   <span className="badge">@{item.username}</span>
                   <span className="badge">:{item.host_port}</span>
+                  {item.node ? <span className="badge">node {item.node}</span> : null}
+                  {item.exit_code !== undefined ? <span className="badge">exit {item.exit_code}</span> : null}
                 </div>
                 <strong>{item.container_id}</strong>
                 <div className="hint-text">expires_at {item.expires_at}{item.terminated_at ? ` · terminated_at ${item.terminated_at}` : ''}</div>
+                {item.stats ? (
+                  <div className="badge-row" style={{ marginTop: 8 }}>
+                    <span className="badge">CPU {item.stats.cpu_percent.toFixed(1)}%</span>
+                    <span className="badge">
+                      内存 {formatBytes(item.stats.memory_bytes)}
+                      {item.stats.memory_limit_bytes ? ` / ${formatBytes(item.stats.memory_limit_bytes)}` : ''}
+                    </span>
+                    <span className="badge">↓ {formatBytes(item.stats.network_rx_bytes)} ↑ {formatBytes(item.stats.network_tx_bytes)}</span>
+                    <span className="badge">PIDs {item.stats.pids}</span>
+                  </div>
+                ) : null}
+                {inspection?.id === item.id ? (
+                  <div style={{ marginTop: 12 }}>
+                    <div className="hint-text">{inspection.title}</div>
+                    <pre className="code-block">{inspection.text.trim() || '(empty)'}</pre>
+                  </div>
+                ) : null}
                 <div className="wrap-actions" style={{ marginTop: 12 }}>
+                  <button className="ghost-button" type="button" disabled={saving || item.status === 'terminated'} onClick={() => void showLogs(item.id)}>
+                    日志
+                  </button>
+                  <button className="ghost-button" type="button" disabled={saving} onClick={() => void showEvents(item.id)}>
+                    事件
+                  </button>
+                  <button className="ghost-button" type="button" disabled={saving || item.status === 'terminated'} onClick={() => void exec(item.id)}>
+                    诊断命令
+                  </button>
                   <button className="ghost-button danger-button" type="button" disabled={saving} onClick={() => void terminate(item.id)}>
                     终止
                   </button>
@@ -5,6 +5,7 @@ export type AdminPermission =
   | 'contest:write'
   | 'challenge:read'
   | 'challenge:write'
+  | 'challenge:delete'
   | 'attachment:write'
   | 'announcement:read'
   | 'announcement:write'
@@ -30,6 +31,7 @@ export function hasAdminPermission(user: AuthUser | null, permission: AdminPermi
       'contest:write': true,
       'challenge:read': true,
       'challenge:write': true,
+      'challenge:delete': true,
       'attachment:write': true,
       'announcement:read': true,
       'announcement:write': true,
@@ -45,6 +47,7 @@ export function hasAdminPermission(user: AuthUser | null, permission: AdminPermi
       'contest:write': false,
       'challenge:read': true,
       'challenge:write': false,
+      'challenge:delete': false,
       'attachment:write': true,
       'announcement:read': true,
       'announcement:write': false,
@@ -60,6 +63,7 @@ export function hasAdminPermission(user: AuthUser | null, permission: AdminPermi
       'contest:write': false,
       'challenge:read': true,
       'challenge:write': true,
+      'challenge:delete': false,
       'attachment:write': true,
       'announcement:read': false,
       'announcement:write': false,
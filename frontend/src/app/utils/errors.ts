@@ -1,6 +1,9 @@
+import type { ActiveInstanceSummary } from '../../api'
+
 export type AppError = Error & {
   code?: string
   status?: number
+  activeInstances?: ActiveInstanceSummary[]
 }
 
 export type NoticeTone = 'neutral' | 'ok' | 'danger'
@@ -62,6 +65,12 @@ export function errorToNotice(error: unknown, fallback: string): Notice {
   if (code === 'instance_capacity_reached') {
     return { tone: 'danger', text: '当前题目实例配额已满，请稍后再试。' }
   }
+  if (code === 'instance_quota_exceeded') {
+    const active = (error as AppError).activeInstances ?? []
+    const list = active.map((item) => item.title || item.slug || item.challenge_id).join('、')
+    const base = (error as AppError).status === 503 ? '平台实例资源已满，请稍后再试。' : '已达到个人实例配额，请先停止一个实例。'
+    return { tone: 'danger', text: list ? `${base}当前活动实例：${list}` : base }
+  }
   if (code === 'instance_cooldown_active') {
     return { tone: 'danger', text: '刚刚创建过实例，冷却中，请稍后再试。' }
   }
@@ -0,0 +1,130 @@
+// Client side of the optional proof-of-work gate on register and login. The
+// server issues a signed challenge; a solution is a nonce such that
+// sha256(challenge + ":" + nonce) starts with `difficulty` zero bits.
+//
+// SHA-256 is implemented here instead of using crypto.subtle, which is only
+// available on HTTPS origins and is too slow when awaited once per attempt.
+
+export type PowChallengeResponse = {
+  enabled: boolean
+  challenge?: string
+  algorithm?: string
+  scope?: string
+  difficulty?: number
+  expires_at?: string
+}
+
+export type PowSolution = {
+  pow_challenge: string
+  pow_nonce: string
+}
+
+const K = new Uint32Array([
+  0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5, 0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3,
+  0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174, 0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+  0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967, 0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13,
+  0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85, 0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+  0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3, 0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208,
+  0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+])
+
+const words = new Uint32Array(64)
+
+// sha256 returns the eight 32-bit words of the digest of bytes.
+export function sha256(bytes: Uint8Array): Uint32Array {
+  const padded = new Uint8Array(Math.ceil((bytes.length + 9) / 64) * 64)
+  padded.set(bytes)
+  padded[bytes.length] = 0x80
+  const view = new DataView(padded.buffer)
+  const bitLength = bytes.length * 8
+  view.setUint32(padded.length - 8, Math.floor(bitLength / 0x100000000))
+  view.setUint32(padded.length - 4, bitLength >>> 0)
+
+  const hash = new Uint32Array([0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19])
+  for (let offset = 0; offset < padded.length; offset += 64) {
+    for (let i = 0; i < 16; i++) {
+      words[i] = view.getUint32(offset + i * 4)
+    }
+    for (let i = 16; i < 64; i++) {
+      const w15 = words[i - 15]
+      const w2 = words[i - 2]
+      const s0 = ((w15 >>> 7) | (w15 << 25)) ^ ((w15 >>> 18) | (w15 << 14)) ^ (w15 >>> 3)
+      const s1 = ((w2 >>> 17) | (w2 << 15)) ^ ((w2 >>> 19) | (w2 << 13)) ^ (w2 >>> 10)
+      words[i] = (words[i - 16] + s0 + words[i - 7] + s1) | 0
+    }
+    let a = hash[0]
+    let b = hash[1]
+    let c = hash[2]
+    let d = hash[3]
+    let e = hash[4]
+    let f = hash[5]
+    let g = hash[6]
+    let h = hash[7]
+    for (let i = 0; i < 64; i++) {
+      const s1 = ((e >>> 6) | (e << 26)) ^ ((e >>> 11) | (e << 21)) ^ ((e >>> 25) | (e << 7))
+      const t1 = (h + s1 + ((e & f) ^ (~e & g)) + K[i] + words[i]) | 0
+      const s0 = ((a >>> 2) | (a << 30)) ^ ((a >>> 13) | (a << 19)) ^ ((a >>> 22) | (a << 10))
+      const t2 = (s0 + ((a & b) ^ (a & c) ^ (b & c))) | 0
+      h = g
+      g = f
+      f = e
+      e = (d + t1) | 0
+      d = c
+      c = b
+      b = a
+      a = (t1 + t2) | 0
+    }
+    hash[0] += a
+    hash[1] += b
+    hash[2] += c
+    hash[3] += d
+    hash[4] += e
+    hash[5] += f
+    hash[6] += g
+    hash[7] += h
+  }
+  return hash
+}
+
+export function leadingZeroBits(digest: Uint32Array): number {
+  let count = 0
+  for (const word of digest) {
+    if (word === 0) {
+      count += 32
+      continue
+    }
+    return count + Math.clz32(word)
+  }
+  return count
+}
+
+// solvePow searches nonces 0, 1, 2, ... and yields to the event loop between
+// batches so the page stays responsive while it works.
+export async function solvePow(challenge: string, difficulty: number): Promise<string> {
+  const encoder = new TextEncoder()
+  const batch = 4096
+  for (let start = 0; ; start += batch) {
+    for (let nonce = start; nonce < start + batch; nonce++) {
+      if (leadingZeroBits(sha256(encoder.encode(`${challenge}:${nonce}`))) >= difficulty) {
+        return String(nonce)
+      }
+    }
+    await new Promise((resolve) => setTimeout(resolve, 0))
+  }
+}
+
+// proofOfWork fetches a challenge for scope and solves it. It resolves to an
+// empty object when the gate is off, so the result can always be spread into
+// the request body.
+export async function proofOfWork(scope: 'register' | 'login'): Promise<PowSolution | Record<string, never>> {
+  const response = await fetch(`/api/v1/auth/pow-challenge?scope=${scope}`)
+  if (!response.ok) {
+    throw new Error(`HTTP ${response.status}`)
+  }
+  const payload = (await response.json()) as PowChallengeResponse
+  if (!payload.enabled || !payload.challenge) {
+    return {}
+  }
+  const nonce = await solvePow(payload.challenge, payload.difficulty ?? 0)
+  return { pow_challenge: payload.challenge, pow_nonce: nonce }
+}
@@ -0,0 +1,37 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+: "${DATABASE_URL:?DATABASE_URL is required}"
+
+if [[ -d backend && -f backend/go.mod ]]; then
+  REPO_ROOT="$(pwd)"
+  cd backend
+
+  args=()
+  while [[ $# -gt 0 ]]; do
+    case "$1" in
+      --out)
+        shift
+        [[ $# -gt 0 ]] || { echo "--out requires a value" >&2; exit 1; }
+        if [[ "$1" == /* ]]; then
+          args+=(--out "$1")
+        else
+          args+=(--out "$REPO_ROOT/$1")
+        fi
+        ;;
+      --attachment-dir)
+        shift
+        [[ $# -gt 0 ]] || { echo "--attachment-dir requires a value" >&2; exit 1; }
+        args+=(--attachment-dir "$1")
+        ;;
+      *)
+        args+=("$1")
+        ;;
+    esac
+    shift
+  done
+
+  exec go run ./cmd/export-challenges "${args[@]}"
+fi
+
+exec /usr/local/bin/export-challenges "$@"